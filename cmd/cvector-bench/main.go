@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -130,9 +131,13 @@ func benchmarkInsert(db *cvector.DB, count int, description string) BenchmarkRes
 	latencies := make([]time.Duration, count)
 	errors := 0
 	
-	// Get current stats to start IDs from a safe number
-	stats, _ := db.Stats()
-	startID := uint64(stats.TotalVectors + 1000) // Start from a safe ID
+	// Start past every ID the database has seen, so no insert collides
+	stats, err := db.Stats()
+	if err != nil {
+		fmt.Printf("\n    Error reading stats: %v", err)
+		return result
+	}
+	startID := stats.NextID
 	
 	startTime := time.Now()
 	
@@ -193,7 +198,7 @@ func benchmarkGet(db *cvector.DB, count int, description string) BenchmarkResult
 	runtime.GC()
 	runtime.ReadMemStats(&memBefore)
 	
-	errors := 0
+	errorCount := 0
 	startTime := time.Now()
 	
 	for i := 0; i < count; i++ {
@@ -204,8 +209,8 @@ func benchmarkGet(db *cvector.DB, count int, description string) BenchmarkResult
 		_, err := db.Get(id)
 		latency := time.Since(opStart)
 		
-		if err != nil && err != cvector.ErrVectorNotFound {
-			errors++
+		if err != nil && !errors.Is(err, cvector.ErrVectorNotFound) {
+			errorCount++
 		}
 		
 		// Update min/max latency
@@ -220,7 +225,7 @@ func benchmarkGet(db *cvector.DB, count int, description string) BenchmarkResult
 	result.Duration = time.Since(startTime)
 	result.QPS = float64(count) / result.Duration.Seconds()
 	result.AvgLatency = result.Duration / time.Duration(count)
-	result.ErrorCount = errors
+	result.ErrorCount = errorCount
 	
 	runtime.ReadMemStats(&memAfter)
 	result.MemoryUsed = memAfter.Alloc - memBefore.Alloc
@@ -279,11 +284,15 @@ func benchmarkMixedWorkload(db *cvector.DB, operations int) BenchmarkResult {
 		MinLatency:    time.Hour,
 	}
 	
-	errors := 0
+	errorCount := 0
 	
-	// Get current stats for safe ID ranges
-	stats, _ := db.Stats()
-	writeStartID := uint64(stats.TotalVectors + 10000) // Safe range for new inserts
+	// Writes use IDs past every ID the database has seen
+	stats, err := db.Stats()
+	if err != nil {
+		fmt.Printf("\n    Error reading stats: %v", err)
+		return result
+	}
+	writeStartID := stats.NextID
 	
 	startTime := time.Now()
 	
@@ -297,7 +306,7 @@ func benchmarkMixedWorkload(db *cvector.DB, operations int) BenchmarkResult {
 		case opType < 0.7: // 70% reads
 			readID := uint64(rand.Intn(int(stats.TotalVectors)) + 1)
 			_, err = db.Get(readID)
-			if err == cvector.ErrVectorNotFound {
+			if errors.Is(err, cvector.ErrVectorNotFound) {
 				err = nil // Expected error
 			}
 		case opType < 0.9: // 20% writes
@@ -312,7 +321,7 @@ func benchmarkMixedWorkload(db *cvector.DB, operations int) BenchmarkResult {
 		latency := time.Since(opStart)
 		
 		if err != nil {
-			errors++
+			errorCount++
 		}
 		
 		// Update min/max latency
@@ -327,11 +336,11 @@ func benchmarkMixedWorkload(db *cvector.DB, operations int) BenchmarkResult {
 	result.Duration = time.Since(startTime)
 	result.QPS = float64(operations) / result.Duration.Seconds()
 	result.AvgLatency = result.Duration / time.Duration(operations)
-	result.ErrorCount = errors
+	result.ErrorCount = errorCount
 	
 	fmt.Printf(" ✅ %.2f QPS", result.QPS)
-	if errors > 0 {
-		fmt.Printf(" (⚠️ %d errors)", errors)
+	if errorCount > 0 {
+		fmt.Printf(" (⚠️ %d errors)", errorCount)
 	}
 	fmt.Println()
 	return result
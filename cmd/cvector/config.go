@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/asmit-gupta/cvector/pkg/cvector"
+)
+
+const configFileName = ".cvector.yaml"
+
+// cliDefaults holds the values used when a command's flags are omitted.
+// Precedence is built-in constants, then the config file, then environment
+// variables; explicit flags always win.
+type cliDefaults struct {
+	Path       string
+	Dimension  int
+	Similarity string
+
+	// Embedding provider used by the embed command
+	EmbedProvider string
+	EmbedModel    string
+	EmbedURL      string
+}
+
+var defaults = cliDefaults{
+	Path:          defaultDBPath,
+	Dimension:     defaultDimension,
+	Similarity:    "cosine",
+	EmbedProvider: "ollama",
+	EmbedModel:    "nomic-embed-text",
+}
+
+// ignoresDefaults names the commands whose flags take no defaults, so they
+// run even when the config file cannot be read
+var ignoresDefaults = map[string]bool{
+	"copy":    true,
+	"clone":   true,
+	"drop":    true,
+	"load":    true,
+	"restore": true,
+	"unlock":  true,
+}
+
+// loadDefaults layers the config file and environment over the built-in defaults
+func loadDefaults() (cliDefaults, error) {
+	d := defaults
+
+	path := os.Getenv("CVECTOR_CONFIG")
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, configFileName)
+		}
+	}
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return d, err
+		}
+		for key, value := range values {
+			if err := d.set(key, value); err != nil {
+				return d, fmt.Errorf("%s: %v", path, err)
+			}
+		}
+	}
+
+	envKeys := map[string]string{
+		"CVECTOR_PATH":       "path",
+		"CVECTOR_DIMENSION":  "dimension",
+		"CVECTOR_SIMILARITY": "similarity",
+
+		"CVECTOR_EMBED_PROVIDER": "embed_provider",
+		"CVECTOR_EMBED_MODEL":    "embed_model",
+		"CVECTOR_EMBED_URL":      "embed_url",
+	}
+	for env, key := range envKeys {
+		if value, ok := os.LookupEnv(env); ok && value != "" {
+			if err := d.set(key, value); err != nil {
+				return d, fmt.Errorf("%s: %v", env, err)
+			}
+		}
+	}
+
+	return d, nil
+}
+
+func (d *cliDefaults) set(key, value string) error {
+	switch key {
+	case "path":
+		d.Path = value
+	case "dimension":
+		dim, err := strconv.Atoi(value)
+		if err != nil || dim <= 0 {
+			return fmt.Errorf("invalid dimension %q", value)
+		}
+		d.Dimension = dim
+	case "similarity":
+		similarity, err := cvector.ParseSimilarity(value)
+		if err != nil {
+			return err
+		}
+		d.Similarity = similarity.String()
+	case "embed_provider":
+		switch strings.ToLower(value) {
+		case "openai", "ollama":
+			d.EmbedProvider = strings.ToLower(value)
+		default:
+			return fmt.Errorf("unknown embedding provider %q", value)
+		}
+	case "embed_model":
+		d.EmbedModel = value
+	case "embed_url":
+		d.EmbedURL = value
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	return nil
+}
+
+// readConfigFile parses the flat "key: value" subset of YAML the config uses
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected \"key: value\"", path, lineNo)
+		}
+		value = strings.TrimSpace(value)
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		value = strings.Trim(value, `"'`)
+
+		values[strings.TrimSpace(key)] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/asmit-gupta/cvector/pkg/cvector"
+	"github.com/asmit-gupta/cvector/pkg/embed"
+)
+
+// embedTextKey is the metadata key the embedded text is stored under
+const embedTextKey = "text"
+
+func handleEmbed(args []string) {
+	fs := flag.NewFlagSet("embed", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	text := fs.String("text", "", "Text to embed")
+	provider := fs.String("provider", defaults.EmbedProvider, "Embedding provider (ollama, openai)")
+	model := fs.String("model", defaults.EmbedModel, "Embedding model")
+	baseURL := fs.String("base-url", defaults.EmbedURL, "Provider API root (default: the provider's public or local endpoint)")
+	search := fs.Bool("search", false, "Search with the embedding instead of inserting it")
+	topK := fs.Int("top-k", 10, "Number of results to return with --search")
+	id := fs.Uint64("id", 0, "Vector ID to insert the embedding under")
+	metadataStr := fs.String("metadata", "", "Vector metadata (JSON object); the text is added under \""+embedTextKey+"\"")
+	timeout := fs.Duration("timeout", time.Minute, "Maximum time to wait for the provider")
+
+	fs.Parse(args)
+
+	if *text == "" {
+		fmt.Println("Error: --text is required")
+		os.Exit(1)
+	}
+	if !*search && *id == 0 {
+		fmt.Println("Error: --id is required unless --search is given")
+		os.Exit(1)
+	}
+	if *search && *topK <= 0 {
+		fmt.Println("Error: --top-k must be greater than 0")
+		os.Exit(1)
+	}
+
+	metadata := map[string]any{}
+	if *metadataStr != "" {
+		if err := json.Unmarshal([]byte(*metadataStr), &metadata); err != nil {
+			fmt.Printf("Error parsing metadata: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	metadata[embedTextKey] = *text
+
+	embedder, err := newEmbedder(*provider, *model, *baseURL)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	db.WithEmbedder(embedder)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if !*search {
+		fmt.Printf("Embedding with %s/%s and inserting as vector ID %d\n", *provider, *model, *id)
+		if err := db.InsertText(ctx, *id, *text, metadata); err != nil {
+			fmt.Printf("Error inserting text: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Vector inserted successfully!\n")
+		return
+	}
+
+	fmt.Printf("Embedding with %s/%s and searching (top-%d)\n", *provider, *model, *topK)
+	results, err := db.SearchText(ctx, *text, *topK)
+	if err != nil {
+		fmt.Printf("Error searching: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No similar vectors found.")
+		return
+	}
+
+	fmt.Printf("\nSearch Results (%d found):\n", len(results))
+	fmt.Println("Rank | Vector ID | Similarity | Text")
+	fmt.Println("-----|-----------|------------|-----")
+	for i, result := range results {
+		stored := ""
+		if v, err := db.Get(result.ID); err == nil {
+			stored, _ = v.Metadata[embedTextKey].(string)
+		}
+		fmt.Printf("%-4d | %-9d | %-10.6f | %s\n", i+1, result.ID, result.Similarity, stored)
+	}
+}
+
+// newEmbedder builds the named provider. The OpenAI key is read from
+// CVECTOR_EMBED_API_KEY, falling back to OPENAI_API_KEY, so it never has to
+// appear on the command line or in the config file.
+func newEmbedder(provider, model, baseURL string) (cvector.Embedder, error) {
+	switch strings.ToLower(provider) {
+	case "ollama":
+		return embed.NewOllama(embed.OllamaConfig{BaseURL: baseURL, Model: model})
+	case "openai":
+		key := os.Getenv("CVECTOR_EMBED_API_KEY")
+		if key == "" {
+			key = os.Getenv("OPENAI_API_KEY")
+		}
+		return embed.NewOpenAI(embed.OpenAIConfig{BaseURL: baseURL, APIKey: key, Model: model})
+	default:
+		return nil, fmt.Errorf("unknown embedding provider '%s'. Use ollama or openai", provider)
+	}
+}
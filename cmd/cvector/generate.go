@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// clusterSpread is the standard deviation of points around their cluster center
+const clusterSpread = 0.1
+
+// newVectorGenerator returns a function producing random vectors drawn from
+// the named distribution
+func newVectorGenerator(distribution string, dimension, clusters int, normalize bool) (func() []float32, error) {
+	var sample func() []float32
+
+	switch distribution {
+	case "uniform":
+		sample = func() []float32 {
+			data := make([]float32, dimension)
+			for i := range data {
+				data[i] = rand.Float32()*2 - 1 // Random float between -1 and 1
+			}
+			return data
+		}
+	case "gaussian":
+		sample = func() []float32 {
+			data := make([]float32, dimension)
+			for i := range data {
+				data[i] = float32(rand.NormFloat64())
+			}
+			return data
+		}
+	case "clustered":
+		if clusters <= 0 {
+			return nil, fmt.Errorf("--clusters must be greater than 0")
+		}
+		centers := make([][]float32, clusters)
+		for c := range centers {
+			centers[c] = make([]float32, dimension)
+			for i := range centers[c] {
+				centers[c][i] = rand.Float32()*2 - 1
+			}
+		}
+		sample = func() []float32 {
+			center := centers[rand.Intn(clusters)]
+			data := make([]float32, dimension)
+			for i := range data {
+				data[i] = center[i] + float32(rand.NormFloat64()*clusterSpread)
+			}
+			return data
+		}
+	default:
+		return nil, fmt.Errorf("unknown distribution '%s'. Use uniform, gaussian, or clustered", distribution)
+	}
+
+	if !normalize {
+		return sample, nil
+	}
+	return func() []float32 {
+		return normalizeVector(sample())
+	}, nil
+}
+
+// normalizeVector scales data to unit length in place; zero vectors are left as-is
+func normalizeVector(data []float32) []float32 {
+	var sum float64
+	for _, v := range data {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return data
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range data {
+		data[i] /= norm
+	}
+	return data
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"math/rand"
+	"io"
+	"math"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/asmit-gupta/cvector/pkg/cvector"
 )
@@ -25,84 +30,221 @@ func main() {
 	command := os.Args[1]
 	args := os.Args[2:]
 
-	switch command {
-	case "create":
-		handleCreate(args)
-	case "insert":
-		handleInsert(args)
-	case "get":
-		handleGet(args)
-	case "delete":
-		handleDelete(args)
-	case "stats":
-		handleStats(args)
-	case "generate":
-		handleGenerate(args)
-	case "drop":
-		handleDrop(args)
-	case "search":
-		handleSearch(args)
-	default:
+	commands := map[string]func([]string){
+		"create":          handleCreate,
+		"insert":          handleInsert,
+		"get":             handleGet,
+		"update-metadata": handleUpdateMetadata,
+		"delete":          handleDelete,
+		"undelete":        handleUndelete,
+		"stats":           handleStats,
+		"compact":         handleCompact,
+		"migrate":         handleMigrate,
+		"repair":          handleRepair,
+		"generate":        handleGenerate,
+		"drop":            handleDrop,
+		"unlock":          handleUnlock,
+		"search":          handleSearch,
+		"list":            handleList,
+		"top":             handleTop,
+		"copy":            handleCopy,
+		"clone":           handleCopy,
+		"dump":            handleDump,
+		"load":            handleLoad,
+		"backup":          handleBackup,
+		"restore":         handleRestore,
+		"edit":            handleEdit,
+		"inspect":         handleInspect,
+		"analyze":         handleAnalyze,
+		"dedupe":          handleDedupe,
+		"cluster":         handleCluster,
+		"pca":             handlePCA,
+		"knn-graph":       handleKNNGraph,
+		"embed":           handleEmbed,
+		"tune":            handleTune,
+	}
+	handler, ok := commands[command]
+	if !ok {
 		fmt.Printf("Unknown command: %s\n", command)
 		printUsage()
 		os.Exit(1)
 	}
+
+	// A broken config file only stops the commands that read it
+	if !ignoresDefaults[command] {
+		loaded, err := loadDefaults()
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		defaults = loaded
+	}
+
+	handler(args)
 }
 
 func printUsage() {
 	fmt.Println("CVector - Vector Database CLI")
 	fmt.Println("")
 	fmt.Println("Usage:")
-	fmt.Println("  cvector create [--path=PATH] [--dimension=DIM] [--name=NAME]")
+	fmt.Println("  cvector create [--path=PATH] [--dimension=DIM] [--name=NAME] [--description=TEXT] [--normalize] [--max-vectors=N]")
 	fmt.Println("    Create a new vector database")
 	fmt.Println("")
-	fmt.Println("  cvector insert [--path=PATH] --id=ID --vector=\"1.0,2.0,3.0,...\"")
+	fmt.Println("  cvector insert [--path=PATH] --id=ID --vector=\"1.0,2.0,3.0,...\" [--metadata=JSON] [--tags=A,B]")
 	fmt.Println("    Insert a vector into the database")
 	fmt.Println("")
 	fmt.Println("  cvector get [--path=PATH] --id=ID")
 	fmt.Println("    Retrieve a vector by ID")
 	fmt.Println("")
-	fmt.Println("  cvector delete [--path=PATH] --id=ID")
+	fmt.Println("  cvector update-metadata [--path=PATH] --id=ID --metadata=JSON")
+	fmt.Println("    Merge keys into a vector's metadata without rewriting its data; null removes a key")
+	fmt.Println("")
+	fmt.Println("  cvector delete [--path=PATH] --id=ID [--soft]")
+	fmt.Println("  cvector undelete [--path=PATH] --id=ID")
 	fmt.Println("    Delete a vector by ID")
 	fmt.Println("")
-	fmt.Println("  cvector stats [--path=PATH]")
+	fmt.Println("  cvector stats [--path=PATH] [--skip-corrupt]")
 	fmt.Println("    Show database statistics")
 	fmt.Println("")
-	fmt.Println("  cvector generate [--path=PATH] --count=N [--dimension=DIM]")
+	fmt.Println("  cvector compact [--path=PATH]")
+	fmt.Println("    Rewrite the database file without deleted vectors")
+	fmt.Println("")
+	fmt.Println("  cvector migrate [--path=PATH]")
+	fmt.Println("    Upgrade a database file to the current format, keeping a backup")
+	fmt.Println("")
+	fmt.Println("  cvector repair [--path=PATH] --out=PATH [--report=FILE]")
+	fmt.Println("    Salvage the readable vectors of a corrupt database into a new one")
+	fmt.Println("")
+	fmt.Println("  cvector generate [--path=PATH] --count=N [--dimension=DIM] [--distribution=TYPE] [--clusters=K] [--normalize]")
 	fmt.Println("    Generate random test vectors")
 	fmt.Println("")
-	fmt.Println("  cvector drop --path=PATH")
+	fmt.Println("  cvector drop --path=PATH [--yes|--force] [--if-exists]")
 	fmt.Println("    Drop (delete) a database")
 	fmt.Println("")
-	fmt.Println("  cvector search [--path=PATH] --vector=\"1.0,2.0,3.0,...\" [--top-k=K] [--similarity=TYPE]")
+	fmt.Println("  cvector unlock --path=PATH [--force]")
+	fmt.Println("    Show which process holds a database's lock; --force removes a stale lock")
+	fmt.Println("")
+	fmt.Println("  cvector search [--path=PATH] (--vector=\"1.0,2.0,3.0,...\" | --id=ID) [--top-k=K] [--oversample=N] [--ef=N] [--similarity=TYPE] [--normalize-scores] [--dedupe-by=KEY] [--tags=A,B] [--exclude-tags=A,B] [--range=KEY=MIN..MAX] [--geo=KEY:LAT,LON:METERS] [--keywords=KEY:WORDS] [--hybrid=KEY:TEXT] [--facets=KEY,KEY] [--aggregate=KEY:OP,...] [--explain]")
 	fmt.Println("    Search for similar vectors")
 	fmt.Println("")
+	fmt.Println("  cvector list [--path=PATH] [--limit=N] [--offset=N] [--with-metadata]")
+	fmt.Println("    List stored vector IDs and timestamps")
+	fmt.Println("")
+	fmt.Println("  cvector top [--path=PATH] [--interval=1s] [--count=N]")
+	fmt.Println("    Monitor vector count, write rate and file size live")
+	fmt.Println("")
+	fmt.Println("  cvector copy --from=PATH --to=PATH [--filter=KEY=VALUE,...]")
+	fmt.Println("    Clone a database, optionally only vectors whose metadata matches")
+	fmt.Println("")
+	fmt.Println("  cvector dump [--path=PATH] [--out=FILE|URL]")
+	fmt.Println("    Write the whole database as a single stream, to stdout by default")
+	fmt.Println("")
+	fmt.Println("  cvector load --path=PATH [--in=FILE|URL]")
+	fmt.Println("    Create a database from a dump stream, read from stdin by default")
+	fmt.Println("")
+	fmt.Println("  cvector backup [--path=PATH] --out=FILE|URL")
+	fmt.Println("    Write a compressed archive of the database with a checksummed manifest")
+	fmt.Println("")
+	fmt.Println("  cvector restore --in=FILE|URL --path=PATH")
+	fmt.Println("    Verify a backup archive and restore it to a new database")
+	fmt.Println("")
+	fmt.Println("  cvector edit [--path=PATH] [--name=NAME] [--description=TEXT] [--default-top-k=K] [--default-min-similarity=S] [--default-oversample=N] [--schema=JSON]")
+	fmt.Println("    Rename a database, change its description, set its search defaults or its metadata schema")
+	fmt.Println("")
+	fmt.Println("  cvector inspect [--path=PATH] --id=ID")
+	fmt.Println("    Show how a vector record is stored on disk")
+	fmt.Println("")
+	fmt.Println("  cvector analyze [--path=PATH] [--dimensions]")
+	fmt.Println("    Show norm distribution, per-dimension statistics and intrinsic dimensionality")
+	fmt.Println("")
+	fmt.Println("  cvector dedupe [--path=PATH] [--threshold=0.999] [--action=report|delete|tag] [--tag-key=KEY]")
+	fmt.Println("    Find groups of near-duplicate vectors and optionally delete or tag them")
+	fmt.Println("")
+	fmt.Println("  cvector cluster [--path=PATH] --k=K [--iterations=N] [--tag-key=KEY]")
+	fmt.Println("    Run k-means over stored vectors, optionally saving each vector's cluster as metadata")
+	fmt.Println("")
+	fmt.Println("  cvector pca [--path=PATH] --to=PATH --dim=N")
+	fmt.Println("    Write a copy of the database reduced to its N principal components")
+	fmt.Println("")
+	fmt.Println("  cvector knn-graph [--path=PATH] --out=FILE [--k=10] [--similarity=TYPE]")
+	fmt.Println("    Write the exact k-nearest-neighbor graph as CSV edges (source,target,rank,score)")
+	fmt.Println("")
+	fmt.Println("  cvector embed [--path=PATH] --text=TEXT (--id=ID | --search [--top-k=K]) [--provider=NAME] [--model=MODEL]")
+	fmt.Println("    Embed text with an embedding provider and insert it, or search with it")
+	fmt.Println("")
+	fmt.Println("  cvector tune [--path=PATH] --dataset=FILE.npy [--target-recall=R] [--top-k=K] [--dry-run]")
+	fmt.Println("    Find the smallest ef that reaches the target recall on sample queries and save it")
+	fmt.Println("")
 	fmt.Println("Options:")
-	fmt.Printf("  --path        Database file path (default: %s)\n", defaultDBPath)
-	fmt.Printf("  --dimension   Vector dimension (default: %d)\n", defaultDimension)
+	fmt.Printf("  --path        Database file path (default: %s)\n", defaults.Path)
+	fmt.Printf("  --dimension   Vector dimension (default: %d)\n", defaults.Dimension)
 	fmt.Println("  --name        Database name")
+	fmt.Println("  --description Database description")
 	fmt.Println("  --id          Vector ID")
 	fmt.Println("  --vector      Vector data as comma-separated floats")
+	fmt.Println("  --metadata    Vector metadata as a JSON object")
+	fmt.Println("  --tags        Comma-separated tags; with search, only vectors carrying all of them")
+	fmt.Println("  --exclude-tags  Comma-separated tags search skips vectors carrying any of")
+	fmt.Println("  --range       Numeric metadata ranges for search, e.g. price=10..20,year=2020..; either end may be left open")
+	fmt.Println("  --geo         Geo radius for search: metadata point KEY within METERS of LAT,LON, e.g. location:52.52,13.40:5000")
+	fmt.Println("  --keywords    Keyword filter for search: text metadata KEY containing every word, e.g. title:red shoes")
+	fmt.Println("  --hybrid      Blend search with a keyword ranking of an indexed text field, e.g. title:red shoes")
+	fmt.Println("  --facets      Metadata keys whose values search counts over all matches, e.g. category,language")
+	fmt.Println("  --aggregate   Summaries of the search results' metadata: KEY:min, max, avg, sum, top or topN, e.g. price:avg,brand:top5")
 	fmt.Println("  --count       Number of vectors to generate")
-	fmt.Println("  --top-k       Number of results to return (default: 10)")
-	fmt.Println("  --similarity  Similarity type: cosine, dot, euclidean (default: cosine)")
+	fmt.Println("  --distribution  Generated data: uniform, gaussian, clustered (default: uniform)")
+	fmt.Println("  --clusters    Cluster count for --distribution=clustered (default: 10)")
+	fmt.Println("  --normalize   Scale generated vectors to unit length; with create, store all vectors normalized")
+	fmt.Println("  --max-vectors Live vector limit for create; inserts beyond it fail (default: none)")
+	fmt.Println("  --dim         Target dimension for pca")
+	fmt.Println("  --text        Text to embed")
+	fmt.Printf("  --provider    Embedding provider: ollama, openai (default: %s)\n", defaults.EmbedProvider)
+	fmt.Printf("  --model       Embedding model (default: %s)\n", defaults.EmbedModel)
+	fmt.Println("  --top-k       Number of results to return (default: the database's, else 10)")
+	fmt.Println("  --oversample  Candidates to consider per result, for better recall (default: the database's)")
+	fmt.Printf("  --similarity  Similarity type: cosine, dot, euclidean (default: %s)\n", defaults.Similarity)
+	fmt.Println("  --explain     Show the query plan, candidates scanned and timings")
+	fmt.Println("  --normalize-scores  Report search scores on a 0-1 scale for any similarity type")
+	fmt.Println("  --dedupe-by   Metadata key whose value search returns at most once, e.g. doc_id")
+	fmt.Println("  --yes         Skip confirmation prompts (alias: --force)")
+	fmt.Println("  --if-exists   Exit successfully when the database to drop is missing")
+	fmt.Println("  --filter      Metadata match for copy, e.g. lang=en,source=web")
+	fmt.Println("  --schema      Metadata schema as JSON, e.g. {\"fields\":[{\"name\":\"lang\",\"type\":\"string\",\"indexed\":true}]}; null removes it")
+	fmt.Println("  --limit       Maximum number of vectors to list (default: all)")
+	fmt.Println("  --offset      Number of vectors to skip when listing")
+	fmt.Println("  --in          Input for load and restore: a file, or an http(s)://, s3:// or gs:// URL")
+	fmt.Println("  --out         Output file for dump, backup and knn-graph; new database for repair")
+	fmt.Println("  --report      File to write the IDs lost by repair to, one per line")
+	fmt.Println("")
+	fmt.Println("Configuration:")
+	fmt.Printf("  Defaults for --path, --dimension and --similarity are read from ~/%s\n", configFileName)
+	fmt.Println("  (or the file named by CVECTOR_CONFIG) as \"key: value\" lines, and can be")
+	fmt.Println("  overridden with CVECTOR_PATH, CVECTOR_DIMENSION and CVECTOR_SIMILARITY.")
+	fmt.Println("  The embed command reads embed_provider, embed_model and embed_url the same")
+	fmt.Println("  way (CVECTOR_EMBED_PROVIDER, CVECTOR_EMBED_MODEL, CVECTOR_EMBED_URL); the")
+	fmt.Println("  OpenAI key comes from CVECTOR_EMBED_API_KEY or OPENAI_API_KEY.")
 }
 
 func handleCreate(args []string) {
 	fs := flag.NewFlagSet("create", flag.ExitOnError)
-	path := fs.String("path", defaultDBPath, "Database path")
-	dimension := fs.Int("dimension", defaultDimension, "Vector dimension")
+	path := fs.String("path", defaults.Path, "Database path")
+	dimension := fs.Int("dimension", defaults.Dimension, "Vector dimension")
 	name := fs.String("name", "test_db", "Database name")
+	description := fs.String("description", "", "Database description")
+	normalize := fs.Bool("normalize", false, "Store every vector scaled to unit length")
+	maxVectors := fs.Int("max-vectors", 0, "Maximum number of live vectors (0 for no limit)")
 
 	fs.Parse(args)
 
 	config := &cvector.DBConfig{
 		Name:              *name,
+		Description:       *description,
 		DataPath:          *path,
 		Dimension:         uint32(*dimension),
 		DefaultSimilarity: cvector.SimilarityCosine,
 		MemoryMapped:      false,
-		MaxVectors:        1000000,
+		MaxVectors:        *maxVectors,
+		NormalizeOnInsert: *normalize,
 	}
 
 	fmt.Printf("Creating database: %s\n", *path)
@@ -121,9 +263,11 @@ func handleCreate(args []string) {
 
 func handleInsert(args []string) {
 	fs := flag.NewFlagSet("insert", flag.ExitOnError)
-	path := fs.String("path", defaultDBPath, "Database path")
+	path := fs.String("path", defaults.Path, "Database path")
 	id := fs.Uint64("id", 0, "Vector ID")
 	vectorStr := fs.String("vector", "", "Vector data (comma-separated floats)")
+	metadataStr := fs.String("metadata", "", "Vector metadata (JSON object)")
+	tagsStr := fs.String("tags", "", "Vector tags (comma-separated)")
 
 	fs.Parse(args)
 
@@ -144,6 +288,14 @@ func handleInsert(args []string) {
 		os.Exit(1)
 	}
 
+	var metadata map[string]any
+	if *metadataStr != "" {
+		if err := json.Unmarshal([]byte(*metadataStr), &metadata); err != nil {
+			fmt.Printf("Error parsing metadata: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	fmt.Printf("Opening database: %s\n", *path)
 	db, err := cvector.OpenDB(*path)
 	if err != nil {
@@ -153,6 +305,8 @@ func handleInsert(args []string) {
 	defer db.Close()
 
 	vector := cvector.NewVector(*id, vectorData)
+	vector.Metadata = metadata
+	vector.Tags = parseTags(*tagsStr)
 	fmt.Printf("Inserting vector ID %d (dimension: %d)\n", *id, len(vectorData))
 
 	err = db.Insert(vector)
@@ -166,7 +320,7 @@ func handleInsert(args []string) {
 
 func handleGet(args []string) {
 	fs := flag.NewFlagSet("get", flag.ExitOnError)
-	path := fs.String("path", defaultDBPath, "Database path")
+	path := fs.String("path", defaults.Path, "Database path")
 	id := fs.Uint64("id", 0, "Vector ID")
 
 	fs.Parse(args)
@@ -195,13 +349,21 @@ func handleGet(args []string) {
 	fmt.Printf("  ID: %d\n", vector.ID)
 	fmt.Printf("  Dimension: %d\n", vector.Dimension)
 	fmt.Printf("  Timestamp: %s\n", vector.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Version: %d\n", vector.Version)
 	fmt.Printf("  Data: [%s]\n", formatVector(vector.Data))
+	if len(vector.Metadata) > 0 {
+		fmt.Printf("  Metadata: %s\n", formatMetadata(vector.Metadata))
+	}
+	if len(vector.Tags) > 0 {
+		fmt.Printf("  Tags: %s\n", strings.Join(vector.Tags, ", "))
+	}
 }
 
 func handleDelete(args []string) {
 	fs := flag.NewFlagSet("delete", flag.ExitOnError)
-	path := fs.String("path", defaultDBPath, "Database path")
+	path := fs.String("path", defaults.Path, "Database path")
 	id := fs.Uint64("id", 0, "Vector ID")
+	soft := fs.Bool("soft", false, "Keep the vector's metadata so undelete can restore it")
 
 	fs.Parse(args)
 
@@ -211,7 +373,7 @@ func handleDelete(args []string) {
 	}
 
 	fmt.Printf("Opening database: %s\n", *path)
-	db, err := cvector.OpenDB(*path)
+	db, err := cvector.OpenDBWithConfig(&cvector.DBConfig{DataPath: *path, SoftDelete: *soft})
 	if err != nil {
 		fmt.Printf("Error opening database: %v\n", err)
 		os.Exit(1)
@@ -228,14 +390,79 @@ func handleDelete(args []string) {
 	fmt.Printf("Vector deleted successfully!\n")
 }
 
+func handleUpdateMetadata(args []string) {
+	fs := flag.NewFlagSet("update-metadata", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	id := fs.Uint64("id", 0, "Vector ID")
+	metadataStr := fs.String("metadata", "", "Keys to merge (JSON object); null removes a key")
+
+	fs.Parse(args)
+
+	if *id == 0 || *metadataStr == "" {
+		fmt.Println("Error: --id and --metadata are required")
+		os.Exit(1)
+	}
+
+	var patch map[string]any
+	if err := json.Unmarshal([]byte(*metadataStr), &patch); err != nil {
+		fmt.Printf("Error parsing metadata: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if err := db.UpdateMetadata(*id, patch); err != nil {
+		fmt.Printf("Error updating metadata: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Metadata of vector %d updated.\n", *id)
+}
+
+func handleUndelete(args []string) {
+	fs := flag.NewFlagSet("undelete", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	id := fs.Uint64("id", 0, "Vector ID")
+
+	fs.Parse(args)
+
+	if *id == 0 {
+		fmt.Println("Error: --id is required")
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	fmt.Printf("Restoring vector ID %d\n", *id)
+	if err := db.Undelete(*id); err != nil {
+		fmt.Printf("Error restoring vector: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Vector restored successfully!\n")
+}
+
 func handleStats(args []string) {
 	fs := flag.NewFlagSet("stats", flag.ExitOnError)
-	path := fs.String("path", defaultDBPath, "Database path")
+	path := fs.String("path", defaults.Path, "Database path")
+	skipCorrupt := fs.Bool("skip-corrupt", false, "Open despite damaged records and count them")
 
 	fs.Parse(args)
 
 	fmt.Printf("Opening database: %s\n", *path)
-	db, err := cvector.OpenDB(*path)
+	db, err := cvector.OpenDBWithConfig(&cvector.DBConfig{DataPath: *path, SkipCorruptRecords: *skipCorrupt})
 	if err != nil {
 		fmt.Printf("Error opening database: %v\n", err)
 		os.Exit(1)
@@ -249,26 +476,69 @@ func handleStats(args []string) {
 	}
 
 	fmt.Printf("Database Statistics:\n")
+	if stats.Name != "" {
+		fmt.Printf("  Name: %s\n", stats.Name)
+	}
+	if stats.Description != "" {
+		fmt.Printf("  Description: %s\n", stats.Description)
+	}
 	fmt.Printf("  Path: %s\n", stats.DBPath)
 	fmt.Printf("  Total Vectors: %d\n", stats.TotalVectors)
 	fmt.Printf("  Dimension: %d\n", stats.Dimension)
 	fmt.Printf("  File Size: %d bytes (%.2f MB)\n", stats.TotalSizeBytes, float64(stats.TotalSizeBytes)/(1024*1024))
 	fmt.Printf("  Default Similarity: %v\n", stats.DefaultSimilarity)
+	fmt.Printf("  Deleted (unreclaimed): %d (%d bytes)\n", stats.DeletedVectors, stats.ReclaimableBytes)
+	if stats.UnreadableRecords > 0 {
+		fmt.Printf("  Unreadable Records: %d (run cvector repair to salvage the rest)\n", stats.UnreadableRecords)
+	}
+	fmt.Printf("  Fragmentation: %.1f%%\n", stats.Fragmentation)
+	fmt.Printf("  Dead Ratio: %.1f%% of records\n", stats.DeadRatio*100)
+	fmt.Printf("  Index: %s (%s, %d vectors indexed)\n", stats.IndexType, stats.IndexStatus, stats.IndexedVectors)
+	if stats.UnindexedVectors > 0 {
+		fmt.Printf("  Unindexed Vectors: %d (scanned by searches)\n", stats.UnindexedVectors)
+	}
+	if stats.IndexLoaded {
+		fmt.Printf("  Index Loaded: from %s.hnsw\n", stats.DBPath)
+	}
+	if stats.EfSearch > 0 {
+		fmt.Printf("  EF Search: %d\n", stats.EfSearch)
+	}
+	fmt.Printf("  Memory Mapped: %v\n", stats.MemoryMapped)
+	fmt.Printf("  Normalize On Insert: %v\n", stats.NormalizeOnInsert)
+	if stats.MaxVectors > 0 {
+		fmt.Printf("  Max Vectors: %d\n", stats.MaxVectors)
+	} else {
+		fmt.Printf("  Max Vectors: unlimited\n")
+	}
+	if stats.LastCompaction.IsZero() {
+		fmt.Printf("  Last Compaction: never\n")
+	} else {
+		fmt.Printf("  Last Compaction: %s\n", stats.LastCompaction.Format("2006-01-02 15:04:05"))
+	}
+
+	usage, err := db.MemoryUsage()
+	if err != nil {
+		fmt.Printf("Error getting memory usage: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Engine Memory: %.2f MB\n", float64(usage.Total)/(1024*1024))
+	fmt.Printf("  Lookup Table: %d bytes\n", usage.LookupTable)
+	fmt.Printf("  Index Structure: %d bytes\n", usage.IndexStructure)
+	fmt.Printf("  Index Graph: %d bytes\n", usage.IndexGraph)
+	fmt.Printf("  Index Vectors: %d bytes\n", usage.IndexVectors)
+	fmt.Printf("  I/O Buffers: %d bytes\n", usage.IOBuffers)
+	fmt.Printf("  Memory Mapped: %d bytes\n", usage.Mapped)
+	fmt.Printf("  Read Cache: %d bytes\n", usage.Cache)
+	fmt.Printf("  Block Cache: %d bytes\n", usage.BlockCache)
 }
 
-func handleGenerate(args []string) {
-	fs := flag.NewFlagSet("generate", flag.ExitOnError)
-	path := fs.String("path", defaultDBPath, "Database path")
-	count := fs.Int("count", 0, "Number of vectors to generate")
-	dimension := fs.Int("dimension", defaultDimension, "Vector dimension")
+func handleCompact(args []string) {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
 
 	fs.Parse(args)
 
-	if *count <= 0 {
-		fmt.Println("Error: --count must be greater than 0")
-		os.Exit(1)
-	}
-
 	fmt.Printf("Opening database: %s\n", *path)
 	db, err := cvector.OpenDB(*path)
 	if err != nil {
@@ -277,97 +547,163 @@ func handleGenerate(args []string) {
 	}
 	defer db.Close()
 
-	fmt.Printf("Generating %d random vectors (dimension: %d)\n", *count, *dimension)
-
-	for i := 0; i < *count; i++ {
-		// Generate random vector
-		data := make([]float32, *dimension)
-		for j := range data {
-			data[j] = rand.Float32()*2 - 1 // Random float between -1 and 1
-		}
+	before, err := db.Stats()
+	if err != nil {
+		fmt.Printf("Error getting stats: %v\n", err)
+		os.Exit(1)
+	}
 
-		vector := cvector.NewVector(uint64(i+1), data)
-		err = db.Insert(vector)
-		if err != nil {
-			fmt.Printf("Error inserting vector %d: %v\n", i+1, err)
-			continue
-		}
+	fmt.Printf("Compacting %d deleted vectors\n", before.DeletedVectors)
+	if err := db.Compact(); err != nil {
+		fmt.Printf("Error compacting database: %v\n", err)
+		os.Exit(1)
+	}
 
-		if (i+1)%100 == 0 {
-			fmt.Printf("  Generated %d vectors...\n", i+1)
-		}
+	after, err := db.Stats()
+	if err != nil {
+		fmt.Printf("Error getting stats: %v\n", err)
+		os.Exit(1)
 	}
 
-	fmt.Printf("Generated %d vectors successfully!\n", *count)
+	fmt.Printf("Compaction complete: %d -> %d bytes\n", before.TotalSizeBytes, after.TotalSizeBytes)
 }
 
-func handleDrop(args []string) {
-	fs := flag.NewFlagSet("drop", flag.ExitOnError)
-	path := fs.String("path", "", "Database path")
+func handleMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
 
 	fs.Parse(args)
 
-	if *path == "" {
-		fmt.Println("Error: --path is required for drop command")
+	fmt.Printf("Migrating database: %s\n", *path)
+	result, err := cvector.Migrate(*path)
+	if err != nil {
+		fmt.Printf("Error migrating database: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Dropping database: %s\n", *path)
-	fmt.Print("Are you sure? (y/N): ")
-	var response string
-	fmt.Scanln(&response)
-
-	if strings.ToLower(response) != "y" && strings.ToLower(response) != "yes" {
-		fmt.Println("Operation cancelled.")
+	if result.BackupPath == "" {
+		fmt.Printf("Database is already at format version %d\n", result.ToVersion)
 		return
 	}
+	fmt.Printf("Backup written to %s\n", result.BackupPath)
+	fmt.Printf("Migrated from format version %d to %d\n", result.FromVersion, result.ToVersion)
+}
 
-	err := cvector.DropDB(*path)
+func handleRepair(args []string) {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Corrupt database path")
+	out := fs.String("out", "", "Path of the repaired database to create")
+	reportPath := fs.String("report", "", "File to write lost IDs to, one per line")
+
+	fs.Parse(args)
+
+	if *out == "" {
+		fmt.Println("Error: --out is required for repair command")
+		os.Exit(1)
+	}
+
+	fmt.Printf("Repairing %s into %s\n", *path, *out)
+	report, err := cvector.Repair(*path, *out)
 	if err != nil {
-		fmt.Printf("Error dropping database: %v\n", err)
+		fmt.Printf("Error repairing database: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Database dropped successfully!\n")
+	fmt.Printf("Records scanned:    %d\n", report.RecordsScanned)
+	fmt.Printf("Vectors recovered:  %d\n", report.Recovered)
+	fmt.Printf("Deleted dropped:    %d\n", report.Deleted)
+	fmt.Printf("Records unreadable: %d\n", report.Unreadable)
+	fmt.Printf("IDs lost:           %d\n", len(report.LostIDs))
+
+	if *reportPath != "" {
+		var b strings.Builder
+		for _, id := range report.LostIDs {
+			fmt.Fprintf(&b, "%d\n", id)
+		}
+		if err := os.WriteFile(*reportPath, []byte(b.String()), 0644); err != nil {
+			fmt.Printf("Error writing report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Lost IDs written to %s\n", *reportPath)
+	} else if len(report.LostIDs) > 0 {
+		ids := make([]string, len(report.LostIDs))
+		for i, id := range report.LostIDs {
+			ids[i] = strconv.FormatUint(id, 10)
+		}
+		fmt.Printf("Lost IDs: %s\n", strings.Join(ids, ","))
+	}
 }
 
-func handleSearch(args []string) {
-	fs := flag.NewFlagSet("search", flag.ExitOnError)
-	path := fs.String("path", defaultDBPath, "Database path")
-	vectorStr := fs.String("vector", "", "Query vector data (comma-separated floats)")
-	topK := fs.Int("top-k", 10, "Number of results to return")
-	similarityStr := fs.String("similarity", "cosine", "Similarity type (cosine, dot, euclidean)")
+func handleAnalyze(args []string) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	showDimensions := fs.Bool("dimensions", false, "Print mean and variance for every dimension")
 
 	fs.Parse(args)
 
-	if *vectorStr == "" {
-		fmt.Println("Error: --vector is required")
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
 		os.Exit(1)
 	}
+	defer db.Close()
 
-	if *topK <= 0 {
-		fmt.Println("Error: --top-k must be greater than 0")
+	analysis, err := db.Analyze()
+	if err != nil {
+		fmt.Printf("Error analyzing database: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Parse vector data
-	queryVector, err := parseVectorString(*vectorStr)
-	if err != nil {
-		fmt.Printf("Error parsing query vector: %v\n", err)
-		os.Exit(1)
+	if analysis.Count == 0 {
+		fmt.Println("Database is empty.")
+		return
+	}
+
+	fmt.Printf("Vector Analysis (%d vectors, dimension %d):\n", analysis.Count, analysis.Dimension)
+	fmt.Printf("  Norm: min %.4f, max %.4f, mean %.4f, stddev %.4f\n",
+		analysis.Norms.Min, analysis.Norms.Max, analysis.Norms.Mean, analysis.Norms.StdDev)
+	fmt.Printf("  Normalized: %v\n", analysis.Normalized)
+	if analysis.IntrinsicDimension > 0 {
+		fmt.Printf("  Intrinsic Dimension: ~%.1f (from %d vectors)\n", analysis.IntrinsicDimension, analysis.IntrinsicSample)
+	} else {
+		fmt.Printf("  Intrinsic Dimension: not enough distinct vectors\n")
+	}
+
+	fmt.Printf("\nNorm Histogram:\n")
+	largest := 0
+	for _, bucket := range analysis.Norms.Histogram {
+		if bucket.Count > largest {
+			largest = bucket.Count
+		}
 	}
+	for _, bucket := range analysis.Norms.Histogram {
+		bar := strings.Repeat("#", bucket.Count*40/largest)
+		fmt.Printf("  %10.4f - %-10.4f %8d %s\n", bucket.Low, bucket.High, bucket.Count, bar)
+	}
+
+	if *showDimensions {
+		fmt.Printf("\nDimension | Mean       | Variance\n")
+		fmt.Println("----------|------------|-----------")
+		for i := range analysis.DimensionMeans {
+			fmt.Printf("%-9d | %10.6f | %10.6f\n", i, analysis.DimensionMeans[i], analysis.DimensionVariances[i])
+		}
+	}
+}
+
+func handleDedupe(args []string) {
+	fs := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	threshold := fs.Float64("threshold", 0.999, "Minimum similarity for two vectors to count as duplicates")
+	action := fs.String("action", "report", "What to do with duplicates (report, delete, tag)")
+	tagKey := fs.String("tag-key", "duplicate_of", "Metadata key set to the canonical ID by --action=tag")
+
+	fs.Parse(args)
 
-	// Parse similarity type
-	var similarity cvector.SimilarityType
-	switch strings.ToLower(*similarityStr) {
-	case "cosine":
-		similarity = cvector.SimilarityCosine
-	case "dot", "dotproduct":
-		similarity = cvector.SimilarityDotProduct
-	case "euclidean", "l2":
-		similarity = cvector.SimilarityEuclidean
+	switch *action {
+	case "report", "delete", "tag":
 	default:
-		fmt.Printf("Error: unknown similarity type '%s'. Use cosine, dot, or euclidean\n", *similarityStr)
+		fmt.Printf("Error: unknown action '%s'. Use report, delete, or tag\n", *action)
 		os.Exit(1)
 	}
 
@@ -379,69 +715,1121 @@ func handleSearch(args []string) {
 	}
 	defer db.Close()
 
-	query := &cvector.Query{
-		QueryVector:   queryVector,
-		TopK:          uint32(*topK),
-		Similarity:    similarity,
-		MinSimilarity: 0.0, // No minimum similarity filter
-	}
-
-	fmt.Printf("Searching for similar vectors (top-%d, similarity: %s, dimension: %d)\n", 
-		*topK, *similarityStr, len(queryVector))
-
-	results, err := db.Search(query)
+	groups, err := db.FindDuplicates(float32(*threshold))
 	if err != nil {
-		fmt.Printf("Error searching: %v\n", err)
+		fmt.Printf("Error finding duplicates: %v\n", err)
 		os.Exit(1)
 	}
 
-	if len(results) == 0 {
-		fmt.Println("No similar vectors found.")
+	if len(groups) == 0 {
+		fmt.Printf("No duplicates found at threshold %g.\n", *threshold)
 		return
 	}
 
-	fmt.Printf("\nSearch Results (%d found):\n", len(results))
-	fmt.Println("Rank | Vector ID | Similarity Score")
-	fmt.Println("-----|-----------|----------------")
-	for i, result := range results {
-		fmt.Printf("%-4d | %-9d | %.6f\n", i+1, result.ID, result.Similarity)
+	duplicates := 0
+	fmt.Printf("Duplicate Groups (threshold %g):\n", *threshold)
+	fmt.Println("Keep      | Duplicates")
+	fmt.Println("----------|-----------")
+	for _, group := range groups {
+		ids := make([]string, len(group.Duplicates))
+		for i, id := range group.Duplicates {
+			ids[i] = strconv.FormatUint(id, 10)
+		}
+		fmt.Printf("%-9d | %s\n", group.Canonical, strings.Join(ids, ", "))
+		duplicates += len(group.Duplicates)
+	}
+	fmt.Printf("\n%d groups, %d duplicate vectors\n", len(groups), duplicates)
+
+	switch *action {
+	case "delete":
+		deleted, err := db.DeleteDuplicates(groups)
+		if err != nil {
+			fmt.Printf("Error deleting duplicates: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted %d duplicate vectors\n", deleted)
+	case "tag":
+		tagged, err := db.TagDuplicates(groups, *tagKey)
+		if err != nil {
+			fmt.Printf("Error tagging duplicates: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Tagged %d duplicate vectors with '%s'\n", tagged, *tagKey)
 	}
 }
 
-// Helper functions
+func handleCluster(args []string) {
+	fs := flag.NewFlagSet("cluster", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	k := fs.Int("k", 0, "Number of clusters")
+	iterations := fs.Int("iterations", 20, "Maximum k-means iterations")
+	tagKey := fs.String("tag-key", "", "Metadata key to store each vector's cluster index under")
 
-func parseVectorString(vectorStr string) ([]float32, error) {
-	parts := strings.Split(vectorStr, ",")
-	data := make([]float32, len(parts))
+	fs.Parse(args)
 
-	for i, part := range parts {
-		val, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+	if *k <= 0 {
+		fmt.Println("Error: --k must be greater than 0")
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	start := time.Now()
+	clustering, err := db.Cluster(*k, *iterations)
+	if err != nil {
+		fmt.Printf("Error clustering: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Clustered %d vectors into %d clusters in %d iterations (%v)\n",
+		len(clustering.Assignments), *k, clustering.Iterations, time.Since(start).Round(time.Millisecond))
+	fmt.Printf("Inertia: %.4f\n\n", clustering.Inertia)
+	fmt.Println("Cluster | Size     | Centroid")
+	fmt.Println("--------|----------|---------")
+	for c, centroid := range clustering.Centroids {
+		fmt.Printf("%-7d | %-8d | %s\n", c, clustering.Sizes[c], formatVector(centroid))
+	}
+
+	if *tagKey != "" {
+		tagged, err := db.TagClusters(clustering, *tagKey)
 		if err != nil {
-			return nil, fmt.Errorf("invalid float value: %s", part)
+			fmt.Printf("Error tagging vectors: %v\n", err)
+			os.Exit(1)
 		}
-		data[i] = float32(val)
+		fmt.Printf("\nTagged %d vectors with '%s'\n", tagged, *tagKey)
 	}
-
-	return data, nil
 }
 
-func formatVector(data []float32) string {
-	if len(data) <= 10 {
-		strs := make([]string, len(data))
-		for i, v := range data {
-			strs[i] = fmt.Sprintf("%.3f", v)
-		}
-		return strings.Join(strs, ", ")
+func handlePCA(args []string) {
+	fs := flag.NewFlagSet("pca", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	to := fs.String("to", "", "Destination database path")
+	dim := fs.Int("dim", 0, "Target dimension")
+
+	fs.Parse(args)
+
+	if *to == "" || *dim <= 0 {
+		fmt.Println("Error: --to and --dim are required")
+		os.Exit(1)
 	}
 
-	// Show first 5 and last 5 values for long vectors
-	var parts []string
-	for i := 0; i < 5; i++ {
-		parts = append(parts, fmt.Sprintf("%.3f", data[i]))
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
 	}
-	parts = append(parts, "...")
-	for i := len(data) - 5; i < len(data); i++ {
-		parts = append(parts, fmt.Sprintf("%.3f", data[i]))
+	defer db.Close()
+
+	start := time.Now()
+	pca, err := db.TrainPCA(*dim)
+	if err != nil {
+		fmt.Printf("Error training PCA: %v\n", err)
+		os.Exit(1)
 	}
-	return strings.Join(parts, ", ")
-}
\ No newline at end of file
+	fmt.Printf("Trained %d -> %d projection in %v\n",
+		pca.SourceDimension, pca.TargetDimension(), time.Since(start).Round(time.Millisecond))
+	fmt.Printf("Retained variance: %.2f%%\n", pca.RetainedVariance*100)
+
+	fmt.Printf("Writing reduced database: %s\n", *to)
+	reduced, err := db.ReduceTo(*to, pca)
+	if err != nil {
+		fmt.Printf("Error reducing database: %v\n", err)
+		os.Exit(1)
+	}
+	defer reduced.Close()
+
+	stats, err := reduced.Stats()
+	if err != nil {
+		fmt.Printf("Error getting stats: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Reduced %d vectors successfully!\n", stats.TotalVectors)
+}
+
+func handleKNNGraph(args []string) {
+	fs := flag.NewFlagSet("knn-graph", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	out := fs.String("out", "", "Output CSV file")
+	k := fs.Int("k", 10, "Neighbors per vector")
+	similarityStr := fs.String("similarity", defaults.Similarity, "Similarity type (cosine, dot, euclidean)")
+
+	fs.Parse(args)
+
+	if *out == "" {
+		fmt.Println("Error: --out is required")
+		os.Exit(1)
+	}
+	if *k <= 0 {
+		fmt.Println("Error: --k must be greater than 0")
+		os.Exit(1)
+	}
+
+	similarity, err := cvector.ParseSimilarity(*similarityStr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Printf("Error creating output file: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"source", "target", "rank", "score"})
+
+	start := time.Now()
+	edges := 0
+	err = db.KNNGraph(*k, similarity, func(e cvector.KNNEdge) error {
+		edges++
+		return w.Write([]string{
+			strconv.FormatUint(e.Source, 10),
+			strconv.FormatUint(e.Target, 10),
+			strconv.Itoa(e.Rank),
+			strconv.FormatFloat(float64(e.Score), 'g', -1, 32),
+		})
+	})
+	if err == nil {
+		w.Flush()
+		err = w.Error()
+	}
+	if err != nil {
+		fmt.Printf("Error building k-NN graph: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Wrote %d edges to %s in %v\n", edges, *out, time.Since(start).Round(time.Millisecond))
+}
+
+func handleGenerate(args []string) {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	count := fs.Int("count", 0, "Number of vectors to generate")
+	dimension := fs.Int("dimension", defaults.Dimension, "Vector dimension")
+	distribution := fs.String("distribution", "uniform", "Value distribution (uniform, gaussian, clustered)")
+	clusters := fs.Int("clusters", 10, "Number of clusters for the clustered distribution")
+	normalize := fs.Bool("normalize", false, "Scale generated vectors to unit length")
+
+	fs.Parse(args)
+
+	if *count <= 0 {
+		fmt.Println("Error: --count must be greater than 0")
+		os.Exit(1)
+	}
+
+	generate, err := newVectorGenerator(strings.ToLower(*distribution), *dimension, *clusters, *normalize)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	fmt.Printf("Generating %d random vectors (dimension: %d, distribution: %s)\n", *count, *dimension, *distribution)
+
+	for i := 0; i < *count; i++ {
+		data := generate()
+
+		vector := cvector.NewVector(uint64(i+1), data)
+		err = db.Insert(vector)
+		if err != nil {
+			fmt.Printf("Error inserting vector %d: %v\n", i+1, err)
+			continue
+		}
+
+		if (i+1)%100 == 0 {
+			fmt.Printf("  Generated %d vectors...\n", i+1)
+		}
+	}
+
+	fmt.Printf("Generated %d vectors successfully!\n", *count)
+}
+
+func handleDrop(args []string) {
+	fs := flag.NewFlagSet("drop", flag.ExitOnError)
+	path := fs.String("path", "", "Database path")
+	var yes bool
+	fs.BoolVar(&yes, "yes", false, "Skip the confirmation prompt")
+	fs.BoolVar(&yes, "force", false, "Skip the confirmation prompt (alias for --yes)")
+	ifExists := fs.Bool("if-exists", false, "Succeed without error if the database does not exist")
+
+	fs.Parse(args)
+
+	if *path == "" {
+		fmt.Println("Error: --path is required for drop command")
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(*path); os.IsNotExist(err) && *ifExists {
+		fmt.Printf("Database %s does not exist, nothing to drop.\n", *path)
+		return
+	}
+
+	fmt.Printf("Dropping database: %s\n", *path)
+	if !yes {
+		fmt.Print("Are you sure? (y/N): ")
+		var response string
+		fmt.Scanln(&response)
+
+		if strings.ToLower(response) != "y" && strings.ToLower(response) != "yes" {
+			fmt.Println("Operation cancelled.")
+			return
+		}
+	}
+
+	err := cvector.DropDB(*path)
+	if err != nil {
+		fmt.Printf("Error dropping database: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Database dropped successfully!\n")
+}
+
+func handleUnlock(args []string) {
+	fs := flag.NewFlagSet("unlock", flag.ExitOnError)
+	path := fs.String("path", "", "Database path")
+	force := fs.Bool("force", false, "Remove the lock even though a process holds it")
+
+	fs.Parse(args)
+
+	if *path == "" {
+		fmt.Println("Error: --path is required for unlock command")
+		os.Exit(1)
+	}
+
+	pid, err := cvector.LockHolder(*path)
+	if err != nil {
+		fmt.Printf("Error reading lock: %v\n", err)
+		os.Exit(1)
+	}
+	switch {
+	case pid == 0:
+		fmt.Printf("Database %s is not locked\n", *path)
+		return
+	case pid > 0:
+		fmt.Printf("Database %s is locked by process %d\n", *path, pid)
+	default:
+		fmt.Printf("Database %s is locked by an unknown process\n", *path)
+	}
+
+	if !*force {
+		fmt.Println("Stop that process, or pass --force if it is hung and the lock is stale.")
+		os.Exit(1)
+	}
+	if err := cvector.ForceUnlock(*path); err != nil {
+		fmt.Printf("Error removing lock: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Lock removed.")
+}
+
+func handleSearch(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	vectorStr := fs.String("vector", "", "Query vector data (comma-separated floats)")
+	id := fs.Uint64("id", 0, "Search with this stored vector instead of --vector, leaving it out of the results")
+	topK := fs.Int("top-k", 0, "Number of results to return (default: the database's, else 10)")
+	oversample := fs.Int("oversample", 0, "Candidates to consider per result (default: the database's)")
+	ef := fs.Int("ef", 0, "HNSW candidate list size, trading latency for recall (default: twice --top-k)")
+	similarityStr := fs.String("similarity", defaults.Similarity, "Similarity type (cosine, dot, euclidean)")
+	explain := fs.Bool("explain", false, "Show how the search was executed")
+	normalizeScores := fs.Bool("normalize-scores", false, "Report scores on a 0-1 scale")
+	dedupeBy := fs.String("dedupe-by", "", "Metadata key whose value is returned at most once")
+	tagsStr := fs.String("tags", "", "Only return vectors carrying all these tags (comma-separated)")
+	excludeTagsStr := fs.String("exclude-tags", "", "Skip vectors carrying any of these tags (comma-separated)")
+	rangeStr := fs.String("range", "", "Numeric metadata ranges, KEY=MIN..MAX[,KEY=MIN..MAX...]")
+	geoStr := fs.String("geo", "", "Geo radius, KEY:LAT,LON:METERS")
+	keywordsStr := fs.String("keywords", "", "Keyword filter, KEY:WORDS")
+	hybridStr := fs.String("hybrid", "", "Keyword leg of a hybrid search, KEY:TEXT")
+	facetsStr := fs.String("facets", "", "Metadata keys to count values of over all matches (comma-separated)")
+	aggregateStr := fs.String("aggregate", "", "Aggregations over the results, KEY:OP[,KEY:OP...]")
+
+	fs.Parse(args)
+
+	if (*vectorStr == "") == (*id == 0) {
+		fmt.Println("Error: one of --vector and --id is required")
+		os.Exit(1)
+	}
+
+	if *topK < 0 || *oversample < 0 || *ef < 0 {
+		fmt.Println("Error: --top-k, --oversample and --ef must not be negative")
+		os.Exit(1)
+	}
+
+	// Parse vector data
+	var queryVector []float32
+	var err error
+	if *vectorStr != "" {
+		if queryVector, err = parseVectorString(*vectorStr); err != nil {
+			fmt.Printf("Error parsing query vector: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	aggs, err := parseAggregations(*aggregateStr)
+	if err != nil {
+		fmt.Printf("Error parsing aggregations: %v\n", err)
+		os.Exit(1)
+	}
+	ranges, err := parseRanges(*rangeStr)
+	if err != nil {
+		fmt.Printf("Error parsing ranges: %v\n", err)
+		os.Exit(1)
+	}
+	geoRadius, err := parseGeoRadius(*geoStr)
+	if err != nil {
+		fmt.Printf("Error parsing geo radius: %v\n", err)
+		os.Exit(1)
+	}
+
+	similarity, err := cvector.ParseSimilarity(*similarityStr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	// Unset flags take the database's query defaults
+	queryDefaults := db.QueryDefaults()
+	if *topK == 0 {
+		*topK = int(queryDefaults.TopK)
+	}
+	if *topK == 0 {
+		*topK = 10
+	}
+
+	query := &cvector.Query{
+		QueryVector: queryVector,
+		TopK:        uint32(*topK),
+		Similarity:  similarity,
+		Oversample:  *oversample,
+		EfSearch:    uint32(*ef),
+
+		NormalizeScores: *normalizeScores,
+		DedupeBy:        *dedupeBy,
+		Tags:            parseTags(*tagsStr),
+		ExcludeTags:     parseTags(*excludeTagsStr),
+		Ranges:          ranges,
+		GeoRadius:       geoRadius,
+	}
+	if *keywordsStr != "" {
+		field, words, ok := strings.Cut(*keywordsStr, ":")
+		if !ok || field == "" {
+			fmt.Println("Error: --keywords must be KEY:WORDS")
+			os.Exit(1)
+		}
+		query.Keywords = &cvector.KeywordFilter{Field: field, Text: words}
+	}
+	var hybridField, hybridText string
+	if *hybridStr != "" {
+		var ok bool
+		if hybridField, hybridText, ok = strings.Cut(*hybridStr, ":"); !ok || hybridField == "" {
+			fmt.Println("Error: --hybrid must be KEY:TEXT")
+			os.Exit(1)
+		}
+		if *explain {
+			fmt.Println("Error: --explain does not apply to --hybrid searches")
+			os.Exit(1)
+		}
+	}
+	if *facetsStr != "" {
+		query.Facets = parseTags(*facetsStr)
+		if *explain || hybridField != "" {
+			fmt.Println("Error: --facets does not combine with --explain or --hybrid")
+			os.Exit(1)
+		}
+	}
+	if len(aggs) > 0 && (*explain || hybridField != "" || len(query.Facets) > 0) {
+		fmt.Println("Error: --aggregate does not combine with --explain, --hybrid or --facets")
+		os.Exit(1)
+	}
+	if *id != 0 && (*explain || hybridField != "" || len(query.Facets) > 0 || len(aggs) > 0) {
+		fmt.Println("Error: --id does not combine with --explain, --hybrid, --facets or --aggregate")
+		os.Exit(1)
+	}
+
+	if *id != 0 {
+		fmt.Printf("Searching for vectors similar to vector %d (top-%d, similarity: %s)\n", *id, *topK, *similarityStr)
+	} else {
+		fmt.Printf("Searching for similar vectors (top-%d, similarity: %s, dimension: %d)\n", 
+			*topK, *similarityStr, len(queryVector))
+	}
+
+	var results []*cvector.Result
+	var report *cvector.SearchExplain
+	var facets map[string]map[string]int
+	var aggregates []cvector.AggregateResult
+	if *id != 0 {
+		results, err = db.SearchByID(*id, query)
+	} else if hybridField != "" {
+		results, err = db.SearchHybrid(query, hybridField, hybridText, cvector.Fusion{})
+	} else if len(query.Facets) > 0 {
+		results, facets, err = db.SearchFacets(query)
+	} else if len(aggs) > 0 {
+		results, aggregates, err = db.SearchAggregate(query, aggs)
+	} else {
+		results, report, err = db.SearchExplain(query)
+	}
+	if err != nil {
+		fmt.Printf("Error searching: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *explain {
+		printSearchExplain(report)
+	}
+	if facets != nil {
+		printFacets(query.Facets, facets)
+	}
+	if aggregates != nil {
+		printAggregates(aggregates)
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No similar vectors found.")
+		return
+	}
+
+	fmt.Printf("\nSearch Results (%d found):\n", len(results))
+	fmt.Println("Rank | Vector ID | Similarity Score")
+	fmt.Println("-----|-----------|----------------")
+	for i, result := range results {
+		fmt.Printf("%-4d | %-9d | %.6f\n", i+1, result.ID, result.Similarity)
+	}
+}
+
+func printFacets(keys []string, facets map[string]map[string]int) {
+	fmt.Printf("\nFacets:\n")
+	for _, key := range keys {
+		counts := facets[key]
+		values := make([]string, 0, len(counts))
+		for value := range counts {
+			values = append(values, value)
+		}
+		// Most common first, as a filter sidebar lists them
+		sort.Slice(values, func(i, j int) bool {
+			if counts[values[i]] != counts[values[j]] {
+				return counts[values[i]] > counts[values[j]]
+			}
+			return values[i] < values[j]
+		})
+		fmt.Printf("  %s:", key)
+		if len(values) == 0 {
+			fmt.Printf(" (none)")
+		}
+		for _, value := range values {
+			fmt.Printf(" %s (%d)", value, counts[value])
+		}
+		fmt.Println()
+	}
+}
+
+func printAggregates(aggregates []cvector.AggregateResult) {
+	fmt.Printf("\nAggregates:\n")
+	for _, a := range aggregates {
+		fmt.Printf("  %s %s:", a.Op, a.Field)
+		switch {
+		case a.Count == 0:
+			fmt.Printf(" (no values)")
+		case a.Op == cvector.AggregateTop:
+			for _, v := range a.Top {
+				fmt.Printf(" %s (%d)", v.Value, v.Count)
+			}
+		default:
+			fmt.Printf(" %g (over %d)", a.Value, a.Count)
+		}
+		fmt.Println()
+	}
+}
+
+func printSearchExplain(report *cvector.SearchExplain) {
+	fmt.Printf("\nQuery Plan:\n")
+	fmt.Printf("  Strategy: %s", report.Strategy)
+	if report.IndexFallback {
+		fmt.Printf(" (index search failed, fell back to scan)")
+	}
+	fmt.Println()
+	fmt.Printf("  Candidates Scanned: %d\n", report.CandidatesScanned)
+	if report.Strategy == cvector.SearchStrategyIndex {
+		fmt.Printf("  Index Nodes Visited: %d (ef %d)\n", report.IndexNodesVisited, report.EfSearch)
+	}
+	fmt.Printf("  Filter Selectivity: %.1f%% (%d of %d passed)\n", report.FilterSelectivity*100,
+		report.ThresholdChecked-report.ThresholdRejected, report.ThresholdChecked)
+	fmt.Printf("  I/O Time: %v\n", report.IOTime)
+	fmt.Printf("  Scoring Time: %v\n", report.ScoringTime)
+	fmt.Printf("  Total Time: %v\n", report.TotalTime)
+}
+
+func handleList(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	limit := fs.Int("limit", 0, "Maximum number of vectors to list (0 for all)")
+	offset := fs.Int("offset", 0, "Number of vectors to skip")
+	withMetadata := fs.Bool("with-metadata", false, "Include vector metadata")
+
+	fs.Parse(args)
+
+	if *limit < 0 || *offset < 0 {
+		fmt.Println("Error: --limit and --offset must not be negative")
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	vectors, err := db.List(*offset, *limit)
+	if err != nil {
+		fmt.Printf("Error listing vectors: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(vectors) == 0 {
+		fmt.Println("No vectors found.")
+		return
+	}
+
+	fmt.Printf("\nVectors (%d shown):\n", len(vectors))
+	if *withMetadata {
+		fmt.Println("Vector ID | Timestamp           | Metadata")
+		fmt.Println("----------|---------------------|---------")
+	} else {
+		fmt.Println("Vector ID | Timestamp")
+		fmt.Println("----------|--------------------")
+	}
+	for _, vector := range vectors {
+		timestamp := vector.Timestamp.Format("2006-01-02 15:04:05")
+		if *withMetadata {
+			fmt.Printf("%-9d | %-19s | %s\n", vector.ID, timestamp, formatMetadata(vector.Metadata))
+		} else {
+			fmt.Printf("%-9d | %s\n", vector.ID, timestamp)
+		}
+	}
+}
+
+func handleCopy(args []string) {
+	fs := flag.NewFlagSet("copy", flag.ExitOnError)
+	from := fs.String("from", "", "Source database path")
+	to := fs.String("to", "", "Destination database path")
+	filterStr := fs.String("filter", "", "Only copy vectors whose metadata matches KEY=VALUE[,KEY=VALUE...]")
+
+	fs.Parse(args)
+
+	if *from == "" || *to == "" {
+		fmt.Println("Error: --from and --to are required")
+		os.Exit(1)
+	}
+
+	filter, err := parseMetadataFilter(*filterStr)
+	if err != nil {
+		fmt.Printf("Error parsing filter: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening database: %s\n", *from)
+	db, err := cvector.OpenDB(*from)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	fmt.Printf("Copying to: %s\n", *to)
+	copied, err := db.CopyTo(*to, filter)
+	if err != nil {
+		fmt.Printf("Error copying database: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Copied %d vectors successfully!\n", copied)
+}
+
+// handleDump and handleLoad report progress on stderr, since stdout may be
+// carrying the stream
+func handleDump(args []string) {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	out := fs.String("out", "", "Output file or http(s)://, s3://, gs:// URL (default: stdout)")
+
+	fs.Parse(args)
+
+	fmt.Fprintf(os.Stderr, "Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if *out == "" {
+		n, err := db.WriteTo(os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error dumping database: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Dumped %d bytes successfully!\n", n)
+		return
+	}
+
+	w, err := openOutput(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output: %v\n", err)
+		os.Exit(1)
+	}
+	n, err := db.WriteTo(w)
+	if err != nil {
+		w.Abort(err)
+	} else {
+		err = w.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error dumping database: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Dumped %d bytes successfully!\n", n)
+}
+
+func handleLoad(args []string) {
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	path := fs.String("path", "", "Database path to create")
+	in := fs.String("in", "", "Input file or http(s)://, s3://, gs:// URL (default: stdin)")
+
+	fs.Parse(args)
+
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "Error: --path is required")
+		os.Exit(1)
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := openInput(*in)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening input: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	fmt.Fprintf(os.Stderr, "Loading into: %s\n", *path)
+	db, err := cvector.ReadFrom(r, *path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	stats, err := db.Stats()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting stats: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Loaded %d vectors successfully!\n", stats.TotalVectors)
+}
+
+func handleBackup(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	out := fs.String("out", "", "Archive to write (.tar.gz), as a file or http(s)://, s3://, gs:// URL")
+
+	fs.Parse(args)
+
+	if *out == "" {
+		fmt.Println("Error: --out is required")
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	w, err := openOutput(*out)
+	if err != nil {
+		fmt.Printf("Error creating archive: %v\n", err)
+		os.Exit(1)
+	}
+	if err = db.Backup(w); err != nil {
+		w.Abort(err)
+	} else {
+		err = w.Close()
+	}
+	if err != nil {
+		fmt.Printf("Error backing up database: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Backed up to %s successfully!\n", *out)
+}
+
+func handleRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := fs.String("in", "", "Archive written by cvector backup, as a file or http(s)://, s3://, gs:// URL")
+	path := fs.String("path", "", "Database path to create")
+
+	fs.Parse(args)
+
+	if *in == "" || *path == "" {
+		fmt.Println("Error: --in and --path are required")
+		os.Exit(1)
+	}
+
+	f, err := openInput(*in)
+	if err != nil {
+		fmt.Printf("Error opening archive: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	fmt.Printf("Restoring %s to %s\n", *in, *path)
+	if err := cvector.RestoreBackup(f, *path); err != nil {
+		fmt.Printf("Error restoring backup: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Restored and verified successfully!")
+}
+
+func handleEdit(args []string) {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	name := fs.String("name", "", "New database name")
+	description := fs.String("description", "", "New database description")
+	defaultTopK := fs.Int("default-top-k", 0, "Results returned by searches that do not ask for a number")
+	defaultMinSimilarity := fs.Float64("default-min-similarity", 0, "Score threshold for searches that do not set one")
+	defaultOversample := fs.Int("default-oversample", 0, "Candidates considered per result by searches that do not set it")
+	schemaStr := fs.String("schema", "", "Metadata schema (JSON object, or null to remove it)")
+
+	fs.Parse(args)
+
+	// Track which flags were given so an empty --description can clear it
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	setDefaults := set["default-top-k"] || set["default-min-similarity"] || set["default-oversample"]
+
+	if !set["name"] && !set["description"] && !setDefaults && !set["schema"] {
+		fmt.Println("Error: --name, --description, --schema or a --default-* flag is required")
+		os.Exit(1)
+	}
+	if *defaultTopK < 0 {
+		fmt.Println("Error: --default-top-k must not be negative")
+		os.Exit(1)
+	}
+	var schema *cvector.Schema
+	if set["schema"] {
+		if err := json.Unmarshal([]byte(*schemaStr), &schema); err != nil {
+			fmt.Printf("Error parsing schema: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if set["name"] {
+		if err := db.Rename(*name); err != nil {
+			fmt.Printf("Error renaming database: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Name set to: %s\n", *name)
+	}
+
+	if set["description"] {
+		if err := db.SetDescription(*description); err != nil {
+			fmt.Printf("Error setting description: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Description set to: %s\n", *description)
+	}
+
+	if setDefaults {
+		d := db.QueryDefaults()
+		if set["default-top-k"] {
+			d.TopK = uint32(*defaultTopK)
+		}
+		if set["default-min-similarity"] {
+			d.MinSimilarity = float32(*defaultMinSimilarity)
+		}
+		if set["default-oversample"] {
+			d.Oversample = *defaultOversample
+		}
+		if err := db.SetQueryDefaults(d); err != nil {
+			fmt.Printf("Error setting query defaults: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Query defaults set to: top-k %d, min similarity %g, oversample %d\n", d.TopK, d.MinSimilarity, d.Oversample)
+	}
+
+	if set["schema"] {
+		if err := db.SetSchema(schema); err != nil {
+			fmt.Printf("Error setting schema: %v\n", err)
+			os.Exit(1)
+		}
+		if schema == nil {
+			fmt.Printf("Schema removed\n")
+		} else {
+			fmt.Printf("Schema set: %d fields\n", len(schema.Fields))
+		}
+	}
+
+	fmt.Printf("Database updated successfully!\n")
+}
+
+func handleInspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	id := fs.Uint64("id", 0, "Vector ID")
+
+	fs.Parse(args)
+
+	if *id == 0 {
+		fmt.Println("Error: --id is required")
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	info, err := db.Describe(*id)
+	if err != nil {
+		fmt.Printf("Error inspecting vector: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Record:\n")
+	fmt.Printf("  ID: %d\n", info.ID)
+	fmt.Printf("  File Offset: %d\n", info.Offset)
+	fmt.Printf("  Record Length: %d bytes\n", info.Length)
+	fmt.Printf("  Dimension: %d\n", info.Dimension)
+	fmt.Printf("  Timestamp: %s\n", info.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Deleted: %v\n", info.Deleted)
+	fmt.Printf("  Version: %d\n", info.Version)
+	fmt.Printf("  Checksum (CRC-32): %08x\n", info.Checksum)
+	fmt.Printf("  Format Version: %d\n", info.FormatVersion)
+}
+
+// Helper functions
+
+func parseVectorString(vectorStr string) ([]float32, error) {
+	parts := strings.Split(vectorStr, ",")
+	data := make([]float32, len(parts))
+
+	for i, part := range parts {
+		val, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float value: %s", part)
+		}
+		data[i] = float32(val)
+	}
+
+	return data, nil
+}
+
+func formatVector(data []float32) string {
+	if len(data) <= 10 {
+		strs := make([]string, len(data))
+		for i, v := range data {
+			strs[i] = fmt.Sprintf("%.3f", v)
+		}
+		return strings.Join(strs, ", ")
+	}
+
+	// Show first 5 and last 5 values for long vectors
+	var parts []string
+	for i := 0; i < 5; i++ {
+		parts = append(parts, fmt.Sprintf("%.3f", data[i]))
+	}
+	parts = append(parts, "...")
+	for i := len(data) - 5; i < len(data); i++ {
+		parts = append(parts, fmt.Sprintf("%.3f", data[i]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatMetadata(metadata map[string]any) string {
+	if len(metadata) == 0 {
+		return "{}"
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Sprintf("%v", metadata)
+	}
+	return string(encoded)
+}
+
+// parseTags splits a comma-separated tag list, dropping blank entries
+func parseTags(tagsStr string) []string {
+	var tags []string
+	for _, tag := range strings.Split(tagsStr, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// parseAggregations turns "price:avg,brand:top5" into aggregations, topN
+// keeping the N most common values. An empty string gives none.
+func parseAggregations(aggStr string) ([]cvector.Aggregation, error) {
+	var aggs []cvector.Aggregation
+	for _, part := range parseTags(aggStr) {
+		field, op, ok := strings.Cut(part, ":")
+		if !ok || field == "" {
+			return nil, fmt.Errorf("%q is not KEY:OP", part)
+		}
+		a := cvector.Aggregation{Field: field, Op: cvector.AggregateOp(op)}
+		if n, isTop := strings.CutPrefix(op, "top"); isTop && n != "" {
+			count, err := strconv.Atoi(n)
+			if err != nil || count <= 0 {
+				return nil, fmt.Errorf("%q: top needs a positive count", part)
+			}
+			a.Op, a.N = cvector.AggregateTop, count
+		}
+		switch a.Op {
+		case cvector.AggregateMin, cvector.AggregateMax, cvector.AggregateAvg, cvector.AggregateSum, cvector.AggregateTop:
+		default:
+			return nil, fmt.Errorf("%q: unknown operation %q", part, op)
+		}
+		aggs = append(aggs, a)
+	}
+	return aggs, nil
+}
+
+// parseRanges turns "k1=1..2,k2=3.." into numeric ranges, an empty end
+// being open. An empty string gives no ranges.
+func parseRanges(rangeStr string) (map[string]cvector.Range, error) {
+	if strings.TrimSpace(rangeStr) == "" {
+		return nil, nil
+	}
+
+	ranges := make(map[string]cvector.Range)
+	for _, part := range strings.Split(rangeStr, ",") {
+		key, bounds, ok := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		lo, hi, dots := strings.Cut(bounds, "..")
+		if !ok || !dots || key == "" {
+			return nil, fmt.Errorf("invalid range term: %s", part)
+		}
+		r := cvector.Range{Min: math.Inf(-1), Max: math.Inf(1)}
+		var err error
+		if lo = strings.TrimSpace(lo); lo != "" {
+			if r.Min, err = strconv.ParseFloat(lo, 64); err != nil {
+				return nil, fmt.Errorf("invalid range term: %s", part)
+			}
+		}
+		if hi = strings.TrimSpace(hi); hi != "" {
+			if r.Max, err = strconv.ParseFloat(hi, 64); err != nil {
+				return nil, fmt.Errorf("invalid range term: %s", part)
+			}
+		}
+		ranges[key] = r
+	}
+	return ranges, nil
+}
+
+// parseGeoRadius turns "key:lat,lon:meters" into a geo radius filter. An
+// empty string gives none.
+func parseGeoRadius(geoStr string) (*cvector.GeoRadius, error) {
+	if strings.TrimSpace(geoStr) == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(geoStr, ":")
+	if len(parts) != 3 || strings.TrimSpace(parts[0]) == "" {
+		return nil, fmt.Errorf("expected KEY:LAT,LON:METERS, got %s", geoStr)
+	}
+	lat, lon, ok := strings.Cut(parts[1], ",")
+	if !ok {
+		return nil, fmt.Errorf("expected LAT,LON, got %s", parts[1])
+	}
+	radius := &cvector.GeoRadius{Field: strings.TrimSpace(parts[0])}
+	var err error
+	if radius.Center.Lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil {
+		return nil, fmt.Errorf("invalid latitude: %s", lat)
+	}
+	if radius.Center.Lon, err = strconv.ParseFloat(strings.TrimSpace(lon), 64); err != nil {
+		return nil, fmt.Errorf("invalid longitude: %s", lon)
+	}
+	if radius.Meters, err = strconv.ParseFloat(strings.TrimSpace(parts[2]), 64); err != nil {
+		return nil, fmt.Errorf("invalid distance: %s", parts[2])
+	}
+	return radius, nil
+}
+
+// parseMetadataFilter turns "k1=v1,k2=v2" into a predicate requiring every
+// key to be present with a matching value. An empty string matches everything.
+func parseMetadataFilter(filterStr string) (func(*cvector.Vector) bool, error) {
+	if strings.TrimSpace(filterStr) == "" {
+		return nil, nil
+	}
+
+	want := make(map[string]string)
+	for _, part := range strings.Split(filterStr, ",") {
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid filter term: %s", part)
+		}
+		want[key] = strings.TrimSpace(value)
+	}
+
+	return func(vector *cvector.Vector) bool {
+		for key, value := range want {
+			got, ok := vector.Metadata[key]
+			if !ok || fmt.Sprint(got) != value {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	remoteMaxRetries = 5
+	remoteRetryDelay = 500 * time.Millisecond
+)
+
+// errNotResumable means retrying cannot pick the transfer up again
+var errNotResumable = errors.New("transfer cannot be resumed")
+
+// openInput opens a local file, or streams an http://, https://, s3:// or
+// gs:// object without staging it on disk. Bucket URLs are read through
+// the providers' public HTTPS endpoints, so private objects need a
+// presigned https:// URL instead.
+func openInput(location string) (io.ReadCloser, error) {
+	url, remote := remoteURL(location)
+	if !remote {
+		return os.Open(location)
+	}
+
+	r := &resumableReader{url: url}
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// output is a destination opened by openOutput. Close commits what was
+// written and reports whether it arrived; Abort discards it.
+type output interface {
+	io.Writer
+	Close() error
+	Abort(err error)
+}
+
+// openOutput creates a local file, or streams to an http://, https://,
+// s3:// or gs:// URL with a single chunked PUT, mapped as openInput maps
+// them. Uploads cannot resume, and servers that need the length up front,
+// as S3 presigned URLs do, refuse them.
+func openOutput(location string) (output, error) {
+	url, remote := remoteURL(location)
+	if !remote {
+		f, err := os.Create(location)
+		if err != nil {
+			return nil, err
+		}
+		return &fileOutput{File: f}, nil
+	}
+
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPut, url, pr)
+	if err != nil {
+		return nil, err
+	}
+	u := &uploadOutput{pw: pw, done: make(chan error, 1)}
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				err = fmt.Errorf("%s: server returned %s", url, resp.Status)
+			}
+		}
+		// Unblocks a writer the server stopped reading from
+		pr.CloseWithError(err)
+		u.done <- err
+	}()
+	return u, nil
+}
+
+// fileOutput syncs a local file before closing it, and removes it if
+// either fails
+type fileOutput struct {
+	*os.File
+}
+
+func (f *fileOutput) Close() error {
+	err := f.Sync()
+	if closeErr := f.File.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (f *fileOutput) Abort(error) {
+	f.File.Close()
+	os.Remove(f.Name())
+}
+
+// uploadOutput feeds a PUT request body through a pipe
+type uploadOutput struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (u *uploadOutput) Write(p []byte) (int, error) {
+	return u.pw.Write(p)
+}
+
+func (u *uploadOutput) Close() error {
+	u.pw.Close()
+	return <-u.done
+}
+
+// Abort cuts the request body short, so the server never sees a complete
+// upload
+func (u *uploadOutput) Abort(err error) {
+	u.pw.CloseWithError(err)
+	<-u.done
+}
+
+// remoteURL maps a location to the HTTP URL it is fetched from
+func remoteURL(location string) (string, bool) {
+	switch {
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		return location, true
+	case strings.HasPrefix(location, "s3://"):
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(location, "s3://"), "/")
+		return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", bucket, key), true
+	case strings.HasPrefix(location, "gs://"):
+		return "https://storage.googleapis.com/" + strings.TrimPrefix(location, "gs://"), true
+	default:
+		return location, false
+	}
+}
+
+// resumableReader streams an HTTP object, picking up where it left off
+// with a Range request when the connection drops mid-transfer. Resuming
+// sends the first response's ETag in If-Range, so an object that changed
+// in between is refused rather than spliced.
+type resumableReader struct {
+	url     string
+	etag    string
+	body    io.ReadCloser
+	offset  int64
+	retries int
+	failed  error // Set when the connection dropped; the next Read resumes
+}
+
+func (r *resumableReader) connect() error {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	if r.offset > 0 {
+		if r.etag == "" {
+			return fmt.Errorf("%s: server sent no ETag: %w", r.url, errNotResumable)
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+		req.Header.Set("If-Range", r.etag)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case r.offset == 0 && resp.StatusCode == http.StatusOK:
+		r.etag = resp.Header.Get("ETag")
+	case r.offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", r.offset)) {
+			resp.Body.Close()
+			return fmt.Errorf("%s: server resumed at the wrong offset: %w", r.url, errNotResumable)
+		}
+	case r.offset > 0 && resp.StatusCode == http.StatusOK:
+		resp.Body.Close()
+		return fmt.Errorf("%s: object changed or server ignores ranges: %w", r.url, errNotResumable)
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("%s: server returned %s", r.url, resp.Status)
+	}
+	r.body = resp.Body
+	return nil
+}
+
+func (r *resumableReader) Read(p []byte) (int, error) {
+	for {
+		if r.failed != nil {
+			if err := r.resume(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+
+		// Hand over what did arrive and reconnect on the next call
+		r.failed = err
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume reconnects at the current offset, backing off between attempts
+func (r *resumableReader) resume() error {
+	r.body.Close()
+	err := r.failed
+	for r.retries < remoteMaxRetries {
+		time.Sleep(remoteRetryDelay << r.retries)
+		r.retries++
+		fmt.Fprintf(os.Stderr, "Resuming %s at byte %d\n", r.url, r.offset)
+		if err = r.connect(); err == nil {
+			r.failed = nil
+			return nil
+		}
+		if errors.Is(err, errNotResumable) {
+			break
+		}
+	}
+	return fmt.Errorf("%s: giving up after %d retries: %w", r.url, r.retries, err)
+}
+
+func (r *resumableReader) Close() error {
+	return r.body.Close()
+}
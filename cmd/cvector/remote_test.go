@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyServer serves payload with an ETag, dropping the connection halfway
+// through the first full response so the client has to resume
+func flakyServer(t *testing.T, payload []byte, etag func() string) *httptest.Server {
+	dropped := false
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag())
+		if r.Header.Get("Range") != "" || dropped {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(payload))
+			return
+		}
+		dropped = true
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(payload[:len(payload)/2])
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Failed to hijack connection: %v", err)
+			return
+		}
+		conn.Close()
+	}))
+}
+
+func TestOpenInputResumes(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 64<<10)
+	server := flakyServer(t, payload, func() string { return `"v1"` })
+	defer server.Close()
+
+	r, err := openInput(server.URL)
+	if err != nil {
+		t.Fatalf("openInput failed: %v", err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Reading across the dropped connection failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("Expected %d bytes intact, got %d", len(payload), len(got))
+	}
+}
+
+func TestOpenInputRefusesChangedObject(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 64<<10)
+	version := 0
+	server := flakyServer(t, payload, func() string {
+		version++
+		return `"v` + strconv.Itoa(version) + `"`
+	})
+	defer server.Close()
+
+	r, err := openInput(server.URL)
+	if err != nil {
+		t.Fatalf("openInput failed: %v", err)
+	}
+	defer r.Close()
+	if _, err := io.ReadAll(r); !errors.Is(err, errNotResumable) {
+		t.Errorf("Expected errNotResumable when the ETag changes, got %v", err)
+	}
+}
+
+func TestOpenOutputUploads(t *testing.T) {
+	var received bytes.Buffer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if _, err := io.Copy(&received, r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	w, err := openOutput(server.URL + "/dump.cvd")
+	if err != nil {
+		t.Fatalf("openOutput failed: %v", err)
+	}
+	payload := strings.Repeat("vector data ", 10000)
+	if _, err := io.WriteString(w, payload); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if received.String() != payload {
+		t.Errorf("Expected the server to receive %d bytes, got %d", len(payload), received.Len())
+	}
+
+	// A rejected upload is reported by Close
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	if w, err = openOutput(server.URL + "/dump.cvd"); err != nil {
+		t.Fatalf("openOutput failed: %v", err)
+	}
+	io.WriteString(w, payload)
+	if err := w.Close(); err == nil {
+		t.Error("Expected Close to report a rejected upload")
+	}
+}
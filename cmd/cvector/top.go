@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/asmit-gupta/cvector/pkg/cvector"
+)
+
+// topSample is one observation of the database file. latency is how long
+// reading the file took, not the latency of the database's operations,
+// which top cannot see from another process.
+type topSample struct {
+	at      time.Time
+	info    *cvector.FileInfo
+	latency time.Duration
+}
+
+func handleTop(args []string) {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	interval := fs.Duration("interval", time.Second, "Refresh interval")
+	iterations := fs.Int("count", 0, "Number of refreshes before exiting (0 runs until interrupted)")
+
+	fs.Parse(args)
+
+	if *interval <= 0 {
+		fmt.Println("Error: --interval must be greater than 0")
+		os.Exit(1)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	prev, err := sampleTop(*path)
+	if err != nil {
+		fmt.Printf("Error reading database: %v\n", err)
+		os.Exit(1)
+	}
+
+	for n := 0; *iterations == 0 || n < *iterations; n++ {
+		select {
+		case <-interrupt:
+			fmt.Println()
+			return
+		case <-ticker.C:
+		}
+
+		cur, err := sampleTop(*path)
+		if err != nil {
+			fmt.Printf("Error reading database: %v\n", err)
+			os.Exit(1)
+		}
+		renderTop(*path, prev, cur)
+		prev = cur
+	}
+}
+
+func sampleTop(path string) (*topSample, error) {
+	start := time.Now()
+	info, err := cvector.ReadFileInfo(path)
+	if err != nil {
+		return nil, err
+	}
+	return &topSample{at: time.Now(), info: info, latency: time.Since(start)}, nil
+}
+
+func renderTop(path string, prev, cur *topSample) {
+	elapsed := cur.at.Sub(prev.at).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+
+	// Inserts and updates each append a record; an update also marks the
+	// record it replaces deleted. Compaction drops records, so a shrinking
+	// file starts the rates over from this sample.
+	prevRecords := prev.info.LiveRecords + prev.info.DeletedRecords
+	curRecords := cur.info.LiveRecords + cur.info.DeletedRecords
+	if curRecords < prevRecords || cur.info.UpdatedRecords < prev.info.UpdatedRecords {
+		prev, prevRecords = cur, curRecords
+	}
+	updated := cur.info.UpdatedRecords - prev.info.UpdatedRecords
+	inserts := float64(curRecords-prevRecords-updated) / elapsed
+	updates := float64(updated) / elapsed
+	deletes := float64(cur.info.DeletedRecords-prev.info.DeletedRecords-updated) / elapsed
+	growth := float64(cur.info.SizeBytes-prev.info.SizeBytes) / elapsed
+
+	// Clear the screen and move the cursor home
+	fmt.Print("\033[H\033[2J")
+	fmt.Printf("CVector top - %s (updated %s, Ctrl+C to quit)\n\n", path, cur.at.Format("15:04:05"))
+	fmt.Printf("  Live Vectors:    %d\n", cur.info.LiveRecords)
+	fmt.Printf("  Deleted Records: %d\n", cur.info.DeletedRecords)
+	fmt.Printf("  Dimension:       %d\n", cur.info.Dimension)
+	fmt.Printf("  File Size:       %d bytes (%.2f MB)\n", cur.info.SizeBytes, float64(cur.info.SizeBytes)/(1024*1024))
+	fmt.Println()
+	fmt.Printf("  Inserts/sec:     %.1f\n", inserts)
+	fmt.Printf("  Updates/sec:     %.1f\n", updates)
+	fmt.Printf("  Deletes/sec:     %.1f\n", deletes)
+	fmt.Printf("  Growth:          %.2f KB/s\n", growth/1024)
+	fmt.Printf("  File Scan Time:  %v\n", cur.latency.Round(time.Microsecond))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/asmit-gupta/cvector/pkg/cvector"
+)
+
+func handleTune(args []string) {
+	fs := flag.NewFlagSet("tune", flag.ExitOnError)
+	path := fs.String("path", defaults.Path, "Database path")
+	dataset := fs.String("dataset", "", "Query vectors as a 2-D float32 or float64 .npy file")
+	targetRecall := fs.Float64("target-recall", 0.95, "Share of the true nearest neighbors searches should find")
+	topK := fs.Int("top-k", 0, "Results per query (0 uses the database default)")
+	dryRun := fs.Bool("dry-run", false, "Report the best setting without saving it")
+
+	fs.Parse(args)
+
+	if *dataset == "" {
+		fmt.Println("Error: --dataset is required")
+		os.Exit(1)
+	}
+	if *targetRecall <= 0 || *targetRecall > 1 {
+		fmt.Println("Error: --target-recall must be greater than 0 and at most 1")
+		os.Exit(1)
+	}
+	if *topK < 0 {
+		fmt.Println("Error: --top-k must not be negative")
+		os.Exit(1)
+	}
+
+	queries, err := readNpy(*dataset)
+	if err != nil {
+		fmt.Printf("Error reading dataset: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening database: %s\n", *path)
+	db, err := cvector.OpenDB(*path)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	stats, err := db.Stats()
+	if err != nil {
+		fmt.Printf("Error getting stats: %v\n", err)
+		os.Exit(1)
+	}
+	if len(queries[0]) != int(stats.Dimension) {
+		fmt.Printf("Error: dataset has dimension %d, database has %d\n", len(queries[0]), stats.Dimension)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Tuning with %d queries against %d vectors\n", len(queries), stats.TotalVectors)
+	result, err := db.Tune(queries, &cvector.TuneOptions{TargetRecall: *targetRecall, TopK: *topK})
+	if err != nil {
+		fmt.Printf("Error tuning: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("\n%10s %8s %12s\n", "ef", "recall", "latency")
+	for _, trial := range result.Trials {
+		fmt.Printf("%10d %8.4f %12v\n", trial.EfSearch, trial.Recall, trial.Latency)
+	}
+	fmt.Println()
+
+	if !result.Reached {
+		fmt.Printf("Target recall %.4f not reached; best was %.4f at ef=%d\n", *targetRecall, result.Recall, result.EfSearch)
+	} else {
+		fmt.Printf("Recall %.4f at ef=%d, %v per search\n", result.Recall, result.EfSearch, result.Latency)
+	}
+
+	if *dryRun {
+		fmt.Println("Dry run: setting not saved")
+		return
+	}
+	if err := db.SaveEfSearch(result.EfSearch); err != nil {
+		fmt.Printf("Error saving ef: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Saved ef_search=%d with the database\n", result.EfSearch)
+}
+
+var (
+	npyDescr   = regexp.MustCompile(`'descr':\s*'([^']*)'`)
+	npyFortran = regexp.MustCompile(`'fortran_order':\s*(True|False)`)
+	npyShape   = regexp.MustCompile(`'shape':\s*\(([^)]*)\)`)
+)
+
+// readNpy reads a little-endian float32 or float64 array saved by
+// numpy.save, one vector per row. A 1-D array is a single vector.
+func readNpy(path string) ([][]float32, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 10 || !bytes.HasPrefix(data, []byte("\x93NUMPY")) {
+		return nil, fmt.Errorf("%s is not a .npy file", path)
+	}
+
+	// Version 1 has a 2-byte header length, later versions 4
+	var headerLen, offset int
+	if data[6] == 1 {
+		headerLen, offset = int(binary.LittleEndian.Uint16(data[8:10])), 10
+	} else {
+		if len(data) < 12 {
+			return nil, fmt.Errorf("%s: truncated header", path)
+		}
+		headerLen, offset = int(binary.LittleEndian.Uint32(data[8:12])), 12
+	}
+	if offset+headerLen > len(data) {
+		return nil, fmt.Errorf("%s: truncated header", path)
+	}
+	header := string(data[offset : offset+headerLen])
+	body := data[offset+headerLen:]
+
+	descr := npyDescr.FindStringSubmatch(header)
+	fortran := npyFortran.FindStringSubmatch(header)
+	shape := npyShape.FindStringSubmatch(header)
+	if descr == nil || fortran == nil || shape == nil {
+		return nil, fmt.Errorf("%s: unrecognised header %q", path, header)
+	}
+	if fortran[1] == "True" {
+		return nil, fmt.Errorf("%s: Fortran-ordered arrays are not supported", path)
+	}
+
+	var width int
+	switch descr[1] {
+	case "<f4":
+		width = 4
+	case "<f8":
+		width = 8
+	default:
+		return nil, fmt.Errorf("%s: dtype %s is not supported, want float32 or float64", path, descr[1])
+	}
+
+	var dims []int
+	for _, field := range strings.Split(shape[1], ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad shape %q", path, shape[1])
+		}
+		dims = append(dims, n)
+	}
+	switch len(dims) {
+	case 1:
+		dims = []int{1, dims[0]}
+	case 2:
+	default:
+		return nil, fmt.Errorf("%s: want a 1-D or 2-D array, got shape (%s)", path, shape[1])
+	}
+	rows, dimension := dims[0], dims[1]
+	if rows == 0 || dimension == 0 {
+		return nil, fmt.Errorf("%s: array is empty", path)
+	}
+	if len(body) < rows*dimension*width {
+		return nil, fmt.Errorf("%s: truncated data, want %d bytes, got %d", path, rows*dimension*width, len(body))
+	}
+
+	vectors := make([][]float32, rows)
+	for r := range vectors {
+		vectors[r] = make([]float32, dimension)
+		for c := range vectors[r] {
+			at := (r*dimension + c) * width
+			if width == 4 {
+				vectors[r][c] = math.Float32frombits(binary.LittleEndian.Uint32(body[at:]))
+			} else {
+				vectors[r][c] = float32(math.Float64frombits(binary.LittleEndian.Uint64(body[at:])))
+			}
+		}
+	}
+	return vectors, nil
+}
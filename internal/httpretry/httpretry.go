@@ -0,0 +1,79 @@
+// Package httpretry POSTs JSON with the retry policy shared by the
+// embedding clients and webhook delivery.
+package httpretry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDelay caps the backoff between attempts
+const maxDelay = 30 * time.Second
+
+// StatusError is returned when the server answers with a non-2xx status
+// that is not retried, or still fails after every retry
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Body)
+}
+
+// Post sends body to url and returns the response body, retrying network
+// errors, rate limits (429) and server errors (5xx) up to maxRetries times
+// with exponential backoff from delay. A Retry-After header in seconds
+// overrides the backoff for that attempt. Cancelling ctx ends the request
+// and the wait between attempts. decorate, if set, adjusts each request.
+func Post(ctx context.Context, client *http.Client, url string, body []byte,
+	maxRetries int, delay time.Duration, decorate func(*http.Request)) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if decorate != nil {
+			decorate(req)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= maxRetries {
+				return nil, err
+			}
+		} else {
+			respBody, readErr := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+			switch {
+			case resp.StatusCode/100 == 2:
+				if readErr != nil {
+					return nil, readErr
+				}
+				return respBody, nil
+			case !retryable || attempt >= maxRetries:
+				return nil, &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+			}
+
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+				delay = time.Duration(seconds) * time.Second
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxDelay)
+	}
+}
@@ -0,0 +1,94 @@
+package cvector
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrOverloaded is matched by every OverloadError
+var ErrOverloaded = errors.New("cvector: too many inserts")
+
+// minRetryAfter is the shortest wait an OverloadError suggests, so callers
+// never spin while the engine has no latency history yet
+const minRetryAfter = time.Millisecond
+
+// OverloadError is returned by Insert when DBConfig.MaxInflightInserts or
+// MaxQueuedInserts is reached. Nothing was stored; the caller should wait
+// RetryAfter and try again. It matches ErrOverloaded under errors.Is.
+type OverloadError struct {
+	Limit      string // Name of the DBConfig field that was reached
+	Value      int
+	RetryAfter time.Duration // Estimated wait for room, from recent insert latency
+}
+
+func (e *OverloadError) Error() string {
+	return fmt.Sprintf("cvector: %s of %d reached, retry after %v", e.Limit, e.Value, e.RetryAfter)
+}
+
+func (e *OverloadError) Unwrap() error {
+	return ErrOverloaded
+}
+
+// admission turns inserts away once the configured limits are reached
+// instead of letting callers pile up behind the engine
+type admission struct {
+	inflight  chan struct{} // Nil when MaxInflightInserts is unset
+	maxQueued int
+
+	latency  atomic.Int64 // Moving average of one engine insert, in nanoseconds
+	rejected atomic.Uint64
+}
+
+func newAdmission(maxInflight, maxQueued int) *admission {
+	a := &admission{maxQueued: maxQueued}
+	if maxInflight > 0 {
+		a.inflight = make(chan struct{}, maxInflight)
+	}
+	return a
+}
+
+// acquire takes an in-flight slot without waiting
+func (a *admission) acquire() error {
+	if a.inflight == nil {
+		return nil
+	}
+	select {
+	case a.inflight <- struct{}{}:
+		return nil
+	default:
+		return a.reject("MaxInflightInserts", cap(a.inflight), 1)
+	}
+}
+
+func (a *admission) release() {
+	if a.inflight != nil {
+		<-a.inflight
+	}
+}
+
+// observe folds one insert's duration into the moving average
+func (a *admission) observe(d time.Duration) {
+	for {
+		old := a.latency.Load()
+		next := int64(d)
+		if old != 0 {
+			next = old + (int64(d)-old)/8
+		}
+		if a.latency.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// reject counts a refused insert and estimates how long until ahead
+// inserts have drained
+func (a *admission) reject(limit string, value, ahead int) *OverloadError {
+	a.rejected.Add(1)
+	retry := time.Duration(a.latency.Load()) * time.Duration(ahead)
+	if retry < minRetryAfter {
+		retry = minRetryAfter
+	}
+	return &OverloadError{Limit: limit, Value: value, RetryAfter: retry}
+}
@@ -0,0 +1,168 @@
+package cvector
+
+import (
+	"math"
+	"sort"
+)
+
+// AggregateOp names what an Aggregation computes
+type AggregateOp string
+
+const (
+	AggregateMin AggregateOp = "min"
+	AggregateMax AggregateOp = "max"
+	AggregateAvg AggregateOp = "avg"
+	AggregateSum AggregateOp = "sum"
+	AggregateTop AggregateOp = "top" // The most common values, as in facets
+)
+
+// defaultAggregateTop is how many values AggregateTop returns when
+// Aggregation.N is zero
+const defaultAggregateTop = 10
+
+// Aggregation summarizes one metadata field over a set of vectors
+type Aggregation struct {
+	Field string
+	Op    AggregateOp
+	N     int // Values AggregateTop returns, zero meaning 10; others ignore it
+}
+
+// ValueCount is a metadata value and how many vectors hold it
+type ValueCount struct {
+	Value string
+	Count int
+}
+
+// AggregateResult is the outcome of one Aggregation. Min, max, avg and sum
+// consider numeric values only, and Value is zero when none were found.
+type AggregateResult struct {
+	Aggregation
+	Value float64      // Min, max, avg or sum
+	Count int          // Vectors holding a value the aggregation considered
+	Top   []ValueCount // For AggregateTop: most common first, ties by value
+}
+
+func (a Aggregation) valid() bool {
+	switch a.Op {
+	case AggregateMin, AggregateMax, AggregateAvg, AggregateSum, AggregateTop:
+		return a.Field != "" && a.N >= 0
+	}
+	return false
+}
+
+// Aggregate computes aggs over every vector query's filters admit, without
+// a search; query's vector and TopK are ignored, and a nil query covers the
+// whole database. An unknown Op, an empty Field or a negative N fails with
+// ErrInvalidArgs.
+func (db *DB) Aggregate(query *Query, aggs []Aggregation) ([]AggregateResult, error) {
+	if db.db == nil {
+		return nil, ErrInvalidArgs
+	}
+	if err := checkAggregations(aggs); err != nil {
+		return nil, err
+	}
+	if query == nil {
+		query = &Query{}
+	}
+	matched, err := db.matchingMetadata(query)
+	if err != nil {
+		return nil, err
+	}
+	return aggregate(aggs, matched), nil
+}
+
+// SearchAggregate performs a search and computes aggs over the results it
+// returns, such as the price range of the TopK matches
+func (db *DB) SearchAggregate(query *Query, aggs []Aggregation) ([]*Result, []AggregateResult, error) {
+	if err := checkAggregations(aggs); err != nil {
+		return nil, nil, err
+	}
+	results, err := db.Search(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	matched := make([]map[string]any, 0, len(results))
+	for _, r := range results {
+		matched = append(matched, db.meta.get(r.ID))
+	}
+	return results, aggregate(aggs, matched), nil
+}
+
+func checkAggregations(aggs []Aggregation) error {
+	for _, a := range aggs {
+		if !a.valid() {
+			return ErrInvalidArgs
+		}
+	}
+	return nil
+}
+
+// aggregate computes aggs over the metadata of the matched vectors
+func aggregate(aggs []Aggregation, matched []map[string]any) []AggregateResult {
+	out := make([]AggregateResult, len(aggs))
+	for i, a := range aggs {
+		out[i] = AggregateResult{Aggregation: a}
+		r := &out[i]
+		if a.Op == AggregateTop {
+			r.Top, r.Count = topValues(a.Field, a.N, matched)
+			continue
+		}
+
+		var sum float64
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, md := range matched {
+			key, _ := indexKey(md[a.Field])
+			x, ok := key.(float64)
+			if !ok {
+				continue
+			}
+			r.Count++
+			sum += x
+			lo, hi = min(lo, x), max(hi, x)
+		}
+		if r.Count == 0 {
+			continue
+		}
+		switch a.Op {
+		case AggregateMin:
+			r.Value = lo
+		case AggregateMax:
+			r.Value = hi
+		case AggregateAvg:
+			r.Value = sum / float64(r.Count)
+		case AggregateSum:
+			r.Value = sum
+		}
+	}
+	return out
+}
+
+// topValues returns the n most common values of field among the matched
+// vectors, and how many held one
+func topValues(field string, n int, matched []map[string]any) ([]ValueCount, int) {
+	if n == 0 {
+		n = defaultAggregateTop
+	}
+	counts := make(map[string]int)
+	total := 0
+	for _, md := range matched {
+		if value, ok := facetValue(md[field]); ok {
+			counts[value]++
+			total++
+		}
+	}
+	top := make([]ValueCount, 0, len(counts))
+	for value, count := range counts {
+		top = append(top, ValueCount{value, count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Value < top[j].Value
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top, total
+}
@@ -0,0 +1,213 @@
+package cvector
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// analyzeHistogramBuckets is the number of equal-width norm buckets
+	analyzeHistogramBuckets = 20
+
+	// analyzeIntrinsicSample caps the vectors used to estimate intrinsic
+	// dimensionality, which needs all pairwise distances within the sample
+	analyzeIntrinsicSample = 1000
+
+	// unitNormTolerance is how far a norm may be from 1 for the data to be
+	// reported as normalized
+	unitNormTolerance = 1e-3
+)
+
+// Analysis summarises how the stored vectors are distributed
+type Analysis struct {
+	Count     int
+	Dimension uint32
+
+	Norms      NormStats
+	Normalized bool // Every vector has unit length
+
+	// Per-dimension statistics, indexed by component
+	DimensionMeans     []float64
+	DimensionVariances []float64
+
+	// IntrinsicDimension is a TwoNN estimate of the dimensionality of the
+	// manifold the vectors lie on. Values far below Dimension suggest the
+	// data compresses well under PCA or quantization. Zero when there are
+	// too few distinct vectors to estimate.
+	IntrinsicDimension float64
+	IntrinsicSample    int // Vectors used for the estimate
+}
+
+// NormStats describes the distribution of vector L2 norms
+type NormStats struct {
+	Min       float64
+	Max       float64
+	Mean      float64
+	StdDev    float64
+	Histogram []HistogramBucket
+}
+
+// HistogramBucket counts values in [Low, High). The last bucket also
+// includes High.
+type HistogramBucket struct {
+	Low   float64
+	High  float64
+	Count int
+}
+
+// Analyze scans every vector and computes distribution statistics
+func (db *DB) Analyze() (*Analysis, error) {
+	stats, err := db.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	dim := int(stats.Dimension)
+	analysis := &Analysis{
+		Dimension:          stats.Dimension,
+		DimensionMeans:     make([]float64, dim),
+		DimensionVariances: make([]float64, dim),
+	}
+
+	// Welford's algorithm keeps the per-dimension variance numerically stable
+	m2 := make([]float64, dim)
+	var norms []float64
+	var sample [][]float32
+	stride := 1
+	if stats.TotalVectors > analyzeIntrinsicSample {
+		stride = (stats.TotalVectors + analyzeIntrinsicSample - 1) / analyzeIntrinsicSample
+	}
+
+	err = db.Iterate(func(v *Vector) error {
+		analysis.Count++
+		n := float64(analysis.Count)
+
+		var sumSquares float64
+		for i, x := range v.Data {
+			value := float64(x)
+			sumSquares += value * value
+
+			delta := value - analysis.DimensionMeans[i]
+			analysis.DimensionMeans[i] += delta / n
+			m2[i] += delta * (value - analysis.DimensionMeans[i])
+		}
+		norms = append(norms, math.Sqrt(sumSquares))
+
+		if (analysis.Count-1)%stride == 0 && len(sample) < analyzeIntrinsicSample {
+			sample = append(sample, v.Data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if analysis.Count == 0 {
+		return analysis, nil
+	}
+
+	for i := range m2 {
+		analysis.DimensionVariances[i] = m2[i] / float64(analysis.Count)
+	}
+
+	analysis.Norms = normStats(norms)
+	analysis.Normalized = math.Abs(analysis.Norms.Min-1) <= unitNormTolerance &&
+		math.Abs(analysis.Norms.Max-1) <= unitNormTolerance
+
+	analysis.IntrinsicDimension = twoNNDimension(sample)
+	analysis.IntrinsicSample = len(sample)
+
+	return analysis, nil
+}
+
+func normStats(norms []float64) NormStats {
+	stats := NormStats{Min: norms[0], Max: norms[0]}
+
+	var sum float64
+	for _, n := range norms {
+		stats.Min = math.Min(stats.Min, n)
+		stats.Max = math.Max(stats.Max, n)
+		sum += n
+	}
+	stats.Mean = sum / float64(len(norms))
+
+	var squares float64
+	for _, n := range norms {
+		squares += (n - stats.Mean) * (n - stats.Mean)
+	}
+	stats.StdDev = math.Sqrt(squares / float64(len(norms)))
+
+	width := (stats.Max - stats.Min) / analyzeHistogramBuckets
+	if width == 0 {
+		stats.Histogram = []HistogramBucket{{Low: stats.Min, High: stats.Max, Count: len(norms)}}
+		return stats
+	}
+
+	stats.Histogram = make([]HistogramBucket, analyzeHistogramBuckets)
+	for i := range stats.Histogram {
+		stats.Histogram[i].Low = stats.Min + float64(i)*width
+		stats.Histogram[i].High = stats.Min + float64(i+1)*width
+	}
+	stats.Histogram[analyzeHistogramBuckets-1].High = stats.Max
+	for _, n := range norms {
+		bucket := int((n - stats.Min) / width)
+		if bucket >= analyzeHistogramBuckets {
+			bucket = analyzeHistogramBuckets - 1
+		}
+		stats.Histogram[bucket].Count++
+	}
+
+	return stats
+}
+
+// twoNNDimension estimates intrinsic dimensionality from the ratio of each
+// point's second to first nearest-neighbor distance (Facco et al., 2017).
+// The ratios follow a Pareto distribution whose shape is the dimension, so
+// the maximum-likelihood estimate is N / sum(log(r2/r1)).
+func twoNNDimension(points [][]float32) float64 {
+	var logRatios []float64
+	for i, p := range points {
+		first, second := math.Inf(1), math.Inf(1)
+		for j, q := range points {
+			if i == j {
+				continue
+			}
+			d := euclideanDistance(p, q)
+			if d < first {
+				first, second = d, first
+			} else if d < second {
+				second = d
+			}
+		}
+		// Duplicates give a zero first distance and no usable ratio
+		if first > 0 && !math.IsInf(second, 1) {
+			logRatios = append(logRatios, math.Log(second/first))
+		}
+	}
+
+	if len(logRatios) < 2 {
+		return 0
+	}
+
+	// Discard the largest 10% of ratios, which come from outliers
+	sort.Float64s(logRatios)
+	logRatios = logRatios[:len(logRatios)-len(logRatios)/10]
+
+	var sum float64
+	for _, r := range logRatios {
+		sum += r
+	}
+	if sum == 0 {
+		return 0
+	}
+	return float64(len(logRatios)) / sum
+}
+
+func euclideanDistance(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i]) - float64(b[i])
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
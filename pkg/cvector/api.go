@@ -10,15 +10,18 @@ package cvector
 #include <time.h>
 
 // Wrapper functions to avoid CGO struct issues
-cvector_error_t create_db_wrapper(const char* name, const char* path, uint32_t dimension, cvector_db_t** db) {
+cvector_error_t create_db_wrapper(const char* name, const char* path, uint32_t dimension,
+                                  cvector_similarity_t similarity, bool memory_mapped, size_t max_vectors,
+                                  bool normalize_on_insert, cvector_db_t** db) {
     cvector_db_config_t config = {0};
 
     strncpy(config.name, name, CVECTOR_MAX_DB_NAME - 1);
     strncpy(config.data_path, path, CVECTOR_MAX_PATH - 1);
     config.dimension = dimension;
-    config.default_similarity = CVECTOR_SIMILARITY_COSINE;
-    config.memory_mapped = false;
-    config.max_vectors = 1000000;
+    config.default_similarity = similarity;
+    config.memory_mapped = memory_mapped;
+    config.max_vectors = max_vectors;
+    config.normalize_on_insert = normalize_on_insert;
 
     return cvector_db_create(&config, db);
 }
@@ -33,36 +36,137 @@ cvector_error_t insert_vector_wrapper(cvector_db_t* db, uint64_t id, uint32_t di
     return cvector_insert(db, &vector);
 }
 
+cvector_error_t update_vector_wrapper(cvector_db_t* db, uint64_t id, uint32_t dimension, float* data) {
+    cvector_t vector = {0};
+    vector.id = id;
+    vector.dimension = dimension;
+    vector.data = data;
+    vector.timestamp = (uint64_t)time(NULL);
+
+    return cvector_update(db, &vector);
+}
+
+cvector_error_t update_if_vector_wrapper(cvector_db_t* db, uint64_t id, uint32_t dimension, float* data,
+                                         uint32_t expected_version) {
+    cvector_t vector = {0};
+    vector.id = id;
+    vector.dimension = dimension;
+    vector.data = data;
+    vector.timestamp = (uint64_t)time(NULL);
+
+    return cvector_update_if(db, &vector, expected_version);
+}
+
 cvector_error_t search_wrapper(cvector_db_t* db, float* query_vector, uint32_t dimension, 
                               uint32_t top_k, cvector_similarity_t similarity, float min_similarity,
-                              cvector_result_t** results, size_t* result_count) {
+                              bool normalize, uint32_t ef_search, cvector_result_t** results,
+                              size_t* result_count, cvector_search_stats_t* stats) {
     cvector_query_t query = {0};
     query.query_vector = query_vector;
     query.dimension = dimension;
     query.top_k = top_k;
     query.similarity = similarity;
     query.min_similarity = min_similarity;
+    query.normalize = normalize;
+    query.ef_search = ef_search;
     
-    return cvector_search(db, &query, results, result_count);
+    return cvector_search_explain(db, &query, results, result_count, stats);
+}
+
+cvector_error_t search_radius_wrapper(cvector_db_t* db, float* query_vector, uint32_t dimension,
+                                     uint32_t limit, cvector_similarity_t similarity, float min_similarity,
+                                     bool normalize, cvector_result_t** results, size_t* result_count) {
+    cvector_query_t query = {0};
+    query.query_vector = query_vector;
+    query.dimension = dimension;
+    query.top_k = limit;
+    query.similarity = similarity;
+    query.min_similarity = min_similarity;
+    query.normalize = normalize;
+
+    return cvector_search_radius(db, &query, results, result_count);
 }
 */
 import "C"
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 	"unsafe"
 )
 
+// maxSearchTopK is the largest top_k the engine accepts. Oversampling is
+// capped there rather than failing the search.
+const maxSearchTopK = 10000
+
+// maxExactCandidates is the most vectors admitted by indexed filters, such
+// as Query.Tags or Query.Ranges, that a search scores directly instead of
+// searching the whole database and filtering the results
+const maxExactCandidates = 4096
+
+// filterOversample is how many candidates per result a search with
+// Query.DedupeBy, a time range, tag or metadata filters fetches at first
+const filterOversample = 4
+
 // DB represents a CVector database
 type DB struct {
-	db *C.cvector_db_t
+	db     *C.cvector_db_t
+	path   string
+	meta   *metaStore
+	logger *slog.Logger
+
+	versions *versionStore // Previous versions of updated vectors; nil without VersionHistory
+
+	auditLog   *auditLog
+	auditActor string
+
+	queryCounters queryCounters
+
+	dimension       uint32
+	dimensionPolicy DimensionPolicy
+	onConflict      ConflictPolicy
+	softDelete      bool          // Keep deleted vectors' metadata for Undelete
+	queryOverrides  QueryDefaults // Non-zero DBConfig defaults given at open
+
+	searchSlots chan struct{} // Bounds concurrent searches when SearchThreads is set
+	admission   *admission    // Insert limits, see MaxInflightInserts
+
+	hooks *hookChain // Added by Use; shared with the collector
+
+	syncMode SyncMode
+	syncer   *syncer // Background flusher for SyncInterval
+
+	writeBuffer *writeBuffer // Set when WriteBufferSize enables buffered inserts
+
+	collector *collector // Background compaction for the GC policy
+
+	indexBuilder *indexBuilder // Background index build for BackgroundIndex
+
+	pca *PCA // Projection applied to full-dimension inputs, see ReduceTo
+
+	embedder Embedder // Set by WithEmbedder for the text operations
 }
 
-// CreateDB creates a new vector database
+// CreateDB creates a new vector database. Invalid settings are reported as
+// a *ConfigError naming the offending field.
 func CreateDB(config *DBConfig) (*DB, error) {
 	if config == nil {
 		return nil, ErrInvalidArgs
 	}
+	logger := loggerOrDiscard(config.Logger)
+	if err := validateCreate(config); err != nil {
+		logger.Error("cvector create failed", "path", config.DataPath, "error", err)
+		return nil, err
+	}
 
 	cName := C.CString(config.Name)
 	defer C.free(unsafe.Pointer(cName))
@@ -71,49 +175,360 @@ func CreateDB(config *DBConfig) (*DB, error) {
 	defer C.free(unsafe.Pointer(cPath))
 
 	var cDB *C.cvector_db_t
-	result := C.create_db_wrapper(cName, cPath, C.uint32_t(config.Dimension), &cDB)
+	result := C.create_db_wrapper(cName, cPath, C.uint32_t(config.Dimension),
+		C.cvector_similarity_t(config.DefaultSimilarity), C.bool(config.MemoryMapped),
+		C.size_t(config.MaxVectors), C.bool(config.NormalizeOnInsert), &cDB)
 	
 	if result != 0 {
-		return nil, Error(result)
+		logger.Error("cvector create failed", "path", config.DataPath, "code", int(result), "error", Error(result).Error())
+		return nil, newOpError("create", config.DataPath, 0, Error(result))
 	}
 
-	db := &DB{db: cDB}
-	runtime.SetFinalizer(db, (*DB).Close)
+	// Sidecars left behind by an earlier database at this path are stale
+	os.Remove(metaPath(config.DataPath))
+	os.Remove(pcaPath(config.DataPath))
+	os.Remove(versionsPath(config.DataPath))
+
+	meta, err := openMetaStore(config.DataPath)
+	props := dbProperties{
+		Name:                 config.Name,
+		Description:          config.Description,
+		DefaultTopK:          config.DefaultTopK,
+		DefaultMinSimilarity: config.DefaultMinSimilarity,
+		DefaultOversample:    config.DefaultOversample,
+		EfSearch:             config.EfSearch,
+		Schema:               config.Schema.clone(),
+	}
+	if err == nil && props != (dbProperties{}) {
+		err = meta.setProperties(props)
+	}
+	if err != nil {
+		C.cvector_db_close(cDB)
+		return nil, err
+	}
+
+	db, err := newDB(cDB, config, meta, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("cvector database created", "path", config.DataPath, "dimension", config.Dimension,
+		"similarity", int(config.DefaultSimilarity), "max_vectors", config.MaxVectors)
 	
 	return db, nil
 }
 
-// OpenDB opens an existing vector database
+// OpenDB opens an existing vector database. The ANN index is loaded from
+// the <path>.hnsw file saved when the database was last closed, or rebuilt
+// from the vectors when that file is missing, out of date or was built
+// with different index parameters.
 func OpenDB(dbPath string) (*DB, error) {
-	cPath := C.CString(dbPath)
+	return OpenDBWithConfig(&DBConfig{DataPath: dbPath})
+}
+
+// OpenDBWithConfig opens the existing database at config.DataPath and applies
+// the runtime settings in config, such as Logger. Fields that are fixed when
+// a database is created, like Dimension, are read from the file instead.
+func OpenDBWithConfig(config *DBConfig) (*DB, error) {
+	if config == nil {
+		return nil, ErrInvalidArgs
+	}
+	logger := loggerOrDiscard(config.Logger)
+	start := time.Now()
+
+	cPath := C.CString(config.DataPath)
 	defer C.free(unsafe.Pointer(cPath))
 
+	var flags C.uint32_t
+	if config.ReadOnly {
+		flags |= C.CVECTOR_OPEN_READ_ONLY
+	}
+	if config.SkipCorruptRecords {
+		flags |= C.CVECTOR_OPEN_SKIP_CORRUPT
+	}
+	if config.BackgroundIndex {
+		flags |= C.CVECTOR_OPEN_DEFER_INDEX
+	}
+
 	var cDB *C.cvector_db_t
-	result := C.cvector_db_open(cPath, &cDB)
+	result := C.cvector_db_open_flags(cPath, flags, &cDB)
 	if result != 0 {
-		return nil, Error(result)
+		logger.Error("cvector open failed", "path", config.DataPath, "code", int(result), "error", Error(result).Error())
+		return nil, newOpError("open", config.DataPath, 0, Error(result))
 	}
 
-	db := &DB{db: cDB}
-	runtime.SetFinalizer(db, (*DB).Close)
+	meta, err := openMetaStore(config.DataPath)
+	if err != nil {
+		logger.Error("cvector metadata load failed", "path", metaPath(config.DataPath), "error", err)
+		C.cvector_db_close(cDB)
+		return nil, err
+	}
+	meta.readOnly = config.ReadOnly
+
+	pca, err := loadPCA(config.DataPath)
+	if err != nil {
+		logger.Error("cvector projection load failed", "path", pcaPath(config.DataPath), "error", err)
+		C.cvector_db_close(cDB)
+		return nil, err
+	}
+
+	db, err := newDB(cDB, config, meta, logger)
+	if err != nil {
+		return nil, err
+	}
+	db.pca = pca
+
+	if logger.Enabled(context.Background(), slog.LevelInfo) {
+		var cStats C.cvector_db_stats_t
+		if C.cvector_db_stats(cDB, &cStats) == 0 {
+			logger.Info("cvector database opened", "path", config.DataPath,
+				"vectors", int(cStats.total_vectors), "deleted", int(cStats.deleted_vectors),
+				"dimension", uint32(cStats.dimension), "index_loaded", bool(cStats.index_loaded),
+				"duration", time.Since(start))
+		}
+	}
 	
 	return db, nil
 }
 
+// OpenOrCreate opens the database at config.DataPath, creating it from
+// config if no file exists. An existing database must match the configured
+// Dimension and DefaultSimilarity; a mismatch returns an error wrapping
+// ErrDimensionMismatch or ErrInvalidArgs rather than silently opening a
+// database the caller did not ask for.
+func OpenOrCreate(config *DBConfig) (*DB, error) {
+	if config == nil {
+		return nil, ErrInvalidArgs
+	}
+
+	db, err := OpenDBWithConfig(config)
+	if errors.Is(err, ErrDBNotFound) {
+		db, err = CreateDB(config)
+		switch {
+		case errors.Is(err, ErrFileIO) && fileExists(config.DataPath):
+			// Another process created it first
+			db, err = OpenDBWithConfig(config)
+		case err == nil && config.ReadOnly:
+			if err := db.Close(); err != nil {
+				return nil, err
+			}
+			db, err = OpenDBWithConfig(config)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if config.Dimension != 0 && stats.Dimension != config.Dimension {
+		db.Close()
+		return nil, fmt.Errorf("%w: %s has dimension %d, config wants %d",
+			ErrDimensionMismatch, config.DataPath, stats.Dimension, config.Dimension)
+	}
+	if stats.DefaultSimilarity != config.DefaultSimilarity {
+		db.Close()
+		return nil, fmt.Errorf("%w: %s uses %v similarity, config wants %v",
+			ErrInvalidArgs, config.DataPath, stats.DefaultSimilarity, config.DefaultSimilarity)
+	}
+	return db, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// newDB wraps an open engine handle, attaching the runtime settings from
+// config. The handle is closed if any of them fail to initialise.
+func newDB(cDB *C.cvector_db_t, config *DBConfig, meta *metaStore, logger *slog.Logger) (*DB, error) {
+	db := &DB{db: cDB, path: config.DataPath, meta: meta, logger: logger, auditActor: config.AuditActor,
+		dimensionPolicy: config.DimensionPolicy, onConflict: config.OnConflict, softDelete: config.SoftDelete,
+		queryOverrides: QueryDefaults{config.DefaultTopK, config.DefaultMinSimilarity, config.DefaultOversample}}
+	db.queryCounters.reset()
+
+	var cStats C.cvector_db_stats_t
+	if result := C.cvector_db_stats(cDB, &cStats); result != 0 {
+		meta.close()
+		C.cvector_db_close(cDB)
+		return nil, newOpError("stats", config.DataPath, 0, Error(result))
+	}
+	db.dimension = uint32(cStats.dimension)
+
+	if config.SearchThreads > 0 {
+		db.searchSlots = make(chan struct{}, config.SearchThreads)
+	}
+	db.admission = newAdmission(config.MaxInflightInserts, config.MaxQueuedInserts)
+	db.hooks = &hookChain{}
+
+	if config.VersionHistory > 0 {
+		versions, err := openVersionStore(config.DataPath, config.VersionHistory, config.ReadOnly)
+		if err != nil {
+			logger.Error("cvector version history load failed", "path", versionsPath(config.DataPath), "error", err)
+			meta.close()
+			C.cvector_db_close(cDB)
+			return nil, err
+		}
+		db.versions = versions
+	}
+
+	if config.MaxSizeBytes > 0 {
+		if result := C.cvector_set_max_size(cDB, C.uint64_t(config.MaxSizeBytes)); result != 0 {
+			meta.close()
+			C.cvector_db_close(cDB)
+			return nil, newOpError("set_max_size", config.DataPath, 0, Error(result))
+		}
+	}
+	if config.CacheBytes > 0 {
+		if result := C.cvector_set_cache_size(cDB, C.size_t(config.CacheBytes)); result != 0 {
+			meta.close()
+			C.cvector_db_close(cDB)
+			return nil, newOpError("set_cache_size", config.DataPath, 0, Error(result))
+		}
+	}
+	// An ef given at open overrides the one stored with the database
+	efSearch := config.EfSearch
+	if efSearch == 0 {
+		efSearch = meta.properties().EfSearch
+	}
+	if efSearch > 0 {
+		if result := C.cvector_set_ef_search(cDB, C.uint32_t(efSearch)); result != 0 {
+			meta.close()
+			C.cvector_db_close(cDB)
+			return nil, newOpError("set_ef_search", config.DataPath, 0, Error(result))
+		}
+	}
+	if config.BlockCacheBytes > 0 {
+		if result := C.cvector_set_block_cache_size(cDB, C.size_t(config.BlockCacheBytes)); result != 0 {
+			meta.close()
+			C.cvector_db_close(cDB)
+			return nil, newOpError("set_block_cache_size", config.DataPath, 0, Error(result))
+		}
+	}
+
+	if config.AuditLogPath != "" && !config.ReadOnly {
+		audit, err := openAuditLog(config.AuditLogPath)
+		if err != nil {
+			logger.Error("cvector audit log open failed", "path", config.AuditLogPath, "error", err)
+			meta.close()
+			C.cvector_db_close(cDB)
+			return nil, err
+		}
+		db.auditLog = audit
+	}
+
+	db.syncMode = config.SyncMode
+	meta.syncWrites = config.SyncMode == SyncAlways
+	if config.SyncMode == SyncInterval && !config.ReadOnly {
+		interval := config.SyncInterval
+		if interval <= 0 {
+			interval = defaultSyncInterval
+		}
+		// The syncer holds the handles rather than db so the finalizer
+		// can still run for a DB that is never closed
+		path, audit := config.DataPath, db.auditLog
+		db.syncer = startSyncer(interval, logger, func() error {
+			return flushFiles(cDB, path, meta, audit)
+		})
+	}
+
+	if (config.GCDeadRatio > 0 || config.GCMaxAge > 0) && !config.ReadOnly {
+		db.collector = startCollector(cDB, config.DataPath, meta, logger, db.hooks, config.GCDeadRatio, config.GCMaxAge)
+	}
+
+	if cStats.index_building {
+		db.indexBuilder = startIndexBuilder(cDB, config.DataPath, logger)
+	}
+
+	if config.WriteBufferSize > 0 && !config.ReadOnly {
+		// The buffer's goroutine references db, so a buffered DB is only
+		// released by Close, never by the finalizer
+		db.writeBuffer = startWriteBuffer(db, config.WriteBufferSize, config.WriteBufferDelay)
+	}
+
+	runtime.SetFinalizer(db, (*DB).Close)
+	return db, nil
+}
+
 // Close closes the database
 func (db *DB) Close() error {
 	if db.db == nil {
 		return nil
 	}
 
+	var bufferErr error
+	if db.writeBuffer != nil {
+		bufferErr = db.writeBuffer.close()
+		db.writeBuffer = nil
+	}
+	if db.collector != nil {
+		db.collector.stop()
+		db.collector = nil
+	}
+	if db.indexBuilder != nil {
+		db.indexBuilder.stop()
+		db.indexBuilder = nil
+	}
+	if db.syncer != nil {
+		db.syncer.stop()
+		db.syncer = nil
+	}
+
 	result := C.cvector_db_close(db.db)
 	db.db = nil
 	runtime.SetFinalizer(db, nil)
+
+	metaErr := db.meta.close()
+	if metaErr != nil {
+		db.logger.Error("cvector metadata compaction failed", "path", metaPath(db.path), "error", metaErr)
+	}
+	if db.versions != nil {
+		if err := db.versions.close(); err != nil {
+			db.logger.Error("cvector version history compaction failed", "path", versionsPath(db.path), "error", err)
+			if metaErr == nil {
+				metaErr = err
+			}
+		}
+		db.versions = nil
+	}
+	if db.auditLog != nil {
+		if err := db.auditLog.close(); err != nil && metaErr == nil {
+			metaErr = err
+		}
+		db.auditLog = nil
+	}
 	
 	if result != 0 {
-		return Error(result)
+		return db.engineError("close", Error(result))
 	}
-	return nil
+	db.logger.Info("cvector database closed", "path", db.path)
+	if bufferErr != nil {
+		return bufferErr
+	}
+	return metaErr
+}
+
+// Refresh reloads a read-only database from its files, picking up the
+// vectors and metadata a writer has flushed since it was opened or last
+// refreshed. Until then a read-only handle keeps seeing the database as it
+// was, even across the writer's compactions, so one writer and any number
+// of reader processes can share a file. It does nothing on a writable
+// database, which is always current.
+func (db *DB) Refresh() error {
+	if db.db == nil {
+		return ErrInvalidArgs
+	}
+	if !db.meta.readOnly {
+		return nil
+	}
+
+	if result := C.cvector_db_refresh(db.db); result != 0 {
+		return db.engineError("refresh", Error(result))
+	}
+	return db.meta.reload()
 }
 
 // DropDB removes a database file
@@ -123,22 +538,97 @@ func DropDB(dbPath string) error {
 
 	result := C.cvector_db_drop(cPath)
 	if result != 0 {
-		return Error(result)
+		return newOpError("drop", dbPath, 0, Error(result))
+	}
+
+	for _, sidecar := range []string{metaPath(dbPath), pcaPath(dbPath), versionsPath(dbPath)} {
+		if err := os.Remove(sidecar); err != nil && !os.IsNotExist(err) {
+			return ErrFileIO
+		}
 	}
 	return nil
 }
 
-// Insert adds a vector to the database
+// Insert adds a vector to the database. Inserting an ID that is already
+// stored is resolved by DBConfig.OnConflict.
 func (db *DB) Insert(vector *Vector) error {
+	return db.InsertAs(db.auditActor, vector)
+}
+
+// InsertAs adds a vector to the database, recording actor as the caller
+// responsible in the audit log.
+//
+// With DBConfig.WriteBufferSize set, the vector is validated and queued
+// instead, and InsertAs returns before it is stored. Failures of queued
+// inserts are logged and returned by the next Flush or Close.
+//
+// Past DBConfig.MaxInflightInserts or MaxQueuedInserts it returns an
+// *OverloadError without storing the vector.
+func (db *DB) InsertAs(actor string, vector *Vector) error {
+	call := &Call{Op: HookInsert, Actor: actor, Vector: vector}
+	return db.hooks.run(call, func() error { return db.submit(call.Actor, call.Vector) })
+}
+
+// submit queues or applies an insert that has passed the hooks
+func (db *DB) submit(actor string, vector *Vector) error {
+	if db.writeBuffer != nil && db.db != nil {
+		if vector == nil || len(vector.Data) == 0 {
+			return ErrInvalidArgs
+		}
+		if err := validateVectorData(vector.Data); err != nil {
+			return err
+		}
+		if err := db.meta.validate(vector.ID, vector.Metadata); err != nil {
+			return err
+		}
+		queued := *vector
+		queued.Data = append([]float32(nil), vector.Data...)
+		queued.Metadata = copyMetadata(vector.Metadata)
+		queued.Tags = slices.Clone(vector.Tags)
+		if pending, ok := db.writeBuffer.enqueue(actor, &queued, db.admission.maxQueued); !ok {
+			return db.admission.reject("MaxQueuedInserts", db.admission.maxQueued, pending-db.admission.maxQueued+1)
+		}
+		return nil
+	}
+
+	if err := db.admission.acquire(); err != nil {
+		return err
+	}
+	start := time.Now()
+	err := db.insert(actor, vector)
+	db.admission.observe(time.Since(start))
+	db.admission.release()
+	if err != nil {
+		return err
+	}
+	return db.syncWrite()
+}
+
+func (db *DB) insert(actor string, vector *Vector) error {
 	if db.db == nil {
 		return ErrInvalidArgs
 	}
 	if vector == nil || len(vector.Data) == 0 {
 		return ErrInvalidArgs
 	}
+	if err := validateVectorData(vector.Data); err != nil {
+		return err
+	}
+	if err := db.meta.validate(vector.ID, vector.Metadata); err != nil {
+		return err
+	}
+
+	data, err := db.conform(vector.Data)
+	if err != nil {
+		return err
+	}
+	dimension := vector.Dimension
+	if len(data) != len(vector.Data) {
+		dimension = uint32(len(data))
+	}
 
 	// Allocate C array for vector data
-	dataSize := len(vector.Data)
+	dataSize := len(data)
 	cData := (*C.float)(C.malloc(C.size_t(dataSize * 4))) // 4 bytes per float32
 	if cData == nil {
 		return ErrOutOfMemory
@@ -147,16 +637,48 @@ func (db *DB) Insert(vector *Vector) error {
 
 	// Copy data using slice header manipulation  
 	cDataSlice := (*[1 << 20]C.float)(unsafe.Pointer(cData))[:dataSize:dataSize]
-	for i, v := range vector.Data {
+	for i, v := range data {
 		cDataSlice[i] = C.float(v)
 	}
 
 	// Use wrapper function instead of creating struct in Go
-	result := C.insert_vector_wrapper(db.db, C.uint64_t(vector.ID), C.uint32_t(vector.Dimension), cData)
+	result := C.insert_vector_wrapper(db.db, C.uint64_t(vector.ID), C.uint32_t(dimension), cData)
+	if Error(result) == ErrDuplicateID {
+		switch db.onConflict {
+		case ConflictIgnore:
+			return nil
+		case ConflictOverwrite:
+			previous := db.previousVersion(vector.ID)
+			result = C.update_vector_wrapper(db.db, C.uint64_t(vector.ID), C.uint32_t(dimension), cData)
+			if result != 0 {
+				return db.engineError("update", Error(result), "id", vector.ID)
+			}
+			db.collectGarbage()
+			if err := db.retainVersion(previous); err != nil {
+				return err
+			}
+			if err := db.meta.put(vector.ID, vector.Metadata, vector.Tags); err != nil {
+				return err
+			}
+			return db.audit(actor, AuditUpdate, vector.ID, dimension)
+		}
+	}
 	if result != 0 {
-		return Error(result)
+		return db.engineError("insert", Error(result), "id", vector.ID)
 	}
-	return nil
+
+	// A fresh insert starts the versions over, so earlier history is moot
+	if db.versions != nil {
+		if err := db.versions.forget(vector.ID); err != nil {
+			return err
+		}
+	}
+	if len(vector.Metadata) > 0 || len(vector.Tags) > 0 {
+		if err := db.meta.put(vector.ID, vector.Metadata, vector.Tags); err != nil {
+			return err
+		}
+	}
+	return db.audit(actor, AuditInsert, vector.ID, dimension)
 }
 
 // Get retrieves a vector by ID
@@ -168,15 +690,36 @@ func (db *DB) Get(id uint64) (*Vector, error) {
 	var cVector *C.cvector_t
 	result := C.cvector_get(db.db, C.cvector_id_t(id), &cVector)
 	if result != 0 {
-		return nil, Error(result)
+		return nil, db.engineError("get", Error(result), "id", id)
+	}
+	defer C.cvector_free_vector(cVector)
+
+	vector := vectorFromC(cVector)
+	vector.Metadata = db.meta.get(id)
+	vector.Tags = db.meta.getTags(id)
+	return vector, nil
+}
+
+// getData returns the stored data of vector id, skipping the metadata and
+// tag lookups of Get
+func (db *DB) getData(id uint64) ([]float32, error) {
+	var cVector *C.cvector_t
+	result := C.cvector_get(db.db, C.cvector_id_t(id), &cVector)
+	if result != 0 {
+		return nil, db.engineError("get", Error(result), "id", id)
 	}
 	defer C.cvector_free_vector(cVector)
 
-	// Convert C vector to Go vector
+	return vectorFromC(cVector).Data, nil
+}
+
+// vectorFromC copies a C vector into Go memory
+func vectorFromC(cVector *C.cvector_t) *Vector {
 	vector := &Vector{
 		ID:        uint64(cVector.id),
 		Dimension: uint32(cVector.dimension),
 		Timestamp: time.Unix(int64(cVector.timestamp), 0),
+		Version:   uint32(cVector.version),
 	}
 
 	// Copy vector data safely
@@ -188,106 +731,1190 @@ func (db *DB) Get(id uint64) (*Vector, error) {
 			vector.Data[i] = float32(v)
 		}
 	}
-
-	return vector, nil
+	return vector
 }
 
 // Delete removes a vector by ID
 func (db *DB) Delete(id uint64) error {
+	return db.DeleteAs(db.auditActor, id)
+}
+
+// DeleteAs removes a vector by ID, recording actor as the caller responsible
+// in the audit log
+func (db *DB) DeleteAs(actor string, id uint64) error {
+	call := &Call{Op: HookDelete, Actor: actor, ID: id}
+	return db.hooks.run(call, func() error {
+		// Apply buffered inserts first so a delete never overtakes them
+		if db.writeBuffer != nil {
+			if err := db.writeBuffer.drain(); err != nil {
+				return err
+			}
+		}
+		if err := db.delete(call.Actor, call.ID); err != nil {
+			return err
+		}
+		return db.syncWrite()
+	})
+}
+
+func (db *DB) delete(actor string, id uint64) error {
 	if db.db == nil {
 		return ErrInvalidArgs
 	}
 
 	result := C.cvector_delete(db.db, C.cvector_id_t(id))
 	if result != 0 {
-		return Error(result)
+		return db.engineError("delete", Error(result), "id", id)
 	}
-	return nil
+	db.collectGarbage()
+	if err := db.forgetMetadata(id); err != nil {
+		return err
+	}
+	return db.audit(actor, AuditDelete, id, 0)
 }
 
-// Stats returns database statistics
-func (db *DB) Stats() (*Stats, error) {
+// forgetMetadata drops the metadata of a deleted vector, or sets it aside
+// for Undelete when SoftDelete is set
+func (db *DB) forgetMetadata(id uint64) error {
+	if db.softDelete {
+		return db.meta.moveToTrash(id)
+	}
+	return db.meta.remove(id)
+}
+
+// Undelete restores vector id as it was when last deleted, with its
+// version and timestamp, and with its metadata if it was deleted through a
+// handle opened with SoftDelete. Deleted records remain restorable until
+// the next compaction, after which Undelete fails with ErrVectorNotFound.
+// It fails with ErrDuplicateID if the ID has been inserted again.
+func (db *DB) Undelete(id uint64) error {
 	if db.db == nil {
-		return nil, ErrInvalidArgs
+		return ErrInvalidArgs
+	}
+	if db.writeBuffer != nil {
+		if err := db.writeBuffer.drain(); err != nil {
+			return err
+		}
 	}
 
-	var cStats C.cvector_db_stats_t
-	result := C.cvector_db_stats(db.db, &cStats)
+	result := C.cvector_undelete(db.db, C.cvector_id_t(id))
 	if result != 0 {
-		return nil, Error(result)
+		return db.engineError("undelete", Error(result), "id", id)
 	}
-
-	stats := &Stats{
-		TotalVectors:      int(cStats.total_vectors),
-		TotalSizeBytes:    int(cStats.total_size_bytes),
-		Dimension:         uint32(cStats.dimension),
-		DefaultSimilarity: SimilarityType(cStats.default_similarity),
-		DBPath:            C.GoString(&cStats.db_path[0]),
+	if err := db.meta.restore(id); err != nil {
+		return err
 	}
+	if err := db.audit(db.auditActor, AuditUndelete, id, 0); err != nil {
+		return err
+	}
+	return db.syncWrite()
+}
 
-	return stats, nil
+// UpdateIf replaces the data of vector id, keeping its metadata, only if
+// the stored vector is still at expectedVersion, the Version returned by
+// Get. Otherwise it fails with ErrVersionConflict and changes nothing, so
+// a writer that read, modified and wrote back a vector can tell another
+// writer got there first and retry from a fresh Get. Versions start at 1
+// on insert and a vector that is deleted and inserted again starts over.
+func (db *DB) UpdateIf(id uint64, expectedVersion uint32, data []float32) error {
+	call := &Call{Op: HookInsert, Actor: db.auditActor, Vector: NewVector(id, data)}
+	return db.hooks.run(call, func() error {
+		// Buffered inserts may create or replace this vector
+		if db.writeBuffer != nil {
+			if err := db.writeBuffer.drain(); err != nil {
+				return err
+			}
+		}
+		if err := db.updateIf(call.Actor, call.Vector.ID, expectedVersion, call.Vector.Data); err != nil {
+			return err
+		}
+		return db.syncWrite()
+	})
 }
 
-// Search performs a similarity search on the database
-func (db *DB) Search(query *Query) ([]*Result, error) {
-	if db.db == nil {
-		return nil, ErrInvalidArgs
+func (db *DB) updateIf(actor string, id uint64, expectedVersion uint32, data []float32) error {
+	if db.db == nil || len(data) == 0 {
+		return ErrInvalidArgs
 	}
-	if query == nil || len(query.QueryVector) == 0 {
-		return nil, ErrInvalidArgs
+	if err := validateVectorData(data); err != nil {
+		return err
+	}
+	data, err := db.conform(data)
+	if err != nil {
+		return err
 	}
 
-	// Allocate C array for query vector
-	dataSize := len(query.QueryVector)
-	cData := (*C.float)(C.malloc(C.size_t(dataSize * 4))) // 4 bytes per float32
+	cData := (*C.float)(C.malloc(C.size_t(len(data) * 4)))
 	if cData == nil {
-		return nil, ErrOutOfMemory
+		return ErrOutOfMemory
 	}
 	defer C.free(unsafe.Pointer(cData))
-
-	// Copy query vector data
-	cDataSlice := (*[1 << 20]C.float)(unsafe.Pointer(cData))[:dataSize:dataSize]
-	for i, v := range query.QueryVector {
+	cDataSlice := unsafe.Slice(cData, len(data))
+	for i, v := range data {
 		cDataSlice[i] = C.float(v)
 	}
 
-	// Perform search
-	var cResults *C.cvector_result_t
-	var resultCount C.size_t
-	
-	result := C.search_wrapper(
-		db.db,
-		cData,
-		C.uint32_t(len(query.QueryVector)),
-		C.uint32_t(query.TopK),
-		C.cvector_similarity_t(query.Similarity),
-		C.float(query.MinSimilarity),
-		&cResults,
-		&resultCount,
-	)
-	
+	previous := db.previousVersion(id)
+	result := C.update_if_vector_wrapper(db.db, C.uint64_t(id), C.uint32_t(len(data)), cData, C.uint32_t(expectedVersion))
 	if result != 0 {
-		return nil, Error(result)
+		return db.engineError("update", Error(result), "id", id, "version", expectedVersion)
 	}
-
-	if resultCount == 0 || cResults == nil {
-		return []*Result{}, nil
+	db.collectGarbage()
+	if err := db.retainVersion(previous); err != nil {
+		return err
 	}
-	defer C.cvector_free_results(cResults, resultCount)
+	return db.audit(actor, AuditUpdate, id, uint32(len(data)))
+}
 
-	// Convert C results to Go results
-	results := make([]*Result, int(resultCount))
-	cResultsSlice := (*[1 << 20]C.cvector_result_t)(unsafe.Pointer(cResults))[:int(resultCount):int(resultCount)]
-	
-	for i, cResult := range cResultsSlice {
-		results[i] = &Result{
-			ID:         uint64(cResult.id),
-			Similarity: float32(cResult.similarity),
-			Vector:     nil, // Vector data not loaded by default
+// DeleteIf removes vector id only if it is still at expectedVersion,
+// failing with ErrVersionConflict otherwise. See UpdateIf.
+func (db *DB) DeleteIf(id uint64, expectedVersion uint32) error {
+	call := &Call{Op: HookDelete, Actor: db.auditActor, ID: id}
+	return db.hooks.run(call, func() error {
+		if db.writeBuffer != nil {
+			if err := db.writeBuffer.drain(); err != nil {
+				return err
+			}
+		}
+		if db.db == nil {
+			return ErrInvalidArgs
+		}
+		result := C.cvector_delete_if(db.db, C.cvector_id_t(call.ID), C.uint32_t(expectedVersion))
+		if result != 0 {
+			return db.engineError("delete", Error(result), "id", call.ID, "version", expectedVersion)
+		}
+		db.collectGarbage()
+		if err := db.forgetMetadata(call.ID); err != nil {
+			return err
 		}
+		if err := db.audit(call.Actor, AuditDelete, call.ID, 0); err != nil {
+			return err
+		}
+		return db.syncWrite()
+	})
+}
+
+// Rename changes the database name recorded at creation
+func (db *DB) Rename(name string) error {
+	if db.db == nil || name == "" || len(name) >= C.CVECTOR_MAX_DB_NAME {
+		return ErrInvalidArgs
 	}
 
-	return results, nil
+	props := db.meta.properties()
+	props.Name = name
+	return db.meta.setProperties(props)
+}
+
+// SetDescription replaces the free-form database description
+func (db *DB) SetDescription(description string) error {
+	if db.db == nil {
+		return ErrInvalidArgs
+	}
+
+	props := db.meta.properties()
+	props.Description = description
+	return db.meta.setProperties(props)
+}
+
+// QueryDefaults returns the values Search uses for Query fields left zero:
+// those given when the database was opened, falling back to the stored ones
+func (db *DB) QueryDefaults() QueryDefaults {
+	props := db.meta.properties()
+	d := QueryDefaults{props.DefaultTopK, props.DefaultMinSimilarity, props.DefaultOversample}
+	if db.queryOverrides.TopK != 0 {
+		d.TopK = db.queryOverrides.TopK
+	}
+	if db.queryOverrides.MinSimilarity != 0 {
+		d.MinSimilarity = db.queryOverrides.MinSimilarity
+	}
+	if db.queryOverrides.Oversample != 0 {
+		d.Oversample = db.queryOverrides.Oversample
+	}
+	return d
+}
+
+// SetQueryDefaults stores new defaults for Query fields with the database.
+// Overrides given when this handle was opened still take precedence.
+func (db *DB) SetQueryDefaults(d QueryDefaults) error {
+	if db.db == nil || d.MinSimilarity < -1 || d.MinSimilarity > 1 || d.Oversample < 0 {
+		return ErrInvalidArgs
+	}
+
+	props := db.meta.properties()
+	props.DefaultTopK = d.TopK
+	props.DefaultMinSimilarity = d.MinSimilarity
+	props.DefaultOversample = d.Oversample
+	return db.meta.setProperties(props)
+}
+
+// Describe returns storage-level details about the record for id. Unlike
+// Get it also reports deleted records that are still present in the file.
+func (db *DB) Describe(id uint64) (*RecordInfo, error) {
+	if db.db == nil {
+		return nil, ErrInvalidArgs
+	}
+
+	var cInfo C.cvector_record_info_t
+	result := C.cvector_describe(db.db, C.cvector_id_t(id), &cInfo)
+	if result != 0 {
+		return nil, db.engineError("describe", Error(result), "id", id)
+	}
+
+	return &RecordInfo{
+		ID:            uint64(cInfo.id),
+		Offset:        int64(cInfo.file_offset),
+		Length:        int(cInfo.record_length),
+		Dimension:     uint32(cInfo.dimension),
+		Timestamp:     time.Unix(int64(cInfo.timestamp), 0),
+		Deleted:       bool(cInfo.is_deleted),
+		Version:       uint32(cInfo.version),
+		Checksum:      uint32(cInfo.checksum),
+		FormatVersion: uint32(cInfo.format_version),
+	}, nil
+}
+
+// IDs returns the IDs of all stored vectors in ascending order
+func (db *DB) IDs() ([]uint64, error) {
+	if db.db == nil {
+		return nil, ErrInvalidArgs
+	}
+
+	var cIDs *C.cvector_id_t
+	var count C.size_t
+	result := C.cvector_list_ids(db.db, &cIDs, &count)
+	if result != 0 {
+		return nil, db.engineError("list_ids", Error(result))
+	}
+	if count == 0 || cIDs == nil {
+		return []uint64{}, nil
+	}
+	defer C.cvector_free_ids(cIDs)
+
+	ids := make([]uint64, int(count))
+	cIDSlice := unsafe.Slice(cIDs, int(count))
+	for i, id := range cIDSlice {
+		ids[i] = uint64(id)
+	}
+
+	return ids, nil
+}
+
+// contains reports whether id is a live vector without reading its data
+func (db *DB) contains(id uint64) bool {
+	return bool(C.cvector_contains(db.db, C.cvector_id_t(id)))
+}
+
+// GetByTimeRange returns the vectors whose Timestamp is at or after from and
+// before to, oldest first and then by ID, such as everything written since
+// a consumer last looked. A zero from or to leaves that end open.
+// Timestamps have one second precision.
+func (db *DB) GetByTimeRange(from, to time.Time) ([]*Vector, error) {
+	ids, err := db.idsByTime(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make([]*Vector, 0, len(ids))
+	for _, id := range ids {
+		v, err := db.Get(id)
+		if errors.Is(err, ErrVectorNotFound) {
+			continue // Deleted since it was listed
+		}
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
+
+// idsByTime lists the vectors written in [from, to), oldest first
+func (db *DB) idsByTime(from, to time.Time) ([]uint64, error) {
+	if db.db == nil {
+		return nil, ErrInvalidArgs
+	}
+
+	// Stored timestamps are whole seconds, so rounding both bounds up keeps
+	// the comparisons exact
+	var cFrom, cTo C.uint64_t
+	if !from.IsZero() {
+		cFrom = C.uint64_t(max(ceilUnix(from), 0))
+	}
+	if !to.IsZero() {
+		if ceilUnix(to) <= 0 {
+			return []uint64{}, nil
+		}
+		cTo = C.uint64_t(ceilUnix(to))
+	}
+
+	var cIDs *C.cvector_id_t
+	var count C.size_t
+	result := C.cvector_list_ids_by_time(db.db, cFrom, cTo, &cIDs, &count)
+	if result != 0 {
+		return nil, db.engineError("list_ids_by_time", Error(result))
+	}
+	if count == 0 || cIDs == nil {
+		return []uint64{}, nil
+	}
+	defer C.cvector_free_ids(cIDs)
+
+	ids := make([]uint64, int(count))
+	for i, id := range unsafe.Slice(cIDs, int(count)) {
+		ids[i] = uint64(id)
+	}
+	return ids, nil
+}
+
+func ceilUnix(t time.Time) int64 {
+	if t.Nanosecond() > 0 {
+		return t.Unix() + 1
+	}
+	return t.Unix()
+}
+
+// List returns up to limit vectors ordered by ID, skipping the first offset.
+// A limit of zero or less returns everything after offset.
+func (db *DB) List(offset, limit int) ([]*Vector, error) {
+	if offset < 0 {
+		return nil, ErrInvalidArgs
+	}
+
+	ids, err := db.IDs()
+	if err != nil {
+		return nil, err
+	}
+
+	if offset >= len(ids) {
+		return []*Vector{}, nil
+	}
+	ids = ids[offset:]
+	if limit > 0 && limit < len(ids) {
+		ids = ids[:limit]
+	}
+
+	vectors := make([]*Vector, 0, len(ids))
+	for _, id := range ids {
+		vector, err := db.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, vector)
+	}
+
+	return vectors, nil
+}
+
+// Stats returns database statistics
+func (db *DB) Stats() (*Stats, error) {
+	if db.db == nil {
+		return nil, ErrInvalidArgs
+	}
+
+	var cStats C.cvector_db_stats_t
+	result := C.cvector_db_stats(db.db, &cStats)
+	if result != 0 {
+		return nil, db.engineError("stats", Error(result))
+	}
+
+	props := db.meta.properties()
+	stats := &Stats{
+		Name:              props.Name,
+		Description:       props.Description,
+		TotalVectors:      int(cStats.total_vectors),
+		TotalSizeBytes:    int(cStats.total_size_bytes),
+		Dimension:         uint32(cStats.dimension),
+		DefaultSimilarity: SimilarityType(cStats.default_similarity),
+		DBPath:            C.GoString(&cStats.db_path[0]),
+		DeletedVectors:    int(cStats.deleted_vectors),
+		UnreadableRecords: int(cStats.unreadable_records),
+		ReclaimableBytes:  int(cStats.reclaimable_bytes),
+		Fragmentation:     float64(cStats.fragmentation),
+		DeadRatio:         deadRatio(int(cStats.total_vectors), int(cStats.deleted_vectors)),
+		IndexType:         "none",
+		IndexStatus:       IndexStatusNone,
+		IndexedVectors:    int(cStats.indexed_vectors),
+		MemoryMapped:      bool(cStats.memory_mapped),
+		NormalizeOnInsert: bool(cStats.normalize_on_insert),
+		MaxVectors:        int(cStats.max_vectors),
+		MaxSizeBytes:      int64(cStats.max_size_bytes),
+		NextID:            uint64(cStats.next_id),
+		CacheCapacity:     int(cStats.cache_capacity_bytes),
+		CacheBytes:        int(cStats.cache_used_bytes),
+		CacheEntries:      int(cStats.cache_entries),
+		CacheHits:         uint64(cStats.cache_hits),
+		CacheMisses:       uint64(cStats.cache_misses),
+
+		BlockCacheCapacity: int(cStats.block_cache_capacity_bytes),
+		BlockCacheBytes:    int(cStats.block_cache_used_bytes),
+		BlockCacheHits:     uint64(cStats.block_cache_hits),
+		BlockCacheMisses:   uint64(cStats.block_cache_misses),
+
+		RejectedInserts: db.admission.rejected.Load(),
+	}
+
+	if cStats.last_compaction != 0 {
+		stats.LastCompaction = time.Unix(int64(cStats.last_compaction), 0)
+	}
+
+	if cStats.index_enabled {
+		progress := newIndexProgress(&cStats)
+		stats.IndexType = "hnsw"
+		stats.IndexStatus = progress.Status
+		stats.UnindexedVectors = progress.Pending
+		stats.IndexLoaded = bool(cStats.index_loaded)
+		stats.EfSearch = int(cStats.ef_search)
+	}
+
+	return stats, nil
+}
+
+// SetMaxVectors changes the live vector limit enforced by Insert, which
+// fails with ErrDBFull at the limit. Zero removes the limit. The new limit
+// is written to the database file immediately.
+func (db *DB) SetMaxVectors(n int) error {
+	if db.db == nil || n < 0 {
+		return ErrInvalidArgs
+	}
+
+	result := C.cvector_set_max_vectors(db.db, C.size_t(n))
+	if result != 0 {
+		return db.engineError("set_max_vectors", Error(result), "max_vectors", n)
+	}
+	return nil
+}
+
+// SetMaxSize changes the data file quota enforced by Insert, which fails
+// with ErrQuotaExceeded past it, overwrites included. Zero removes the quota. Unlike
+// SetMaxVectors it is not stored in the file and lasts until Close.
+func (db *DB) SetMaxSize(bytes int64) error {
+	if db.db == nil || bytes < 0 {
+		return ErrInvalidArgs
+	}
+
+	result := C.cvector_set_max_size(db.db, C.uint64_t(bytes))
+	if result != 0 {
+		return db.engineError("set_max_size", Error(result), "max_size_bytes", bytes)
+	}
+	return nil
+}
+
+// SetEfSearch changes how many candidates index searches keep while
+// walking the HNSW graph, for queries that leave Query.EfSearch at zero.
+// Raising it finds more of the true nearest neighbors at the cost of
+// latency; zero restores the default of twice TopK. The setting lasts
+// until the database is closed and takes effect for the next search.
+func (db *DB) SetEfSearch(ef int) error {
+	if db.db == nil || ef < 0 || ef > C.CVECTOR_MAX_EF_SEARCH {
+		return ErrInvalidArgs
+	}
+
+	result := C.cvector_set_ef_search(db.db, C.uint32_t(ef))
+	if result != 0 {
+		return db.engineError("set_ef_search", Error(result), "ef", ef)
+	}
+	return nil
+}
+
+// SaveEfSearch stores ef with the database as the candidate list size for
+// queries that set none, so later opens use it unless they give their own
+// DBConfig.EfSearch, and applies it to this handle. Zero clears it.
+func (db *DB) SaveEfSearch(ef int) error {
+	if err := db.SetEfSearch(ef); err != nil {
+		return err
+	}
+
+	props := db.meta.properties()
+	props.EfSearch = ef
+	return db.meta.setProperties(props)
+}
+
+// SetCacheSize changes the read cache budget, evicting the least recently
+// used vectors to fit. Zero disables the cache. The budget lasts until the
+// database is closed.
+func (db *DB) SetCacheSize(bytes int) error {
+	if db.db == nil || bytes < 0 {
+		return ErrInvalidArgs
+	}
+
+	result := C.cvector_set_cache_size(db.db, C.size_t(bytes))
+	if result != 0 {
+		return db.engineError("set_cache_size", Error(result), "bytes", bytes)
+	}
+	return nil
+}
+
+// SetBlockCacheSize changes the block cache budget, evicting the least
+// recently used blocks to fit. Zero disables the cache. The budget lasts
+// until the database is closed.
+func (db *DB) SetBlockCacheSize(bytes int) error {
+	if db.db == nil || bytes < 0 {
+		return ErrInvalidArgs
+	}
+
+	result := C.cvector_set_block_cache_size(db.db, C.size_t(bytes))
+	if result != 0 {
+		return db.engineError("set_block_cache_size", Error(result), "bytes", bytes)
+	}
+	return nil
+}
+
+// MemoryUsage reports the memory currently held by the C engine for this
+// database. It does not include Go-side allocations such as metadata.
+func (db *DB) MemoryUsage() (*MemoryUsage, error) {
+	if db.db == nil {
+		return nil, ErrInvalidArgs
+	}
+
+	var cUsage C.cvector_memory_usage_t
+	result := C.cvector_memory_usage(db.db, &cUsage)
+	if result != 0 {
+		return nil, db.engineError("memory_usage", Error(result))
+	}
+
+	return &MemoryUsage{
+		Database:       int64(cUsage.database_bytes),
+		LookupTable:    int64(cUsage.lookup_table_bytes),
+		IndexStructure: int64(cUsage.index_structure_bytes),
+		IndexGraph:     int64(cUsage.index_graph_bytes),
+		IndexVectors:   int64(cUsage.index_vector_bytes),
+		IOBuffers:      int64(cUsage.io_buffer_bytes),
+		Mapped:         int64(cUsage.mapped_bytes),
+		Cache:          int64(cUsage.cache_bytes),
+		BlockCache:     int64(cUsage.block_cache_bytes),
+		Total:          int64(cUsage.total_bytes),
+	}, nil
+}
+
+// Iterate calls fn for every vector in ID order, as the database stood
+// when iteration started: vectors inserted, overwritten or deleted while it
+// runs, by fn or anyone else, are visited as they were, and compactions do
+// not disturb it. Writes are not held up meanwhile. Metadata is captured
+// at the start too. Returning an error from fn stops the iteration and
+// returns that error.
+func (db *DB) Iterate(fn func(*Vector) error) error {
+	if db.db == nil {
+		return ErrInvalidArgs
+	}
+
+	var view *C.cvector_view_t
+	if result := C.cvector_view_open(db.db, &view); result != 0 {
+		return db.engineError("view_open", Error(result))
+	}
+	defer C.cvector_view_close(view)
+	metadata, tags := db.meta.view(), db.meta.viewTags()
+
+	count := int(C.cvector_view_count(view))
+	for i := 0; i < count; i++ {
+		var cVector *C.cvector_t
+		if result := C.cvector_view_get(view, C.size_t(i), &cVector); result != 0 {
+			return db.engineError("view_get", Error(result))
+		}
+		vector := vectorFromC(cVector)
+		C.cvector_free_vector(cVector)
+		vector.Metadata = copyMetadata(metadata[vector.ID])
+		vector.Tags = slices.Clone(tags[vector.ID])
+
+		if err := fn(vector); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Warmup reads every stored vector once so the first queries after open
+// do not pay cold-read latency. Reads fill the vector and block caches
+// when they are configured, and the OS page cache otherwise. The HNSW
+// index is built in memory at open and needs no warming. Warmup stops
+// early with ctx.Err() when ctx is done.
+func (db *DB) Warmup(ctx context.Context) error {
+	ids, err := db.IDs()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	for i, id := range ids {
+		if i%256 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		var cVector *C.cvector_t
+		result := C.cvector_get(db.db, C.cvector_id_t(id), &cVector)
+		if Error(result) == ErrVectorNotFound {
+			continue
+		}
+		if result != 0 {
+			return db.engineError("warmup", Error(result), "id", id)
+		}
+		C.cvector_free_vector(cVector)
+	}
+
+	db.logger.Info("cvector database warmed up", "path", db.path, "vectors", len(ids), "duration", time.Since(start))
+	return nil
+}
+
+// CopyTo clones the database into a new database at dstPath with the same
+// dimension and default similarity. If filter is non-nil only vectors for
+// which it returns true are copied. It returns the number of vectors copied.
+func (db *DB) CopyTo(dstPath string, filter func(*Vector) bool) (int, error) {
+	stats, err := db.Stats()
+	if err != nil {
+		return 0, err
+	}
+
+	props := db.meta.properties()
+	dst, err := CreateDB(&DBConfig{
+		Name:                 strings.TrimSuffix(filepath.Base(dstPath), filepath.Ext(dstPath)),
+		Description:          stats.Description,
+		DataPath:             dstPath,
+		Dimension:            stats.Dimension,
+		DefaultSimilarity:    stats.DefaultSimilarity,
+		NormalizeOnInsert:    stats.NormalizeOnInsert,
+		MaxVectors:           stats.MaxVectors,
+		DefaultTopK:          props.DefaultTopK,
+		DefaultMinSimilarity: props.DefaultMinSimilarity,
+		DefaultOversample:    props.DefaultOversample,
+		EfSearch:             props.EfSearch,
+		Logger:               db.logger,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if db.pca != nil {
+		if err := db.pca.save(dstPath); err != nil {
+			dst.Close()
+			DropDB(dstPath)
+			return 0, err
+		}
+		dst.pca = db.pca
+	}
+
+	copied := 0
+	err = db.Iterate(func(vector *Vector) error {
+		if filter != nil && !filter(vector) {
+			return nil
+		}
+		if err := dst.Insert(vector); err != nil {
+			return err
+		}
+		copied++
+		return nil
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		DropDB(dstPath)
+		return 0, err
+	}
+
+	return copied, nil
+}
+
+// ReadFileInfo scans a database file without opening it. Unlike Stats it
+// does not take ownership of the file, so it is safe to call while another
+// process has the database open.
+func ReadFileInfo(dbPath string) (*FileInfo, error) {
+	cPath := C.CString(dbPath)
+	defer C.free(unsafe.Pointer(cPath))
+
+	var cInfo C.cvector_file_info_t
+	result := C.cvector_file_info(cPath, &cInfo)
+	if result != 0 {
+		return nil, newOpError("file_info", dbPath, 0, Error(result))
+	}
+
+	return &FileInfo{
+		Dimension:         uint32(cInfo.dimension),
+		DefaultSimilarity: SimilarityType(cInfo.default_similarity),
+		LiveRecords:       int(cInfo.live_records),
+		DeletedRecords:    int(cInfo.deleted_records),
+		UpdatedRecords:    int(cInfo.updated_records),
+		SizeBytes:         int(cInfo.file_size_bytes),
+		FormatVersion:     int(cInfo.format_version),
+	}, nil
+}
+
+// Search performs a similarity search on the database. Results are ordered
+// best first, and results with equal similarity by ascending ID, so
+// repeated queries return a stable order. When query.Explain is set each
+// result carries diagnostics in Result.Explain. TopK, MinSimilarity and
+// Oversample left zero take the database's QueryDefaults.
+func (db *DB) Search(query *Query) ([]*Result, error) {
+	results, _, err := db.SearchExplain(query)
+	return results, err
+}
+
+// SearchExplain performs a search and also returns how it was executed,
+// whether or not query.Explain is set. The report is returned even when
+// there are no results, and is nil when a hook answered the search.
+func (db *DB) SearchExplain(query *Query) ([]*Result, *SearchExplain, error) {
+	var explain *SearchExplain
+	call := &Call{Op: HookSearch, Query: query}
+	err := db.hooks.run(call, func() error {
+		var err error
+		call.Results, explain, err = db.search(call.Query)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return call.Results, explain, nil
+}
+
+func (db *DB) search(query *Query) ([]*Result, *SearchExplain, error) {
+	if db.db == nil {
+		return nil, nil, ErrInvalidArgs
+	}
+	if query == nil {
+		return nil, nil, ErrInvalidArgs
+	}
+	data := query.vector()
+	if len(data) == 0 {
+		return nil, nil, ErrInvalidArgs
+	}
+	if err := validateVectorData(data); err != nil {
+		return nil, nil, err
+	}
+
+	queryVector, err := db.conform(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Zero fields fall back to the database's query defaults
+	defaults := db.QueryDefaults()
+	topK, minSimilarity, oversample := query.TopK, query.MinSimilarity, query.Oversample
+	if topK == 0 {
+		topK = defaults.TopK
+	}
+	if minSimilarity == 0 {
+		minSimilarity = defaults.MinSimilarity
+	}
+	if oversample == 0 {
+		oversample = defaults.Oversample
+	}
+	// The engine's checks, made here too so that a search scoring indexed
+	// filter candidates itself accepts the same queries
+	if topK == 0 || topK > maxSearchTopK || minSimilarity < -1 || minSimilarity > 1 ||
+		query.EfSearch > C.CVECTOR_MAX_EF_SEARCH {
+		return nil, nil, ErrInvalidArgs
+	}
+	fetch := topK
+	if oversample > 1 {
+		fetch = min(topK*uint32(oversample), max(topK, maxSearchTopK))
+	}
+
+	// Allocate C array for query vector
+	dataSize := len(queryVector)
+	cData := (*C.float)(C.malloc(C.size_t(dataSize * 4))) // 4 bytes per float32
+	if cData == nil {
+		return nil, nil, ErrOutOfMemory
+	}
+	defer C.free(unsafe.Pointer(cData))
+
+	// Copy query vector data
+	cDataSlice := (*[1 << 20]C.float)(unsafe.Pointer(cData))[:dataSize:dataSize]
+	for i, v := range queryVector {
+		cDataSlice[i] = C.float(v)
+	}
+
+	admit, candidates, err := db.queryFilter(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Perform search. Filtered searches widen the fetch until topK results
+	// pass the filters or the database has no more to give.
+	filtered := query.DedupeBy != "" || admit != nil
+	if filtered {
+		fetch = max(fetch, min(topK*filterOversample, max(topK, maxSearchTopK)))
+	}
+	var hits []C.cvector_result_t
+	var explain *SearchExplain
+	if candidates != nil && len(candidates) <= max(int(fetch), maxExactCandidates) {
+		// Few enough vectors pass the indexed filters to score them all,
+		// which is exact and leaves the rest of the database untouched
+		hits, explain, err = db.scoreCandidates(queryVector, query.Similarity, query.Normalize, minSimilarity, candidates)
+		if err != nil {
+			db.queryCounters.recordError()
+			return nil, nil, err
+		}
+		db.queryCounters.record(explain)
+		hits = db.filterHits(hits, admit, query.DedupeBy)
+	} else {
+		for {
+			var cResults *C.cvector_result_t
+			var resultCount C.size_t
+			var cStats C.cvector_search_stats_t
+
+			db.acquireSearch()
+			result := C.search_wrapper(
+				db.db,
+				cData,
+				C.uint32_t(dataSize),
+				C.uint32_t(fetch),
+				C.cvector_similarity_t(query.Similarity),
+				C.float(minSimilarity),
+				C.bool(query.Normalize),
+				C.uint32_t(query.EfSearch),
+				&cResults,
+				&resultCount,
+				&cStats,
+			)
+			db.releaseSearch()
+
+			if result != 0 {
+				db.queryCounters.recordError()
+				return nil, nil, db.engineError("search", Error(result), "top_k", topK)
+			}
+
+			explain = newSearchExplain(&cStats)
+			db.queryCounters.record(explain)
+
+			hits = nil
+			if resultCount > 0 && cResults != nil {
+				hits = append(hits, unsafe.Slice(cResults, int(resultCount))...)
+				C.cvector_free_results(cResults, resultCount)
+			}
+			if !filtered {
+				break
+			}
+			hits = db.filterHits(hits, admit, query.DedupeBy)
+			if len(hits) >= int(topK) || int(resultCount) < int(fetch) || fetch >= maxSearchTopK {
+				break
+			}
+			fetch = min(fetch*2, maxSearchTopK)
+		}
+	}
+
+	if len(hits) == 0 {
+		return []*Result{}, explain, nil
+	}
+
+	// Convert C results to Go results, dropping the oversampled extras
+	kept := min(len(hits), int(topK))
+	results := make([]*Result, kept)
+	for i, cResult := range hits[:kept] {
+		results[i] = &Result{
+			ID:         uint64(cResult.id),
+			Similarity: float32(cResult.similarity),
+			Vector:     nil, // Vector data not loaded by default
+		}
+		if query.Explain {
+			results[i].Explain = &ResultExplain{
+				Rank:            i + 1,
+				Source:          explain.Strategy,
+				ThresholdMargin: results[i].Similarity - minSimilarity,
+				Search:          explain,
+			}
+		}
+		if query.NormalizeScores {
+			results[i].Similarity = NormalizeScore(query.Similarity, results[i].Similarity)
+		}
+	}
+
+	return results, explain, nil
+}
+
+// queryFilter returns whether the query's time range, tag and metadata
+// filters admit an ID, or nil if it sets none. Filters answered from an
+// index also give the IDs they admit as candidates, nil if there are none,
+// which search can score directly when there are few.
+func (db *DB) queryFilter(query *Query) (admit func(id uint64) bool, candidates map[uint64]bool, err error) {
+	var checks []func(id uint64) bool
+	narrow := func(ids map[uint64]bool) {
+		if candidates == nil {
+			candidates = ids
+			return
+		}
+		for id := range candidates {
+			if !ids[id] {
+				delete(candidates, id)
+			}
+		}
+	}
+
+	if !query.InsertedAfter.IsZero() || !query.InsertedBefore.IsZero() {
+		ids, err := db.idsByTime(query.InsertedAfter, query.InsertedBefore)
+		if err != nil {
+			return nil, nil, err
+		}
+		inRange := make(map[uint64]bool, len(ids))
+		for _, id := range ids {
+			inRange[id] = true
+		}
+		narrow(inRange)
+	}
+	if tags := normalizeTags(query.Tags); tags != nil {
+		narrow(db.meta.tagged(tags))
+	}
+	if exclude := normalizeTags(query.ExcludeTags); exclude != nil {
+		checks = append(checks, func(id uint64) bool { return !db.meta.hasAnyTag(id, exclude) })
+	}
+	if radius := query.GeoRadius; radius != nil && (!radius.Center.valid() || !(radius.Meters >= 0)) {
+		return nil, nil, ErrInvalidArgs
+	}
+	if query.Keywords != nil && len(tokenize(query.Keywords.Text)) == 0 {
+		return nil, nil, ErrInvalidArgs
+	}
+	if len(query.Filter) > 0 || len(query.Ranges) > 0 || query.GeoRadius != nil || query.Keywords != nil {
+		ids, check := db.meta.filter(query)
+		if ids != nil {
+			narrow(ids)
+		}
+		if check != nil {
+			checks = append(checks, check)
+		}
+	}
+
+	if candidates == nil && len(checks) == 0 {
+		return nil, nil, nil
+	}
+	return func(id uint64) bool {
+		if candidates != nil && !candidates[id] {
+			return false
+		}
+		for _, check := range checks {
+			if !check(id) {
+				return false
+			}
+		}
+		return true
+	}, candidates, nil
+}
+
+// filterHits drops the hits admit rejects, unless it is nil, and keeps the
+// best of the hits sharing a value of the metadata key dedupeBy, comparing
+// values as Query.Filter does. Hits without the key, or with a value that
+// cannot be compared, are all kept.
+func (db *DB) filterHits(hits []C.cvector_result_t, admit func(id uint64) bool, dedupeBy string) []C.cvector_result_t {
+	seen := make(map[any]bool)
+	kept := hits[:0]
+	for _, hit := range hits {
+		if admit != nil && !admit(uint64(hit.id)) {
+			continue
+		}
+		if dedupeBy == "" {
+			kept = append(kept, hit)
+			continue
+		}
+		if v, ok := db.meta.value(uint64(hit.id), dedupeBy); ok {
+			if key, ok := indexKey(v); ok {
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+		}
+		kept = append(kept, hit)
+	}
+	return kept
+}
+
+// scoreCandidates scores the candidates exactly against queryVector and
+// returns those meeting minSimilarity, zero meaning any, best first and
+// ties by ID, in the engine's result form. Candidates deleted meanwhile
+// are skipped.
+func (db *DB) scoreCandidates(queryVector []float32, similarity SimilarityType, normalize bool,
+	minSimilarity float32, candidates map[uint64]bool) ([]C.cvector_result_t, *SearchExplain, error) {
+	start := time.Now()
+	explain := &SearchExplain{Strategy: SearchStrategyScan, FilterSelectivity: 1}
+
+	ids := make([]uint64, 0, len(candidates))
+	vectors := make([][]float32, 0, len(candidates))
+	for id := range candidates {
+		v, err := db.Get(id)
+		if errors.Is(err, ErrVectorNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		vectors = append(vectors, v.Data)
+	}
+	explain.IOTime = time.Since(start)
+	if len(vectors) == 0 {
+		explain.TotalTime = time.Since(start)
+		return nil, explain, nil
+	}
+
+	if normalize {
+		queryVector = normalizedCopy(queryVector)
+	}
+	scoring := time.Now()
+	scores, err := DistanceMatrix([][]float32{queryVector}, vectors, similarity)
+	if err != nil {
+		return nil, nil, err
+	}
+	hits := make([]C.cvector_result_t, 0, len(ids))
+	for i, id := range ids {
+		score := scores[0][i]
+		if similarity == SimilarityEuclidean {
+			score = -score
+		}
+		if minSimilarity != 0 && score < minSimilarity {
+			explain.ThresholdRejected++
+			continue
+		}
+		hits = append(hits, C.cvector_result_t{id: C.cvector_id_t(id), similarity: C.float(score)})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].similarity != hits[j].similarity {
+			return hits[i].similarity > hits[j].similarity
+		}
+		return hits[i].id < hits[j].id
+	})
+
+	explain.CandidatesScanned = len(ids)
+	explain.ThresholdChecked = len(ids)
+	explain.FilterSelectivity = float64(len(hits)) / float64(len(ids))
+	explain.ScoringTime = time.Since(scoring)
+	explain.TotalTime = time.Since(start)
+	return hits, explain, nil
+}
+
+// SearchRadius returns every vector whose similarity to query.QueryVector is
+// at least query.MinSimilarity, best first and ties by ID. Unlike Search it
+// scans all vectors, so the result is exact. TopK caps the results; zero
+// returns every match.
+func (db *DB) SearchRadius(query *Query) ([]*Result, error) {
+	call := &Call{Op: HookSearch, Query: query, Radius: true}
+	err := db.hooks.run(call, func() error {
+		var err error
+		call.Results, err = db.searchRadius(call.Query)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return call.Results, nil
+}
+
+func (db *DB) searchRadius(query *Query) ([]*Result, error) {
+	if db.db == nil {
+		return nil, ErrInvalidArgs
+	}
+	if query == nil {
+		return nil, ErrInvalidArgs
+	}
+	data := query.vector()
+	if len(data) == 0 {
+		return nil, ErrInvalidArgs
+	}
+	if err := validateVectorData(data); err != nil {
+		return nil, err
+	}
+
+	queryVector, err := db.conform(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dataSize := len(queryVector)
+	cData := (*C.float)(C.malloc(C.size_t(dataSize * 4))) // 4 bytes per float32
+	if cData == nil {
+		return nil, ErrOutOfMemory
+	}
+	defer C.free(unsafe.Pointer(cData))
+
+	cDataSlice := unsafe.Slice(cData, dataSize)
+	for i, v := range queryVector {
+		cDataSlice[i] = C.float(v)
+	}
+
+	admit, _, err := db.queryFilter(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filtered matches are capped once the filters have run
+	filtered := query.DedupeBy != "" || admit != nil
+	topK := query.TopK
+	if filtered {
+		topK = 0
+	}
+
+	var cResults *C.cvector_result_t
+	var resultCount C.size_t
+	db.acquireSearch()
+	result := C.search_radius_wrapper(db.db, cData, C.uint32_t(dataSize), C.uint32_t(topK),
+		C.cvector_similarity_t(query.Similarity), C.float(query.MinSimilarity), C.bool(query.Normalize),
+		&cResults, &resultCount)
+	db.releaseSearch()
+	if result != 0 {
+		return nil, db.engineError("search_radius", Error(result))
+	}
+	if resultCount == 0 || cResults == nil {
+		return []*Result{}, nil
+	}
+	defer C.cvector_free_results(cResults, resultCount)
+
+	cResultsSlice := unsafe.Slice(cResults, int(resultCount))
+	if filtered {
+		cResultsSlice = db.filterHits(cResultsSlice, admit, query.DedupeBy)
+		if query.TopK > 0 && len(cResultsSlice) > int(query.TopK) {
+			cResultsSlice = cResultsSlice[:query.TopK]
+		}
+	}
+	results := make([]*Result, len(cResultsSlice))
+	for i, cResult := range cResultsSlice {
+		results[i] = &Result{
+			ID:         uint64(cResult.id),
+			Similarity: float32(cResult.similarity),
+		}
+		if query.NormalizeScores {
+			results[i].Similarity = NormalizeScore(query.Similarity, results[i].Similarity)
+		}
+	}
+
+	return results, nil
+}
+
+// NormalizeScore maps a raw score of the given metric onto a 0-1 relevance
+// scale where higher is better, so scores of different metrics can be
+// compared and thresholded alike. Cosine similarity s maps to (s+1)/2, dot
+// products through the logistic function 1/(1+e^-s), and euclidean scores,
+// which are negated distances d, to 1/(1+d). The mappings keep the order of
+// results, but MinSimilarity still applies to the raw score.
+func NormalizeScore(similarity SimilarityType, score float32) float32 {
+	s := float64(score)
+	switch similarity {
+	case SimilarityDotProduct:
+		return float32(1 / (1 + math.Exp(-s)))
+	case SimilarityEuclidean:
+		return float32(1 / (1 - min(s, 0)))
+	default:
+		return float32(min(max((s+1)/2, 0), 1))
+	}
+}
+
+func newSearchExplain(cStats *C.cvector_search_stats_t) *SearchExplain {
+	explain := &SearchExplain{
+		Strategy:          SearchStrategyScan,
+		IndexFallback:     bool(cStats.index_fallback),
+		CandidatesScanned: int(cStats.candidates_scanned),
+		IndexNodesVisited: int(cStats.index_nodes_visited),
+		EfSearch:          int(cStats.ef_search),
+		ThresholdChecked:  int(cStats.threshold_checked),
+		ThresholdRejected: int(cStats.threshold_rejected),
+		FilterSelectivity: 1,
+		IOTime:            time.Duration(cStats.io_ns),
+		ScoringTime:       time.Duration(cStats.scoring_ns),
+		TotalTime:         time.Duration(cStats.total_ns),
+	}
+	if cStats.used_index {
+		explain.Strategy = SearchStrategyIndex
+	}
+	if explain.ThresholdChecked > 0 {
+		passed := explain.ThresholdChecked - explain.ThresholdRejected
+		explain.FilterSelectivity = float64(passed) / float64(explain.ThresholdChecked)
+	}
+	return explain
 }
 
 // NewVector creates a new vector with the current timestamp
@@ -0,0 +1,126 @@
+package cvector
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditOp names the kind of mutation recorded in the audit log
+type AuditOp string
+
+const (
+	AuditInsert   AuditOp = "insert"
+	AuditUpdate   AuditOp = "update" // Insert that overwrote an existing ID
+	AuditDelete   AuditOp = "delete"
+	AuditUndelete AuditOp = "undelete"
+
+	AuditUpdateMetadata AuditOp = "update_metadata" // Metadata patched; the vector is unchanged
+	AuditSetTags        AuditOp = "set_tags"        // Tags replaced; the vector is unchanged
+)
+
+// AuditEntry is one line of the audit log
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor,omitempty"`
+	Op        AuditOp   `json:"op"`
+	ID        uint64    `json:"id"`
+	Dimension uint32    `json:"dimension,omitempty"`
+}
+
+// auditLog appends one JSON line per successful mutation. The file is only
+// ever opened for appending, so existing entries are never rewritten.
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, ErrFileIO
+	}
+	return &auditLog{file: f}, nil
+}
+
+func (a *auditLog) record(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return ErrInvalidArgs
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return ErrFileIO
+	}
+	return nil
+}
+
+func (a *auditLog) sync() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.file.Sync(); err != nil {
+		return ErrFileIO
+	}
+	return nil
+}
+
+func (a *auditLog) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.file.Close(); err != nil {
+		return ErrFileIO
+	}
+	return nil
+}
+
+// audit records a mutation when an audit log is configured. A failure to
+// record is returned to the caller: the mutation itself has already been
+// applied, but an audited deployment must not lose entries silently.
+func (db *DB) audit(actor string, op AuditOp, id uint64, dimension uint32) error {
+	if db.auditLog == nil {
+		return nil
+	}
+
+	err := db.auditLog.record(AuditEntry{
+		Time:      time.Now().UTC(),
+		Actor:     actor,
+		Op:        op,
+		ID:        id,
+		Dimension: dimension,
+	})
+	if err != nil {
+		db.logger.Error("cvector audit write failed", "path", db.path, "op", string(op), "id", id, "error", err)
+	}
+	return err
+}
+
+// ReadAuditLog returns every entry in the audit log at path, oldest first
+func ReadAuditLog(path string) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, ErrFileIO
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, ErrDBCorrupt
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ErrFileIO
+	}
+
+	return entries, nil
+}
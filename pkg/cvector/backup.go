@@ -0,0 +1,291 @@
+package cvector
+
+/*
+#include "core/cvector.h"
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+	"unsafe"
+)
+
+// Names of the files inside a backup archive. They are fixed so an
+// archive restores to any path.
+const (
+	backupManifest = "manifest.json"
+	backupData     = "data.cvdb"
+	backupMeta     = "data.cvdb" + metaSuffix
+	backupPCA      = "data.cvdb" + pcaSuffix
+	backupVersions = "data.cvdb" + versionSuffix
+	backupIndex    = "data.cvdb" + indexSuffix
+)
+
+// indexSuffix names the HNSW index the engine saves next to a data file
+const indexSuffix = ".hnsw"
+
+// backupVersion is bumped when the archive layout changes. Archives of
+// earlier versions still restore.
+const backupVersion = 3
+
+// BackupManifest is the first entry of a backup archive. It lists every
+// other file with its size and SHA-256 so a restore can verify them.
+type BackupManifest struct {
+	Version       int          `json:"version"`
+	Created       time.Time    `json:"created"`
+	FormatVersion int          `json:"format_version"` // Data file format, see FormatVersion
+	Files         []BackupFile `json:"files"`
+}
+
+// BackupFile describes one file in a backup archive
+type BackupFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Backup writes the database to w as a gzip-compressed tar archive holding
+// a manifest, a consistent snapshot of the data file, its HNSW index when
+// complete, and the metadata, PCA and version history sidecars. Writes
+// wait while the data file is copied; searches do not. Restore it with
+// RestoreBackup.
+func (db *DB) Backup(w io.Writer) error {
+	if db.db == nil {
+		return ErrInvalidArgs
+	}
+	if err := db.Flush(); err != nil {
+		return err
+	}
+
+	// Snapshot next to the database, where there is room for a copy of it
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".backup-*")
+	if err != nil {
+		return ErrFileIO
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+	defer os.Remove(tmpPath + indexSuffix)
+
+	cPath := C.CString(tmpPath)
+	defer C.free(unsafe.Pointer(cPath))
+	if result := C.cvector_snapshot(db.db, cPath); result != 0 {
+		return db.engineError("snapshot", Error(result))
+	}
+
+	manifest := BackupManifest{Version: backupVersion, Created: time.Now().UTC(), FormatVersion: FormatVersion}
+	data, err := os.Open(tmpPath)
+	if err != nil {
+		return ErrFileIO
+	}
+	defer data.Close()
+	dataFile, err := hashBackupFile(backupData, data)
+	if err != nil {
+		return err
+	}
+	manifest.Files = append(manifest.Files, dataFile)
+
+	// The snapshot saves the index alongside when it covers every vector,
+	// so the restored database opens without rebuilding it
+	index, err := os.Open(tmpPath + indexSuffix)
+	if err == nil {
+		defer index.Close()
+		indexFile, err := hashBackupFile(backupIndex, index)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, indexFile)
+	}
+
+	sidecars := map[string][]byte{}
+	if meta, err := db.meta.snapshot(); err != nil {
+		return err
+	} else if len(meta) > 0 {
+		sidecars[backupMeta] = meta
+	}
+	if db.pca != nil {
+		pca, err := json.Marshal(db.pca)
+		if err != nil {
+			return err
+		}
+		sidecars[backupPCA] = pca
+	}
+	if db.versions != nil {
+		if versions, err := db.versions.snapshot(); err != nil {
+			return err
+		} else if len(versions) > 0 {
+			sidecars[backupVersions] = versions
+		}
+	}
+	for _, name := range []string{backupMeta, backupPCA, backupVersions} {
+		if content, ok := sidecars[name]; ok {
+			sum := sha256.Sum256(content)
+			manifest.Files = append(manifest.Files, BackupFile{Name: name, Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])})
+		}
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeBackupEntry(tw, backupManifest, int64(len(manifestJSON)), manifest.Created, bytes.NewReader(manifestJSON)); err != nil {
+		return err
+	}
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return ErrFileIO
+	}
+	if err := writeBackupEntry(tw, backupData, dataFile.Size, manifest.Created, data); err != nil {
+		return err
+	}
+	for _, file := range manifest.Files[1:] {
+		var content io.Reader = bytes.NewReader(sidecars[file.Name])
+		if file.Name == backupIndex {
+			if _, err := index.Seek(0, io.SeekStart); err != nil {
+				return ErrFileIO
+			}
+			content = index
+		}
+		if err := writeBackupEntry(tw, file.Name, file.Size, manifest.Created, content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// RestoreBackup unpacks an archive written by Backup into a database at
+// path, which must not exist. Every file is checked against the manifest;
+// on any mismatch nothing is left at path and the error matches
+// ErrDBCorrupt.
+func RestoreBackup(r io.Reader, path string) (err error) {
+	targets := map[string]string{
+		backupData:     path,
+		backupMeta:     metaPath(path),
+		backupPCA:      pcaPath(path),
+		backupVersions: versionsPath(path),
+		backupIndex:    path + indexSuffix,
+	}
+	for _, target := range targets {
+		if fileExists(target) {
+			return fmt.Errorf("cvector: restore target %s already exists: %w", target, ErrFileIO)
+		}
+	}
+
+	var written []string
+	defer func() {
+		if err != nil {
+			for _, target := range written {
+				os.Remove(target)
+			}
+		}
+	}()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("cvector: reading backup: %w", ErrDBCorrupt)
+	}
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != backupManifest {
+		return fmt.Errorf("cvector: backup has no manifest: %w", ErrDBCorrupt)
+	}
+	var manifest BackupManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return fmt.Errorf("cvector: reading backup manifest: %w", ErrDBCorrupt)
+	}
+	if manifest.Version < 1 || manifest.Version > backupVersion {
+		return fmt.Errorf("cvector: backup version %d: %w", manifest.Version, ErrVersionTooNew)
+	}
+	expected := map[string]BackupFile{}
+	for _, file := range manifest.Files {
+		if _, ok := targets[file.Name]; !ok {
+			return fmt.Errorf("cvector: backup lists unexpected file %q: %w", file.Name, ErrDBCorrupt)
+		}
+		expected[file.Name] = file
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cvector: reading backup: %w", ErrDBCorrupt)
+		}
+		file, ok := expected[hdr.Name]
+		if !ok {
+			return fmt.Errorf("cvector: backup has unexpected file %q: %w", hdr.Name, ErrDBCorrupt)
+		}
+		delete(expected, hdr.Name)
+
+		target := targets[hdr.Name]
+		written = append(written, target)
+		if err := restoreBackupFile(tr, target, file); err != nil {
+			return err
+		}
+	}
+	if len(expected) > 0 {
+		return fmt.Errorf("cvector: backup is missing %d files: %w", len(expected), ErrDBCorrupt)
+	}
+
+	_, err = ReadFileInfo(path)
+	return err
+}
+
+// restoreBackupFile copies one archive entry to target, checking it
+// against its manifest entry
+func restoreBackupFile(r io.Reader, target string, file BackupFile) error {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return ErrFileIO
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cvector: restoring %s: %w", file.Name, ErrDBCorrupt)
+	}
+	if n != file.Size || hex.EncodeToString(hash.Sum(nil)) != file.SHA256 {
+		return fmt.Errorf("cvector: %s does not match the backup manifest: %w", file.Name, ErrDBCorrupt)
+	}
+	return nil
+}
+
+func hashBackupFile(name string, r io.Reader) (BackupFile, error) {
+	hash := sha256.New()
+	n, err := io.Copy(hash, r)
+	if err != nil {
+		return BackupFile{}, ErrFileIO
+	}
+	return BackupFile{Name: name, Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+func writeBackupEntry(tw *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
@@ -0,0 +1,66 @@
+package cvector
+
+// Centroid returns the component-wise mean of the vectors with the given
+// IDs, such as a profile vector built from a user's interaction history.
+// Every ID must exist.
+func (db *DB) Centroid(ids []uint64) ([]float32, error) {
+	if db.db == nil || len(ids) == 0 {
+		return nil, ErrInvalidArgs
+	}
+
+	var sum []float64
+	for _, id := range ids {
+		v, err := db.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		sum = accumulate(sum, v.Data)
+	}
+	return mean(sum, len(ids)), nil
+}
+
+// CentroidWhere returns the mean of every vector accepted by filter, and
+// the number of vectors averaged. A nil filter averages the whole database.
+func (db *DB) CentroidWhere(filter func(*Vector) bool) ([]float32, int, error) {
+	if db.db == nil {
+		return nil, 0, ErrInvalidArgs
+	}
+
+	var sum []float64
+	count := 0
+	err := db.Iterate(func(v *Vector) error {
+		if filter != nil && !filter(v) {
+			return nil
+		}
+		sum = accumulate(sum, v.Data)
+		count++
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if count == 0 {
+		return nil, 0, ErrVectorNotFound
+	}
+	return mean(sum, count), count, nil
+}
+
+// accumulate adds v into sum, sized on first use. Sums are kept in float64
+// so long histories don't lose precision.
+func accumulate(sum []float64, v []float32) []float64 {
+	if sum == nil {
+		sum = make([]float64, len(v))
+	}
+	for i, x := range v {
+		sum[i] += float64(x)
+	}
+	return sum
+}
+
+func mean(sum []float64, count int) []float32 {
+	out := make([]float32, len(sum))
+	for i, s := range sum {
+		out[i] = float32(s / float64(count))
+	}
+	return out
+}
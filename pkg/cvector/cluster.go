@@ -0,0 +1,133 @@
+package cvector
+
+/*
+#include "core/cvector.h"
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"errors"
+	"unsafe"
+)
+
+// clusterSeed makes clustering reproducible across runs on the same data
+const clusterSeed = 0x5EED
+
+// Clustering is the result of k-means over the stored vectors
+type Clustering struct {
+	Centroids   [][]float32
+	Assignments map[uint64]int // Vector ID to index into Centroids
+	Sizes       []int          // Vectors assigned to each centroid
+	Iterations  int            // Iterations run before convergence or the limit
+	Inertia     float64        // Sum of squared distances to assigned centroids
+}
+
+// Cluster partitions the stored vectors into k clusters by Euclidean
+// distance, running at most iterations rounds of k-means. Seeding is
+// deterministic, so the same data always gives the same clustering.
+func (db *DB) Cluster(k, iterations int) (*Clustering, error) {
+	if db.db == nil || k <= 0 || iterations <= 0 {
+		return nil, ErrInvalidArgs
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		return nil, err
+	}
+	dim := int(stats.Dimension)
+
+	ids, err := db.IDs()
+	if err != nil {
+		return nil, err
+	}
+	if k > len(ids) {
+		return nil, ErrInvalidArgs
+	}
+
+	// The vectors are packed into one C buffer so the engine's distance
+	// kernels run without crossing into Go per comparison
+	cData := (*C.float)(C.malloc(C.size_t(len(ids) * dim * 4)))
+	cCentroids := (*C.float)(C.malloc(C.size_t(k * dim * 4)))
+	cAssignments := (*C.uint32_t)(C.malloc(C.size_t(len(ids) * 4)))
+	defer C.free(unsafe.Pointer(cData))
+	defer C.free(unsafe.Pointer(cCentroids))
+	defer C.free(unsafe.Pointer(cAssignments))
+	if cData == nil || cCentroids == nil || cAssignments == nil {
+		return nil, ErrOutOfMemory
+	}
+
+	data := unsafe.Slice(cData, len(ids)*dim)
+	n := 0
+	for _, id := range ids {
+		v, err := db.Get(id)
+		if errors.Is(err, ErrVectorNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, x := range v.Data {
+			data[n*dim+i] = C.float(x)
+		}
+		ids[n] = id
+		n++
+	}
+	ids = ids[:n]
+	if k > n {
+		return nil, ErrInvalidArgs
+	}
+
+	var iterationsRun C.uint32_t
+	var inertia C.double
+	result := C.cvector_kmeans(cData, C.size_t(n), C.uint32_t(dim), C.uint32_t(k), C.uint32_t(iterations),
+		C.uint64_t(clusterSeed), cCentroids, cAssignments, &iterationsRun, &inertia)
+	if result != 0 {
+		return nil, db.engineError("cluster", Error(result))
+	}
+
+	clustering := &Clustering{
+		Centroids:   make([][]float32, k),
+		Assignments: make(map[uint64]int, n),
+		Sizes:       make([]int, k),
+		Iterations:  int(iterationsRun),
+		Inertia:     float64(inertia),
+	}
+
+	centroids := unsafe.Slice(cCentroids, k*dim)
+	for c := range clustering.Centroids {
+		clustering.Centroids[c] = make([]float32, dim)
+		for i := range clustering.Centroids[c] {
+			clustering.Centroids[c][i] = float32(centroids[c*dim+i])
+		}
+	}
+
+	assignments := unsafe.Slice(cAssignments, n)
+	for i, id := range ids {
+		cluster := int(assignments[i])
+		clustering.Assignments[id] = cluster
+		clustering.Sizes[cluster]++
+	}
+
+	return clustering, nil
+}
+
+// TagClusters sets metadata key on every clustered vector to the index of
+// its cluster, keeping the rest of its metadata, and returns the number of
+// vectors tagged. Vectors deleted since clustering are skipped.
+func (db *DB) TagClusters(clustering *Clustering, key string) (int, error) {
+	if db.db == nil || clustering == nil || key == "" {
+		return 0, ErrInvalidArgs
+	}
+
+	tagged := 0
+	for id, cluster := range clustering.Assignments {
+		ok, err := db.tagVector(id, key, cluster)
+		if err != nil {
+			return tagged, err
+		}
+		if ok {
+			tagged++
+		}
+	}
+	return tagged, nil
+}
@@ -0,0 +1,158 @@
+package cvector
+
+/*
+#include "core/cvector.h"
+*/
+import "C"
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Compact rewrites the database file without its tombstoned records,
+// reclaiming the space deletes and overwrites leave behind. Searches and
+// writes wait while it runs.
+func (db *DB) Compact() error {
+	if db.db == nil {
+		return ErrInvalidArgs
+	}
+
+	return db.hooks.run(&Call{Op: HookCompact}, func() error {
+		if result := C.cvector_compact(db.db); result != 0 {
+			return db.engineError("compact", Error(result))
+		}
+		db.meta.emptyTrash()
+		return nil
+	})
+}
+
+// collectGarbage gives the GC policy a chance to run after a write that
+// left a tombstone
+func (db *DB) collectGarbage() {
+	if db.collector != nil {
+		db.collector.check()
+	}
+}
+
+// deadRatio is the fraction of stored records that are tombstones
+func deadRatio(live, deleted int) float64 {
+	if deleted == 0 {
+		return 0
+	}
+	return float64(deleted) / float64(live+deleted)
+}
+
+// collector compacts in the background once the DBConfig.GCDeadRatio or
+// GCMaxAge policy is met. Like the syncer it holds the handle rather than
+// the DB. Its compactions pass through the DB's hooks.
+type collector struct {
+	cDB    *C.cvector_db_t
+	path   string
+	meta   *metaStore
+	logger *slog.Logger
+	hooks  *hookChain
+
+	deadRatio float64
+	maxAge    time.Duration
+	opened    time.Time
+
+	mu      sync.Mutex
+	running bool
+	stopped bool
+	wg      sync.WaitGroup
+	done    chan struct{}
+}
+
+func startCollector(cDB *C.cvector_db_t, path string, meta *metaStore, logger *slog.Logger, hooks *hookChain, ratio float64, maxAge time.Duration) *collector {
+	c := &collector{cDB: cDB, path: path, meta: meta, logger: logger, hooks: hooks, deadRatio: ratio, maxAge: maxAge,
+		opened: time.Now(), done: make(chan struct{})}
+
+	// Tombstones age without further writes, so the age policy needs a clock
+	if maxAge > 0 {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			period := maxAge / 4
+			if period <= 0 {
+				period = maxAge
+			}
+			ticker := time.NewTicker(period)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					c.check()
+				case <-c.done:
+					return
+				}
+			}
+		}()
+	}
+
+	c.check()
+	return c
+}
+
+// due reports whether the current tombstones meet the policy
+func (c *collector) due() bool {
+	var cStats C.cvector_db_stats_t
+	if C.cvector_db_stats(c.cDB, &cStats) != 0 || cStats.deleted_vectors == 0 {
+		return false
+	}
+
+	ratio := deadRatio(int(cStats.total_vectors), int(cStats.deleted_vectors))
+	if c.deadRatio > 0 && ratio >= c.deadRatio {
+		return true
+	}
+	if c.maxAge > 0 {
+		since := c.opened
+		if cStats.last_compaction != 0 {
+			if last := time.Unix(int64(cStats.last_compaction), 0); last.After(since) {
+				since = last
+			}
+		}
+		return time.Since(since) >= c.maxAge
+	}
+	return false
+}
+
+// check starts a compaction when one is due and none is running
+func (c *collector) check() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running || c.stopped || !c.due() {
+		return
+	}
+
+	c.running = true
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		start := time.Now()
+		err := c.hooks.run(&Call{Op: HookCompact, Background: true}, func() error {
+			if result := C.cvector_compact(c.cDB); result != 0 {
+				return newOpError("compact", c.path, 0, Error(result))
+			}
+			c.meta.emptyTrash()
+			return nil
+		})
+		if err != nil {
+			c.logger.Error("cvector background compaction failed", "path", c.path, "error", err)
+		} else {
+			c.logger.Info("cvector database compacted", "path", c.path, "duration", time.Since(start))
+		}
+		c.mu.Lock()
+		c.running = false
+		c.mu.Unlock()
+	}()
+}
+
+// stop ends the age clock and waits for an in-flight compaction
+func (c *collector) stop() {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+	close(c.done)
+	c.wg.Wait()
+}
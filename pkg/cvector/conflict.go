@@ -0,0 +1,16 @@
+package cvector
+
+// ConflictPolicy decides what Insert does when a live vector already has
+// the inserted ID
+type ConflictPolicy int
+
+const (
+	// ConflictError fails the insert with ErrDuplicateID
+	ConflictError ConflictPolicy = iota
+
+	// ConflictOverwrite replaces the stored vector and its metadata
+	ConflictOverwrite
+
+	// ConflictIgnore keeps the stored vector and reports success
+	ConflictIgnore
+)
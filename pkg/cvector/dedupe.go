@@ -0,0 +1,132 @@
+package cvector
+
+import (
+	"errors"
+	"sort"
+)
+
+// DuplicateGroup is a set of vectors that are all within the threshold of at
+// least one other member. Canonical is the lowest ID in the group; the rest
+// are listed in Duplicates in ascending order.
+type DuplicateGroup struct {
+	Canonical  uint64
+	Duplicates []uint64
+}
+
+// FindDuplicates groups vectors whose similarity to another vector is at
+// least threshold, using the database's default similarity. Each vector is
+// used as an exact radius query, so the cost grows with the square of the
+// number of vectors.
+func (db *DB) FindDuplicates(threshold float32) ([]DuplicateGroup, error) {
+	if threshold <= 0 || threshold > 1 {
+		return nil, ErrInvalidArgs
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	parent := make(map[uint64]uint64)
+	var find func(id uint64) uint64
+	find = func(id uint64) uint64 {
+		p, ok := parent[id]
+		if !ok || p == id {
+			return id
+		}
+		root := find(p)
+		parent[id] = root
+		return root
+	}
+	union := func(a, b uint64) {
+		ra, rb := find(a), find(b)
+		if ra == rb {
+			return
+		}
+		// Keep the lowest ID as the root so it becomes the canonical member
+		if rb < ra {
+			ra, rb = rb, ra
+		}
+		parent[ra] = ra
+		parent[rb] = ra
+	}
+
+	err = db.Iterate(func(v *Vector) error {
+		results, err := db.SearchRadius(&Query{
+			QueryVector:   v.Data,
+			Similarity:    stats.DefaultSimilarity,
+			MinSimilarity: threshold,
+		})
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			if r.ID != v.ID {
+				union(v.ID, r.ID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[uint64][]uint64)
+	for id := range parent {
+		root := find(id)
+		if id != root {
+			members[root] = append(members[root], id)
+		}
+	}
+
+	groups := make([]DuplicateGroup, 0, len(members))
+	for root, ids := range members {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		groups = append(groups, DuplicateGroup{Canonical: root, Duplicates: ids})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Canonical < groups[j].Canonical })
+
+	return groups, nil
+}
+
+// DeleteDuplicates deletes every non-canonical member of groups and returns
+// the number of vectors removed. Vectors that no longer exist are skipped.
+func (db *DB) DeleteDuplicates(groups []DuplicateGroup) (int, error) {
+	deleted := 0
+	for _, group := range groups {
+		for _, id := range group.Duplicates {
+			err := db.Delete(id)
+			if errors.Is(err, ErrVectorNotFound) {
+				continue
+			}
+			if err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// TagDuplicates sets metadata key on every non-canonical member of groups
+// to the canonical ID, keeping the rest of its metadata, and returns the
+// number of vectors tagged. Vectors that no longer exist are skipped.
+func (db *DB) TagDuplicates(groups []DuplicateGroup, key string) (int, error) {
+	if db.db == nil || key == "" {
+		return 0, ErrInvalidArgs
+	}
+
+	tagged := 0
+	for _, group := range groups {
+		for _, id := range group.Duplicates {
+			ok, err := db.tagVector(id, key, group.Canonical)
+			if err != nil {
+				return tagged, err
+			}
+			if ok {
+				tagged++
+			}
+		}
+	}
+	return tagged, nil
+}
@@ -0,0 +1,45 @@
+package cvector
+
+// DimensionPolicy decides what happens to vectors whose length differs from
+// the database dimension, such as embeddings from a model revision with a
+// slightly different output size. It applies to inserted and query vectors.
+type DimensionPolicy int
+
+const (
+	// DimensionStrict rejects mismatched vectors with ErrDimensionMismatch
+	DimensionStrict DimensionPolicy = iota
+
+	// DimensionPad appends zeros to short vectors. Long vectors are rejected.
+	DimensionPad
+
+	// DimensionTruncate drops the trailing components of long vectors.
+	// Short vectors are rejected.
+	DimensionTruncate
+)
+
+// adapt resizes data to dimension when the policy allows it, returning data
+// unchanged otherwise so the engine reports the mismatch
+func (p DimensionPolicy) adapt(data []float32, dimension int) []float32 {
+	switch {
+	case p == DimensionPad && len(data) < dimension:
+		padded := make([]float32, dimension)
+		copy(padded, data)
+		return padded
+	case p == DimensionTruncate && len(data) > dimension:
+		return data[:dimension:dimension]
+	default:
+		return data
+	}
+}
+
+// conform maps an input vector into the stored space: resizing it under
+// the dimension policy, then applying the PCA projection if there is one.
+// Reduced databases resize towards the projection's source dimension
+// unless the vector already has the stored dimension.
+func (db *DB) conform(data []float32) ([]float32, error) {
+	dimension := int(db.dimension)
+	if db.pca != nil && len(data) != dimension {
+		dimension = db.pca.SourceDimension
+	}
+	return db.project(db.dimensionPolicy.adapt(data, dimension))
+}
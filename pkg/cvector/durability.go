@@ -0,0 +1,111 @@
+package cvector
+
+/*
+#include "core/cvector.h"
+*/
+import "C"
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SyncMode decides when writes are forced to stable storage
+type SyncMode int
+
+const (
+	// SyncOS leaves writes in the OS page cache until the kernel writes
+	// them back or Flush is called. It is the fastest mode, but a power
+	// loss or kernel crash can drop recent writes. This is the default.
+	SyncOS SyncMode = iota
+
+	// SyncAlways flushes after every insert and delete, before the call
+	// returns. Nothing acknowledged is lost, at the cost of one fsync per
+	// write.
+	SyncAlways
+
+	// SyncInterval flushes in the background every DBConfig.SyncInterval,
+	// bounding how much a crash can lose while keeping writes fast
+	SyncInterval
+)
+
+const defaultSyncInterval = time.Second
+
+// Flush forces every write made so far, including metadata, audit entries
+// and buffered inserts, to stable storage. With a write buffer it returns
+// the first buffered insert that failed since the previous Flush.
+func (db *DB) Flush() error {
+	if db.db == nil {
+		return ErrInvalidArgs
+	}
+	if db.writeBuffer != nil {
+		if err := db.writeBuffer.drain(); err != nil {
+			return err
+		}
+	}
+
+	if result := C.cvector_flush(db.db); result != 0 {
+		return db.engineError("flush", Error(result))
+	}
+	return syncSidecars(db.meta, db.auditLog)
+}
+
+// syncWrite flushes after a mutation under SyncAlways
+func (db *DB) syncWrite() error {
+	if db.syncMode != SyncAlways {
+		return nil
+	}
+	return db.Flush()
+}
+
+// flushFiles is Flush for the background syncer, which holds the handles
+// rather than the DB
+func flushFiles(cDB *C.cvector_db_t, path string, meta *metaStore, audit *auditLog) error {
+	if result := C.cvector_flush(cDB); result != 0 {
+		return newOpError("flush", path, 0, Error(result))
+	}
+	return syncSidecars(meta, audit)
+}
+
+func syncSidecars(meta *metaStore, audit *auditLog) error {
+	if err := meta.sync(); err != nil {
+		return err
+	}
+	if audit != nil {
+		return audit.sync()
+	}
+	return nil
+}
+
+// syncer runs flush on a ticker until stopped
+type syncer struct {
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func startSyncer(interval time.Duration, logger *slog.Logger, flush func() error) *syncer {
+	s := &syncer{done: make(chan struct{})}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := flush(); err != nil {
+					logger.Error("cvector background flush failed", "error", err)
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// stop ends the background loop and waits for an in-flight flush
+func (s *syncer) stop() {
+	close(s.done)
+	s.wg.Wait()
+}
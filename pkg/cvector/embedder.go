@@ -0,0 +1,75 @@
+package cvector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNoEmbedder is returned by the text operations when no Embedder has
+// been attached with WithEmbedder
+var ErrNoEmbedder = errors.New("cvector: no embedder configured")
+
+// Embedder turns text into vectors. Implementations return one vector per
+// input, in input order, each of the database's dimension.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// WithEmbedder attaches e for InsertText and SearchText and returns db so
+// the call can be chained after opening
+func (db *DB) WithEmbedder(e Embedder) *DB {
+	db.embedder = e
+	return db
+}
+
+// InsertText embeds text and stores the vector under id with metadata
+func (db *DB) InsertText(ctx context.Context, id uint64, text string, metadata map[string]any) error {
+	vectors, err := db.embed(ctx, []string{text})
+	if err != nil {
+		return err
+	}
+
+	vector := NewVector(id, vectors[0])
+	vector.Metadata = metadata
+	return db.Insert(vector)
+}
+
+// SearchText embeds query and returns its k nearest vectors under the
+// database's default similarity
+func (db *DB) SearchText(ctx context.Context, query string, k int) ([]*Result, error) {
+	if k <= 0 {
+		return nil, ErrInvalidArgs
+	}
+
+	vectors, err := db.embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.Search(&Query{
+		QueryVector: vectors[0],
+		TopK:        uint32(k),
+		Similarity:  stats.DefaultSimilarity,
+	})
+}
+
+func (db *DB) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if db.embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+
+	vectors, err := db.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("cvector: embedder returned %d vectors for %d texts", len(vectors), len(texts))
+	}
+	return vectors, nil
+}
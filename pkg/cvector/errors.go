@@ -0,0 +1,61 @@
+package cvector
+
+/*
+#include "core/cvector.h"
+*/
+import "C"
+import (
+	"fmt"
+	"strings"
+)
+
+// OpError is returned when the C engine rejects an operation. It records
+// which call failed and unwraps to its Code, so callers can still test for
+// a specific failure with errors.Is(err, ErrVectorNotFound).
+type OpError struct {
+	Op     string // Engine operation, such as "insert" or "open"
+	Path   string // Database file the operation ran against
+	ID     uint64 // Vector ID, zero when the operation is not about one vector
+	Code   Error
+	Detail string // Message reported by the engine for Code
+}
+
+func (e *OpError) Error() string {
+	var b strings.Builder
+	b.WriteString("cvector ")
+	b.WriteString(e.Op)
+	if e.Path != "" {
+		fmt.Fprintf(&b, " %s", e.Path)
+	}
+	if e.ID != 0 {
+		fmt.Fprintf(&b, " id %d", e.ID)
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Detail)
+	return b.String()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Code
+}
+
+// newOpError wraps a non-zero engine result, taking the message from the
+// engine itself rather than the Go-side table
+func newOpError(op, path string, id uint64, result Error) *OpError {
+	detail := C.GoString(C.cvector_error_string(C.cvector_error_t(result)))
+	if limit := MemoryLimit(); result == ErrOutOfMemory && limit > 0 {
+		detail = fmt.Sprintf("%s (memory limit %d bytes, %d charged)", detail, limit, MemoryCharged())
+	}
+	if result == ErrLocked && path != "" {
+		if pid, err := LockHolder(path); err == nil && pid > 0 {
+			detail = fmt.Sprintf("%s (held by process %d)", detail, pid)
+		}
+	}
+	return &OpError{
+		Op:     op,
+		Path:   path,
+		ID:     id,
+		Code:   result,
+		Detail: detail,
+	}
+}
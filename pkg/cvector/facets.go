@@ -0,0 +1,83 @@
+package cvector
+
+import "fmt"
+
+// SearchFacets performs a search and also counts, for each metadata key in
+// query.Facets, how many vectors hold each of its values, so a UI can render
+// a filter sidebar from the same call. The counts cover every vector the
+// query's filters admit, not only the TopK returned. Values are keyed by
+// their printed form, numbers alike whatever their Go type; vectors without
+// the key, or with a list or object under it, are not counted.
+func (db *DB) SearchFacets(query *Query) ([]*Result, map[string]map[string]int, error) {
+	results, err := db.Search(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	facets, err := db.facets(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return results, facets, nil
+}
+
+// facets counts the values of query.Facets over the vectors its filters
+// admit
+func (db *DB) facets(query *Query) (map[string]map[string]int, error) {
+	counts := make(map[string]map[string]int, len(query.Facets))
+	for _, key := range query.Facets {
+		counts[key] = make(map[string]int)
+	}
+	if len(counts) == 0 {
+		return counts, nil
+	}
+
+	matched, err := db.matchingMetadata(query)
+	if err != nil {
+		return nil, err
+	}
+	for _, md := range matched {
+		for key, values := range counts {
+			if value, ok := facetValue(md[key]); ok {
+				values[value]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+// matchingMetadata returns the metadata of every vector query's filters
+// admit, skipping those without any
+func (db *DB) matchingMetadata(query *Query) ([]map[string]any, error) {
+	admit, candidates, err := db.queryFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	entries := db.meta.view()
+	var matched []map[string]any
+	if candidates != nil {
+		// Fewer to visit than the whole database
+		for id := range candidates {
+			if md, ok := entries[id]; ok && admit(id) {
+				matched = append(matched, md)
+			}
+		}
+		return matched, nil
+	}
+	for id, md := range entries {
+		if admit == nil || admit(id) {
+			matched = append(matched, md)
+		}
+	}
+	return matched, nil
+}
+
+// facetValue returns the printed form of a metadata value that facets and
+// top-value aggregations group by, numbers alike whatever their Go type.
+// ok is false for lists and objects.
+func facetValue(value any) (string, bool) {
+	key, ok := indexKey(value)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(key), true
+}
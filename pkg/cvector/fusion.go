@@ -0,0 +1,117 @@
+package cvector
+
+import "sort"
+
+// FusionMethod names how ranked result lists are merged into one
+type FusionMethod string
+
+const (
+	// FusionRRF scores each vector by reciprocal rank fusion: the sum over
+	// the lists it appears in of weight/(RRFK+rank), with ranks from 1. It
+	// needs no comparable scores, so it suits lists from different metrics.
+	FusionRRF FusionMethod = "rrf"
+
+	// FusionWeightedSum scores each vector by the weighted sum of its
+	// similarities, with lists it is missing from adding nothing
+	FusionWeightedSum FusionMethod = "weighted_sum"
+)
+
+// defaultRRFK is the customary rank constant for reciprocal rank fusion
+const defaultRRFK = 60
+
+// Fusion configures how FuseResults and SearchFused merge result lists
+type Fusion struct {
+	Method  FusionMethod // Defaults to FusionRRF
+	Weights []float32    // One per list; nil weights every list 1
+	RRFK    int          // Rank constant for FusionRRF; zero uses 60
+	TopK    int          // Results to keep; zero keeps all
+}
+
+// FuseResults merges ranked result lists, each best first, into one list
+// ordered by fused score, which is reported as each result's Similarity.
+// Ties are broken by ascending ID. For FusionWeightedSum the lists' scores
+// should be on a common scale, such as from Query.NormalizeScores.
+func FuseResults(fusion Fusion, lists ...[]*Result) ([]*Result, error) {
+	if fusion.Weights != nil && len(fusion.Weights) != len(lists) {
+		return nil, ErrInvalidArgs
+	}
+	if fusion.RRFK < 0 || fusion.TopK < 0 {
+		return nil, ErrInvalidArgs
+	}
+	rrfK := fusion.RRFK
+	if rrfK == 0 {
+		rrfK = defaultRRFK
+	}
+
+	var contribution func(rank int, r *Result) float64
+	switch fusion.Method {
+	case FusionRRF, "":
+		contribution = func(rank int, _ *Result) float64 { return 1 / float64(rrfK+rank+1) }
+	case FusionWeightedSum:
+		contribution = func(_ int, r *Result) float64 { return float64(r.Similarity) }
+	default:
+		return nil, ErrInvalidArgs
+	}
+
+	scores := make(map[uint64]float64)
+	first := make(map[uint64]*Result)
+	for i, list := range lists {
+		weight := float64(1)
+		if fusion.Weights != nil {
+			weight = float64(fusion.Weights[i])
+		}
+		for rank, r := range list {
+			scores[r.ID] += weight * contribution(rank, r)
+			if _, ok := first[r.ID]; !ok {
+				first[r.ID] = r
+			}
+		}
+	}
+
+	fused := make([]*Result, 0, len(scores))
+	for id, score := range scores {
+		fused = append(fused, &Result{ID: id, Similarity: float32(score), Vector: first[id].Vector})
+	}
+	sort.Slice(fused, func(i, j int) bool {
+		if fused[i].Similarity != fused[j].Similarity {
+			return fused[i].Similarity > fused[j].Similarity
+		}
+		return fused[i].ID < fused[j].ID
+	})
+	if fusion.TopK > 0 && len(fused) > fusion.TopK {
+		fused = fused[:fusion.TopK]
+	}
+	return fused, nil
+}
+
+// SearchFused runs each query with Search and merges the results with
+// FuseResults, as for a multi-vector query. For FusionWeightedSum the
+// queries are scored with NormalizeScores, so different metrics combine on
+// the same 0-1 scale. TopK left zero keeps the database's default top-k.
+func (db *DB) SearchFused(queries []*Query, fusion Fusion) ([]*Result, error) {
+	if len(queries) == 0 {
+		return nil, ErrInvalidArgs
+	}
+
+	lists := make([][]*Result, len(queries))
+	for i, query := range queries {
+		if query == nil {
+			return nil, ErrInvalidArgs
+		}
+		if fusion.Method == FusionWeightedSum {
+			q := *query
+			q.NormalizeScores = true
+			query = &q
+		}
+		results, err := db.Search(query)
+		if err != nil {
+			return nil, err
+		}
+		lists[i] = results
+	}
+
+	if fusion.TopK == 0 {
+		fusion.TopK = int(db.QueryDefaults().TopK)
+	}
+	return FuseResults(fusion, lists...)
+}
@@ -0,0 +1,91 @@
+package cvector
+
+import "math"
+
+// earthRadiusMeters is the mean radius of the Earth
+const earthRadiusMeters = 6371008.8
+
+// geoCellDegrees is the side of the cells the geo index buckets points
+// into. A point lies within geoCellReach of its cell's centre.
+const geoCellDegrees = 0.25
+
+var geoCellReach = geoCellDegrees / 2 * math.Sqrt2 * math.Pi / 180 * earthRadiusMeters
+
+// GeoPoint is a location in degrees. It is stored in metadata as
+// {"lat": ..., "lon": ...}, and values of that form are read back as
+// points.
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func (p GeoPoint) valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 180
+}
+
+// DistanceMeters returns the great-circle distance between p and q
+func (p GeoPoint) DistanceMeters(q GeoPoint) float64 {
+	lat1, lat2 := p.Lat*math.Pi/180, q.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (q.Lon - p.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(min(h, 1)))
+}
+
+// GeoRadius keeps only vectors whose geo metadata Field lies within
+// Meters of Center, for queries like "similar items near me"
+type GeoRadius struct {
+	Field  string
+	Center GeoPoint
+	Meters float64
+}
+
+func (r *GeoRadius) contains(p GeoPoint) bool {
+	return r.Center.DistanceMeters(p) <= r.Meters
+}
+
+// geoValue reads a metadata value as a point: a GeoPoint, or a map with
+// numeric lat and lon keys as it comes back from the sidecar
+func geoValue(value any) (GeoPoint, bool) {
+	switch v := value.(type) {
+	case GeoPoint:
+		return v, v.valid()
+	case *GeoPoint:
+		if v == nil {
+			return GeoPoint{}, false
+		}
+		return *v, v.valid()
+	case map[string]any:
+		if len(v) != 2 {
+			return GeoPoint{}, false
+		}
+		lat, latOK := indexKey(v["lat"])
+		lon, lonOK := indexKey(v["lon"])
+		if !latOK || !lonOK {
+			return GeoPoint{}, false
+		}
+		p := GeoPoint{}
+		var ok bool
+		if p.Lat, ok = lat.(float64); !ok {
+			return GeoPoint{}, false
+		}
+		if p.Lon, ok = lon.(float64); !ok {
+			return GeoPoint{}, false
+		}
+		return p, p.valid()
+	}
+	return GeoPoint{}, false
+}
+
+// geoCell is a cell of the geo index
+type geoCell struct {
+	lat, lon int32
+}
+
+func cellOf(p GeoPoint) geoCell {
+	return geoCell{int32(math.Floor(p.Lat / geoCellDegrees)), int32(math.Floor(p.Lon / geoCellDegrees))}
+}
+
+func (c geoCell) centre() GeoPoint {
+	return GeoPoint{(float64(c.lat) + 0.5) * geoCellDegrees, (float64(c.lon) + 0.5) * geoCellDegrees}
+}
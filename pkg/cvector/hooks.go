@@ -0,0 +1,95 @@
+package cvector
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// HookOp names the call a hook is wrapping
+type HookOp string
+
+const (
+	HookInsert  HookOp = "insert"
+	HookDelete  HookOp = "delete"
+	HookSearch  HookOp = "search"
+	HookCompact HookOp = "compact"
+
+	HookUpdateMetadata HookOp = "update_metadata"
+	HookSetTags        HookOp = "set_tags"
+)
+
+// Call describes an Insert, Delete, Search, Compact, metadata update or
+// tag change passing through the hooks. A hook may change its inputs
+// before calling next, and its outputs after.
+type Call struct {
+	Op    HookOp
+	Actor string // Caller recorded in the audit log, for writes
+
+	Vector  *Vector                   // Insert
+	ID      uint64                    // Delete and SetTags
+	Tags    []string                  // SetTags
+	Patches map[uint64]map[string]any // UpdateMetadata, by vector ID
+	Query   *Query                    // Search; SearchRadius queries have Radius set
+	Radius  bool
+
+	// Background marks a compaction started by the GC policy rather than
+	// a call to Compact
+	Background bool
+
+	// Results holds the search results once next returns. A hook that
+	// answers a search itself, from a cache say, sets it and returns nil
+	// without calling next.
+	Results []*Result
+}
+
+// Hook wraps Insert, Delete, Search, Compact, UpdateMetadata and SetTags
+// in the manner of HTTP middleware. It runs the call by invoking next,
+// vetoes it by returning an error without doing so, and can observe the
+// outcome by inspecting what next returns. The As, Explain, Text and Many
+// variants pass through hooks too, as do compactions started by the GC
+// policy.
+type Hook func(call *Call, next func() error) error
+
+// Use adds hook to the chain run by every later Insert, Delete, Search,
+// Compact, UpdateMetadata and SetTags. Hooks run in the order they were
+// added, the first outermost. It is safe to call while other operations
+// are in flight.
+func (db *DB) Use(hook Hook) {
+	if hook == nil {
+		return
+	}
+	db.hooks.add(hook)
+}
+
+// hookChain holds the hooks copy-on-write, so running them takes no lock
+type hookChain struct {
+	mu    sync.Mutex // Serializes add
+	hooks atomic.Pointer[[]Hook]
+}
+
+func (h *hookChain) add(hook Hook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hooks := []Hook{hook}
+	if old := h.hooks.Load(); old != nil {
+		hooks = append(append([]Hook(nil), *old...), hook)
+	}
+	h.hooks.Store(&hooks)
+}
+
+// run passes call through the chain, with op at its centre
+func (h *hookChain) run(call *Call, op func() error) error {
+	hooks := h.hooks.Load()
+	if hooks == nil {
+		return op()
+	}
+
+	var next func(i int) error
+	next = func(i int) error {
+		if i == len(*hooks) {
+			return op()
+		}
+		return (*hooks)[i](call, func() error { return next(i + 1) })
+	}
+	return next(0)
+}
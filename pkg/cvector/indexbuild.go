@@ -0,0 +1,130 @@
+package cvector
+
+/*
+#include "core/cvector.h"
+*/
+import "C"
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// indexBatch is how many vectors the background build adds to the index
+// per engine call. Writes wait for at most one batch, and get the lock
+// during the pause the builder takes between batches.
+const (
+	indexBatch = 1024
+	indexPause = time.Millisecond
+)
+
+// IndexProgress reports how much of the database the ANN index covers; see
+// DB.IndexStatus
+type IndexProgress struct {
+	Status   IndexStatus
+	Building bool // A background build is adding vectors to the index
+	Indexed  int  // Vectors in the index
+	Pending  int  // Live vectors missing from the index, which searches scan
+	Total    int  // Live vectors
+}
+
+// Fraction is the share of live vectors in the index, 1 for an empty
+// database
+func (p *IndexProgress) Fraction() float64 {
+	if p.Total == 0 {
+		return 1
+	}
+	return float64(p.Total-p.Pending) / float64(p.Total)
+}
+
+// IndexStatus reports the ANN index's coverage and, for a database opened
+// with BackgroundIndex, how far the build has got. Vectors still missing
+// from the index are found by searches all the same, by scanning them.
+func (db *DB) IndexStatus() (*IndexProgress, error) {
+	if db.db == nil {
+		return nil, ErrInvalidArgs
+	}
+
+	var cStats C.cvector_db_stats_t
+	if result := C.cvector_db_stats(db.db, &cStats); result != 0 {
+		return nil, db.engineError("stats", Error(result))
+	}
+	return newIndexProgress(&cStats), nil
+}
+
+func newIndexProgress(cStats *C.cvector_db_stats_t) *IndexProgress {
+	p := &IndexProgress{
+		Status:   IndexStatusNone,
+		Building: bool(cStats.index_building),
+		Indexed:  int(cStats.indexed_vectors),
+		Pending:  int(cStats.unindexed_vectors),
+		Total:    int(cStats.total_vectors),
+	}
+	switch {
+	case !bool(cStats.index_enabled):
+		p.Pending = 0
+	case p.Building:
+		p.Status = IndexStatusBuilding
+	case p.Pending > 0:
+		p.Status = IndexStatusPartial
+	default:
+		p.Status = IndexStatusReady
+	}
+	return p
+}
+
+// indexBuilder fills in the index of a database opened with
+// BackgroundIndex, one batch at a time so writes get the lock in between.
+// Like the collector it holds the handle rather than the DB.
+type indexBuilder struct {
+	cDB    *C.cvector_db_t
+	path   string
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func startIndexBuilder(cDB *C.cvector_db_t, path string, logger *slog.Logger) *indexBuilder {
+	b := &indexBuilder{cDB: cDB, path: path, logger: logger}
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+func (b *indexBuilder) run() {
+	defer b.wg.Done()
+	start := time.Now()
+	for {
+		b.mu.Lock()
+		if b.stopped {
+			b.mu.Unlock()
+			return
+		}
+		var remaining C.size_t
+		result := C.cvector_build_index(b.cDB, indexBatch, &remaining)
+		b.mu.Unlock()
+
+		if result != 0 {
+			// Searches keep scanning whatever the index is missing
+			b.logger.Error("cvector background index build failed", "path", b.path,
+				"pending", int(remaining), "error", newOpError("build_index", b.path, 0, Error(result)))
+			return
+		}
+		if remaining == 0 {
+			b.logger.Info("cvector index built", "path", b.path, "duration", time.Since(start))
+			return
+		}
+		time.Sleep(indexPause)
+	}
+}
+
+// stop ends the build after the batch in flight, leaving the rest of the
+// vectors to be scanned until the next open
+func (b *indexBuilder) stop() {
+	b.mu.Lock()
+	b.stopped = true
+	b.mu.Unlock()
+	b.wg.Wait()
+}
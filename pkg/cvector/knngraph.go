@@ -0,0 +1,78 @@
+package cvector
+
+import "sort"
+
+// knnBlockRows is how many source vectors are scored per distance matrix
+// call, bounding the scratch matrix to knnBlockRows * vector count floats
+const knnBlockRows = 256
+
+// KNNEdge links a vector to one of its nearest neighbors
+type KNNEdge struct {
+	Source uint64
+	Target uint64
+	Rank   int     // 1 for the nearest neighbor
+	Score  float32 // Similarity, or distance for SimilarityEuclidean
+}
+
+// KNNGraph computes the exact k-nearest-neighbor graph of the stored
+// vectors under metric, calling fn with each vector's k neighbors in rank
+// order. Vectors never link to themselves. The cost grows with the square
+// of the number of vectors, which makes the result a ground truth for
+// judging the approximate index.
+func (db *DB) KNNGraph(k int, metric SimilarityType, fn func(KNNEdge) error) error {
+	if db.db == nil || k <= 0 || fn == nil {
+		return ErrInvalidArgs
+	}
+
+	var ids []uint64
+	var vectors [][]float32
+	err := db.Iterate(func(v *Vector) error {
+		ids = append(ids, v.ID)
+		vectors = append(vectors, v.Data)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	better := func(a, b float32) bool { return a > b }
+	if metric == SimilarityEuclidean {
+		better = func(a, b float32) bool { return a < b }
+	}
+
+	neighbors := make([]int, 0, len(ids))
+	for start := 0; start < len(vectors); start += knnBlockRows {
+		end := min(start+knnBlockRows, len(vectors))
+
+		scores, err := DistanceMatrix(vectors[start:end], vectors, metric)
+		if err != nil {
+			return err
+		}
+
+		for i, row := range scores {
+			source := start + i
+
+			neighbors = neighbors[:0]
+			for j := range row {
+				if j != source {
+					neighbors = append(neighbors, j)
+				}
+			}
+			sort.Slice(neighbors, func(x, y int) bool {
+				a, b := row[neighbors[x]], row[neighbors[y]]
+				if a != b {
+					return better(a, b)
+				}
+				return ids[neighbors[x]] < ids[neighbors[y]]
+			})
+
+			for rank, j := range neighbors[:min(k, len(neighbors))] {
+				err := fn(KNNEdge{Source: ids[source], Target: ids[j], Rank: rank + 1, Score: row[j]})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
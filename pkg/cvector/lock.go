@@ -0,0 +1,40 @@
+package cvector
+
+/*
+#include <stdlib.h>
+#include "core/cvector.h"
+*/
+import "C"
+import "unsafe"
+
+// LockHolder reports the PID of the process holding the write lock on the
+// database at dbPath: 0 when nobody does, -1 when it is held by a process
+// that has not recorded its PID. Opening a database for writing, creating
+// it, dropping it and migrating it all take the lock, so they fail with
+// ErrLocked while it is held, in this process or another. Read-only opens
+// neither take it nor wait for it.
+func LockHolder(dbPath string) (int, error) {
+	cPath := C.CString(dbPath)
+	defer C.free(unsafe.Pointer(cPath))
+
+	var pid C.long
+	if result := C.cvector_lock_holder(cPath, &pid); result != 0 {
+		return 0, newOpError("lock_holder", dbPath, 0, Error(result))
+	}
+	return int(pid), nil
+}
+
+// ForceUnlock removes the lock file of the database at dbPath so it can be
+// opened again. Locks are released when their process exits, so this is
+// only needed for a holder that is hung, or on a filesystem that keeps
+// locks after their process is gone. Breaking the lock of a process that
+// is still writing lets two writers corrupt the file.
+func ForceUnlock(dbPath string) error {
+	cPath := C.CString(dbPath)
+	defer C.free(unsafe.Pointer(cPath))
+
+	if result := C.cvector_force_unlock(cPath); result != 0 {
+		return newOpError("force_unlock", dbPath, 0, Error(result))
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package cvector
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardLogger is used when no DBConfig.Logger is supplied
+var discardLogger = slog.New(slog.DiscardHandler)
+
+func loggerOrDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return discardLogger
+	}
+	return logger
+}
+
+// engineError converts a non-zero C result into an *OpError and logs it
+// with the operation that produced it. An "id" attribute becomes the
+// error's ID. Missing vectors and version conflicts are expected outcomes
+// of lookups and conditional writes, so they are logged at debug level
+// rather than as errors.
+func (db *DB) engineError(op string, result Error, attrs ...any) error {
+	level := slog.LevelError
+	if result == ErrVectorNotFound || result == ErrVersionConflict {
+		level = slog.LevelDebug
+	}
+
+	var id uint64
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if key, ok := attrs[i].(string); ok && key == "id" {
+			id, _ = attrs[i+1].(uint64)
+		}
+	}
+
+	attrs = append([]any{"op", op, "path", db.path, "code", int(result), "error", result.Error()}, attrs...)
+	db.logger.Log(context.Background(), level, "cvector engine error", attrs...)
+	return newOpError(op, db.path, id, result)
+}
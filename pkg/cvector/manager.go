@@ -0,0 +1,423 @@
+package cvector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// managerSuffix names the database files under a Manager's root
+const managerSuffix = ".cvdb"
+
+// ErrDatabaseInUse is returned by Manager.Drop while a call is using the
+// database
+var ErrDatabaseInUse = errors.New("cvector: database is in use")
+
+// ManagerConfig configures a Manager
+type ManagerConfig struct {
+	// Root is the directory holding one <name>.cvdb file per database. It
+	// is created if missing.
+	Root string
+
+	// Dimension, when set, creates a database of that dimension the first
+	// time its name is used. Zero makes unknown names fail with
+	// ErrDBNotFound. Databases made with Create, or already on disk, keep
+	// their own dimension and similarity whatever this is.
+	Dimension uint32
+
+	// Options apply to every database the Manager opens. Limits, when set,
+	// adds options for one database, such as WithMaxSize or WithAdmission,
+	// after Options.
+	Options []Option
+	Limits  func(name string) []Option
+
+	// IdleTimeout closes databases no call has used for this long. MaxOpen
+	// caps the databases held open, closing the least recently used idle
+	// one to make room. Zero disables either.
+	IdleTimeout time.Duration
+	MaxOpen     int
+}
+
+// Manager opens databases under a root directory by name on first use,
+// keeps them open for later calls, and closes them once idle. It is safe
+// for concurrent use.
+//
+//	m, err := cvector.NewManager(cvector.ManagerConfig{Root: "data", Dimension: 384, IdleTimeout: time.Minute})
+//	err = m.Do("tenant-42", func(db *cvector.DB) error { return db.Insert(v) })
+type Manager struct {
+	config ManagerConfig
+
+	mu     sync.Mutex
+	dbs    map[string]*managedDB
+	closed bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// managedDB is one database in the Manager. ready is closed once the open
+// finishes and gone once the close does; callers wait on them rather than
+// holding the Manager's lock across either.
+type managedDB struct {
+	db       *DB
+	err      error
+	refs     int
+	lastUsed time.Time
+	closing  bool
+	ready    chan struct{}
+	gone     chan struct{}
+}
+
+// NewManager returns a Manager for config, creating its root directory
+func NewManager(config ManagerConfig) (*Manager, error) {
+	switch {
+	case config.Root == "":
+		return nil, &ConfigError{"Root", "must not be empty"}
+	case config.IdleTimeout < 0:
+		return nil, &ConfigError{"IdleTimeout", fmt.Sprintf("must not be negative, got %v", config.IdleTimeout)}
+	case config.MaxOpen < 0:
+		return nil, &ConfigError{"MaxOpen", fmt.Sprintf("must not be negative, got %d", config.MaxOpen)}
+	}
+	if err := os.MkdirAll(config.Root, 0755); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{config: config, dbs: make(map[string]*managedDB), done: make(chan struct{})}
+	if config.IdleTimeout > 0 {
+		m.wg.Add(1)
+		go m.reapIdle()
+	}
+	return m, nil
+}
+
+// Path returns the file the named database is stored in
+func (m *Manager) Path(name string) string {
+	return filepath.Join(m.config.Root, name+managerSuffix)
+}
+
+// Create makes a database with its own dimension and default similarity,
+// so one root can hold collections of different embedding models side by
+// side. Options and Limits apply as they do to databases created on first
+// use. It fails with ErrFileIO if the name is taken.
+func (m *Manager) Create(name string, dimension uint32, similarity SimilarityType) error {
+	if !validDBName(name) {
+		return invalidDBName(name)
+	}
+	if fileExists(m.Path(name)) {
+		return fmt.Errorf("cvector: database %s already exists: %w", name, ErrFileIO)
+	}
+
+	opts := append(m.options(name), WithCreateIfMissing(dimension), WithSimilarity(similarity))
+	db, err := Open(m.Path(name), opts...)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// Do runs fn with the named database, opening or creating it as needed.
+// The database stays open at least until fn returns; fn must not keep it
+// afterwards.
+func (m *Manager) Do(name string, fn func(db *DB) error) error {
+	db, err := m.acquire(name)
+	if err != nil {
+		return err
+	}
+	defer m.release(name)
+	return fn(db)
+}
+
+// Insert adds vector to the named database
+func (m *Manager) Insert(name string, vector *Vector) error {
+	return m.Do(name, func(db *DB) error { return db.Insert(vector) })
+}
+
+// Delete removes a vector from the named database
+func (m *Manager) Delete(name string, id uint64) error {
+	return m.Do(name, func(db *DB) error { return db.Delete(id) })
+}
+
+// Search runs query against the named database
+func (m *Manager) Search(name string, query *Query) ([]*Result, error) {
+	var results []*Result
+	err := m.Do(name, func(db *DB) error {
+		var err error
+		results, err = db.Search(query)
+		return err
+	})
+	return results, err
+}
+
+// Names lists the databases under the root, open or not, sorted
+func (m *Manager) Names() ([]string, error) {
+	entries, err := os.ReadDir(m.config.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), managerSuffix)
+		if ok && !entry.IsDir() && validDBName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// OpenCount reports how many databases the Manager holds open
+func (m *Manager) OpenCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.openLocked()
+}
+
+// Drop closes the named database and removes its files. It fails with
+// ErrDatabaseInUse while a Do call is using it.
+func (m *Manager) Drop(name string) error {
+	if !validDBName(name) {
+		return invalidDBName(name)
+	}
+
+	m.mu.Lock()
+	if entry, ok := m.dbs[name]; ok {
+		if entry.refs > 0 {
+			m.mu.Unlock()
+			return ErrDatabaseInUse
+		}
+		m.evictLocked(name, entry)
+	}
+	m.mu.Unlock()
+
+	if err := m.wait(name); err != nil {
+		return err
+	}
+	return DropDB(m.Path(name))
+}
+
+// Close closes every open database and stops the idle timer. Calls made
+// afterwards fail with ErrInvalidArgs.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.done)
+	m.mu.Unlock()
+
+	m.wg.Wait()
+
+	// Waits for calls in flight, which release their databases as they finish
+	var firstErr error
+	for {
+		m.mu.Lock()
+		var pending []*managedDB
+		for name, entry := range m.dbs {
+			if !entry.closing && entry.refs == 0 {
+				m.evictLocked(name, entry)
+			}
+			pending = append(pending, entry)
+		}
+		m.mu.Unlock()
+		if len(pending) == 0 {
+			return firstErr
+		}
+		for _, entry := range pending {
+			if entry.closing {
+				<-entry.gone
+				if entry.err != nil && firstErr == nil {
+					firstErr = entry.err
+				}
+			} else {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+}
+
+// acquire returns the named database with a reference held
+func (m *Manager) acquire(name string) (*DB, error) {
+	if !validDBName(name) {
+		return nil, invalidDBName(name)
+	}
+
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return nil, ErrInvalidArgs
+		}
+		entry, ok := m.dbs[name]
+		if ok && entry.closing {
+			// Let the close finish before opening the file again
+			m.mu.Unlock()
+			<-entry.gone
+			continue
+		}
+		if ok {
+			entry.refs++
+			entry.lastUsed = time.Now()
+			m.mu.Unlock()
+			<-entry.ready
+			if entry.err != nil {
+				m.release(name)
+				return nil, entry.err
+			}
+			return entry.db, nil
+		}
+
+		entry = &managedDB{refs: 1, lastUsed: time.Now(), ready: make(chan struct{}), gone: make(chan struct{})}
+		m.dbs[name] = entry
+		m.evictForRoomLocked()
+		m.mu.Unlock()
+
+		entry.db, entry.err = m.open(name)
+		close(entry.ready)
+		if entry.err != nil {
+			m.mu.Lock()
+			entry.closing = true
+			delete(m.dbs, name)
+			close(entry.gone)
+			m.mu.Unlock()
+			return nil, entry.err
+		}
+		return entry.db, nil
+	}
+}
+
+func (m *Manager) release(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if entry, ok := m.dbs[name]; ok && !entry.closing {
+		entry.refs--
+		entry.lastUsed = time.Now()
+	}
+}
+
+func (m *Manager) open(name string) (*DB, error) {
+	opts := m.options(name)
+	if m.config.Dimension > 0 && !fileExists(m.Path(name)) {
+		opts = append(opts, WithCreateIfMissing(m.config.Dimension))
+	}
+	return Open(m.Path(name), opts...)
+}
+
+// options returns the Options and Limits for the named database
+func (m *Manager) options(name string) []Option {
+	opts := append([]Option(nil), m.config.Options...)
+	if m.config.Limits != nil {
+		opts = append(opts, m.config.Limits(name)...)
+	}
+	return opts
+}
+
+// evictForRoomLocked closes least recently used idle databases while more
+// than MaxOpen are open
+func (m *Manager) evictForRoomLocked() {
+	if m.config.MaxOpen == 0 {
+		return
+	}
+	for m.openLocked() > m.config.MaxOpen {
+		var oldest string
+		var oldestEntry *managedDB
+		for name, entry := range m.dbs {
+			if entry.closing || entry.refs > 0 {
+				continue
+			}
+			if oldestEntry == nil || entry.lastUsed.Before(oldestEntry.lastUsed) {
+				oldest, oldestEntry = name, entry
+			}
+		}
+		if oldestEntry == nil {
+			return // Everything is in use; allow the overshoot
+		}
+		m.evictLocked(oldest, oldestEntry)
+	}
+}
+
+// openLocked counts databases that are not already closing
+func (m *Manager) openLocked() int {
+	n := 0
+	for _, entry := range m.dbs {
+		if !entry.closing {
+			n++
+		}
+	}
+	return n
+}
+
+// evictLocked starts closing an idle database in the background. It leaves
+// the map once closed, so nobody reopens the file in the meantime.
+func (m *Manager) evictLocked(name string, entry *managedDB) {
+	entry.closing = true
+	go func() {
+		<-entry.ready
+		if entry.db != nil {
+			entry.err = entry.db.Close()
+		}
+		m.mu.Lock()
+		delete(m.dbs, name)
+		m.mu.Unlock()
+		close(entry.gone)
+	}()
+}
+
+// wait blocks until the named database is not being closed
+func (m *Manager) wait(name string) error {
+	m.mu.Lock()
+	entry, ok := m.dbs[name]
+	m.mu.Unlock()
+	if !ok || !entry.closing {
+		return nil
+	}
+	<-entry.gone
+	return entry.err
+}
+
+func (m *Manager) reapIdle() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(max(m.config.IdleTimeout/4, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.mu.Lock()
+			for name, entry := range m.dbs {
+				if !entry.closing && entry.refs == 0 && time.Since(entry.lastUsed) >= m.config.IdleTimeout {
+					m.evictLocked(name, entry)
+				}
+			}
+			m.mu.Unlock()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// validDBName accepts names that stay inside the root: letters, digits,
+// '-', '_' and '.', not starting with '.'
+func validDBName(name string) bool {
+	if name == "" || name[0] == '.' {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func invalidDBName(name string) error {
+	return fmt.Errorf("cvector: invalid database name %q: %w", name, ErrInvalidArgs)
+}
@@ -0,0 +1,109 @@
+package cvector
+
+/*
+#include "core/cvector.h"
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"unsafe"
+)
+
+// DistanceMatrix scores every vector in a against every vector in b, so
+// result[i][j] compares a[i] with b[j]. Cosine and dot product give
+// similarities; Euclidean gives distances. All vectors must share one
+// dimension.
+func DistanceMatrix(a, b [][]float32, metric SimilarityType) ([][]float32, error) {
+	if len(a) == 0 || len(b) == 0 {
+		return nil, ErrInvalidArgs
+	}
+	dim := len(a[0])
+	if dim == 0 {
+		return nil, ErrInvalidArgs
+	}
+
+	cA, err := packVectors(a, dim)
+	if err != nil {
+		return nil, err
+	}
+	defer C.free(unsafe.Pointer(cA))
+
+	cB, err := packVectors(b, dim)
+	if err != nil {
+		return nil, err
+	}
+	defer C.free(unsafe.Pointer(cB))
+
+	cOut := (*C.float)(C.malloc(C.size_t(len(a) * len(b) * 4)))
+	if cOut == nil {
+		return nil, ErrOutOfMemory
+	}
+	defer C.free(unsafe.Pointer(cOut))
+
+	result := C.cvector_distance_matrix(cA, C.size_t(len(a)), cB, C.size_t(len(b)),
+		C.uint32_t(dim), C.cvector_similarity_t(metric), cOut)
+	if result != 0 {
+		return nil, newOpError("distance_matrix", "", 0, Error(result))
+	}
+
+	out := unsafe.Slice(cOut, len(a)*len(b))
+	matrix := make([][]float32, len(a))
+	for i := range matrix {
+		matrix[i] = make([]float32, len(b))
+		for j := range matrix[i] {
+			matrix[i][j] = float32(out[i*len(b)+j])
+		}
+	}
+	return matrix, nil
+}
+
+// DistanceMatrix scores the stored vectors with IDs in a against those with
+// IDs in b, as the package-level DistanceMatrix does. Every ID must exist.
+func (db *DB) DistanceMatrix(a, b []uint64, metric SimilarityType) ([][]float32, error) {
+	if db.db == nil {
+		return nil, ErrInvalidArgs
+	}
+
+	vectorsA, err := db.getAll(a)
+	if err != nil {
+		return nil, err
+	}
+	vectorsB, err := db.getAll(b)
+	if err != nil {
+		return nil, err
+	}
+	return DistanceMatrix(vectorsA, vectorsB, metric)
+}
+
+func (db *DB) getAll(ids []uint64) ([][]float32, error) {
+	vectors := make([][]float32, len(ids))
+	for i, id := range ids {
+		v, err := db.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		vectors[i] = v.Data
+	}
+	return vectors, nil
+}
+
+// packVectors copies vectors into one row-major C buffer, which the caller
+// must free
+func packVectors(vectors [][]float32, dim int) (*C.float, error) {
+	cData := (*C.float)(C.malloc(C.size_t(len(vectors) * dim * 4)))
+	if cData == nil {
+		return nil, ErrOutOfMemory
+	}
+
+	data := unsafe.Slice(cData, len(vectors)*dim)
+	for i, v := range vectors {
+		if len(v) != dim {
+			C.free(unsafe.Pointer(cData))
+			return nil, ErrDimensionMismatch
+		}
+		for j, x := range v {
+			data[i*dim+j] = C.float(x)
+		}
+	}
+	return cData, nil
+}
@@ -0,0 +1,31 @@
+package cvector
+
+/*
+#include "core/cvector.h"
+*/
+import "C"
+
+// SetMemoryLimit caps the bytes the C engine holds in read caches and HNSW
+// indexes, across every open database in the process. Inserts that would
+// grow an index past the limit fail with ErrOutOfMemory, and nothing is
+// written. Caches shed entries instead. A database opened over the limit
+// keeps a partial index and falls back to scanning. Zero, the default,
+// removes the limit.
+func SetMemoryLimit(bytes int64) error {
+	if bytes < 0 {
+		return ErrInvalidArgs
+	}
+	C.cvector_set_memory_limit(C.size_t(bytes))
+	return nil
+}
+
+// MemoryLimit returns the limit set by SetMemoryLimit, zero for none
+func MemoryLimit() int64 {
+	return int64(C.cvector_memory_limit())
+}
+
+// MemoryCharged returns the bytes currently counted against the memory
+// limit. It is tracked whether or not a limit is set.
+func MemoryCharged() int64 {
+	return int64(C.cvector_memory_charged())
+}
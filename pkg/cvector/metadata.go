@@ -0,0 +1,1014 @@
+package cvector
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// metaSuffix is appended to the data path to name the metadata sidecar file
+const metaSuffix = ".meta"
+
+// metaRecord is a single line in the metadata sidecar. A vector's line
+// carries both its metadata and its tags. Lines carrying Properties
+// describe the database itself rather than a vector. Trashed
+// lines set aside the metadata of a soft-deleted vector, and Restored lines
+// bring it back.
+type metaRecord struct {
+	ID         uint64         `json:"id"`
+	Metadata   map[string]any `json:"metadata,omitempty"`
+	Tags       []string       `json:"tags,omitempty"`
+	Deleted    bool           `json:"deleted,omitempty"`
+	Trashed    bool           `json:"trashed,omitempty"`
+	Restored   bool           `json:"restored,omitempty"`
+	Properties *dbProperties  `json:"db,omitempty"`
+}
+
+// dbProperties are the editable, database-level attributes
+type dbProperties struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	DefaultTopK          uint32  `json:"default_top_k,omitempty"`
+	DefaultMinSimilarity float32 `json:"default_min_similarity,omitempty"`
+	DefaultOversample    int     `json:"default_oversample,omitempty"`
+	EfSearch             int     `json:"ef_search,omitempty"`
+
+	Schema *Schema `json:"schema,omitempty"` // Replaced, never modified, so it may be shared
+}
+
+// metaStore keeps per-vector metadata and tags in memory and persists
+// them as an append-only JSON-lines file next to the data file. The file
+// is compacted on close so it only grows within a session. Tags, and the
+// values of fields the schema marks indexed, are also indexed so filters
+// on them are set lookups.
+type metaStore struct {
+	mu        sync.RWMutex
+	path      string
+	entries   map[uint64]map[string]any
+	tags      map[uint64][]string                        // Sorted and distinct
+	tagIndex  map[string]map[uint64]struct{}             // IDs carrying each tag
+	fields    map[string]map[any]map[uint64]struct{}     // Indexed field, then value, to IDs; see indexKey
+	numbers   map[string][]numberEntry                   // Indexed numeric fields, sorted for range filters
+	points    map[string]map[geoCell]map[uint64]GeoPoint // Indexed geo fields, bucketed by cell
+	texts     map[string]*textIndex                      // Indexed text fields
+	trash     map[uint64]map[string]any                  // Metadata of soft-deleted vectors
+	trashTags map[uint64][]string                        // Tags of soft-deleted vectors
+	props     dbProperties
+	file      *os.File
+	dirty     bool
+
+	readOnly   bool // Set for read-only databases; writes fail with ErrReadOnly
+	syncWrites bool // fsync after every append, for SyncAlways
+}
+
+func metaPath(dbPath string) string {
+	return dbPath + metaSuffix
+}
+
+// openMetaStore loads the sidecar for dbPath, replaying it if present
+func openMetaStore(dbPath string) (*metaStore, error) {
+	m := &metaStore{
+		path:      metaPath(dbPath),
+		entries:   make(map[uint64]map[string]any),
+		tags:      make(map[uint64][]string),
+		tagIndex:  make(map[string]map[uint64]struct{}),
+		trash:     make(map[uint64]map[string]any),
+		trashTags: make(map[uint64][]string),
+	}
+
+	f, err := os.Open(m.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, ErrFileIO
+	}
+	defer f.Close()
+
+	var schema *Schema
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec metaRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// Skip a line torn by a crash mid-write
+			continue
+		}
+		switch {
+		case rec.Properties != nil:
+			m.props = *rec.Properties
+			m.props.Schema = nil // Set below, once the entries it indexes are loaded
+			schema = rec.Properties.Schema
+		case rec.Trashed:
+			m.applyTrash(rec.ID, rec.Metadata, rec.Tags)
+		case rec.Restored:
+			m.applyRestore(rec.ID)
+		case rec.Deleted:
+			m.applySet(rec.ID, nil, nil)
+		default:
+			m.applySet(rec.ID, rec.Metadata, rec.Tags)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ErrFileIO
+	}
+
+	m.props.Schema = schema
+	m.reindex()
+	return m, nil
+}
+
+// reload replaces the entries and properties with what the sidecar holds
+// now, for read-only stores following a writer
+func (m *metaStore) reload() error {
+	fresh, err := openMetaStore(strings.TrimSuffix(m.path, metaSuffix))
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = fresh.entries
+	m.tags = fresh.tags
+	m.tagIndex = fresh.tagIndex
+	m.fields = fresh.fields
+	m.numbers = fresh.numbers
+	m.points = fresh.points
+	m.texts = fresh.texts
+	m.trash = fresh.trash
+	m.trashTags = fresh.trashTags
+	m.props = fresh.props
+	return nil
+}
+
+// get returns a copy of the metadata stored for id, or nil
+func (m *metaStore) get(id uint64) map[string]any {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return copyMetadata(m.entries[id])
+}
+
+// value returns one metadata value stored for id
+func (m *metaStore) value(id uint64, key string) (any, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	v, ok := m.entries[id][key]
+	return v, ok
+}
+
+// view returns the metadata of every vector as it stands now. Entries are
+// replaced rather than modified, so later writes do not show through.
+func (m *metaStore) view() map[uint64]map[string]any {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return maps.Clone(m.entries)
+}
+
+// set replaces the metadata stored for id, keeping its tags
+func (m *metaStore) set(id uint64, metadata map[string]any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.putLocked(id, copyMetadata(metadata), m.tags[id])
+}
+
+// setTags replaces the tags stored for id, keeping its metadata
+func (m *metaStore) setTags(id uint64, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.putLocked(id, m.entries[id], normalizeTags(tags))
+}
+
+// put replaces both the metadata and the tags stored for id
+func (m *metaStore) put(id uint64, metadata map[string]any, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.putLocked(id, copyMetadata(metadata), normalizeTags(tags))
+}
+
+func (m *metaStore) putLocked(id uint64, md map[string]any, tags []string) error {
+	if err := m.props.Schema.validate(id, md); err != nil {
+		return err
+	}
+	if len(md) == 0 && len(tags) == 0 {
+		_, live := m.entries[id]
+		_, tagged := m.tags[id]
+		_, trashed := m.trash[id]
+		_, trashedTags := m.trashTags[id]
+		if !live && !tagged && !trashed && !trashedTags {
+			return nil
+		}
+		return m.appendLocked(metaRecord{ID: id, Deleted: true}, func() { m.applySet(id, nil, nil) })
+	}
+	return m.appendLocked(metaRecord{ID: id, Metadata: md, Tags: tags}, func() { m.applySet(id, md, tags) })
+}
+
+// patch merges each patch into the metadata of its ID, a nil value removing
+// the key, and keeps the tags. Every result is checked against the schema
+// before any is stored, so a rejected patch changes nothing.
+func (m *metaStore) patch(patches map[uint64]map[string]any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	merged := make(map[uint64]map[string]any, len(patches))
+	for id, patch := range patches {
+		md := copyMetadata(m.entries[id])
+		if md == nil {
+			md = make(map[string]any, len(patch))
+		}
+		for key, value := range patch {
+			if value == nil {
+				delete(md, key)
+			} else {
+				md[key] = value
+			}
+		}
+		if err := m.props.Schema.validate(id, md); err != nil {
+			return err
+		}
+		merged[id] = md
+	}
+	for id, md := range merged {
+		if err := m.putLocked(id, md, m.tags[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks metadata for id against the schema without storing it
+func (m *metaStore) validate(id uint64, metadata map[string]any) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.props.Schema.validate(id, metadata)
+}
+
+// getTags returns a copy of the tags stored for id, or nil
+func (m *metaStore) getTags(id uint64) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.tags[id])
+}
+
+// viewTags returns the tags of every vector as they stand now. Like view,
+// it is unaffected by later writes.
+func (m *metaStore) viewTags() map[uint64][]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return maps.Clone(m.tags)
+}
+
+// tagged returns the IDs carrying every one of tags
+func (m *metaStore) tagged(tags []string) map[uint64]bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Intersect starting from the rarest tag
+	sets := make([]map[uint64]struct{}, len(tags))
+	for i, tag := range tags {
+		sets[i] = m.tagIndex[tag]
+	}
+	slices.SortFunc(sets, func(a, b map[uint64]struct{}) int { return len(a) - len(b) })
+
+	ids := make(map[uint64]bool, len(sets[0]))
+outer:
+	for id := range sets[0] {
+		for _, set := range sets[1:] {
+			if _, ok := set[id]; !ok {
+				continue outer
+			}
+		}
+		ids[id] = true
+	}
+	return ids
+}
+
+// hasAnyTag reports whether id carries at least one of tags
+func (m *metaStore) hasAnyTag(id uint64, tags []string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, tag := range tags {
+		if _, ok := m.tagIndex[tag][id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applySet replaces the live metadata and tags of id, dropping any it had
+// in the trash
+func (m *metaStore) applySet(id uint64, md map[string]any, tags []string) {
+	m.setEntry(id, md)
+	m.applyTags(id, tags)
+	delete(m.trash, id)
+	delete(m.trashTags, id)
+}
+
+// setEntry replaces the live metadata of id, keeping the field indexes in
+// step
+func (m *metaStore) setEntry(id uint64, md map[string]any) {
+	for field, entries := range m.numbers {
+		if old, ok := indexKey(m.entries[id][field]); ok {
+			if x, ok := old.(float64); ok {
+				entries = removeNumber(entries, numberEntry{x, id})
+			}
+		}
+		if key, ok := indexKey(md[field]); ok {
+			if x, ok := key.(float64); ok {
+				entries = insertNumber(entries, numberEntry{x, id})
+			}
+		}
+		m.numbers[field] = entries
+	}
+	for field, cells := range m.points {
+		if old, ok := geoValue(m.entries[id][field]); ok {
+			cell := cellOf(old)
+			delete(cells[cell], id)
+			if len(cells[cell]) == 0 {
+				delete(cells, cell)
+			}
+		}
+		if p, ok := geoValue(md[field]); ok {
+			addPoint(cells, id, p)
+		}
+	}
+	for field, index := range m.texts {
+		if old, ok := m.entries[id][field].(string); ok {
+			index.remove(id, old)
+		}
+		if text, ok := md[field].(string); ok {
+			index.add(id, text)
+		}
+	}
+	for field, values := range m.fields {
+		if key, ok := indexKey(m.entries[id][field]); ok {
+			if ids := values[key]; ids != nil {
+				delete(ids, id)
+				if len(ids) == 0 {
+					delete(values, key)
+				}
+			}
+		}
+	}
+	if len(md) == 0 {
+		delete(m.entries, id)
+		return
+	}
+	m.entries[id] = md
+	for field, values := range m.fields {
+		if key, ok := indexKey(md[field]); ok {
+			ids := values[key]
+			if ids == nil {
+				ids = make(map[uint64]struct{})
+				values[key] = ids
+			}
+			ids[id] = struct{}{}
+		}
+	}
+}
+
+// reindex rebuilds the field indexes for the schema's indexed fields
+func (m *metaStore) reindex() {
+	m.fields = make(map[string]map[any]map[uint64]struct{})
+	m.numbers = make(map[string][]numberEntry)
+	for _, field := range m.props.Schema.indexedNumbers() {
+		var entries []numberEntry
+		for id, md := range m.entries {
+			if key, ok := indexKey(md[field]); ok {
+				if x, ok := key.(float64); ok {
+					entries = append(entries, numberEntry{x, id})
+				}
+			}
+		}
+		slices.SortFunc(entries, compareNumbers)
+		m.numbers[field] = entries
+	}
+	m.points = make(map[string]map[geoCell]map[uint64]GeoPoint)
+	for _, field := range m.props.Schema.indexedPoints() {
+		cells := make(map[geoCell]map[uint64]GeoPoint)
+		for id, md := range m.entries {
+			if p, ok := geoValue(md[field]); ok {
+				addPoint(cells, id, p)
+			}
+		}
+		m.points[field] = cells
+	}
+	m.texts = make(map[string]*textIndex)
+	for _, field := range m.props.Schema.indexedTexts() {
+		index := newTextIndex()
+		for id, md := range m.entries {
+			if text, ok := md[field].(string); ok {
+				index.add(id, text)
+			}
+		}
+		m.texts[field] = index
+	}
+	for _, field := range m.props.Schema.indexed() {
+		values := make(map[any]map[uint64]struct{})
+		for id, md := range m.entries {
+			if key, ok := indexKey(md[field]); ok {
+				ids := values[key]
+				if ids == nil {
+					ids = make(map[uint64]struct{})
+					values[key] = ids
+				}
+				ids[id] = struct{}{}
+			}
+		}
+		m.fields[field] = values
+	}
+}
+
+// setSchema replaces the schema once every live entry conforms to it
+func (m *metaStore) setSchema(schema *Schema) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, md := range m.entries {
+		if err := schema.validate(id, md); err != nil {
+			return err
+		}
+	}
+	props := m.props
+	props.Schema = schema
+	return m.appendLocked(metaRecord{Properties: &props}, func() {
+		m.props = props
+		m.reindex()
+	})
+}
+
+// filter resolves the metadata conditions of query: Filter, Ranges,
+// GeoRadius and Keywords. Those on indexed fields are answered up front, as the IDs
+// passing them all, or nil if there are none. The rest are left to check,
+// nil if there are none. Numbers of any type compare by value.
+func (m *metaStore) filter(query *Query) (ids map[uint64]bool, check func(id uint64) bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	narrow := func(matched map[uint64]bool) {
+		if ids == nil {
+			ids = matched
+			return
+		}
+		for id := range ids {
+			if !matched[id] {
+				delete(ids, id)
+			}
+		}
+	}
+
+	scanned := make(map[string]any) // Checked against the entries
+	for field, value := range query.Filter {
+		key, ok := indexKey(value)
+		if !ok {
+			return map[uint64]bool{}, nil
+		}
+		values, indexed := m.fields[field]
+		if !indexed {
+			scanned[field] = key
+			continue
+		}
+		matched := make(map[uint64]bool, len(values[key]))
+		for id := range values[key] {
+			matched[id] = true
+		}
+		narrow(matched)
+	}
+	scannedRanges := make(map[string]Range)
+	for field, r := range query.Ranges {
+		entries, indexed := m.numbers[field]
+		if !indexed {
+			scannedRanges[field] = r
+			continue
+		}
+		lo, _ := slices.BinarySearchFunc(entries, numberEntry{r.Min, 0}, compareNumbers)
+		matched := make(map[uint64]bool)
+		for _, e := range entries[lo:] {
+			if e.value > r.Max {
+				break
+			}
+			matched[e.id] = true
+		}
+		narrow(matched)
+	}
+	var scannedGeo *GeoRadius
+	if radius := query.GeoRadius; radius != nil {
+		if cells, indexed := m.points[radius.Field]; indexed {
+			// Any point in a cell is within geoCellReach of its centre
+			matched := make(map[uint64]bool)
+			for cell, points := range cells {
+				if radius.Center.DistanceMeters(cell.centre()) > radius.Meters+geoCellReach {
+					continue
+				}
+				for id, p := range points {
+					if radius.contains(p) {
+						matched[id] = true
+					}
+				}
+			}
+			narrow(matched)
+		} else {
+			scannedGeo = radius
+		}
+	}
+
+	var scannedKeywords *KeywordFilter
+	var words []string
+	if keywords := query.Keywords; keywords != nil {
+		words = distinctTokens(keywords.Text)
+		if index, indexed := m.texts[keywords.Field]; indexed {
+			narrow(index.containing(words))
+		} else {
+			scannedKeywords = keywords
+		}
+	}
+
+	if len(scanned) == 0 && len(scannedRanges) == 0 && scannedGeo == nil && scannedKeywords == nil {
+		return ids, nil
+	}
+	return ids, func(id uint64) bool {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		for field, want := range scanned {
+			if got, ok := indexKey(m.entries[id][field]); !ok || got != want {
+				return false
+			}
+		}
+		for field, r := range scannedRanges {
+			got, ok := indexKey(m.entries[id][field])
+			if x, isNumber := got.(float64); !ok || !isNumber || !r.contains(x) {
+				return false
+			}
+		}
+		if scannedGeo != nil {
+			p, ok := geoValue(m.entries[id][scannedGeo.Field])
+			if !ok || !scannedGeo.contains(p) {
+				return false
+			}
+		}
+		if scannedKeywords != nil {
+			text, _ := m.entries[id][scannedKeywords.Field].(string)
+			have := tokenize(text)
+			for _, word := range words {
+				if !slices.Contains(have, word) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+}
+
+// applyTags replaces the tags of id, keeping the index in step
+func (m *metaStore) applyTags(id uint64, tags []string) {
+	for _, tag := range m.tags[id] {
+		if ids := m.tagIndex[tag]; ids != nil {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(m.tagIndex, tag)
+			}
+		}
+	}
+	if len(tags) == 0 {
+		delete(m.tags, id)
+		return
+	}
+	m.tags[id] = tags
+	for _, tag := range tags {
+		ids := m.tagIndex[tag]
+		if ids == nil {
+			ids = make(map[uint64]struct{})
+			m.tagIndex[tag] = ids
+		}
+		ids[id] = struct{}{}
+	}
+}
+
+// moveToTrash sets aside the metadata and tags of a soft-deleted vector,
+// replacing any left by an earlier delete of the same ID
+func (m *metaStore) moveToTrash(id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	md, tags := m.entries[id], m.tags[id]
+	_, trashed := m.trash[id]
+	_, trashedTags := m.trashTags[id]
+	if md == nil && tags == nil && !trashed && !trashedTags {
+		return nil
+	}
+	return m.appendLocked(metaRecord{ID: id, Metadata: md, Tags: tags, Trashed: true}, func() { m.applyTrash(id, md, tags) })
+}
+
+// restore brings back metadata and tags set aside by moveToTrash, if any
+func (m *metaStore) restore(id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, trashed := m.trash[id]
+	_, trashedTags := m.trashTags[id]
+	if !trashed && !trashedTags {
+		return nil
+	}
+	return m.appendLocked(metaRecord{ID: id, Restored: true}, func() { m.applyRestore(id) })
+}
+
+// emptyTrash forgets the metadata of soft-deleted vectors once a compaction
+// has dropped their records. The sidecar catches up when it is compacted.
+func (m *metaStore) emptyTrash() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.trash) > 0 || len(m.trashTags) > 0 {
+		clear(m.trash)
+		clear(m.trashTags)
+		m.dirty = true
+	}
+}
+
+func (m *metaStore) applyTrash(id uint64, md map[string]any, tags []string) {
+	m.setEntry(id, nil)
+	m.applyTags(id, nil)
+	if md == nil {
+		delete(m.trash, id)
+	} else {
+		m.trash[id] = md
+	}
+	if tags == nil {
+		delete(m.trashTags, id)
+	} else {
+		m.trashTags[id] = tags
+	}
+}
+
+func (m *metaStore) applyRestore(id uint64) {
+	if md, ok := m.trash[id]; ok {
+		m.setEntry(id, md)
+		delete(m.trash, id)
+	}
+	if tags, ok := m.trashTags[id]; ok {
+		m.applyTags(id, tags)
+		delete(m.trashTags, id)
+	}
+}
+
+// properties returns the stored database-level attributes
+func (m *metaStore) properties() dbProperties {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.props
+}
+
+// setProperties replaces the stored database-level attributes
+func (m *metaStore) setProperties(props dbProperties) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.appendLocked(metaRecord{Properties: &props}, func() {
+		reindex := props.Schema != m.props.Schema
+		m.props = props
+		if reindex {
+			m.reindex()
+		}
+	})
+}
+
+// remove drops any metadata and tags stored for id
+func (m *metaStore) remove(id uint64) error {
+	return m.put(id, nil, nil)
+}
+
+// appendLocked writes rec to the sidecar and applies it in memory on success
+func (m *metaStore) appendLocked(rec metaRecord, apply func()) error {
+	if m.readOnly {
+		return ErrReadOnly
+	}
+	if m.file == nil {
+		f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return ErrFileIO
+		}
+		m.file = f
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return ErrInvalidArgs
+	}
+	if _, err := m.file.Write(append(line, '\n')); err != nil {
+		return ErrFileIO
+	}
+	if m.syncWrites {
+		if err := m.file.Sync(); err != nil {
+			return ErrFileIO
+		}
+	}
+
+	apply()
+	m.dirty = true
+	return nil
+}
+
+// sync forces appended entries to stable storage
+func (m *metaStore) sync() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.file == nil {
+		return nil
+	}
+	if err := m.file.Sync(); err != nil {
+		return ErrFileIO
+	}
+	return nil
+}
+
+// close compacts the sidecar down to one line per live entry
+func (m *metaStore) close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.file != nil {
+		m.file.Close()
+		m.file = nil
+	}
+	if !m.dirty {
+		return nil
+	}
+	m.dirty = false
+
+	if len(m.entries) == 0 && len(m.tags) == 0 && len(m.trash) == 0 && len(m.trashTags) == 0 && m.props == (dbProperties{}) {
+		if err := os.Remove(m.path); err != nil && !os.IsNotExist(err) {
+			return ErrFileIO
+		}
+		return nil
+	}
+
+	tmp := m.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return ErrFileIO
+	}
+
+	w := bufio.NewWriter(f)
+	if err := m.encodeLocked(w); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return ErrFileIO
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return ErrFileIO
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return ErrFileIO
+	}
+
+	if err := os.Rename(tmp, m.path); err != nil {
+		os.Remove(tmp)
+		return ErrFileIO
+	}
+	return nil
+}
+
+// snapshot returns the compacted sidecar contents, one line per live entry
+func (m *metaStore) snapshot() ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var buf bytes.Buffer
+	if err := m.encodeLocked(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeLocked writes the properties, live entries and trash as JSON lines,
+// one line per vector
+func (m *metaStore) encodeLocked(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	if m.props != (dbProperties{}) {
+		props := m.props
+		if err := enc.Encode(metaRecord{Properties: &props}); err != nil {
+			return err
+		}
+	}
+	for id, md := range m.entries {
+		if err := enc.Encode(metaRecord{ID: id, Metadata: md, Tags: m.tags[id]}); err != nil {
+			return err
+		}
+	}
+	for id, tags := range m.tags {
+		if _, ok := m.entries[id]; ok {
+			continue
+		}
+		if err := enc.Encode(metaRecord{ID: id, Tags: tags}); err != nil {
+			return err
+		}
+	}
+	for id, md := range m.trash {
+		if err := enc.Encode(metaRecord{ID: id, Metadata: md, Tags: m.trashTags[id], Trashed: true}); err != nil {
+			return err
+		}
+	}
+	for id, tags := range m.trashTags {
+		if _, ok := m.trash[id]; ok {
+			continue
+		}
+		if err := enc.Encode(metaRecord{ID: id, Tags: tags, Trashed: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagVector sets one metadata key on a stored vector, keeping its other
+// keys. It reports false without error if the vector does not exist.
+func (db *DB) tagVector(id uint64, key string, value any) (bool, error) {
+	if _, err := db.Get(id); errors.Is(err, ErrVectorNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	metadata := db.meta.get(id)
+	if metadata == nil {
+		metadata = make(map[string]any)
+	}
+	metadata[key] = value
+	if err := db.meta.set(id, metadata); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetTags replaces the tags of vector id, keeping its data and metadata.
+// Nil or empty tags remove them all. The change is recorded in the audit
+// log.
+func (db *DB) SetTags(id uint64, tags []string) error {
+	call := &Call{Op: HookSetTags, Actor: db.auditActor, ID: id, Tags: tags}
+	return db.hooks.run(call, func() error {
+		if db.db == nil {
+			return ErrInvalidArgs
+		}
+		// A buffered insert may create or replace the vector being tagged
+		if db.writeBuffer != nil {
+			if err := db.writeBuffer.drain(); err != nil {
+				return err
+			}
+		}
+		if !db.contains(call.ID) {
+			return newOpError("set_tags", db.path, call.ID, ErrVectorNotFound)
+		}
+		if err := db.meta.setTags(call.ID, call.Tags); err != nil {
+			return err
+		}
+		if err := db.audit(call.Actor, AuditSetTags, call.ID, 0); err != nil {
+			return err
+		}
+		return db.syncWrite()
+	})
+}
+
+// UpdateMetadata merges patch into the metadata of vector id: keys set to
+// nil are removed, others are added or replaced, and the rest are kept.
+// Only the metadata sidecar is written, so the vector data and its version
+// are untouched.
+func (db *DB) UpdateMetadata(id uint64, patch map[string]any) error {
+	return db.UpdateMetadataMany(map[uint64]map[string]any{id: patch})
+}
+
+// UpdateMetadataMany applies UpdateMetadata to many vectors at once, such as
+// when relabeling a collection. Every vector must exist and every result
+// must satisfy the schema, or nothing is changed. Each vector patched is
+// recorded in the audit log.
+func (db *DB) UpdateMetadataMany(patches map[uint64]map[string]any) error {
+	call := &Call{Op: HookUpdateMetadata, Actor: db.auditActor, Patches: patches}
+	return db.hooks.run(call, func() error {
+		if db.db == nil {
+			return ErrInvalidArgs
+		}
+		// Buffered inserts may create or replace the vectors being patched
+		if db.writeBuffer != nil {
+			if err := db.writeBuffer.drain(); err != nil {
+				return err
+			}
+		}
+		ids := make([]uint64, 0, len(call.Patches))
+		for id := range call.Patches {
+			if !db.contains(id) {
+				return newOpError("update_metadata", db.path, id, ErrVectorNotFound)
+			}
+			ids = append(ids, id)
+		}
+		if err := db.meta.patch(call.Patches); err != nil {
+			return err
+		}
+		slices.Sort(ids)
+		for _, id := range ids {
+			if err := db.audit(call.Actor, AuditUpdateMetadata, id, 0); err != nil {
+				return err
+			}
+		}
+		return db.syncWrite()
+	})
+}
+
+func copyMetadata(md map[string]any) map[string]any {
+	if md == nil {
+		return nil
+	}
+	out := make(map[string]any, len(md))
+	for k, v := range md {
+		out[k] = v
+	}
+	return out
+}
+
+// normalizeTags returns tags sorted with duplicates and empty tags dropped,
+// or nil if none remain
+func normalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag != "" {
+			out = append(out, tag)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+// bm25 scores the IDs whose indexed text field contains any of words; ok
+// is false if the field has no index
+func (m *metaStore) bm25(field string, words []string) (scores map[uint64]float64, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	index, ok := m.texts[field]
+	if !ok {
+		return nil, false
+	}
+	return index.bm25(words), true
+}
+
+func addPoint(cells map[geoCell]map[uint64]GeoPoint, id uint64, p GeoPoint) {
+	cell := cellOf(p)
+	points := cells[cell]
+	if points == nil {
+		points = make(map[uint64]GeoPoint)
+		cells[cell] = points
+	}
+	points[id] = p
+}
+
+// numberEntry is one value of an indexed numeric field, ordered by value
+// then ID
+type numberEntry struct {
+	value float64
+	id    uint64
+}
+
+func compareNumbers(a, b numberEntry) int {
+	if c := cmp.Compare(a.value, b.value); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.id, b.id)
+}
+
+func insertNumber(entries []numberEntry, e numberEntry) []numberEntry {
+	i, found := slices.BinarySearchFunc(entries, e, compareNumbers)
+	if found {
+		return entries
+	}
+	return slices.Insert(entries, i, e)
+}
+
+func removeNumber(entries []numberEntry, e numberEntry) []numberEntry {
+	if i, found := slices.BinarySearchFunc(entries, e, compareNumbers); found {
+		return slices.Delete(entries, i, i+1)
+	}
+	return entries
+}
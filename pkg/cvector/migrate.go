@@ -0,0 +1,52 @@
+package cvector
+
+/*
+#include <stdlib.h>
+#include "core/cvector.h"
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// FormatVersion is the on-disk format version written by this package.
+// Opening a newer file fails with ErrVersionTooNew. An older file is
+// upgraded in place when opened for writing, and read as it is when opened
+// read-only.
+const FormatVersion = C.CVECTOR_FILE_VERSION
+
+// MigrateResult describes what Migrate did
+type MigrateResult struct {
+	FromVersion int
+	ToVersion   int
+	BackupPath  string // Empty when the file was already current
+}
+
+// Migrate upgrades the database file at dbPath in place to FormatVersion,
+// as opening it for writing would, but first copies the original next to
+// it as dbPath.v<N>.bak. The database must not be open. A file that is
+// already current is left untouched.
+func Migrate(dbPath string) (*MigrateResult, error) {
+	info, err := ReadFileInfo(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	result := &MigrateResult{FromVersion: info.FormatVersion, ToVersion: FormatVersion}
+	if info.FormatVersion == FormatVersion {
+		return result, nil
+	}
+
+	result.BackupPath = fmt.Sprintf("%s.v%d.bak", dbPath, info.FormatVersion)
+	cPath := C.CString(dbPath)
+	defer C.free(unsafe.Pointer(cPath))
+	cBackup := C.CString(result.BackupPath)
+	defer C.free(unsafe.Pointer(cBackup))
+
+	var from C.uint32_t
+	if code := C.cvector_migrate(cPath, cBackup, &from); code != 0 {
+		return nil, newOpError("migrate", dbPath, 0, Error(code))
+	}
+	result.FromVersion = int(from)
+	return result, nil
+}
@@ -0,0 +1,205 @@
+package cvector
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Option configures Open. Options are applied in order, so later options
+// override earlier ones.
+type Option func(*openOptions)
+
+type openOptions struct {
+	config          DBConfig
+	createIfMissing bool
+}
+
+// Open opens the database at path, configured by opts. It is the
+// extensible counterpart of OpenDBWithConfig: new settings arrive as new
+// options rather than as changes callers have to make to a DBConfig.
+//
+//	db, err := cvector.Open("vectors.cvdb", cvector.WithCreateIfMissing(384), cvector.WithSearchThreads(8))
+func Open(path string, opts ...Option) (*DB, error) {
+	o := openOptions{config: DBConfig{DataPath: path}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.createIfMissing {
+		return OpenOrCreate(&o.config)
+	}
+	return OpenDBWithConfig(&o.config)
+}
+
+// WithConfig starts from an existing DBConfig. Its DataPath is replaced by
+// the path given to Open.
+func WithConfig(config DBConfig) Option {
+	return func(o *openOptions) {
+		path := o.config.DataPath
+		o.config = config
+		o.config.DataPath = path
+	}
+}
+
+// WithCreateIfMissing creates the database with the given dimension when
+// no file exists at the path, as OpenOrCreate does. An existing database
+// must have that dimension and the WithSimilarity metric.
+func WithCreateIfMissing(dimension uint32) Option {
+	return func(o *openOptions) {
+		o.createIfMissing = true
+		o.config.Dimension = dimension
+	}
+}
+
+// WithReadOnly opens the database without write access. Mutations fail
+// with ErrReadOnly and closing leaves the files untouched.
+func WithReadOnly() Option {
+	return func(o *openOptions) { o.config.ReadOnly = true }
+}
+
+// WithSkipCorruptRecords opens a database with damaged records, serving
+// the intact ones; see DBConfig.SkipCorruptRecords
+func WithSkipCorruptRecords() Option {
+	return func(o *openOptions) { o.config.SkipCorruptRecords = true }
+}
+
+// WithSoftDelete keeps deleted vectors' metadata for Undelete; see
+// DBConfig.SoftDelete
+func WithSoftDelete() Option {
+	return func(o *openOptions) { o.config.SoftDelete = true }
+}
+
+// WithBackgroundIndex builds the HNSW index in the background after
+// opening; see DBConfig.BackgroundIndex
+func WithBackgroundIndex() Option {
+	return func(o *openOptions) { o.config.BackgroundIndex = true }
+}
+
+// WithVersionHistory keeps n previous versions of each overwritten vector;
+// see DBConfig.VersionHistory
+func WithVersionHistory(n int) Option {
+	return func(o *openOptions) { o.config.VersionHistory = n }
+}
+
+// WithMMap requests memory-mapped storage for a database created by Open
+func WithMMap() Option {
+	return func(o *openOptions) { o.config.MemoryMapped = true }
+}
+
+// WithSearchThreads caps the number of searches that run in the engine at
+// once; further callers wait for a slot. Zero leaves searches unbounded.
+func WithSearchThreads(n int) Option {
+	return func(o *openOptions) { o.config.SearchThreads = n }
+}
+
+// WithEfSearch sets the HNSW candidate list size for queries that set
+// none; see DB.SetEfSearch
+func WithEfSearch(ef int) Option {
+	return func(o *openOptions) { o.config.EfSearch = ef }
+}
+
+// WithCache keeps up to bytes of recently read vectors in memory
+func WithCache(bytes int) Option {
+	return func(o *openOptions) { o.config.CacheBytes = bytes }
+}
+
+// WithBlockCache keeps up to bytes of file blocks in memory for Gets and
+// scans to share
+func WithBlockCache(bytes int) Option {
+	return func(o *openOptions) { o.config.BlockCacheBytes = bytes }
+}
+
+// WithSimilarity sets the default similarity of a database created by Open
+func WithSimilarity(similarity SimilarityType) Option {
+	return func(o *openOptions) { o.config.DefaultSimilarity = similarity }
+}
+
+// WithNormalizeOnInsert stores vectors at unit length in a database created
+// by Open
+func WithNormalizeOnInsert() Option {
+	return func(o *openOptions) { o.config.NormalizeOnInsert = true }
+}
+
+// WithMaxVectors sets the live vector limit of a database created by Open
+func WithMaxVectors(n int) Option {
+	return func(o *openOptions) { o.config.MaxVectors = n }
+}
+
+// WithMaxSize caps the data file at bytes; see DBConfig.MaxSizeBytes
+func WithMaxSize(bytes int64) Option {
+	return func(o *openOptions) { o.config.MaxSizeBytes = bytes }
+}
+
+// WithAdmission limits unbuffered inserts running at once and buffered
+// inserts waiting; see DBConfig.MaxInflightInserts
+func WithAdmission(maxInflight, maxQueued int) Option {
+	return func(o *openOptions) {
+		o.config.MaxInflightInserts = maxInflight
+		o.config.MaxQueuedInserts = maxQueued
+	}
+}
+
+// WithDimensionPolicy sets how mismatched vector lengths are handled
+func WithDimensionPolicy(policy DimensionPolicy) Option {
+	return func(o *openOptions) { o.config.DimensionPolicy = policy }
+}
+
+// WithOnConflict sets what Insert does with an ID that is already stored
+func WithOnConflict(policy ConflictPolicy) Option {
+	return func(o *openOptions) { o.config.OnConflict = policy }
+}
+
+// WithSync sets when writes are forced to disk. interval is only used by
+// SyncInterval; zero selects the one second default.
+func WithSync(mode SyncMode, interval time.Duration) Option {
+	return func(o *openOptions) {
+		o.config.SyncMode = mode
+		o.config.SyncInterval = interval
+	}
+}
+
+// WithWriteBuffer queues inserts and applies them in groups of up to size,
+// waiting at most delay for a group to fill
+func WithWriteBuffer(size int, delay time.Duration) Option {
+	return func(o *openOptions) {
+		o.config.WriteBufferSize = size
+		o.config.WriteBufferDelay = delay
+	}
+}
+
+// WithGC compacts in the background once tombstones reach deadRatio of the
+// stored records or maxAge has passed since the last compaction. Zero
+// disables either trigger.
+func WithGC(deadRatio float64, maxAge time.Duration) Option {
+	return func(o *openOptions) {
+		o.config.GCDeadRatio = deadRatio
+		o.config.GCMaxAge = maxAge
+	}
+}
+
+// WithLogger sends structured events to logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *openOptions) { o.config.Logger = logger }
+}
+
+// WithAuditLog records mutations in the JSON-lines file at path, attributed
+// to actor unless the call names one
+func WithAuditLog(path, actor string) Option {
+	return func(o *openOptions) {
+		o.config.AuditLogPath = path
+		o.config.AuditActor = actor
+	}
+}
+
+// acquireSearch blocks until a search slot is free when SearchThreads is set
+func (db *DB) acquireSearch() {
+	if db.searchSlots != nil {
+		db.searchSlots <- struct{}{}
+	}
+}
+
+func (db *DB) releaseSearch() {
+	if db.searchSlots != nil {
+		<-db.searchSlots
+	}
+}
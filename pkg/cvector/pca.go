@@ -0,0 +1,359 @@
+package cvector
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+const (
+	// pcaSuffix is appended to the data path to name the PCA sidecar file
+	pcaSuffix = ".pca"
+
+	// pcaTrainSample caps the vectors used to estimate the covariance matrix
+	pcaTrainSample = 5000
+
+	// pcaIterations bounds the subspace iterations used to find components
+	pcaIterations = 200
+	pcaTolerance  = 1e-9
+)
+
+// PCA is a linear projection onto the principal components of a dataset
+type PCA struct {
+	SourceDimension int         `json:"source_dimension"`
+	Mean            []float32   `json:"mean"`
+	Components      [][]float32 `json:"components"` // One unit vector per output dimension
+	Variances       []float64   `json:"variances"`  // Variance captured by each component
+
+	// RetainedVariance is the fraction of the total variance kept by the
+	// components, an upper bound on how much structure the reduction loses
+	RetainedVariance float64 `json:"retained_variance"`
+}
+
+// TargetDimension is the number of dimensions Transform produces
+func (p *PCA) TargetDimension() int {
+	return len(p.Components)
+}
+
+// Transform projects v onto the principal components
+func (p *PCA) Transform(v []float32) ([]float32, error) {
+	if len(v) != p.SourceDimension {
+		return nil, ErrDimensionMismatch
+	}
+
+	out := make([]float32, len(p.Components))
+	for i, component := range p.Components {
+		var sum float64
+		for j, x := range v {
+			sum += float64(x-p.Mean[j]) * float64(component[j])
+		}
+		out[i] = float32(sum)
+	}
+	return out, nil
+}
+
+func pcaPath(dbPath string) string {
+	return dbPath + pcaSuffix
+}
+
+func loadPCA(dbPath string) (*PCA, error) {
+	data, err := os.ReadFile(pcaPath(dbPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ErrFileIO
+	}
+
+	var p PCA
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, ErrDBCorrupt
+	}
+	return &p, nil
+}
+
+func (p *PCA) save(dbPath string) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return ErrInvalidArgs
+	}
+	if err := os.WriteFile(pcaPath(dbPath), data, 0644); err != nil {
+		return ErrFileIO
+	}
+	return nil
+}
+
+// TrainPCA computes the targetDim principal components of the stored
+// vectors. Large databases are sampled evenly for the covariance estimate.
+func (db *DB) TrainPCA(targetDim int) (*PCA, error) {
+	stats, err := db.Stats()
+	if err != nil {
+		return nil, err
+	}
+	dim := int(stats.Dimension)
+	if targetDim <= 0 || targetDim > dim {
+		return nil, ErrInvalidArgs
+	}
+
+	stride := 1
+	if stats.TotalVectors > pcaTrainSample {
+		stride = (stats.TotalVectors + pcaTrainSample - 1) / pcaTrainSample
+	}
+
+	var sample [][]float32
+	seen := 0
+	err = db.Iterate(func(v *Vector) error {
+		if seen%stride == 0 {
+			sample = append(sample, v.Data)
+		}
+		seen++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sample) < 2 {
+		return nil, ErrInvalidArgs
+	}
+
+	mean := make([]float64, dim)
+	for _, v := range sample {
+		for i, x := range v {
+			mean[i] += float64(x)
+		}
+	}
+	for i := range mean {
+		mean[i] /= float64(len(sample))
+	}
+
+	// Covariance matrix, filled in the upper triangle and mirrored
+	cov := make([][]float64, dim)
+	for i := range cov {
+		cov[i] = make([]float64, dim)
+	}
+	centered := make([]float64, dim)
+	for _, v := range sample {
+		for i, x := range v {
+			centered[i] = float64(x) - mean[i]
+		}
+		for i := 0; i < dim; i++ {
+			ci := centered[i]
+			row := cov[i]
+			for j := i; j < dim; j++ {
+				row[j] += ci * centered[j]
+			}
+		}
+	}
+	var totalVariance float64
+	for i := 0; i < dim; i++ {
+		for j := i; j < dim; j++ {
+			cov[i][j] /= float64(len(sample))
+			cov[j][i] = cov[i][j]
+		}
+		totalVariance += cov[i][i]
+	}
+
+	components, variances := topEigenvectors(cov, targetDim)
+
+	p := &PCA{
+		SourceDimension: dim,
+		Mean:            make([]float32, dim),
+		Components:      make([][]float32, targetDim),
+		Variances:       variances,
+	}
+	for i, m := range mean {
+		p.Mean[i] = float32(m)
+	}
+	var retained float64
+	for i, component := range components {
+		p.Components[i] = make([]float32, dim)
+		for j, x := range component {
+			p.Components[i][j] = float32(x)
+		}
+		retained += variances[i]
+	}
+	p.RetainedVariance = 1
+	if totalVariance > 0 {
+		p.RetainedVariance = math.Min(retained/totalVariance, 1)
+	}
+
+	return p, nil
+}
+
+// topEigenvectors finds the k leading eigenvectors of the symmetric matrix m
+// by orthogonal subspace iteration, returned in order of decreasing eigenvalue
+func topEigenvectors(m [][]float64, k int) ([][]float64, []float64) {
+	dim := len(m)
+	rng := rand.New(rand.NewSource(1))
+
+	q := make([][]float64, k)
+	for i := range q {
+		q[i] = make([]float64, dim)
+		for j := range q[i] {
+			q[i][j] = rng.NormFloat64()
+		}
+	}
+	orthonormalize(q)
+
+	z := make([][]float64, k)
+	for i := range z {
+		z[i] = make([]float64, dim)
+	}
+
+	for iter := 0; iter < pcaIterations; iter++ {
+		for i := range q {
+			multiplySymmetric(m, q[i], z[i])
+		}
+		orthonormalize(z)
+
+		// Converged when every basis vector is unchanged up to sign
+		delta := 0.0
+		for i := range z {
+			var dot float64
+			for j := range z[i] {
+				dot += z[i][j] * q[i][j]
+			}
+			delta = math.Max(delta, 1-math.Abs(dot))
+		}
+		q, z = z, q
+		if delta < pcaTolerance {
+			break
+		}
+	}
+
+	values := make([]float64, k)
+	scratch := make([]float64, dim)
+	for i := range q {
+		multiplySymmetric(m, q[i], scratch)
+		for j := range scratch {
+			values[i] += q[i][j] * scratch[j]
+		}
+	}
+
+	order := make([]int, k)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return values[order[a]] > values[order[b]] })
+
+	vectors := make([][]float64, k)
+	sorted := make([]float64, k)
+	for i, idx := range order {
+		vectors[i] = q[idx]
+		sorted[i] = math.Max(values[idx], 0)
+	}
+	return vectors, sorted
+}
+
+func multiplySymmetric(m [][]float64, v, out []float64) {
+	for i, row := range m {
+		var sum float64
+		for j, x := range row {
+			sum += x * v[j]
+		}
+		out[i] = sum
+	}
+}
+
+// orthonormalize applies modified Gram-Schmidt to the rows of vs in place.
+// A row that collapses to zero is replaced by a unit vector orthogonal to
+// the earlier rows.
+func orthonormalize(vs [][]float64) {
+	for i := range vs {
+		for attempt := 0; ; attempt++ {
+			for j := 0; j < i; j++ {
+				var dot float64
+				for d := range vs[i] {
+					dot += vs[i][d] * vs[j][d]
+				}
+				for d := range vs[i] {
+					vs[i][d] -= dot * vs[j][d]
+				}
+			}
+
+			var norm float64
+			for _, x := range vs[i] {
+				norm += x * x
+			}
+			norm = math.Sqrt(norm)
+			if norm > 1e-12 || attempt >= len(vs[i]) {
+				if norm > 1e-12 {
+					for d := range vs[i] {
+						vs[i][d] /= norm
+					}
+				}
+				break
+			}
+
+			// Degenerate direction: restart from a basis vector
+			for d := range vs[i] {
+				vs[i][d] = 0
+			}
+			vs[i][attempt] = 1
+		}
+	}
+}
+
+// ReduceTo creates a database at dstPath holding every vector projected
+// through p, along with its metadata. The projection is stored alongside
+// the new database, so vectors and queries of the original dimension passed
+// to its Insert and Search are transformed automatically.
+func (db *DB) ReduceTo(dstPath string, p *PCA) (*DB, error) {
+	if p == nil || p.TargetDimension() == 0 {
+		return nil, ErrInvalidArgs
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		return nil, err
+	}
+	if int(stats.Dimension) != p.SourceDimension {
+		return nil, ErrDimensionMismatch
+	}
+
+	dst, err := CreateDB(&DBConfig{
+		Name:              stats.Name,
+		Description:       stats.Description,
+		DataPath:          dstPath,
+		Dimension:         uint32(p.TargetDimension()),
+		DefaultSimilarity: stats.DefaultSimilarity,
+		NormalizeOnInsert: stats.NormalizeOnInsert,
+		MaxVectors:        stats.MaxVectors,
+		Logger:            db.logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.save(dstPath)
+	if err == nil {
+		dst.pca = p
+		err = db.Iterate(func(v *Vector) error {
+			return dst.Insert(v)
+		})
+	}
+	if err != nil {
+		dst.Close()
+		DropDB(dstPath)
+		return nil, err
+	}
+
+	return dst, nil
+}
+
+// PCA returns the projection applied by this database, or nil if it stores
+// vectors as given
+func (db *DB) PCA() *PCA {
+	return db.pca
+}
+
+// project maps a vector of the projection's source dimension into the
+// stored space. Vectors already in the stored dimension pass through.
+func (db *DB) project(data []float32) ([]float32, error) {
+	if db.pca == nil || len(data) != db.pca.SourceDimension {
+		return data, nil
+	}
+	return db.pca.Transform(data)
+}
@@ -0,0 +1,179 @@
+package cvector
+
+import (
+	"math"
+	"sort"
+)
+
+// Reranker reorders search candidates, best first, typically with a model
+// too costly to run over the whole database. It may drop candidates and
+// change their Similarity.
+type Reranker func(query *Query, candidates []*Result) ([]*Result, error)
+
+// Pipeline is a search run in stages, each narrowing the candidates of the
+// one before: a wide prefetch, then exact rescoring, then reranking, say.
+// Build one with DB.Pipeline and execute it with Run.
+type Pipeline struct {
+	db     *DB
+	query  *Query
+	stages []pipelineStage
+	err    error
+}
+
+type pipelineStage struct {
+	limit    int
+	prefetch bool
+	metric   SimilarityType // Rescore
+	rerank   Reranker       // Rerank
+}
+
+// Pipeline starts a staged search for query. Its TopK is the number of
+// results Run returns, and its other fields apply to the prefetch.
+func (db *DB) Pipeline(query *Query) *Pipeline {
+	return &Pipeline{db: db, query: query}
+}
+
+// Prefetch finds the limit best candidates with an index search. It must be
+// the first stage; without it Run fetches only TopK candidates.
+func (p *Pipeline) Prefetch(limit int) *Pipeline {
+	if limit <= 0 || len(p.stages) > 0 {
+		return p.fail()
+	}
+	p.stages = append(p.stages, pipelineStage{limit: limit, prefetch: true})
+	return p
+}
+
+// Rescore scores the candidates exactly against their stored vectors with
+// metric and keeps the limit best. Euclidean scores are negated distances,
+// as in Search.
+func (p *Pipeline) Rescore(limit int, metric SimilarityType) *Pipeline {
+	if limit <= 0 {
+		return p.fail()
+	}
+	p.stages = append(p.stages, pipelineStage{limit: limit, metric: metric})
+	return p
+}
+
+// Rerank passes the candidates to fn and keeps the limit best it returns
+func (p *Pipeline) Rerank(limit int, fn Reranker) *Pipeline {
+	if limit <= 0 || fn == nil {
+		return p.fail()
+	}
+	p.stages = append(p.stages, pipelineStage{limit: limit, rerank: fn})
+	return p
+}
+
+func (p *Pipeline) fail() *Pipeline {
+	if p.err == nil {
+		p.err = ErrInvalidArgs
+	}
+	return p
+}
+
+// Run executes the stages in order and returns the best TopK results of
+// the last, or ErrInvalidArgs if a stage was added with bad arguments.
+func (p *Pipeline) Run() ([]*Result, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.db.db == nil || p.query == nil {
+		return nil, ErrInvalidArgs
+	}
+
+	topK := p.query.TopK
+	if topK == 0 {
+		topK = p.db.QueryDefaults().TopK
+	}
+	stages := p.stages
+	prefetch := *p.query
+	if len(stages) > 0 && stages[0].prefetch {
+		prefetch.TopK = uint32(min(stages[0].limit, maxSearchTopK))
+		stages = stages[1:]
+	}
+	candidates, err := p.db.Search(&prefetch)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range stages {
+		if stage.rerank != nil {
+			candidates, err = stage.rerank(p.query, candidates)
+		} else {
+			candidates, err = p.rescore(candidates, stage.metric)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(candidates) > stage.limit {
+			candidates = candidates[:stage.limit]
+		}
+	}
+
+	if topK > 0 && len(candidates) > int(topK) {
+		candidates = candidates[:topK]
+	}
+	return candidates, nil
+}
+
+// rescore scores candidates against the query with metric, best first
+func (p *Pipeline) rescore(candidates []*Result, metric SimilarityType) ([]*Result, error) {
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+	queryVector, err := p.db.conform(p.query.vector())
+	if err != nil {
+		return nil, err
+	}
+	if p.query.Normalize {
+		queryVector = normalizedCopy(queryVector)
+	}
+
+	ids := make([]uint64, len(candidates))
+	for i, r := range candidates {
+		ids[i] = r.ID
+	}
+	vectors, err := p.db.getAll(ids)
+	if err != nil {
+		return nil, err
+	}
+	scores, err := DistanceMatrix([][]float32{queryVector}, vectors, metric)
+	if err != nil {
+		return nil, err
+	}
+
+	rescored := make([]*Result, len(candidates))
+	for i, r := range candidates {
+		score := scores[0][i]
+		if metric == SimilarityEuclidean {
+			score = -score
+		}
+		if p.query.NormalizeScores {
+			score = NormalizeScore(metric, score)
+		}
+		rescored[i] = &Result{ID: r.ID, Similarity: score, Vector: r.Vector}
+	}
+	sort.SliceStable(rescored, func(i, j int) bool {
+		if rescored[i].Similarity != rescored[j].Similarity {
+			return rescored[i].Similarity > rescored[j].Similarity
+		}
+		return rescored[i].ID < rescored[j].ID
+	})
+	return rescored, nil
+}
+
+// normalizedCopy returns v scaled to unit length, as Query.Normalize does
+func normalizedCopy(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	out := append([]float32(nil), v...)
+	if sum == 0 {
+		return out
+	}
+	norm := math.Sqrt(sum)
+	for i := range out {
+		out[i] = float32(float64(out[i]) / norm)
+	}
+	return out
+}
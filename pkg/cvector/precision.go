@@ -0,0 +1,41 @@
+package cvector
+
+// Vectors are stored and scored as float32. The float64 forms below convert
+// at the API boundary, rounding each component to the nearest float32.
+// Components beyond the float32 range become infinite and are rejected
+// with ErrInvalidVectorData, like NaNs.
+
+// NewVector64 creates a vector from float64 components with the current
+// timestamp
+func NewVector64(id uint64, data []float64) *Vector {
+	return NewVector(id, toFloat32(data))
+}
+
+// Data64 returns the vector's components widened to float64
+func (v *Vector) Data64() []float64 {
+	out := make([]float64, len(v.Data))
+	for i, x := range v.Data {
+		out[i] = float64(x)
+	}
+	return out
+}
+
+// vector returns the query vector, converting QueryVector64 when
+// QueryVector is empty
+func (q *Query) vector() []float32 {
+	if len(q.QueryVector) == 0 && len(q.QueryVector64) > 0 {
+		return toFloat32(q.QueryVector64)
+	}
+	return q.QueryVector
+}
+
+func toFloat32(data []float64) []float32 {
+	if data == nil {
+		return nil
+	}
+	out := make([]float32, len(data))
+	for i, x := range data {
+		out[i] = float32(x)
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+package cvector
+
+import (
+	"sync"
+	"time"
+)
+
+// QueryStats holds cumulative search counters since the database was opened
+// or the counters were last reset
+type QueryStats struct {
+	Searches          int64 // Successful searches
+	IndexSearches     int64 // Searches answered by the HNSW index
+	Scans             int64 // Searches answered by an exhaustive scan
+	IndexFallbacks    int64 // Index searches that failed and fell back to a scan
+	Errors            int64 // Searches rejected by the engine
+	CandidatesScanned int64 // Vectors scored across all searches
+	IndexNodesVisited int64
+	FilterRejections  int64 // Candidates dropped by MinSimilarity
+	TotalTime         time.Duration
+	Since             time.Time
+}
+
+// queryCounters accumulates QueryStats for a DB
+type queryCounters struct {
+	mu    sync.Mutex
+	stats QueryStats
+}
+
+func (c *queryCounters) record(explain *SearchExplain) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Searches++
+	if explain.Strategy == SearchStrategyIndex {
+		c.stats.IndexSearches++
+	} else {
+		c.stats.Scans++
+	}
+	if explain.IndexFallback {
+		c.stats.IndexFallbacks++
+	}
+	c.stats.CandidatesScanned += int64(explain.CandidatesScanned)
+	c.stats.IndexNodesVisited += int64(explain.IndexNodesVisited)
+	c.stats.FilterRejections += int64(explain.ThresholdRejected)
+	c.stats.TotalTime += explain.TotalTime
+}
+
+func (c *queryCounters) recordError() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Errors++
+}
+
+func (c *queryCounters) snapshot() QueryStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+func (c *queryCounters) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats = QueryStats{Since: time.Now()}
+}
+
+// QueryStats returns a snapshot of the cumulative search counters
+func (db *DB) QueryStats() QueryStats {
+	return db.queryCounters.snapshot()
+}
+
+// ResetQueryStats zeroes the search counters and restarts the Since clock
+func (db *DB) ResetQueryStats() {
+	db.queryCounters.reset()
+}
@@ -0,0 +1,204 @@
+package cvector
+
+import "sort"
+
+// Recommend returns the k vectors most like the positive examples and least
+// like the negative ones, excluding the examples themselves. It searches
+// with the positives' centroid moved away from the negatives' centroid by
+// the distance between them, using the database's default similarity.
+func (db *DB) Recommend(positiveIDs, negativeIDs []uint64, k int) ([]*Result, error) {
+	if db.db == nil || len(positiveIDs) == 0 || k <= 0 {
+		return nil, ErrInvalidArgs
+	}
+
+	target, err := db.Centroid(positiveIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(negativeIDs) > 0 {
+		avoid, err := db.Centroid(negativeIDs)
+		if err != nil {
+			return nil, err
+		}
+		for i := range target {
+			target[i] += target[i] - avoid[i]
+		}
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		return nil, err
+	}
+	exclude := recommendExamples(positiveIDs, negativeIDs)
+	results, err := db.Search(&Query{
+		QueryVector: target,
+		TopK:        uint32(min(k+len(exclude), maxSearchTopK)),
+		Similarity:  stats.DefaultSimilarity,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recommendTrim(results, exclude, k), nil
+}
+
+// SearchByID searches with the stored vector id as the query vector, for
+// "more like this" lookups, in one call instead of a Get and a Search.
+// query's vector fields are ignored, and query may be nil to use the
+// database's defaults. The vector itself is left out of the results unless
+// query.IncludeSelf is set.
+func (db *DB) SearchByID(id uint64, query *Query) ([]*Result, error) {
+	if db.db == nil {
+		return nil, ErrInvalidArgs
+	}
+	data, err := db.getData(id)
+	if err != nil {
+		return nil, err
+	}
+
+	q := Query{}
+	if query != nil {
+		q = *query
+	}
+	q.QueryVector, q.QueryVector64 = data, nil
+	if q.IncludeSelf {
+		return db.Search(&q)
+	}
+
+	// Fetch one more to make up for dropping the vector itself
+	topK := q.TopK
+	if topK == 0 {
+		topK = db.QueryDefaults().TopK
+	}
+	if topK > 0 {
+		q.TopK = min(topK+1, max(topK, maxSearchTopK))
+	}
+	results, err := db.Search(&q)
+	if err != nil {
+		return nil, err
+	}
+	return recommendTrim(results, map[uint64]bool{id: true}, int(topK)), nil
+}
+
+// RecommendBestScore is Recommend scoring each candidate by its best match
+// among the examples instead of against one combined query. A candidate
+// closer to a positive than to any negative scores its best positive
+// similarity; otherwise it scores the negation of its best negative one, so
+// it ranks below every candidate that favours the positives. Candidates are
+// the neighbours of each positive, which suits positives that are far apart.
+func (db *DB) RecommendBestScore(positiveIDs, negativeIDs []uint64, k int) ([]*Result, error) {
+	if db.db == nil || len(positiveIDs) == 0 || k <= 0 {
+		return nil, ErrInvalidArgs
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		return nil, err
+	}
+	metric := stats.DefaultSimilarity
+	positives, err := db.getAll(positiveIDs)
+	if err != nil {
+		return nil, err
+	}
+	negatives, err := db.getAll(negativeIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude := recommendExamples(positiveIDs, negativeIDs)
+	seen := make(map[uint64]bool)
+	var candidates []uint64
+	for _, positive := range positives {
+		results, err := db.Search(&Query{
+			QueryVector: positive,
+			TopK:        uint32(min(k+len(exclude), maxSearchTopK)),
+			Similarity:  metric,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range results {
+			if !exclude[r.ID] && !seen[r.ID] {
+				seen[r.ID] = true
+				candidates = append(candidates, r.ID)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return []*Result{}, nil
+	}
+
+	vectors, err := db.getAll(candidates)
+	if err != nil {
+		return nil, err
+	}
+	best := func(examples [][]float32) ([]float32, error) {
+		if len(examples) == 0 {
+			return nil, nil
+		}
+		scores, err := DistanceMatrix(vectors, examples, metric)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]float32, len(vectors))
+		for i, row := range scores {
+			for j, s := range row {
+				if metric == SimilarityEuclidean {
+					s = -s
+				}
+				if j == 0 || s > out[i] {
+					out[i] = s
+				}
+			}
+		}
+		return out, nil
+	}
+	bestPositive, err := best(positives)
+	if err != nil {
+		return nil, err
+	}
+	bestNegative, err := best(negatives)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Result, len(candidates))
+	for i, id := range candidates {
+		score := bestPositive[i]
+		if bestNegative != nil && bestNegative[i] > score {
+			score = -bestNegative[i]
+		}
+		results[i] = &Result{ID: id, Similarity: score}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Similarity != results[j].Similarity {
+			return results[i].Similarity > results[j].Similarity
+		}
+		return results[i].ID < results[j].ID
+	})
+	return recommendTrim(results, exclude, k), nil
+}
+
+func recommendExamples(positiveIDs, negativeIDs []uint64) map[uint64]bool {
+	exclude := make(map[uint64]bool, len(positiveIDs)+len(negativeIDs))
+	for _, id := range positiveIDs {
+		exclude[id] = true
+	}
+	for _, id := range negativeIDs {
+		exclude[id] = true
+	}
+	return exclude
+}
+
+// recommendTrim drops the examples from results and keeps the first k
+func recommendTrim(results []*Result, exclude map[uint64]bool, k int) []*Result {
+	kept := results[:0]
+	for _, r := range results {
+		if !exclude[r.ID] {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) > k {
+		kept = kept[:k]
+	}
+	return kept
+}
@@ -0,0 +1,117 @@
+package cvector
+
+/*
+#include <stdlib.h>
+#include "core/cvector.h"
+*/
+import "C"
+import (
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+// RepairReport describes what Repair salvaged from a damaged database
+type RepairReport struct {
+	RecordsScanned int
+	Recovered      int      // Live vectors written to the new database
+	Deleted        int      // Intact tombstones and superseded copies, dropped as compaction would
+	Unreadable     int      // Damaged or truncated records that were skipped
+	LostIDs        []uint64 // IDs of skipped records with no intact copy, ascending
+}
+
+// Repair salvages the database at srcPath, typically one that fails to open
+// with ErrDBCorrupt, into a new database at dstPath, which must not exist.
+// Damaged records are skipped and the rest are kept with their metadata,
+// versions and timestamps. The source is only read. Only a damaged file
+// header cannot be repaired, and fails with ErrDBCorrupt.
+//
+// LostIDs are read from the damaged records themselves, so an ID damaged
+// along with its record may be missing or wrong.
+func Repair(srcPath, dstPath string) (*RepairReport, error) {
+	for _, target := range []string{dstPath, metaPath(dstPath), pcaPath(dstPath)} {
+		if fileExists(target) {
+			return nil, fmt.Errorf("cvector: repair target %s already exists: %w", target, ErrFileIO)
+		}
+	}
+
+	cSrc := C.CString(srcPath)
+	defer C.free(unsafe.Pointer(cSrc))
+	cDst := C.CString(dstPath)
+	defer C.free(unsafe.Pointer(cDst))
+
+	var cReport C.cvector_repair_report_t
+	var cLost *C.cvector_id_t
+	var lostCount C.size_t
+	if code := C.cvector_repair(cSrc, cDst, &cReport, &cLost, &lostCount); code != 0 {
+		return nil, newOpError("repair", srcPath, 0, Error(code))
+	}
+
+	report := &RepairReport{
+		RecordsScanned: int(cReport.records_scanned),
+		Recovered:      int(cReport.recovered_vectors),
+		Deleted:        int(cReport.deleted_records),
+		Unreadable:     int(cReport.unreadable_records),
+	}
+	if lostCount > 0 {
+		for _, id := range unsafe.Slice(cLost, lostCount) {
+			report.LostIDs = append(report.LostIDs, uint64(id))
+		}
+		C.cvector_free_ids(cLost)
+	}
+
+	if err := repairSidecars(srcPath, dstPath); err != nil {
+		os.Remove(dstPath)
+		os.Remove(metaPath(dstPath))
+		os.Remove(pcaPath(dstPath))
+		return nil, err
+	}
+	return report, nil
+}
+
+// repairSidecars carries the metadata and tags of the recovered vectors
+// and the PCA projection over to the repaired database. The sidecars are
+// read as leniently as OpenDB does, so a torn metadata line is dropped
+// like there.
+func repairSidecars(srcPath, dstPath string) error {
+	src, err := openMetaStore(srcPath)
+	if err != nil {
+		return err
+	}
+
+	repaired, err := OpenDBWithConfig(&DBConfig{DataPath: dstPath, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	ids, err := repaired.IDs()
+	repaired.Close()
+	if err != nil {
+		return err
+	}
+
+	meta := &metaStore{
+		path:    metaPath(dstPath),
+		entries: make(map[uint64]map[string]any),
+		tags:    make(map[uint64][]string),
+		props:   src.props,
+		dirty:   true,
+	}
+	for _, id := range ids {
+		if md, ok := src.entries[id]; ok {
+			meta.entries[id] = md
+		}
+		if tags, ok := src.tags[id]; ok {
+			meta.tags[id] = tags
+		}
+	}
+	if err := meta.close(); err != nil {
+		return err
+	}
+
+	if p, err := loadPCA(srcPath); err != nil {
+		return err
+	} else if p != nil {
+		return p.save(dstPath)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package cvector
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// FieldType is the type of value a schema field holds
+type FieldType string
+
+const (
+	FieldString FieldType = "string"
+	FieldNumber FieldType = "number" // Any Go integer or float type; stored as float64
+	FieldBool   FieldType = "bool"
+	FieldGeo    FieldType = "geo"  // A GeoPoint
+	FieldText   FieldType = "text" // A string searched by its words; see KeywordSearch
+)
+
+// SchemaField declares one metadata key
+type SchemaField struct {
+	Name    string    `json:"name"`
+	Type    FieldType `json:"type"`
+	Indexed bool      `json:"indexed,omitempty"` // Answer the field's filters from an index; text needs it for KeywordSearch
+}
+
+// Schema declares the metadata keys a database's vectors may carry. Once
+// set, metadata with an undeclared key or a value of the wrong type is
+// rejected with a *SchemaError, so typos fail at insert instead of
+// silently never matching a filter.
+type Schema struct {
+	Fields []SchemaField `json:"fields"`
+
+	// AllowUnknown accepts keys not in Fields, unchecked and unindexed
+	AllowUnknown bool `json:"allow_unknown,omitempty"`
+}
+
+// SchemaError reports metadata the database's Schema rejects. It matches
+// ErrInvalidArgs under errors.Is.
+type SchemaError struct {
+	ID     uint64 // Vector whose metadata was rejected
+	Field  string
+	Reason string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("metadata of vector %d: field %q %s", e.ID, e.Field, e.Reason)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return ErrInvalidArgs
+}
+
+// field returns the declaration of name, or nil
+func (s *Schema) field(name string) *SchemaField {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Fields {
+		if s.Fields[i].Name == name {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+// check reports the first problem with the schema itself
+func (s *Schema) check() error {
+	seen := make(map[string]bool, len(s.Fields))
+	for _, f := range s.Fields {
+		switch {
+		case f.Name == "":
+			return &ConfigError{"Schema", "field names must not be empty"}
+		case seen[f.Name]:
+			return &ConfigError{"Schema", fmt.Sprintf("field %q declared twice", f.Name)}
+		case f.Type != FieldString && f.Type != FieldNumber && f.Type != FieldBool && f.Type != FieldGeo && f.Type != FieldText:
+			return &ConfigError{"Schema", fmt.Sprintf("field %q has unknown type %q", f.Name, f.Type)}
+		}
+		seen[f.Name] = true
+	}
+	return nil
+}
+
+// validate checks the metadata of vector id against the schema. A nil
+// schema accepts anything.
+func (s *Schema) validate(id uint64, md map[string]any) error {
+	if s == nil {
+		return nil
+	}
+	for key, value := range md {
+		f := s.field(key)
+		if f == nil {
+			if s.AllowUnknown {
+				continue
+			}
+			return &SchemaError{id, key, "is not in the schema"}
+		}
+		if got := fieldType(value); got != f.Type && !(f.Type == FieldText && got == FieldString) {
+			return &SchemaError{id, key, fmt.Sprintf("must be a %s, got %T", f.Type, value)}
+		}
+	}
+	return nil
+}
+
+// indexed returns the names of the indexed fields whose values can be
+// looked up by equality, which excludes points and text
+func (s *Schema) indexed() []string {
+	if s == nil {
+		return nil
+	}
+	var names []string
+	for _, f := range s.Fields {
+		if f.Indexed && f.Type != FieldGeo && f.Type != FieldText {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// indexedNumbers returns the names of the indexed numeric fields, which
+// also get a sorted index for Query.Ranges
+func (s *Schema) indexedNumbers() []string {
+	if s == nil {
+		return nil
+	}
+	var names []string
+	for _, f := range s.Fields {
+		if f.Indexed && f.Type == FieldNumber {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// indexedPoints returns the names of the indexed geo fields
+func (s *Schema) indexedPoints() []string {
+	if s == nil {
+		return nil
+	}
+	var names []string
+	for _, f := range s.Fields {
+		if f.Indexed && f.Type == FieldGeo {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// indexedTexts returns the names of the indexed text fields
+func (s *Schema) indexedTexts() []string {
+	if s == nil {
+		return nil
+	}
+	var names []string
+	for _, f := range s.Fields {
+		if f.Indexed && f.Type == FieldText {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+func (s *Schema) clone() *Schema {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.Fields = slices.Clone(s.Fields)
+	return &c
+}
+
+// fieldType returns the schema type of a metadata value, or "" if it has
+// none
+func fieldType(value any) FieldType {
+	switch value.(type) {
+	case string:
+		return FieldString
+	case bool:
+		return FieldBool
+	case float64, float32, int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64, json.Number:
+		return FieldNumber
+	}
+	if _, ok := geoValue(value); ok {
+		return FieldGeo
+	}
+	return ""
+}
+
+// indexKey returns value in the form the field indexes store it, so that
+// numbers compare equal whatever their Go type, as they do once the
+// metadata has been through the sidecar. ok is false for values no index
+// holds, such as lists and objects.
+func indexKey(value any) (key any, ok bool) {
+	switch v := value.(type) {
+	case string, bool, float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return nil, false
+}
+
+// Schema returns the database's metadata schema, or nil if it has none
+func (db *DB) Schema() *Schema {
+	return db.meta.properties().Schema.clone()
+}
+
+// SetSchema replaces the database's metadata schema, building indexes for
+// its indexed fields. It fails with a *SchemaError, changing nothing, if
+// any stored metadata does not conform. A nil schema removes it.
+func (db *DB) SetSchema(schema *Schema) error {
+	if db.db == nil {
+		return ErrInvalidArgs
+	}
+	if schema != nil {
+		if err := schema.check(); err != nil {
+			return err
+		}
+	}
+	if err := db.meta.setSchema(schema.clone()); err != nil {
+		return err
+	}
+	return db.syncWrite()
+}
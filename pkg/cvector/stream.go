@@ -0,0 +1,341 @@
+package cvector
+
+/*
+#include "core/cvector.h"
+*/
+import "C"
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// streamMagic starts every stream written by WriteTo
+const streamMagic = "CVSTREAM"
+
+// streamVersion is bumped when the stream layout changes. Version 2 added
+// each vector's tags; version 1 streams still read.
+const streamVersion = 2
+
+// Record tags
+const (
+	streamEnd    = 0
+	streamVector = 1
+)
+
+// maxStreamMetadata bounds one vector's encoded metadata or tags, so a
+// corrupt length cannot ask for an unbounded allocation
+const maxStreamMetadata = 64 << 20
+
+// streamHeader describes the database a stream was written from
+type streamHeader struct {
+	Name              string          `json:"name,omitempty"`
+	Description       string          `json:"description,omitempty"`
+	Dimension         uint32          `json:"dimension"`
+	DefaultSimilarity SimilarityType  `json:"similarity"`
+	NormalizeOnInsert bool            `json:"normalize_on_insert,omitempty"`
+	MaxVectors        int             `json:"max_vectors,omitempty"`
+	PCA               json.RawMessage `json:"pca,omitempty"`
+}
+
+// WriteTo serializes the whole database to w as a single stream: its
+// settings, PCA projection, and every vector with its metadata and tags,
+// followed by a count and CRC-32 checksum. ReadFrom turns the stream back
+// into a database. Like Iterate it writes the vectors as they stood when
+// it started, whatever writes happen meanwhile. It implements io.WriterTo.
+func (db *DB) WriteTo(w io.Writer) (int64, error) {
+	stats, err := db.Stats()
+	if err != nil {
+		return 0, err
+	}
+
+	header := streamHeader{
+		Name:              stats.Name,
+		Description:       stats.Description,
+		Dimension:         stats.Dimension,
+		DefaultSimilarity: stats.DefaultSimilarity,
+		NormalizeOnInsert: stats.NormalizeOnInsert,
+		MaxVectors:        stats.MaxVectors,
+	}
+	if db.pca != nil {
+		if header.PCA, err = json.Marshal(db.pca); err != nil {
+			return 0, err
+		}
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &countingWriter{w: w}
+	bw := bufio.NewWriter(counter)
+	crc := crc32.NewIEEE()
+	out := io.MultiWriter(bw, crc)
+
+	var buf [8]byte
+	put32 := func(v uint32) {
+		binary.LittleEndian.PutUint32(buf[:4], v)
+		out.Write(buf[:4])
+	}
+	put64 := func(v uint64) {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		out.Write(buf[:])
+	}
+
+	io.WriteString(out, streamMagic)
+	put32(streamVersion)
+	put32(uint32(len(headerJSON)))
+	out.Write(headerJSON)
+
+	var count uint64
+	err = db.Iterate(func(v *Vector) error {
+		var metadata, tags []byte
+		if len(v.Metadata) > 0 {
+			var err error
+			if metadata, err = json.Marshal(v.Metadata); err != nil {
+				return err
+			}
+		}
+		if len(v.Tags) > 0 {
+			var err error
+			if tags, err = json.Marshal(v.Tags); err != nil {
+				return err
+			}
+		}
+
+		out.Write([]byte{streamVector})
+		put64(v.ID)
+		put32(uint32(len(v.Data)))
+		for _, x := range v.Data {
+			put32(math.Float32bits(x))
+		}
+		put32(uint32(len(metadata)))
+		out.Write(metadata)
+		put32(uint32(len(tags)))
+		out.Write(tags)
+		count++
+
+		// Writes above are buffered; surface a failing writer here rather
+		// than after the whole database has been read
+		return counter.err
+	})
+	if err != nil {
+		return counter.n, err
+	}
+
+	out.Write([]byte{streamEnd})
+	put64(count)
+	binary.LittleEndian.PutUint32(buf[:4], crc.Sum32())
+	bw.Write(buf[:4])
+	if err := bw.Flush(); err != nil {
+		return counter.n, err
+	}
+	return counter.n, nil
+}
+
+// ReadFrom creates a database at path from a stream written by WriteTo and
+// returns it open. The checksum is verified once the stream ends; a
+// truncated or corrupt stream fails with ErrDBCorrupt or
+// io.ErrUnexpectedEOF and leaves nothing at path.
+func ReadFrom(r io.Reader, path string) (*DB, error) {
+	br := bufio.NewReader(r)
+	crc := crc32.NewIEEE()
+	in := io.TeeReader(br, crc)
+
+	var buf [8]byte
+	get32 := func() (uint32, error) {
+		_, err := io.ReadFull(in, buf[:4])
+		return binary.LittleEndian.Uint32(buf[:4]), err
+	}
+	get64 := func() (uint64, error) {
+		_, err := io.ReadFull(in, buf[:])
+		return binary.LittleEndian.Uint64(buf[:]), err
+	}
+
+	magic := make([]byte, len(streamMagic))
+	if _, err := io.ReadFull(in, magic); err != nil {
+		return nil, streamError(err)
+	}
+	if string(magic) != streamMagic {
+		return nil, ErrDBCorrupt
+	}
+	version, err := get32()
+	if err != nil {
+		return nil, streamError(err)
+	}
+	if version < 1 || version > streamVersion {
+		return nil, ErrVersionTooNew
+	}
+
+	headerLen, err := get32()
+	if err != nil {
+		return nil, streamError(err)
+	}
+	if headerLen > maxStreamMetadata {
+		return nil, ErrDBCorrupt
+	}
+	headerJSON := make([]byte, headerLen)
+	if _, err := io.ReadFull(in, headerJSON); err != nil {
+		return nil, streamError(err)
+	}
+	var header streamHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrDBCorrupt
+	}
+
+	var pca *PCA
+	if len(header.PCA) > 0 {
+		pca = &PCA{}
+		if err := json.Unmarshal(header.PCA, pca); err != nil {
+			return nil, ErrDBCorrupt
+		}
+	}
+
+	name := header.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	db, err := CreateDB(&DBConfig{
+		Name:              name,
+		Description:       header.Description,
+		DataPath:          path,
+		Dimension:         header.Dimension,
+		DefaultSimilarity: header.DefaultSimilarity,
+		NormalizeOnInsert: header.NormalizeOnInsert,
+		MaxVectors:        header.MaxVectors,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (*DB, error) {
+		db.Close()
+		DropDB(path)
+		return nil, err
+	}
+	if pca != nil {
+		if err := pca.save(path); err != nil {
+			return fail(err)
+		}
+		db.pca = pca
+	}
+
+	var count uint64
+	for {
+		tag, err := br.ReadByte()
+		if err != nil {
+			return fail(streamError(err))
+		}
+		crc.Write([]byte{tag})
+		if tag == streamEnd {
+			break
+		}
+		if tag != streamVector {
+			return fail(ErrDBCorrupt)
+		}
+
+		id, err := get64()
+		if err != nil {
+			return fail(streamError(err))
+		}
+		n, err := get32()
+		if err != nil {
+			return fail(streamError(err))
+		}
+		if n == 0 || n > C.CVECTOR_MAX_DIMENSION {
+			return fail(ErrDBCorrupt)
+		}
+		data := make([]float32, n)
+		for i := range data {
+			bits, err := get32()
+			if err != nil {
+				return fail(streamError(err))
+			}
+			data[i] = math.Float32frombits(bits)
+		}
+		vector := NewVector(id, data)
+		if err := readStreamJSON(in, &vector.Metadata); err != nil {
+			return fail(err)
+		}
+		if version >= 2 {
+			if err := readStreamJSON(in, &vector.Tags); err != nil {
+				return fail(err)
+			}
+		}
+		if err := db.Insert(vector); err != nil {
+			return fail(err)
+		}
+		count++
+	}
+
+	written, err := get64()
+	if err != nil {
+		return fail(streamError(err))
+	}
+	sum := crc.Sum32()
+	if _, err := io.ReadFull(br, buf[:4]); err != nil {
+		return fail(streamError(err))
+	}
+	if written != count || binary.LittleEndian.Uint32(buf[:4]) != sum {
+		return fail(ErrDBCorrupt)
+	}
+
+	if err := db.Flush(); err != nil {
+		return fail(err)
+	}
+	return db, nil
+}
+
+// readStreamJSON reads a length-prefixed JSON value into v, leaving v
+// alone when the length is zero
+func readStreamJSON(in io.Reader, v any) error {
+	var buf [4]byte
+	if _, err := io.ReadFull(in, buf[:]); err != nil {
+		return streamError(err)
+	}
+	n := binary.LittleEndian.Uint32(buf[:])
+	if n > maxStreamMetadata {
+		return ErrDBCorrupt
+	}
+	if n == 0 {
+		return nil
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(in, data); err != nil {
+		return streamError(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrDBCorrupt
+	}
+	return nil
+}
+
+// streamError reports a stream that ends early as io.ErrUnexpectedEOF
+func streamError(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// countingWriter counts bytes written and remembers the first error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,199 @@
+package cvector
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters for KeywordSearch, at their customary values
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// KeywordFilter keeps only vectors whose text metadata Field contains every
+// word of Text. Words are compared case-insensitively, and punctuation
+// separates them.
+type KeywordFilter struct {
+	Field string
+	Text  string
+}
+
+// tokenize splits text into lowercase words of letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// distinctTokens returns the words of text, sorted and without repeats
+func distinctTokens(text string) []string {
+	tokens := tokenize(text)
+	slices.Sort(tokens)
+	return slices.Compact(tokens)
+}
+
+// textIndex is an inverted index over one text field
+type textIndex struct {
+	postings map[string]map[uint64]int // Word to the IDs containing it and how often
+	lengths  map[uint64]int            // Words in each ID's text
+	total    int                       // Sum of lengths
+}
+
+func newTextIndex() *textIndex {
+	return &textIndex{postings: make(map[string]map[uint64]int), lengths: make(map[uint64]int)}
+}
+
+func (x *textIndex) add(id uint64, text string) {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return
+	}
+	for _, token := range tokens {
+		ids := x.postings[token]
+		if ids == nil {
+			ids = make(map[uint64]int)
+			x.postings[token] = ids
+		}
+		ids[id]++
+	}
+	x.lengths[id] = len(tokens)
+	x.total += len(tokens)
+}
+
+func (x *textIndex) remove(id uint64, text string) {
+	for _, token := range tokenize(text) {
+		if ids := x.postings[token]; ids != nil {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(x.postings, token)
+			}
+		}
+	}
+	x.total -= x.lengths[id]
+	delete(x.lengths, id)
+}
+
+// containing returns the IDs whose text has every one of words
+func (x *textIndex) containing(words []string) map[uint64]bool {
+	ids := make(map[uint64]bool)
+	if len(words) == 0 {
+		return ids
+	}
+	for id := range x.postings[words[0]] {
+		ids[id] = true
+	}
+	for _, word := range words[1:] {
+		for id := range ids {
+			if _, ok := x.postings[word][id]; !ok {
+				delete(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// bm25 scores the IDs containing any of words by Okapi BM25
+func (x *textIndex) bm25(words []string) map[uint64]float64 {
+	scores := make(map[uint64]float64)
+	n := float64(len(x.lengths))
+	if n == 0 {
+		return scores
+	}
+	avgLength := float64(x.total) / n
+	for _, word := range words {
+		ids := x.postings[word]
+		df := float64(len(ids))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range ids {
+			norm := 1 - bm25B + bm25B*float64(x.lengths[id])/avgLength
+			scores[id] += idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + bm25K1*norm)
+		}
+	}
+	return scores
+}
+
+// KeywordSearch ranks vectors by how well their text metadata field
+// matches the words of text, using BM25 over the field's inverted index,
+// and returns the best k. Each result's Similarity is its BM25 score, so
+// it ranks but is not comparable to vector similarities; combine the two
+// with FuseResults, or use SearchHybrid. The field must be an indexed
+// FieldText in the schema, or it fails with ErrInvalidArgs.
+func (db *DB) KeywordSearch(field, text string, k int) ([]*Result, error) {
+	if db.db == nil || k <= 0 {
+		return nil, ErrInvalidArgs
+	}
+	return db.keywordSearch(field, text, k, nil)
+}
+
+// keywordSearch is KeywordSearch keeping only IDs admit accepts, unless
+// it is nil
+func (db *DB) keywordSearch(field, text string, k int, admit func(id uint64) bool) ([]*Result, error) {
+	scores, ok := db.meta.bm25(field, distinctTokens(text))
+	if !ok {
+		return nil, ErrInvalidArgs
+	}
+
+	results := make([]*Result, 0, len(scores))
+	for id, score := range scores {
+		if admit == nil || admit(id) {
+			results = append(results, &Result{ID: id, Similarity: float32(score)})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Similarity != results[j].Similarity {
+			return results[i].Similarity > results[j].Similarity
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// SearchHybrid combines a vector search for query with a keyword search
+// for text over an indexed text field, merging the two rankings with
+// fusion; a zero Fusion uses reciprocal rank fusion. The keyword leg keeps
+// to query's filters, and each leg fetches query's TopK. Fusion.TopK left
+// zero keeps the same number of results.
+func (db *DB) SearchHybrid(query *Query, field, text string, fusion Fusion) ([]*Result, error) {
+	if db.db == nil || query == nil {
+		return nil, ErrInvalidArgs
+	}
+	topK := query.TopK
+	if topK == 0 {
+		topK = db.QueryDefaults().TopK
+	}
+
+	vectorQuery := *query
+	if fusion.Method == FusionWeightedSum {
+		vectorQuery.NormalizeScores = true
+	}
+	vectorResults, err := db.Search(&vectorQuery)
+	if err != nil {
+		return nil, err
+	}
+	admit, _, err := db.queryFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	keywordResults, err := db.keywordSearch(field, text, int(max(topK, 1)), admit)
+	if err != nil {
+		return nil, err
+	}
+	if fusion.Method == FusionWeightedSum {
+		// Squash BM25 scores onto the 0-1 scale of normalized similarities
+		for _, r := range keywordResults {
+			r.Similarity = r.Similarity / (r.Similarity + 1)
+		}
+	}
+
+	if fusion.TopK == 0 {
+		fusion.TopK = int(topK)
+	}
+	return FuseResults(fusion, vectorResults, keywordResults)
+}
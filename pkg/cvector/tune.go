@@ -0,0 +1,166 @@
+package cvector
+
+/*
+#include "core/cvector.h"
+*/
+import "C"
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// defaultTuneRecall is the recall Tune aims for when TuneOptions sets none
+const defaultTuneRecall = 0.95
+
+// TuneOptions controls DB.Tune
+type TuneOptions struct {
+	// TargetRecall is the share of the true TopK nearest neighbors searches
+	// should find, in (0, 1]. Zero for 0.95.
+	TargetRecall float64
+
+	// TopK is the number of results per query. Zero for the database's
+	// default, else 10.
+	TopK int
+
+	// Candidates are the EfSearch values to try, in the order given. Nil
+	// doubles from TopK up to the number of vectors.
+	Candidates []int
+}
+
+// TuneTrial is the outcome of searching every query with one EfSearch
+type TuneTrial struct {
+	EfSearch int
+	Recall   float64       // Share of the true nearest neighbors found
+	Latency  time.Duration // Mean time per search
+}
+
+// TuneResult is the EfSearch Tune settled on and the trials it ran
+type TuneResult struct {
+	EfSearch int
+	Recall   float64
+	Latency  time.Duration
+	Reached  bool // Recall is at least the target
+	Trials   []TuneTrial
+}
+
+// Tune measures how many of the true nearest neighbors of queries index
+// searches find at increasing EfSearch, against exact results from
+// SearchRadius, and picks the smallest EfSearch that reaches the target
+// recall. If none does it picks the one with the best recall, and
+// TuneResult.Reached is false. Searches use the database's default
+// similarity and query defaults. Tune changes no settings; pass
+// TuneResult.EfSearch to SaveEfSearch to keep it.
+func (db *DB) Tune(queries [][]float32, opts *TuneOptions) (*TuneResult, error) {
+	if db.db == nil || len(queries) == 0 {
+		return nil, ErrInvalidArgs
+	}
+	o := TuneOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.TargetRecall == 0 {
+		o.TargetRecall = defaultTuneRecall
+	}
+	if o.TopK == 0 {
+		o.TopK = int(db.QueryDefaults().TopK)
+	}
+	if o.TopK == 0 {
+		o.TopK = 10
+	}
+	if o.TargetRecall < 0 || o.TargetRecall > 1 || o.TopK < 0 || o.TopK > maxSearchTopK {
+		return nil, ErrInvalidArgs
+	}
+	for _, ef := range o.Candidates {
+		if ef <= 0 || ef > C.CVECTOR_MAX_EF_SEARCH {
+			return nil, ErrInvalidArgs
+		}
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		return nil, err
+	}
+	if stats.TotalVectors == 0 {
+		return nil, fmt.Errorf("cvector: tune needs vectors in the database: %w", ErrInvalidArgs)
+	}
+	if o.Candidates == nil {
+		o.Candidates = tuneCandidates(o.TopK, stats.TotalVectors)
+	}
+
+	// The exact neighbors, subject to the same similarity floor as searches
+	minSimilarity := db.QueryDefaults().MinSimilarity
+	floor := minSimilarity
+	if floor == 0 {
+		floor = float32(math.Inf(-1))
+	}
+	truth := make([]map[uint64]bool, len(queries))
+	for i, q := range queries {
+		results, err := db.SearchRadius(&Query{
+			QueryVector:   q,
+			TopK:          uint32(o.TopK),
+			Similarity:    stats.DefaultSimilarity,
+			MinSimilarity: floor,
+		})
+		if err != nil {
+			return nil, err
+		}
+		truth[i] = make(map[uint64]bool, len(results))
+		for _, r := range results {
+			truth[i][r.ID] = true
+		}
+	}
+
+	res := &TuneResult{}
+	for _, ef := range o.Candidates {
+		trial := TuneTrial{EfSearch: ef}
+		found, want := 0, 0
+		var elapsed time.Duration
+		for i, q := range queries {
+			start := time.Now()
+			results, err := db.Search(&Query{
+				QueryVector:   q,
+				TopK:          uint32(o.TopK),
+				Similarity:    stats.DefaultSimilarity,
+				MinSimilarity: minSimilarity,
+				EfSearch:      uint32(ef),
+			})
+			elapsed += time.Since(start)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range results {
+				if truth[i][r.ID] {
+					found++
+				}
+			}
+			want += len(truth[i])
+		}
+		trial.Recall = 1
+		if want > 0 {
+			trial.Recall = float64(found) / float64(want)
+		}
+		trial.Latency = elapsed / time.Duration(len(queries))
+		res.Trials = append(res.Trials, trial)
+
+		if len(res.Trials) == 1 || trial.Recall > res.Recall {
+			res.EfSearch, res.Recall, res.Latency = trial.EfSearch, trial.Recall, trial.Latency
+		}
+		if trial.Recall >= o.TargetRecall {
+			res.Reached = true
+			break
+		}
+	}
+	return res, nil
+}
+
+// tuneCandidates doubles from topK until a graph walk could cover every
+// vector
+func tuneCandidates(topK, vectors int) []int {
+	limit := min(max(vectors, topK), C.CVECTOR_MAX_EF_SEARCH)
+	var candidates []int
+	for ef := topK; ef < limit; ef *= 2 {
+		candidates = append(candidates, ef)
+	}
+	return append(candidates, limit)
+}
@@ -1,6 +1,12 @@
 package cvector
 
-import "time"
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+)
 
 // Error represents CVector error codes
 type Error int
@@ -14,6 +20,15 @@ const (
 	ErrVectorNotFound    Error = -5
 	ErrDimensionMismatch Error = -6
 	ErrDBCorrupt         Error = -7
+	ErrInvalidVectorData Error = -8
+	ErrDBFull            Error = -9
+	ErrDuplicateID       Error = -10
+	ErrReadOnly          Error = -11
+	ErrVersionTooNew     Error = -12
+	ErrNeedsMigration    Error = -13
+	ErrQuotaExceeded     Error = -14
+	ErrVersionConflict   Error = -15
+	ErrLocked            Error = -16
 )
 
 func (e Error) Error() string {
@@ -34,11 +49,54 @@ func (e Error) Error() string {
 		return "Dimension mismatch"
 	case ErrDBCorrupt:
 		return "Database corrupt"
+	case ErrInvalidVectorData:
+		return "Invalid vector data"
+	case ErrDBFull:
+		return "Database full"
+	case ErrDuplicateID:
+		return "Duplicate vector ID"
+	case ErrReadOnly:
+		return "Database is read-only"
+	case ErrVersionTooNew:
+		return "Database file format is newer than this version supports"
+	case ErrNeedsMigration:
+		return "Database file format is outdated; run cvector migrate"
+	case ErrQuotaExceeded:
+		return "Database size quota exceeded"
+	case ErrVersionConflict:
+		return "Vector version does not match"
+	case ErrLocked:
+		return "Database is locked by another process"
 	default:
 		return "Unknown error"
 	}
 }
 
+// VectorDataError reports the first NaN or infinite component of a vector.
+// It matches ErrInvalidVectorData under errors.Is.
+type VectorDataError struct {
+	Index int
+	Value float32
+}
+
+func (e *VectorDataError) Error() string {
+	return fmt.Sprintf("Invalid vector data: component %d is %v", e.Index, e.Value)
+}
+
+func (e *VectorDataError) Unwrap() error {
+	return ErrInvalidVectorData
+}
+
+// validateVectorData checks every component is a finite number
+func validateVectorData(data []float32) error {
+	for i, x := range data {
+		if math.IsNaN(float64(x)) || math.IsInf(float64(x), 0) {
+			return &VectorDataError{Index: i, Value: x}
+		}
+	}
+	return nil
+}
+
 // SimilarityType represents different similarity metrics
 type SimilarityType int
 
@@ -48,14 +106,185 @@ const (
 	SimilarityEuclidean  SimilarityType = 2
 )
 
+// String returns the metric's canonical name: "cosine", "dot" or "euclidean"
+func (s SimilarityType) String() string {
+	switch s {
+	case SimilarityCosine:
+		return "cosine"
+	case SimilarityDotProduct:
+		return "dot"
+	case SimilarityEuclidean:
+		return "euclidean"
+	default:
+		return fmt.Sprintf("SimilarityType(%d)", int(s))
+	}
+}
+
+// ParseSimilarity maps a metric name to its SimilarityType. Matching is
+// case-insensitive and accepts "dotproduct" and "l2" as aliases.
+func ParseSimilarity(name string) (SimilarityType, error) {
+	switch strings.ToLower(name) {
+	case "cosine":
+		return SimilarityCosine, nil
+	case "dot", "dotproduct":
+		return SimilarityDotProduct, nil
+	case "euclidean", "l2":
+		return SimilarityEuclidean, nil
+	default:
+		return 0, fmt.Errorf("unknown similarity type %q: use cosine, dot or euclidean", name)
+	}
+}
+
+// MarshalText encodes the metric by name, so it appears as "cosine" rather
+// than 0 in JSON and other text formats
+func (s SimilarityType) MarshalText() ([]byte, error) {
+	switch s {
+	case SimilarityCosine, SimilarityDotProduct, SimilarityEuclidean:
+		return []byte(s.String()), nil
+	default:
+		return nil, fmt.Errorf("unknown similarity type %d", int(s))
+	}
+}
+
+// UnmarshalText decodes any name accepted by ParseSimilarity
+func (s *SimilarityType) UnmarshalText(text []byte) error {
+	parsed, err := ParseSimilarity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
 // DBConfig holds database configuration
 type DBConfig struct {
 	Name              string
+	Description       string
 	DataPath          string
 	Dimension         uint32
 	DefaultSimilarity SimilarityType
 	MemoryMapped      bool
-	MaxVectors        int
+	MaxVectors        int // Live vector limit; Insert fails with ErrDBFull at it. Zero for none.
+
+	// NormalizeOnInsert stores every vector scaled to unit length. Cosine
+	// searches then run as dot products, and Get returns the normalized
+	// vector rather than the one inserted. Fixed at creation.
+	NormalizeOnInsert bool
+
+	// DimensionPolicy resizes inserted and query vectors whose length
+	// differs from Dimension. The default, DimensionStrict, rejects them.
+	DimensionPolicy DimensionPolicy
+
+	// OnConflict decides what Insert does with an ID that is already
+	// stored. The default, ConflictError, fails with ErrDuplicateID.
+	OnConflict ConflictPolicy
+
+	// DefaultTopK, DefaultMinSimilarity and DefaultOversample fill in the
+	// matching Query fields when a Search leaves them zero. CreateDB stores
+	// them with the database, and DB.SetQueryDefaults changes them later.
+	// When opening, non-zero values override the stored ones for that
+	// handle only.
+	DefaultTopK          uint32
+	DefaultMinSimilarity float32
+	DefaultOversample    int
+
+	// ReadOnly opens the database without write access. Mutations fail
+	// with ErrReadOnly. Any number of read-only handles may share a file
+	// with one writer; see DB.Refresh. Ignored by CreateDB.
+	ReadOnly bool
+
+	// SkipCorruptRecords opens a file with damaged records instead of
+	// failing with ErrDBCorrupt, serving the intact ones. Gets of a damaged
+	// record's ID fail with ErrDBCorrupt until a compaction drops it; see
+	// Stats.UnreadableRecords and Repair. Ignored by CreateDB.
+	SkipCorruptRecords bool
+
+	// SoftDelete has Delete keep the deleted vector's metadata, so Undelete
+	// can restore it along with the vector until the next compaction.
+	// Without it Undelete restores the vector alone.
+	SoftDelete bool
+
+	// BackgroundIndex opens without building the HNSW index first. A
+	// background goroutine builds it in batches while reads and writes go
+	// on; inserts meanwhile wait in a buffer that searches score exactly,
+	// and join the index once the build reaches them. See DB.IndexStatus.
+	// Ignored by CreateDB.
+	BackgroundIndex bool
+
+	// Schema declares the metadata keys vectors may carry, their types and
+	// which are indexed for Query.Filter. Nil accepts any metadata. It is
+	// stored with the database; see DB.SetSchema. Ignored by OpenDB.
+	Schema *Schema
+
+	// VersionHistory keeps this many previous versions of each vector when
+	// it is overwritten, with their metadata, for GetVersion and Rollback;
+	// say, to compare embeddings across a model upgrade. Only handles
+	// opened with it record history. Zero keeps none.
+	VersionHistory int
+
+	// SearchThreads caps concurrent searches in the engine. Zero for no cap.
+	SearchThreads int
+
+	// EfSearch is the HNSW candidate list size for queries that set no
+	// Query.EfSearch; see DB.SetEfSearch. CreateDB stores it with the
+	// database. Zero takes the stored value, see DB.SaveEfSearch, else
+	// twice TopK.
+	EfSearch int
+
+	// CacheBytes keeps up to this many bytes of recently read vectors in
+	// memory, so repeated Gets of popular items skip the file. Zero
+	// disables the cache.
+	CacheBytes int
+
+	// BlockCacheBytes keeps up to this many bytes of 4 KiB file blocks in
+	// memory. It sits below the vector cache and is shared by Gets and
+	// brute-force scans, bounding their memory instead of leaving it all
+	// to the OS page cache. Zero disables it.
+	BlockCacheBytes int
+
+	// MaxSizeBytes caps the size of the data file. Inserts and overwrites
+	// that would grow it further fail with ErrQuotaExceeded; Compact
+	// reclaims space under the quota. Zero for none.
+	MaxSizeBytes int64
+
+	// SyncMode decides when writes are forced to disk; see SyncMode. The
+	// default, SyncOS, leaves it to the operating system. SyncInterval is
+	// the period for SyncInterval mode and defaults to one second.
+	SyncMode     SyncMode
+	SyncInterval time.Duration
+
+	// WriteBufferSize, when positive, makes Insert queue vectors and return
+	// immediately. A background goroutine applies them in groups of up to
+	// WriteBufferSize, waiting at most WriteBufferDelay (10ms by default)
+	// for a group to fill. Queued vectors are not visible to reads until
+	// applied; Flush waits for them. A buffered DB must be closed.
+	WriteBufferSize  int
+	WriteBufferDelay time.Duration
+
+	// MaxInflightInserts and MaxQueuedInserts bound ingest. Once
+	// MaxInflightInserts unbuffered inserts are running in the engine, or
+	// MaxQueuedInserts buffered ones are waiting, Insert fails fast with an
+	// *OverloadError carrying a retry hint rather than blocking. Zero for
+	// no limit.
+	MaxInflightInserts int
+	MaxQueuedInserts   int
+
+	// GCDeadRatio and GCMaxAge schedule compaction in the background.
+	// Compaction starts once tombstones make up GCDeadRatio of the stored
+	// records (0.3 for 30%), or once tombstones exist and GCMaxAge has
+	// passed since the last compaction. Zero disables either trigger.
+	GCDeadRatio float64
+	GCMaxAge    time.Duration
+
+	// Logger receives structured events for opens, closes and engine
+	// errors. Nil disables logging.
+	Logger *slog.Logger
+
+	// AuditLogPath, when set, names an append-only JSON-lines file that
+	// records every successful mutation. AuditActor is recorded for calls
+	// that do not name an actor themselves (Insert rather than InsertAs).
+	AuditLogPath string
+	AuditActor   string
 }
 
 // Vector represents a vector with metadata
@@ -64,28 +293,239 @@ type Vector struct {
 	Dimension uint32
 	Data      []float32
 	Timestamp time.Time
+	Version   uint32         // Set by Get: 1 on insert, bumped by every overwrite; see UpdateIf
+	Metadata  map[string]any // Optional: persisted in the .meta sidecar
+	Tags      []string       // Optional labels, indexed for Query.Tags; stored sorted and distinct
 }
 
 // Result represents a search result
 type Result struct {
 	ID         uint64
 	Similarity float32
-	Vector     *Vector // Optional: full vector data
+	Vector     *Vector        // Optional: full vector data
+	Explain    *ResultExplain // Set when Query.Explain is true
 }
 
 // Query represents a search query
 type Query struct {
-	QueryVector   []float32
+	QueryVector     []float32
+	QueryVector64   []float64 // Used when QueryVector is empty, rounded to float32
+	TopK            uint32
+	Similarity      SimilarityType
+	MinSimilarity   float32
+	Explain         bool // Attach execution diagnostics to each result
+	Normalize       bool // Scale QueryVector to unit length before scoring
+	NormalizeScores bool // Report Similarity on a 0-1 scale; see NormalizeScore
+
+	// DedupeBy, when set, names a metadata key whose value is returned at
+	// most once: of the vectors sharing a value only the best scoring is
+	// kept, and more candidates are fetched so TopK distinct ones remain
+	DedupeBy string
+
+	// InsertedAfter and InsertedBefore, when set, keep only vectors whose
+	// Timestamp is at or after InsertedAfter and before InsertedBefore
+	InsertedAfter  time.Time
+	InsertedBefore time.Time
+
+	// Tags, when set, keeps only vectors carrying every one of them, and
+	// ExcludeTags drops vectors carrying any of them. Both are answered
+	// from an index of Vector.Tags rather than by reading metadata.
+	Tags        []string
+	ExcludeTags []string
+
+	// Filter, when set, keeps only vectors whose metadata has each key set
+	// to the given value. Keys the schema marks indexed are answered from
+	// their index; others are checked on each candidate.
+	Filter map[string]any
+
+	// Ranges, when set, keeps only vectors whose metadata has each key set
+	// to a number within the given range. Indexed numeric keys are answered
+	// from a sorted index, so only vectors in range are considered.
+	Ranges map[string]Range
+
+	// GeoRadius, when set, keeps only vectors with a point in its field
+	// within its distance of its centre. Indexed geo fields are answered
+	// from a grid index.
+	GeoRadius *GeoRadius
+
+	// Keywords, when set, keeps only vectors whose text field contains
+	// every word of its text. Indexed text fields are answered from their
+	// inverted index.
+	Keywords *KeywordFilter
+
+	// Facets names metadata keys whose values SearchFacets counts over
+	// every vector the filters admit; Search ignores it
+	Facets []string
+
+	// IncludeSelf has SearchByID keep the stored vector it searches with
+	// among the results; by default it is left out
+	IncludeSelf bool
+
+	// Oversample, when above 1, has the engine find TopK*Oversample
+	// candidates and keeps the best TopK, trading speed for recall
+	Oversample int
+
+	// EfSearch sizes the candidate list of the HNSW graph walk for this
+	// query alone: larger finds more of the true nearest neighbors, more
+	// slowly. It is raised to TopK if smaller. Zero takes the database's
+	// setting; see DB.SetEfSearch.
+	EfSearch uint32
+}
+
+// Range matches numbers from Min to Max inclusive. Use math.Inf for an
+// open end.
+type Range struct {
+	Min float64
+	Max float64
+}
+
+func (r Range) contains(x float64) bool {
+	return x >= r.Min && x <= r.Max
+}
+
+// QueryDefaults are the values Search uses for Query fields left zero; see
+// DBConfig.DefaultTopK
+type QueryDefaults struct {
 	TopK          uint32
-	Similarity    SimilarityType
 	MinSimilarity float32
+	Oversample    int
+}
+
+// SearchStrategy names how a search found its candidates
+type SearchStrategy string
+
+const (
+	SearchStrategyIndex SearchStrategy = "hnsw" // Approximate search over the HNSW graph
+	SearchStrategyScan  SearchStrategy = "scan" // Exhaustive scan of stored vectors
+)
+
+// SearchExplain describes how a search was executed
+type SearchExplain struct {
+	Strategy          SearchStrategy
+	IndexFallback     bool // The index search failed and a scan was used instead
+	CandidatesScanned int  // Vectors scored against the query
+	IndexNodesVisited int  // HNSW nodes expanded during graph traversal
+	EfSearch          int  // HNSW candidate list size used, zero for scans
+
+	// MinSimilarity filtering
+	ThresholdChecked  int
+	ThresholdRejected int
+	FilterSelectivity float64 // Fraction of checked candidates that passed
+
+	IOTime      time.Duration // Reading vectors from disk
+	ScoringTime time.Duration // Computing similarities, including graph traversal
+	TotalTime   time.Duration
+}
+
+// ResultExplain holds per-result diagnostics
+type ResultExplain struct {
+	Rank            int            // 1-based position in the results
+	Source          SearchStrategy // Phase that produced the result
+	ThresholdMargin float32        // Similarity above Query.MinSimilarity
+	Search          *SearchExplain // Shared report for the whole search
 }
 
 // Stats holds database statistics
 type Stats struct {
+	Name              string
+	Description       string
 	TotalVectors      int
 	TotalSizeBytes    int
 	Dimension         uint32
 	DefaultSimilarity SimilarityType
 	DBPath            string
-}
\ No newline at end of file
+
+	// Space reclamation
+	DeletedVectors    int       // Tombstoned records still occupying file space
+	UnreadableRecords int       // Damaged records skipped by DBConfig.SkipCorruptRecords
+	ReclaimableBytes  int       // Bytes a compaction would free
+	Fragmentation     float64   // Percentage of record space held by tombstones
+	DeadRatio         float64   // Fraction of stored records that are tombstones
+	LastCompaction    time.Time // Zero if the database has never been compacted
+
+	// Index state
+	IndexType        string // "hnsw", or "none" when searches always scan
+	IndexStatus      IndexStatus
+	IndexedVectors   int
+	UnindexedVectors int  // Live vectors missing from the index, which searches scan
+	IndexLoaded      bool // Read from the saved index file at open rather than rebuilt
+	EfSearch         int  // Candidate list size for queries that set none, zero for twice TopK
+
+	MemoryMapped      bool
+	NormalizeOnInsert bool
+	MaxVectors        int   // Zero when there is no limit
+	MaxSizeBytes      int64 // Data file quota, zero when there is none
+
+	// NextID is one past the highest ID ever inserted. IDs from NextID
+	// upwards are never duplicates.
+	NextID uint64
+
+	// Read cache, see DBConfig.CacheBytes
+	CacheCapacity int    // Budget in bytes, zero when disabled
+	CacheBytes    int    // Bytes currently held
+	CacheEntries  int
+	CacheHits     uint64 // Reads answered from memory
+	CacheMisses   uint64 // Reads that went to the file
+
+	// Block cache, see DBConfig.BlockCacheBytes
+	BlockCacheCapacity int
+	BlockCacheBytes    int
+	BlockCacheHits     uint64
+	BlockCacheMisses   uint64 // Blocks read from the file
+
+	// Inserts refused by MaxInflightInserts or MaxQueuedInserts since open
+	RejectedInserts uint64
+}
+
+// MemoryUsage reports bytes allocated by the C engine. These allocations are
+// invisible to runtime.MemStats, so they explain RSS the Go heap does not.
+type MemoryUsage struct {
+	Database       int64 // Database handle and configuration
+	LookupTable    int64 // ID hash table buckets and entries
+	IndexStructure int64 // HNSW node table and node headers
+	IndexGraph     int64 // HNSW neighbor lists
+	IndexVectors   int64 // Vector copies cached by the HNSW index
+	IOBuffers      int64 // File buffers for the open database
+	Mapped         int64 // Resident estimate of memory-mapped data
+	Cache          int64 // Read cache entries and buckets
+	BlockCache     int64 // Block cache entries and buckets
+	Total          int64
+}
+
+// IndexStatus describes how much of the database the ANN index covers
+type IndexStatus string
+
+const (
+	IndexStatusNone     IndexStatus = "none"     // No index; searches scan every vector
+	IndexStatusReady    IndexStatus = "ready"    // Every live vector is indexed
+	IndexStatusPartial  IndexStatus = "partial"  // Some vectors are missing from the index
+	IndexStatusBuilding IndexStatus = "building" // A background build is filling in the index
+)
+
+// FileInfo describes a database file as read directly from disk
+type FileInfo struct {
+	Dimension         uint32
+	DefaultSimilarity SimilarityType
+	LiveRecords       int
+	DeletedRecords    int
+	UpdatedRecords    int // Records appended by updates, live or superseded
+	SizeBytes         int
+	FormatVersion     int // On-disk format version; see FormatVersion
+}
+
+// RecordInfo describes how a single vector is laid out on disk.
+//
+// Checksum is computed from the bytes Describe reads; the file stores no
+// checksum of its own. It cannot show by itself that a record is damaged,
+// only that the record changed since an earlier Describe.
+type RecordInfo struct {
+	ID            uint64
+	Offset        int64  // Byte offset of the record in the data file
+	Length        int    // Record header plus vector data, in bytes
+	Dimension     uint32
+	Timestamp     time.Time
+	Deleted       bool
+	Version       uint32 // Per-vector version, as Vector.Version
+	Checksum      uint32 // CRC-32 of the record bytes as read
+	FormatVersion uint32 // File format version the record was read with
+}
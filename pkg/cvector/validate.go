@@ -0,0 +1,88 @@
+package cvector
+
+/*
+#include "core/cvector.h"
+*/
+import "C"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ConfigError reports a DBConfig field that CreateDB cannot use. It matches
+// ErrInvalidArgs under errors.Is.
+type ConfigError struct {
+	Field  string // DBConfig field name, such as "Dimension"
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return ErrInvalidArgs
+}
+
+// validateCreate checks config before it reaches the engine, which would
+// otherwise reject most of these cases with a bare ErrInvalidArgs
+func validateCreate(config *DBConfig) error {
+	switch {
+	case config.DataPath == "":
+		return &ConfigError{"DataPath", "must not be empty"}
+	case len(config.DataPath) >= C.CVECTOR_MAX_PATH:
+		return &ConfigError{"DataPath", fmt.Sprintf("must be shorter than %d bytes, got %d", C.CVECTOR_MAX_PATH, len(config.DataPath))}
+	case len(config.Name) >= C.CVECTOR_MAX_DB_NAME:
+		return &ConfigError{"Name", fmt.Sprintf("must be shorter than %d bytes, got %d", C.CVECTOR_MAX_DB_NAME, len(config.Name))}
+	case config.Dimension == 0 || config.Dimension > C.CVECTOR_MAX_DIMENSION:
+		return &ConfigError{"Dimension", fmt.Sprintf("must be 1..%d, got %d", C.CVECTOR_MAX_DIMENSION, config.Dimension)}
+	case config.DefaultSimilarity < SimilarityCosine || config.DefaultSimilarity > SimilarityEuclidean:
+		return &ConfigError{"DefaultSimilarity", fmt.Sprintf("unknown similarity type %d", int(config.DefaultSimilarity))}
+	case config.DefaultMinSimilarity < -1 || config.DefaultMinSimilarity > 1:
+		return &ConfigError{"DefaultMinSimilarity", fmt.Sprintf("must be -1..1, got %g", config.DefaultMinSimilarity)}
+	case config.DefaultOversample < 0:
+		return &ConfigError{"DefaultOversample", fmt.Sprintf("must not be negative, got %d", config.DefaultOversample)}
+	case config.MaxVectors < 0:
+		return &ConfigError{"MaxVectors", fmt.Sprintf("must not be negative, got %d", config.MaxVectors)}
+	case config.MaxSizeBytes < 0:
+		return &ConfigError{"MaxSizeBytes", fmt.Sprintf("must not be negative, got %d", config.MaxSizeBytes)}
+	case config.MaxInflightInserts < 0:
+		return &ConfigError{"MaxInflightInserts", fmt.Sprintf("must not be negative, got %d", config.MaxInflightInserts)}
+	case config.MaxQueuedInserts < 0:
+		return &ConfigError{"MaxQueuedInserts", fmt.Sprintf("must not be negative, got %d", config.MaxQueuedInserts)}
+	case config.SearchThreads < 0:
+		return &ConfigError{"SearchThreads", fmt.Sprintf("must not be negative, got %d", config.SearchThreads)}
+	case config.EfSearch < 0 || config.EfSearch > C.CVECTOR_MAX_EF_SEARCH:
+		return &ConfigError{"EfSearch", fmt.Sprintf("must be 0..%d, got %d", C.CVECTOR_MAX_EF_SEARCH, config.EfSearch)}
+	case config.CacheBytes < 0:
+		return &ConfigError{"CacheBytes", fmt.Sprintf("must not be negative, got %d", config.CacheBytes)}
+	case config.BlockCacheBytes < 0:
+		return &ConfigError{"BlockCacheBytes", fmt.Sprintf("must not be negative, got %d", config.BlockCacheBytes)}
+	case config.GCDeadRatio < 0 || config.GCDeadRatio > 1:
+		return &ConfigError{"GCDeadRatio", fmt.Sprintf("must be 0..1, got %g", config.GCDeadRatio)}
+	case config.GCMaxAge < 0:
+		return &ConfigError{"GCMaxAge", fmt.Sprintf("must not be negative, got %v", config.GCMaxAge)}
+	case config.VersionHistory < 0:
+		return &ConfigError{"VersionHistory", fmt.Sprintf("must not be negative, got %d", config.VersionHistory)}
+	}
+	if config.Schema != nil {
+		if err := config.Schema.check(); err != nil {
+			return err
+		}
+	}
+
+	// Probe the directory with a scratch file so an unwritable location is
+	// reported here rather than as a file I/O error from the engine
+	dir := filepath.Dir(config.DataPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return &ConfigError{"DataPath", fmt.Sprintf("cannot create directory %s: %v", dir, err)}
+	}
+	probe, err := os.CreateTemp(dir, ".cvector-probe-*")
+	if err != nil {
+		return &ConfigError{"DataPath", fmt.Sprintf("directory %s is not writable: %v", dir, err)}
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
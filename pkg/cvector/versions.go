@@ -0,0 +1,324 @@
+package cvector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// versionSuffix is appended to the data path to name the version history
+// sidecar file
+const versionSuffix = ".versions"
+
+func versionsPath(dbPath string) string {
+	return dbPath + versionSuffix
+}
+
+// versionRecord is a single line in the history sidecar: a vector as it
+// was before an overwrite. Forget lines drop the history of an ID whose
+// versions started over.
+type versionRecord struct {
+	ID        uint64         `json:"id"`
+	Version   uint32         `json:"version,omitempty"`
+	Timestamp int64          `json:"timestamp,omitempty"`
+	Data      []float32      `json:"data,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	Forget    bool           `json:"forget,omitempty"`
+}
+
+// versionStore keeps up to keep previous versions of each vector in memory
+// and persists them as an append-only JSON-lines file next to the data
+// file, compacted on close like the metadata sidecar.
+type versionStore struct {
+	mu       sync.Mutex
+	path     string
+	keep     int
+	entries  map[uint64][]versionRecord // Oldest first
+	file     *os.File
+	dirty    bool
+	readOnly bool
+}
+
+// openVersionStore loads the history sidecar for dbPath, replaying it if
+// present. Versions beyond keep are dropped as they are read.
+func openVersionStore(dbPath string, keep int, readOnly bool) (*versionStore, error) {
+	s := &versionStore{
+		path:     versionsPath(dbPath),
+		keep:     keep,
+		entries:  make(map[uint64][]versionRecord),
+		readOnly: readOnly,
+	}
+
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, ErrFileIO
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var rec versionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// Skip a line torn by a crash mid-write
+			continue
+		}
+		s.apply(rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ErrFileIO
+	}
+	return s, nil
+}
+
+func (s *versionStore) apply(rec versionRecord) {
+	if rec.Forget {
+		delete(s.entries, rec.ID)
+		return
+	}
+	versions := append(s.entries[rec.ID], rec)
+	if len(versions) > s.keep {
+		versions = slices.Delete(versions, 0, len(versions)-s.keep)
+		s.dirty = true
+	}
+	s.entries[rec.ID] = versions
+}
+
+// record keeps v, the vector as it was before an overwrite
+func (s *versionStore) record(v *Vector) error {
+	return s.append(versionRecord{
+		ID:        v.ID,
+		Version:   v.Version,
+		Timestamp: v.Timestamp.Unix(),
+		Data:      v.Data,
+		Metadata:  v.Metadata,
+	})
+}
+
+// forget drops the history of id, whose versions start over when it is
+// inserted afresh
+func (s *versionStore) forget(id uint64) error {
+	s.mu.Lock()
+	_, ok := s.entries[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return s.append(versionRecord{ID: id, Forget: true})
+}
+
+func (s *versionStore) append(rec versionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if s.file == nil {
+		f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return ErrFileIO
+		}
+		s.file = f
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return ErrInvalidArgs
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return ErrFileIO
+	}
+	s.apply(rec)
+	s.dirty = true
+	return nil
+}
+
+// get returns the retained version of id, as a vector
+func (s *versionStore) get(id uint64, version uint32) (*Vector, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rec := range s.entries[id] {
+		if rec.Version == version {
+			return &Vector{
+				ID:        rec.ID,
+				Dimension: uint32(len(rec.Data)),
+				Data:      slices.Clone(rec.Data),
+				Metadata:  copyMetadata(rec.Metadata),
+				Timestamp: time.Unix(rec.Timestamp, 0),
+				Version:   rec.Version,
+			}, true
+		}
+	}
+	return nil, false
+}
+
+// versions lists the retained versions of id, oldest first
+func (s *versionStore) versions(id uint64) []uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []uint32
+	for _, rec := range s.entries[id] {
+		out = append(out, rec.Version)
+	}
+	return out
+}
+
+// close compacts the sidecar down to the retained versions
+func (s *versionStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	if !s.dirty || s.readOnly {
+		return nil
+	}
+	s.dirty = false
+
+	if len(s.entries) == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return ErrFileIO
+		}
+		return nil
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return ErrFileIO
+	}
+	w := bufio.NewWriter(f)
+	if err := s.encodeLocked(w); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return ErrFileIO
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return ErrFileIO
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return ErrFileIO
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return ErrFileIO
+	}
+	return nil
+}
+
+// snapshot returns the retained versions as the compacted sidecar would
+// hold them, for backups
+func (s *versionStore) snapshot() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := s.encodeLocked(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeLocked writes the retained versions as JSON lines, oldest first
+// for each ID
+func (s *versionStore) encodeLocked(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, versions := range s.entries {
+		for _, rec := range versions {
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetVersion returns version of vector id: the current one, or a previous
+// one retained by DBConfig.VersionHistory. Versions no longer retained
+// fail with ErrVectorNotFound.
+func (db *DB) GetVersion(id uint64, version uint32) (*Vector, error) {
+	current, err := db.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if current.Version == version {
+		return current, nil
+	}
+	if db.versions != nil {
+		if v, ok := db.versions.get(id, version); ok {
+			return v, nil
+		}
+	}
+	return nil, newOpError("get_version", db.path, id, ErrVectorNotFound)
+}
+
+// Versions lists the versions of vector id that GetVersion can return,
+// oldest first and ending with the current one
+func (db *DB) Versions(id uint64) ([]uint32, error) {
+	current, err := db.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	var versions []uint32
+	if db.versions != nil {
+		versions = db.versions.versions(id)
+	}
+	return append(versions, current.Version), nil
+}
+
+// Rollback restores the data and metadata of a retained version of vector
+// id, such as the embedding from before a model upgrade. The rollback is
+// itself an overwrite, so it gets a new version and the version it
+// replaces is retained in turn.
+func (db *DB) Rollback(id uint64, version uint32) error {
+	target, err := db.GetVersion(id, version)
+	if err != nil {
+		return err
+	}
+	current, err := db.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := db.UpdateIf(id, current.Version, target.Data); err != nil {
+		return err
+	}
+	return db.meta.set(id, target.Metadata)
+}
+
+// previousVersion returns vector id as stored before an overwrite, for
+// retainVersion to keep once the overwrite succeeds. It returns nil
+// without DBConfig.VersionHistory or if id is not stored.
+func (db *DB) previousVersion(id uint64) *Vector {
+	if db.versions == nil {
+		return nil
+	}
+	v, err := db.Get(id)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// retainVersion keeps previous, if any, in the version history
+func (db *DB) retainVersion(previous *Vector) error {
+	if previous == nil {
+		return nil
+	}
+	return db.versions.record(previous)
+}
@@ -0,0 +1,164 @@
+package cvector
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultWriteBufferDelay = 10 * time.Millisecond
+
+// writeBuffer queues inserts and applies them from a background goroutine
+// in groups of up to size, waiting at most delay for a group to fill.
+// Under SyncAlways each group is flushed once rather than once per vector.
+type writeBuffer struct {
+	db    *DB
+	size  int
+	delay time.Duration
+	queue chan bufferedWrite
+	kick  chan struct{} // Cuts the wait for a group short, see drain
+
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending int
+	err     error // First failed write since the last drain
+
+	done chan struct{}
+}
+
+type bufferedWrite struct {
+	actor  string
+	vector *Vector
+}
+
+func startWriteBuffer(db *DB, size int, delay time.Duration) *writeBuffer {
+	if delay <= 0 {
+		delay = defaultWriteBufferDelay
+	}
+	b := &writeBuffer{
+		db:    db,
+		size:  size,
+		delay: delay,
+		queue: make(chan bufferedWrite, size*4),
+		kick:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	b.idle = sync.NewCond(&b.mu)
+	go b.run()
+	return b
+}
+
+// enqueue hands a write to the background goroutine, blocking while the
+// queue is full. With limit set it refuses instead once limit writes are
+// pending, reporting how many are.
+func (b *writeBuffer) enqueue(actor string, vector *Vector, limit int) (int, bool) {
+	b.mu.Lock()
+	if limit > 0 && b.pending >= limit {
+		pending := b.pending
+		b.mu.Unlock()
+		return pending, false
+	}
+	b.pending++
+	b.mu.Unlock()
+	b.queue <- bufferedWrite{actor: actor, vector: vector}
+	return 0, true
+}
+
+func (b *writeBuffer) run() {
+	defer close(b.done)
+
+	batch := make([]bufferedWrite, 0, b.size)
+	for {
+		w, ok := <-b.queue
+		if !ok {
+			return
+		}
+		batch = append(batch[:0], w)
+
+		timer := time.NewTimer(b.delay)
+	collect:
+		for len(batch) < b.size {
+			select {
+			case w, ok := <-b.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, w)
+			case <-timer.C:
+				break collect
+			case <-b.kick:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		b.commit(batch)
+	}
+}
+
+func (b *writeBuffer) commit(batch []bufferedWrite) {
+	var firstErr error
+	for _, w := range batch {
+		start := time.Now()
+		err := b.db.insert(w.actor, w.vector)
+		b.db.admission.observe(time.Since(start))
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if b.db.syncMode == SyncAlways {
+		// Not Flush, which would wait for this batch to finish
+		if err := flushFiles(b.db.db, b.db.path, b.db.meta, b.db.auditLog); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		b.db.logger.Error("cvector buffered write failed", "path", b.db.path, "batch", len(batch), "error", firstErr)
+	}
+
+	b.mu.Lock()
+	if b.err == nil {
+		b.err = firstErr
+	}
+	b.pending -= len(batch)
+	b.idle.Broadcast()
+	b.mu.Unlock()
+}
+
+// drain waits until every queued write has been applied and returns the
+// first error since the previous drain
+func (b *writeBuffer) drain() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.pending > 0 {
+		// Commit a partly filled group now rather than after the delay
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+		b.idle.Wait()
+	}
+	err := b.err
+	b.err = nil
+	return err
+}
+
+// close drains the queue and stops the background goroutine
+func (b *writeBuffer) close() error {
+	err := b.drain()
+	close(b.queue)
+	<-b.done
+	return err
+}
+
+// Pending reports how many buffered inserts have not yet been applied. It
+// is always zero without DBConfig.WriteBufferSize.
+func (db *DB) Pending() int {
+	if db.writeBuffer == nil {
+		return 0
+	}
+
+	db.writeBuffer.mu.Lock()
+	defer db.writeBuffer.mu.Unlock()
+	return db.writeBuffer.pending
+}
@@ -0,0 +1,96 @@
+package embed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOllamaBaseURL   = "http://localhost:11434"
+	defaultOllamaBatchSize = 32
+)
+
+// OllamaConfig configures an Ollama embedder
+type OllamaConfig struct {
+	BaseURL string // Default: http://localhost:11434
+	Model   string // For example nomic-embed-text
+
+	BatchSize  int           // Texts per request (default: 32)
+	MaxRetries int           // Retries after server errors (default: 5)
+	RetryDelay time.Duration // First backoff delay, doubled per retry (default: 500ms)
+
+	HTTPClient *http.Client // Default: http.DefaultClient
+}
+
+// Ollama embeds text with a model served by a local Ollama instance
+type Ollama struct {
+	config OllamaConfig
+}
+
+// NewOllama returns an embedder for config, filling in defaults
+func NewOllama(config OllamaConfig) (*Ollama, error) {
+	if config.Model == "" {
+		return nil, fmt.Errorf("embed: model is required")
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = defaultOllamaBaseURL
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultOllamaBatchSize
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = defaultMaxRetries
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = defaultRetryDelay
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &Ollama{config: config}, nil
+}
+
+type ollamaRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Embed implements cvector.Embedder using the /api/embed endpoint
+func (o *Ollama) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += o.config.BatchSize {
+		end := min(start+o.config.BatchSize, len(texts))
+
+		body, err := json.Marshal(ollamaRequest{Model: o.config.Model, Input: texts[start:end]})
+		if err != nil {
+			return nil, err
+		}
+
+		respBody, err := postWithRetry(ctx, o.config.HTTPClient, o.config.BaseURL+"/api/embed", body,
+			o.config.MaxRetries, o.config.RetryDelay, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var resp ollamaResponse
+		if err := json.Unmarshal(respBody, &resp); err != nil {
+			return nil, fmt.Errorf("embed: decoding response: %w", err)
+		}
+		if len(resp.Embeddings) != end-start {
+			return nil, fmt.Errorf("embed: got %d embeddings for %d inputs", len(resp.Embeddings), end-start)
+		}
+		vectors = append(vectors, resp.Embeddings...)
+	}
+	return vectors, nil
+}
@@ -0,0 +1,157 @@
+// Package embed provides cvector.Embedder implementations backed by
+// embedding services.
+package embed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asmit-gupta/cvector/internal/httpretry"
+)
+
+const (
+	defaultOpenAIBaseURL   = "https://api.openai.com/v1"
+	defaultOpenAIBatchSize = 100
+	defaultMaxRetries      = 5
+	defaultRetryDelay      = 500 * time.Millisecond
+)
+
+// OpenAIConfig configures an OpenAI embedder
+type OpenAIConfig struct {
+	// BaseURL is the API root, without the /embeddings suffix. Any
+	// OpenAI-compatible server works. Default: https://api.openai.com/v1
+	BaseURL string
+	APIKey  string
+	Model   string
+
+	// Dimensions asks models that support it for shortened embeddings.
+	// Zero leaves the model's native size.
+	Dimensions int
+
+	BatchSize  int           // Texts per request (default: 100)
+	MaxRetries int           // Retries after rate limits and server errors (default: 5)
+	RetryDelay time.Duration // First backoff delay, doubled per retry (default: 500ms)
+
+	HTTPClient *http.Client // Default: http.DefaultClient
+}
+
+// OpenAI embeds text through an OpenAI-compatible /embeddings endpoint
+type OpenAI struct {
+	config OpenAIConfig
+}
+
+// NewOpenAI returns an embedder for config, filling in defaults
+func NewOpenAI(config OpenAIConfig) (*OpenAI, error) {
+	if config.Model == "" {
+		return nil, fmt.Errorf("embed: model is required")
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = defaultOpenAIBaseURL
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultOpenAIBatchSize
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = defaultMaxRetries
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = defaultRetryDelay
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &OpenAI{config: config}, nil
+}
+
+type openAIRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type openAIResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed implements cvector.Embedder, splitting texts into batches
+func (o *OpenAI) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += o.config.BatchSize {
+		end := min(start+o.config.BatchSize, len(texts))
+
+		batch, err := o.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func (o *OpenAI) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(openAIRequest{Model: o.config.Model, Input: texts, Dimensions: o.config.Dimensions})
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := postWithRetry(ctx, o.config.HTTPClient, o.config.BaseURL+"/embeddings", body,
+		o.config.MaxRetries, o.config.RetryDelay, func(req *http.Request) {
+			if o.config.APIKey != "" {
+				req.Header.Set("Authorization", "Bearer "+o.config.APIKey)
+			}
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp openAIResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("embed: decoding response: %w", err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("embed: got %d embeddings for %d inputs", len(resp.Data), len(texts))
+	}
+
+	// The API may return embeddings out of order; index ties them to inputs
+	sort.Slice(resp.Data, func(i, j int) bool { return resp.Data[i].Index < resp.Data[j].Index })
+	vectors := make([][]float32, len(resp.Data))
+	for i, d := range resp.Data {
+		vectors[i] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// StatusError is returned when the service answers with a non-2xx status
+// that is not retried, or still fails after every retry
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("embed: server returned %d: %s", e.StatusCode, e.Body)
+}
+
+// postWithRetry POSTs a JSON body with the shared retry policy, reporting
+// a failing status as a StatusError
+func postWithRetry(ctx context.Context, client *http.Client, url string, body []byte,
+	maxRetries int, delay time.Duration, decorate func(*http.Request)) ([]byte, error) {
+	respBody, err := httpretry.Post(ctx, client, url, body, maxRetries, delay, decorate)
+	var statusErr *httpretry.StatusError
+	if errors.As(err, &statusErr) {
+		return nil, &StatusError{StatusCode: statusErr.StatusCode, Body: statusErr.Body}
+	}
+	return respBody, err
+}
@@ -0,0 +1,16 @@
+module github.com/asmit-gupta/cvector/pkg/langchain
+
+go 1.24.5
+
+require (
+	github.com/asmit-gupta/cvector v0.0.0
+	github.com/tmc/langchaingo v0.1.13
+)
+
+require (
+	github.com/dlclark/regexp2 v1.10.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/pkoukk/tiktoken-go v0.1.6 // indirect
+)
+
+replace github.com/asmit-gupta/cvector => ../..
@@ -0,0 +1,201 @@
+// Package langchain adapts a cvector database to langchaingo's
+// vectorstores.VectorStore interface. It is a separate module so the core
+// package stays free of third-party dependencies.
+package langchain
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/asmit-gupta/cvector/pkg/cvector"
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// Metadata keys the store sets on every vector it writes
+const (
+	MetaPageContent = "page_content"
+	MetaNamespace   = "namespace"
+)
+
+var (
+	// ErrNoEmbedder is returned when neither the store nor the call options
+	// provide an embedder
+	ErrNoEmbedder = errors.New("langchain: no embedder configured")
+
+	// ErrUnsupportedFilter is returned for filters other than a metadata map
+	ErrUnsupportedFilter = errors.New("langchain: filters must be map[string]any")
+)
+
+// Store implements vectorstores.VectorStore on a cvector database
+type Store struct {
+	db       *cvector.DB
+	embedder embeddings.Embedder
+
+	mu     sync.Mutex
+	nextID uint64
+}
+
+var _ vectorstores.VectorStore = (*Store)(nil)
+
+// New returns a store writing to db and embedding with embedder. New
+// documents are numbered after the highest vector ID already present.
+func New(db *cvector.DB, embedder embeddings.Embedder) (*Store, error) {
+	if db == nil {
+		return nil, cvector.ErrInvalidArgs
+	}
+
+	ids, err := db.IDs()
+	if err != nil {
+		return nil, err
+	}
+	next := uint64(1)
+	for _, id := range ids {
+		next = max(next, id+1)
+	}
+
+	return &Store{db: db, embedder: embedder, nextID: next}, nil
+}
+
+// AddDocuments embeds and stores docs, returning their vector IDs in
+// decimal. Documents rejected by the Deduplicater option are skipped.
+func (s *Store) AddDocuments(ctx context.Context, docs []schema.Document, options ...vectorstores.Option) ([]string, error) {
+	opts := s.options(options)
+	embedder := opts.Embedder
+	if embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+
+	var kept []schema.Document
+	for _, doc := range docs {
+		if opts.Deduplicater != nil && opts.Deduplicater(ctx, doc) {
+			continue
+		}
+		kept = append(kept, doc)
+	}
+	if len(kept) == 0 {
+		return nil, nil
+	}
+
+	texts := make([]string, len(kept))
+	for i, doc := range kept {
+		texts[i] = doc.PageContent
+	}
+	vectors, err := embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(kept) {
+		return nil, errors.New("langchain: embedder returned the wrong number of vectors")
+	}
+
+	s.mu.Lock()
+	first := s.nextID
+	s.nextID += uint64(len(kept))
+	s.mu.Unlock()
+
+	ids := make([]string, 0, len(kept))
+	for i, doc := range kept {
+		metadata := make(map[string]any, len(doc.Metadata)+2)
+		for k, v := range doc.Metadata {
+			metadata[k] = v
+		}
+		metadata[MetaPageContent] = doc.PageContent
+		if opts.NameSpace != "" {
+			metadata[MetaNamespace] = opts.NameSpace
+		}
+
+		vector := cvector.NewVector(first+uint64(i), vectors[i])
+		vector.Metadata = metadata
+		if err := s.db.Insert(vector); err != nil {
+			return ids, err
+		}
+		ids = append(ids, strconv.FormatUint(vector.ID, 10))
+	}
+	return ids, nil
+}
+
+// SimilaritySearch returns up to numDocuments documents nearest to query
+// with at least the ScoreThreshold similarity. The NameSpace and Filters
+// options narrow the candidates before the nearest are picked, as
+// cvector.Query.Filter does. Filters must be a map of metadata keys to
+// required values.
+func (s *Store) SimilaritySearch(ctx context.Context, query string, numDocuments int, options ...vectorstores.Option) ([]schema.Document, error) {
+	if numDocuments <= 0 {
+		return nil, cvector.ErrInvalidArgs
+	}
+
+	opts := s.options(options)
+	if opts.Embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+	var filter map[string]any
+	if opts.Filters != nil {
+		filters, ok := opts.Filters.(map[string]any)
+		if !ok {
+			return nil, ErrUnsupportedFilter
+		}
+		filter = make(map[string]any, len(filters)+1)
+		for k, v := range filters {
+			filter[k] = v
+		}
+	}
+	if opts.NameSpace != "" {
+		if filter == nil {
+			filter = make(map[string]any, 1)
+		}
+		filter[MetaNamespace] = opts.NameSpace
+	}
+
+	vector, err := opts.Embedder.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.db.Stats()
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.db.Search(&cvector.Query{
+		QueryVector:   vector,
+		TopK:          uint32(numDocuments),
+		Similarity:    stats.DefaultSimilarity,
+		MinSimilarity: opts.ScoreThreshold,
+		Filter:        filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []schema.Document
+	for _, r := range results {
+		if r.Similarity < opts.ScoreThreshold {
+			continue
+		}
+		v, err := s.db.Get(r.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		content, _ := v.Metadata[MetaPageContent].(string)
+		metadata := make(map[string]any, len(v.Metadata))
+		for k, value := range v.Metadata {
+			if k != MetaPageContent && k != MetaNamespace {
+				metadata[k] = value
+			}
+		}
+		docs = append(docs, schema.Document{PageContent: content, Metadata: metadata, Score: r.Similarity})
+	}
+	return docs, nil
+}
+
+func (s *Store) options(options []vectorstores.Option) vectorstores.Options {
+	opts := vectorstores.Options{Embedder: s.embedder}
+	for _, apply := range options {
+		apply(&opts)
+	}
+	return opts
+}
@@ -0,0 +1,109 @@
+package langchain
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asmit-gupta/cvector/pkg/cvector"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// fakeEmbedder gives each known word its own axis, so a text is nearest to
+// documents sharing its words
+type fakeEmbedder struct{}
+
+var fakeAxes = []string{"apple", "banana", "car", "truck"}
+
+func (fakeEmbedder) EmbedQuery(_ context.Context, text string) ([]float32, error) {
+	vector := make([]float32, len(fakeAxes))
+	for i, word := range fakeAxes {
+		if strings.Contains(text, word) {
+			vector[i] = 1
+		}
+	}
+	// Unknown text still needs a direction for cosine similarity
+	vector[len(vector)-1] += 0.01
+	return vector, nil
+}
+
+func (e fakeEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i], _ = e.EmbedQuery(ctx, text)
+	}
+	return vectors, nil
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "langchain.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(uint32(len(fakeAxes))))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer func() { db.Close() }()
+
+	store, err := New(db, fakeEmbedder{})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ids, err := store.AddDocuments(ctx, []schema.Document{
+		{PageContent: "an apple", Metadata: map[string]any{"kind": "fruit", "stock": 3}},
+		{PageContent: "a banana", Metadata: map[string]any{"kind": "fruit", "stock": 5}},
+		{PageContent: "a car", Metadata: map[string]any{"kind": "vehicle", "stock": 3}},
+	})
+	if err != nil || len(ids) != 3 {
+		t.Fatalf("AddDocuments returned %v, %v", ids, err)
+	}
+	if _, err := store.AddDocuments(ctx, []schema.Document{{PageContent: "a truck"}}, vectorstores.WithNameSpace("fleet")); err != nil {
+		t.Fatalf("AddDocuments with a namespace failed: %v", err)
+	}
+
+	docs, err := store.SimilaritySearch(ctx, "apple", 1)
+	if err != nil || len(docs) != 1 || docs[0].PageContent != "an apple" || docs[0].Metadata["kind"] != "fruit" {
+		t.Fatalf("Expected the apple document, got %+v (%v)", docs, err)
+	}
+	if _, ok := docs[0].Metadata[MetaPageContent]; ok {
+		t.Error("Expected the page content to be left out of the metadata")
+	}
+
+	// Filters narrow the candidates before the nearest one is picked
+	docs, err = store.SimilaritySearch(ctx, "apple", 1, vectorstores.WithFilters(map[string]any{"kind": "vehicle"}))
+	if err != nil || len(docs) != 1 || docs[0].PageContent != "a car" {
+		t.Errorf("Expected the car for a vehicle filter, got %+v (%v)", docs, err)
+	}
+	docs, err = store.SimilaritySearch(ctx, "apple", 1, vectorstores.WithNameSpace("fleet"))
+	if err != nil || len(docs) != 1 || docs[0].PageContent != "a truck" {
+		t.Errorf("Expected the truck in the fleet namespace, got %+v (%v)", docs, err)
+	}
+
+	// Values that cannot be compared match nothing rather than panicking
+	docs, err = store.SimilaritySearch(ctx, "apple", 3, vectorstores.WithFilters(map[string]any{"kind": []string{"fruit"}}))
+	if err != nil || len(docs) != 0 {
+		t.Errorf("Expected no documents for a slice filter, got %+v (%v)", docs, err)
+	}
+	if _, err := store.SimilaritySearch(ctx, "apple", 3, vectorstores.WithFilters("kind")); err != ErrUnsupportedFilter {
+		t.Errorf("Expected ErrUnsupportedFilter, got %v", err)
+	}
+
+	// Numbers read back from disk still match integer filters
+	db.Close()
+	if db, err = cvector.OpenDB(path); err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	if store, err = New(db, fakeEmbedder{}); err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	docs, err = store.SimilaritySearch(ctx, "apple", 3, vectorstores.WithFilters(map[string]any{"stock": 3}))
+	if err != nil || len(docs) != 2 {
+		t.Errorf("Expected two documents with stock 3 after reopening, got %+v (%v)", docs, err)
+	}
+
+	ids, err = store.AddDocuments(ctx, []schema.Document{{PageContent: "a banana"}})
+	if err != nil || len(ids) != 1 || ids[0] != "5" {
+		t.Errorf("Expected new documents to be numbered after existing ones, got %v (%v)", ids, err)
+	}
+}
@@ -0,0 +1,140 @@
+// Package rag builds retrieval-augmented generation on top of cvector:
+// splitting documents into chunks, storing them with their text, and
+// retrieving stitched context for a query.
+package rag
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Chunk is a piece of a document. Start and End are byte offsets of Text
+// in the source, so overlapping neighbors can be stitched back together.
+type Chunk struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Splitter breaks text into chunks, in order of appearance
+type Splitter interface {
+	Split(text string) []Chunk
+}
+
+// TokenSplitter makes chunks of ChunkSize whitespace-separated tokens, each
+// repeating the last Overlap tokens of the one before
+type TokenSplitter struct {
+	ChunkSize int
+	Overlap   int
+}
+
+// Split implements Splitter
+func (s TokenSplitter) Split(text string) []Chunk {
+	return groupSpans(text, wordSpans(text), s.ChunkSize, s.Overlap)
+}
+
+// SentenceSplitter packs whole sentences into chunks of at most ChunkSize
+// tokens, each repeating the last Overlap sentences of the one before. A
+// sentence longer than ChunkSize becomes a chunk of its own.
+type SentenceSplitter struct {
+	ChunkSize int
+	Overlap   int
+}
+
+// Split implements Splitter
+func (s SentenceSplitter) Split(text string) []Chunk {
+	sentences := sentenceSpans(text)
+	if s.ChunkSize <= 0 {
+		return nil
+	}
+
+	var chunks []Chunk
+	for first := 0; first < len(sentences); {
+		last, tokens := first, sentences[first].tokens
+		for last+1 < len(sentences) && tokens+sentences[last+1].tokens <= s.ChunkSize {
+			last++
+			tokens += sentences[last].tokens
+		}
+
+		start, end := sentences[first].start, sentences[last].end
+		chunks = append(chunks, Chunk{Text: text[start:end], Start: start, End: end})
+		if last == len(sentences)-1 {
+			break
+		}
+
+		// Step back for the overlap, dropping overlap sentences until the
+		// next one fits, so every chunk carries new text
+		next := last + 1
+		first = max(next-s.Overlap, first+1)
+		overlap := 0
+		for i := first; i < next; i++ {
+			overlap += sentences[i].tokens
+		}
+		for first < next && overlap+sentences[next].tokens > s.ChunkSize {
+			overlap -= sentences[first].tokens
+			first++
+		}
+	}
+	return chunks
+}
+
+type span struct {
+	start, end int
+	tokens     int
+}
+
+// groupSpans emits chunks covering size units of spans at a time, moving
+// forward by size - overlap
+func groupSpans(text string, spans []span, size, overlap int) []Chunk {
+	if size <= 0 {
+		return nil
+	}
+	step := max(size-max(overlap, 0), 1)
+
+	var chunks []Chunk
+	for first := 0; first < len(spans); first += step {
+		last := min(first+size, len(spans)) - 1
+		start, end := spans[first].start, spans[last].end
+		chunks = append(chunks, Chunk{Text: text[start:end], Start: start, End: end})
+		if last == len(spans)-1 {
+			break
+		}
+	}
+	return chunks
+}
+
+func wordSpans(text string) []span {
+	var spans []span
+	start := -1
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				spans = append(spans, span{start: start, end: i, tokens: 1})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start: start, end: len(text), tokens: 1})
+	}
+	return spans
+}
+
+// sentenceSpans splits at '.', '!' or '?' followed by whitespace or the
+// end of the text, trimming surrounding whitespace from each sentence
+func sentenceSpans(text string) []span {
+	var spans []span
+	words := wordSpans(text)
+
+	first := 0
+	for i, w := range words {
+		r, _ := utf8.DecodeLastRuneInString(text[w.start:w.end])
+		if r == '.' || r == '!' || r == '?' || i == len(words)-1 {
+			spans = append(spans, span{start: words[first].start, end: w.end, tokens: i - first + 1})
+			first = i + 1
+		}
+	}
+	return spans
+}
@@ -0,0 +1,264 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/asmit-gupta/cvector/pkg/cvector"
+)
+
+// Metadata keys set on every stored chunk. Document metadata is copied
+// alongside them; these keys take precedence.
+const (
+	MetaDocID = "doc_id"
+	MetaChunk = "chunk" // Position of the chunk within its document
+	MetaText  = "text"
+	MetaStart = "start" // Byte offset of the chunk in the document
+	MetaEnd   = "end"
+)
+
+// ErrEmptyDocument is returned by Ingest for a document with no text
+var ErrEmptyDocument = errors.New("rag: document has no text")
+
+// Document is a unit of source text to ingest
+type Document struct {
+	ID       string
+	Text     string
+	Metadata map[string]any
+}
+
+// Passage is retrieved context: consecutive chunks of one document stitched
+// into a single text
+type Passage struct {
+	DocID      string
+	Text       string
+	FirstChunk int
+	LastChunk  int
+	Score      float32        // Score of the best matching chunk in the passage
+	Metadata   map[string]any // Metadata of the best matching chunk
+}
+
+// Store ingests documents into a database and retrieves context from it.
+// A document's chunks get consecutive vector IDs, which is how retrieval
+// finds a hit's neighbors.
+type Store struct {
+	db       *cvector.DB
+	embedder cvector.Embedder
+	splitter Splitter
+
+	mu     sync.Mutex
+	nextID uint64
+}
+
+// NewStore returns a store writing to db. New chunks are numbered after
+// the highest ID already present.
+func NewStore(db *cvector.DB, embedder cvector.Embedder, splitter Splitter) (*Store, error) {
+	if db == nil || embedder == nil || splitter == nil {
+		return nil, cvector.ErrInvalidArgs
+	}
+
+	ids, err := db.IDs()
+	if err != nil {
+		return nil, err
+	}
+	next := uint64(1)
+	for _, id := range ids {
+		next = max(next, id+1)
+	}
+
+	return &Store{db: db, embedder: embedder, splitter: splitter, nextID: next}, nil
+}
+
+// Ingest splits, embeds and stores each document, returning the number of
+// chunks written
+func (s *Store) Ingest(ctx context.Context, docs ...Document) (int, error) {
+	written := 0
+	for _, doc := range docs {
+		chunks := s.splitter.Split(doc.Text)
+		if len(chunks) == 0 {
+			return written, fmt.Errorf("%w: %q", ErrEmptyDocument, doc.ID)
+		}
+
+		texts := make([]string, len(chunks))
+		for i, c := range chunks {
+			texts[i] = c.Text
+		}
+		vectors, err := s.embedder.Embed(ctx, texts)
+		if err != nil {
+			return written, err
+		}
+		if len(vectors) != len(chunks) {
+			return written, fmt.Errorf("rag: embedder returned %d vectors for %d chunks", len(vectors), len(chunks))
+		}
+
+		// Reserve the whole range so concurrent ingests stay consecutive
+		s.mu.Lock()
+		first := s.nextID
+		s.nextID += uint64(len(chunks))
+		s.mu.Unlock()
+
+		for i, c := range chunks {
+			metadata := make(map[string]any, len(doc.Metadata)+5)
+			for k, v := range doc.Metadata {
+				metadata[k] = v
+			}
+			metadata[MetaDocID] = doc.ID
+			metadata[MetaChunk] = i
+			metadata[MetaText] = c.Text
+			metadata[MetaStart] = c.Start
+			metadata[MetaEnd] = c.End
+
+			vector := cvector.NewVector(first+uint64(i), vectors[i])
+			vector.Metadata = metadata
+			if err := s.db.Insert(vector); err != nil {
+				return written, err
+			}
+			written++
+		}
+	}
+	return written, nil
+}
+
+// Retrieve finds the k chunks nearest to query and widens each by window
+// chunks on both sides. Windows that touch within a document are merged,
+// so no text is returned twice. Passages come back best match first.
+func (s *Store) Retrieve(ctx context.Context, query string, k, window int) ([]Passage, error) {
+	if k <= 0 || window < 0 {
+		return nil, cvector.ErrInvalidArgs
+	}
+
+	vectors, err := s.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("rag: embedder returned %d vectors for 1 query", len(vectors))
+	}
+
+	stats, err := s.db.Stats()
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.db.Search(&cvector.Query{
+		QueryVector: vectors[0],
+		TopK:        uint32(k),
+		Similarity:  stats.DefaultSimilarity,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type hit struct {
+		id       uint64
+		chunk    int
+		score    float32
+		rank     int
+		metadata map[string]any
+	}
+	hits := make(map[string][]hit)
+	for rank, r := range results {
+		v, err := s.db.Get(r.ID)
+		if err != nil {
+			return nil, err
+		}
+		docID, ok := v.Metadata[MetaDocID].(string)
+		if !ok {
+			continue // Not written by a Store
+		}
+		hits[docID] = append(hits[docID], hit{id: r.ID, chunk: metaInt(v.Metadata[MetaChunk]), score: r.Similarity, rank: rank, metadata: v.Metadata})
+	}
+
+	type ranked struct {
+		passage Passage
+		rank    int
+	}
+	var passages []ranked
+	for docID, docHits := range hits {
+		sort.Slice(docHits, func(i, j int) bool { return docHits[i].chunk < docHits[j].chunk })
+
+		for i := 0; i < len(docHits); {
+			best := docHits[i]
+			first, last := max(best.chunk-window, 0), best.chunk+window
+
+			// Absorb later hits whose windows touch this one
+			j := i + 1
+			for ; j < len(docHits) && docHits[j].chunk-window <= last+1; j++ {
+				last = docHits[j].chunk + window
+				if docHits[j].rank < best.rank {
+					best = docHits[j]
+				}
+			}
+
+			// The anchor's ID locates the document's other chunks
+			base := docHits[i].id - uint64(docHits[i].chunk)
+			passage, err := s.stitch(docID, base, first, last)
+			if err != nil {
+				return nil, err
+			}
+			passage.Score = best.score
+			passage.Metadata = best.metadata
+			passages = append(passages, ranked{passage: passage, rank: best.rank})
+			i = j
+		}
+	}
+
+	sort.Slice(passages, func(i, j int) bool { return passages[i].rank < passages[j].rank })
+	out := make([]Passage, len(passages))
+	for i, p := range passages {
+		out[i] = p.passage
+	}
+	return out, nil
+}
+
+// stitch joins chunks first..last of a document whose chunk 0 has ID base,
+// dropping text each chunk repeats from the one before. Chunks beyond the
+// ends of the document are skipped.
+func (s *Store) stitch(docID string, base uint64, first, last int) (Passage, error) {
+	passage := Passage{DocID: docID, FirstChunk: -1}
+	prevEnd := 0
+	for c := first; c <= last; c++ {
+		v, err := s.db.Get(base + uint64(c))
+		if errors.Is(err, cvector.ErrVectorNotFound) {
+			continue
+		}
+		if err != nil {
+			return Passage{}, err
+		}
+		if v.Metadata[MetaDocID] != docID || metaInt(v.Metadata[MetaChunk]) != c {
+			continue
+		}
+
+		text, _ := v.Metadata[MetaText].(string)
+		start, end := metaInt(v.Metadata[MetaStart]), metaInt(v.Metadata[MetaEnd])
+		switch {
+		case passage.FirstChunk < 0:
+			passage.Text = text
+			passage.FirstChunk = c
+		case start < prevEnd:
+			if skip := prevEnd - start; skip < len(text) {
+				passage.Text += text[skip:]
+			}
+		default:
+			passage.Text += " " + text
+		}
+		passage.LastChunk = c
+		prevEnd = max(prevEnd, end)
+	}
+	return passage, nil
+}
+
+// metaInt reads a number from metadata, which holds ints when fresh and
+// float64 once reloaded from the JSON sidecar
+func metaInt(v any) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,290 @@
+// Package webhook POSTs cvector change events to HTTP endpoints, so
+// downstream systems can react to inserts, deletes and compactions without
+// a client of their own.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/asmit-gupta/cvector/internal/httpretry"
+	"github.com/asmit-gupta/cvector/pkg/cvector"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	defaultQueueSize     = 10000
+	defaultMaxRetries    = 5
+	defaultRetryDelay    = 500 * time.Millisecond
+	defaultCloseTimeout  = 10 * time.Second
+)
+
+// Event is one change to the database. Events are delivered in batches as
+// {"events": [...]}.
+type Event struct {
+	Type       string    `json:"type"`                 // "insert", "delete", "update_metadata", "set_tags" or "compact"
+	ID         uint64    `json:"id,omitempty"`         // Vector inserted, deleted, updated or tagged
+	Actor      string    `json:"actor,omitempty"`      // Caller recorded in the audit log
+	Background bool      `json:"background,omitempty"` // Compaction started by the GC policy
+	Time       time.Time `json:"time"`
+}
+
+type payload struct {
+	Events []Event `json:"events"`
+}
+
+// Config configures a Notifier
+type Config struct {
+	URLs []string // Endpoints that receive every batch
+
+	BatchSize     int           // Events per request (default: 100)
+	FlushInterval time.Duration // Longest an event waits for its batch to fill (default: 1s)
+
+	// QueueSize bounds events waiting for delivery. When it is full new
+	// events are dropped and logged rather than slowing writes down.
+	// Default: 10000.
+	QueueSize int
+
+	MaxRetries int           // Retries after network errors, 429s and 5xx (default: 5)
+	RetryDelay time.Duration // First backoff delay, doubled per retry (default: 500ms)
+
+	// CloseTimeout bounds how long Close spends delivering the events
+	// still queued. Retries in flight are then cancelled and the rest
+	// dropped. Default: 10s.
+	CloseTimeout time.Duration
+
+	HTTPClient *http.Client // Default: http.DefaultClient
+	Logger     *slog.Logger // Receives delivery failures. Nil disables logging.
+}
+
+// Notifier queues events from a database's hooks and delivers them from a
+// background goroutine. Attach it with db.Use(n.Hook()) and Close it after
+// the database.
+type Notifier struct {
+	config Config
+	queue  chan Event
+	done   chan struct{}
+	ctx    context.Context // Cancelled when Close gives up on delivery
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+}
+
+// New returns a running Notifier for config, filling in defaults
+func New(config Config) (*Notifier, error) {
+	if len(config.URLs) == 0 {
+		return nil, fmt.Errorf("webhook: at least one URL is required")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultFlushInterval
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultQueueSize
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = defaultMaxRetries
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = defaultRetryDelay
+	}
+	if config.CloseTimeout <= 0 {
+		config.CloseTimeout = defaultCloseTimeout
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.Logger == nil {
+		config.Logger = slog.New(slog.DiscardHandler)
+	}
+
+	n := &Notifier{
+		config: config,
+		queue:  make(chan Event, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+	go n.run()
+	return n, nil
+}
+
+// Hook returns a cvector.Hook that queues an event for every successful
+// insert, delete, metadata update, tag change and compaction, one per
+// vector for a batch of metadata updates. Buffered inserts are reported
+// when they are accepted, not when they are applied.
+func (n *Notifier) Hook() cvector.Hook {
+	return func(call *cvector.Call, next func() error) error {
+		if err := next(); err != nil {
+			return err
+		}
+
+		event := Event{Type: string(call.Op), Actor: call.Actor, Time: time.Now().UTC()}
+		switch call.Op {
+		case cvector.HookInsert:
+			event.ID = call.Vector.ID
+		case cvector.HookDelete, cvector.HookSetTags:
+			event.ID = call.ID
+		case cvector.HookCompact:
+			event.Background = call.Background
+		case cvector.HookUpdateMetadata:
+			ids := make([]uint64, 0, len(call.Patches))
+			for id := range call.Patches {
+				ids = append(ids, id)
+			}
+			slices.Sort(ids)
+			for _, id := range ids {
+				event.ID = id
+				n.Notify(event)
+			}
+			return nil
+		default:
+			return nil
+		}
+		n.Notify(event)
+		return nil
+	}
+}
+
+// Notify queues event for delivery, dropping it if the queue is full or
+// the Notifier is closed
+func (n *Notifier) Notify(event Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+
+	select {
+	case n.queue <- event:
+	default:
+		n.dropped++
+		n.config.Logger.Warn("cvector webhook queue full, event dropped", "type", event.Type, "id", event.ID, "dropped", n.dropped)
+	}
+}
+
+// Dropped reports how many events were discarded because the queue was
+// full or Close ran out of time to deliver them
+func (n *Notifier) Dropped() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.dropped
+}
+
+// errCloseTimeout is returned by Close when events were left undelivered
+var errCloseTimeout = errors.New("webhook: close timed out, undelivered events dropped")
+
+// Close delivers the events already queued, then stops the Notifier. If
+// that takes longer than Config.CloseTimeout, retries are cancelled, the
+// events not yet delivered are dropped, and Close returns an error.
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	close(n.queue)
+	n.mu.Unlock()
+
+	timer := time.NewTimer(n.config.CloseTimeout)
+	defer timer.Stop()
+	select {
+	case <-n.done:
+		n.cancel()
+		return nil
+	case <-timer.C:
+		n.cancel()
+		<-n.done
+		return errCloseTimeout
+	}
+}
+
+func (n *Notifier) run() {
+	defer close(n.done)
+
+	batch := make([]Event, 0, n.config.BatchSize)
+	for {
+		event, ok := <-n.queue
+		if !ok {
+			return
+		}
+		batch = append(batch[:0], event)
+
+		timer := time.NewTimer(n.config.FlushInterval)
+	collect:
+		for len(batch) < n.config.BatchSize {
+			select {
+			case event, ok := <-n.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, event)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		n.deliver(batch)
+	}
+}
+
+// deliver sends batch to every URL, logging the ones that still fail after
+// their retries. Once Close has given up, batches are counted as dropped.
+func (n *Notifier) deliver(batch []Event) {
+	body, err := json.Marshal(payload{Events: batch})
+	if err != nil {
+		n.config.Logger.Error("cvector webhook encoding failed", "error", err)
+		return
+	}
+
+	for _, url := range n.config.URLs {
+		if n.ctx.Err() != nil {
+			break
+		}
+		if err := n.post(url, body); err != nil && n.ctx.Err() == nil {
+			n.config.Logger.Error("cvector webhook delivery failed", "url", url, "events", len(batch), "error", err)
+		}
+	}
+	if n.ctx.Err() != nil {
+		n.mu.Lock()
+		n.dropped += len(batch)
+		n.mu.Unlock()
+	}
+}
+
+// StatusError is returned when an endpoint answers with a non-2xx status
+// that is not retried, or still fails after every retry
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook: server returned %d: %s", e.StatusCode, e.Body)
+}
+
+// post sends body to url with the shared retry policy, reporting a failing
+// status as a StatusError
+func (n *Notifier) post(url string, body []byte) error {
+	_, err := httpretry.Post(n.ctx, n.config.HTTPClient, url, body, n.config.MaxRetries, n.config.RetryDelay, nil)
+	var statusErr *httpretry.StatusError
+	if errors.As(err, &statusErr) {
+		return &StatusError{StatusCode: statusErr.StatusCode, Body: statusErr.Body}
+	}
+	return err
+}
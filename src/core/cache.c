@@ -0,0 +1,175 @@
+#include "cache.h"
+#include "memory.h"
+#include <stdlib.h>
+#include <string.h>
+
+#define CVECTOR_CACHE_BUCKETS 4096  // Power of two, see cvector_cache_bucket
+
+static size_t cvector_cache_bucket(const cvector_cache_t* cache, uint64_t key) {
+    // Fibonacci hashing spreads sequential keys across the buckets
+    return (size_t)((key * 0x9E3779B97F4A7C15ULL) >> 32) & (cache->bucket_count - 1);
+}
+
+size_t cvector_cache_entry_size(size_t size) {
+    return sizeof(cvector_cache_entry_t) + size;
+}
+
+static void cvector_cache_unlink(cvector_cache_t* cache, cvector_cache_entry_t* entry) {
+    if (entry->prev) {
+        entry->prev->next = entry->next;
+    } else {
+        cache->head = entry->next;
+    }
+    if (entry->next) {
+        entry->next->prev = entry->prev;
+    } else {
+        cache->tail = entry->prev;
+    }
+    entry->prev = NULL;
+    entry->next = NULL;
+}
+
+static void cvector_cache_push_front(cvector_cache_t* cache, cvector_cache_entry_t* entry) {
+    entry->prev = NULL;
+    entry->next = cache->head;
+    if (cache->head) {
+        cache->head->prev = entry;
+    }
+    cache->head = entry;
+    if (!cache->tail) {
+        cache->tail = entry;
+    }
+}
+
+// Removes entry from its bucket and the LRU list, then frees it
+static void cvector_cache_evict(cvector_cache_t* cache, cvector_cache_entry_t* entry) {
+    cvector_cache_entry_t** link = &cache->buckets[cvector_cache_bucket(cache, entry->key)];
+    while (*link && *link != entry) {
+        link = &(*link)->chain;
+    }
+    if (*link) {
+        *link = entry->chain;
+    }
+    
+    cvector_cache_unlink(cache, entry);
+    cache->used_bytes -= cvector_cache_entry_size(entry->size);
+    cache->entry_count--;
+    cvector_memory_release(cvector_cache_entry_size(entry->size));
+    free(entry);
+}
+
+static cvector_cache_entry_t* cvector_cache_find(const cvector_cache_t* cache, uint64_t key) {
+    if (!cache->buckets) {
+        return NULL;
+    }
+    cvector_cache_entry_t* entry = cache->buckets[cvector_cache_bucket(cache, key)];
+    while (entry && entry->key != key) {
+        entry = entry->chain;
+    }
+    return entry;
+}
+
+cvector_error_t cvector_cache_resize(cvector_cache_t* cache, size_t capacity_bytes) {
+    if (!cache) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (capacity_bytes > 0 && !cache->buckets) {
+        cache->buckets = calloc(CVECTOR_CACHE_BUCKETS, sizeof(cvector_cache_entry_t*));
+        if (!cache->buckets) {
+            return CVECTOR_ERROR_OUT_OF_MEMORY;
+        }
+        cache->bucket_count = CVECTOR_CACHE_BUCKETS;
+    }
+    
+    cache->capacity_bytes = capacity_bytes;
+    while (cache->tail && cache->used_bytes > capacity_bytes) {
+        cvector_cache_evict(cache, cache->tail);
+    }
+    
+    if (capacity_bytes == 0) {
+        free(cache->buckets);
+        cache->buckets = NULL;
+        cache->bucket_count = 0;
+    }
+    return CVECTOR_SUCCESS;
+}
+
+void cvector_cache_destroy(cvector_cache_t* cache) {
+    if (cache) {
+        cvector_cache_resize(cache, 0);
+    }
+}
+
+void cvector_cache_clear(cvector_cache_t* cache) {
+    while (cache->tail) {
+        cvector_cache_evict(cache, cache->tail);
+    }
+}
+
+const cvector_cache_entry_t* cvector_cache_get(cvector_cache_t* cache, uint64_t key) {
+    if (cache->capacity_bytes == 0) {
+        return NULL;
+    }
+    
+    cvector_cache_entry_t* entry = cvector_cache_find(cache, key);
+    if (!entry) {
+        cache->misses++;
+        return NULL;
+    }
+    
+    cache->hits++;
+    if (entry != cache->head) {
+        cvector_cache_unlink(cache, entry);
+        cvector_cache_push_front(cache, entry);
+    }
+    return entry;
+}
+
+void cvector_cache_put(cvector_cache_t* cache, uint64_t key, const void* data, size_t size) {
+    size_t charged = cvector_cache_entry_size(size);
+    if (cache->capacity_bytes == 0 || charged > cache->capacity_bytes) {
+        return;
+    }
+    
+    cvector_cache_entry_t* existing = cvector_cache_find(cache, key);
+    if (existing) {
+        cvector_cache_evict(cache, existing);
+    }
+    
+    while (cache->tail && cache->used_bytes + charged > cache->capacity_bytes) {
+        cvector_cache_evict(cache, cache->tail);
+    }
+    
+    // Under the process memory limit the cache gives up its own entries
+    // first, and skips the value if that is not enough. A skipped value or
+    // failed allocation only costs a future miss.
+    while (!cvector_memory_reserve(charged)) {
+        if (!cache->tail) {
+            return;
+        }
+        cvector_cache_evict(cache, cache->tail);
+    }
+    cvector_cache_entry_t* entry = malloc(charged);
+    if (!entry) {
+        cvector_memory_release(charged);
+        return;
+    }
+    memcpy(entry->data, data, size);
+    entry->key = key;
+    entry->size = size;
+    
+    size_t bucket = cvector_cache_bucket(cache, key);
+    entry->chain = cache->buckets[bucket];
+    cache->buckets[bucket] = entry;
+    cvector_cache_push_front(cache, entry);
+    cache->used_bytes += charged;
+    cache->entry_count++;
+}
+
+void cvector_cache_remove(cvector_cache_t* cache, uint64_t key) {
+    cvector_cache_entry_t* entry = cvector_cache_find(cache, key);
+    if (entry) {
+        cvector_cache_evict(cache, entry);
+    }
+}
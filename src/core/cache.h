@@ -0,0 +1,51 @@
+#ifndef CVECTOR_CACHE_H
+#define CVECTOR_CACHE_H
+
+#include "cvector.h"
+
+// LRU cache of byte strings keyed by a 64-bit key, bounded by a byte
+// budget. The database keeps one of vector records keyed by ID and one of
+// file blocks keyed by block number. Not thread safe; the database
+// serializes access under its mutex.
+
+typedef struct cvector_cache_entry {
+    uint64_t key;
+    size_t size;
+    struct cvector_cache_entry* prev;   // Towards the most recently used
+    struct cvector_cache_entry* next;   // Towards the least recently used
+    struct cvector_cache_entry* chain;  // Next entry in the same bucket
+    unsigned char data[];
+} cvector_cache_entry_t;
+
+typedef struct {
+    size_t capacity_bytes;  // 0 disables the cache
+    size_t used_bytes;
+    size_t entry_count;
+    uint64_t hits;
+    uint64_t misses;
+    cvector_cache_entry_t* head;
+    cvector_cache_entry_t* tail;
+    cvector_cache_entry_t** buckets;
+    size_t bucket_count;
+} cvector_cache_t;
+
+// Changes the budget, evicting least recently used entries to fit it.
+// A budget of 0 empties the cache and releases its buckets.
+cvector_error_t cvector_cache_resize(cvector_cache_t* cache, size_t capacity_bytes);
+void cvector_cache_destroy(cvector_cache_t* cache);
+
+// Returns the cached entry and marks it most recently used, or NULL.
+// Counts a hit or a miss while the cache is enabled.
+const cvector_cache_entry_t* cvector_cache_get(cvector_cache_t* cache, uint64_t key);
+
+// Stores a copy of data. Values larger than the whole budget are skipped.
+void cvector_cache_put(cvector_cache_t* cache, uint64_t key, const void* data, size_t size);
+void cvector_cache_remove(cvector_cache_t* cache, uint64_t key);
+
+// Drops every entry but keeps the budget and counters
+void cvector_cache_clear(cvector_cache_t* cache);
+
+// Bytes charged for an entry holding size bytes, including bookkeeping
+size_t cvector_cache_entry_size(size_t size);
+
+#endif // CVECTOR_CACHE_H
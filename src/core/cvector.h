@@ -15,6 +15,13 @@
 #define CVECTOR_DEFAULT_DIMENSION 512
 #define CVECTOR_MAX_DB_NAME 256
 #define CVECTOR_MAX_PATH 1024
+#define CVECTOR_MAX_EF_SEARCH 100000  // Largest HNSW candidate list a search may ask for
+
+// On-disk format version written by this build. Files from older versions
+// must be upgraded with cvector_migrate; newer ones are refused.
+// 2: header flags and max_vectors, reserved in version 1
+// 3: per-vector version in each record, reserved in version 2
+#define CVECTOR_FILE_VERSION 3
 
 // Error codes
 typedef enum {
@@ -25,7 +32,16 @@ typedef enum {
     CVECTOR_ERROR_DB_NOT_FOUND = -4,
     CVECTOR_ERROR_VECTOR_NOT_FOUND = -5,
     CVECTOR_ERROR_DIMENSION_MISMATCH = -6,
-    CVECTOR_ERROR_DB_CORRUPT = -7
+    CVECTOR_ERROR_DB_CORRUPT = -7,
+    CVECTOR_ERROR_INVALID_VECTOR_DATA = -8,  // NaN or infinite component
+    CVECTOR_ERROR_DB_FULL = -9,              // Insert would exceed max_vectors
+    CVECTOR_ERROR_DUPLICATE_ID = -10,        // Insert of an ID that is already live
+    CVECTOR_ERROR_READ_ONLY = -11,           // Write to a database opened read-only
+    CVECTOR_ERROR_VERSION_TOO_NEW = -12,     // File written by a newer format version
+    CVECTOR_ERROR_NEEDS_MIGRATION = -13,     // File written by an older format version
+    CVECTOR_ERROR_QUOTA_EXCEEDED = -14,      // Write would grow the file past its size quota
+    CVECTOR_ERROR_VERSION_CONFLICT = -15,    // Conditional write found a different vector version
+    CVECTOR_ERROR_LOCKED = -16               // Another open handle holds the database lock
 } cvector_error_t;
 
 // Similarity metrics
@@ -44,6 +60,7 @@ typedef struct {
     uint32_t dimension;
     float* data;
     uint64_t timestamp;  // Creation/update timestamp
+    uint32_t version;    // Starts at 1 on insert, bumped by every update; 0 when not read from a database
 } cvector_t;
 
 // Database configuration
@@ -53,7 +70,8 @@ typedef struct {
     uint32_t dimension;
     cvector_similarity_t default_similarity;
     bool memory_mapped;
-    size_t max_vectors;
+    size_t max_vectors;        // Live vector limit enforced by insert, 0 for none
+    bool normalize_on_insert;  // Store every vector scaled to unit length
 } cvector_db_config_t;
 
 // Database handle
@@ -73,25 +91,184 @@ typedef struct {
     uint32_t top_k;
     cvector_similarity_t similarity;
     float min_similarity;  // Filter threshold
+    bool normalize;        // Scale the query vector to unit length before scoring
+    uint32_t ef_search;    // HNSW candidate list size; 0 for the database's, see cvector_set_ef_search
 } cvector_query_t;
 
 // Core Database Operations
 cvector_error_t cvector_db_create(const cvector_db_config_t* config, cvector_db_t** db);
 cvector_error_t cvector_db_open(const char* db_path, cvector_db_t** db);
+// Opens without write access; mutations fail with CVECTOR_ERROR_READ_ONLY and
+// close leaves the file untouched
+cvector_error_t cvector_db_open_readonly(const char* db_path, cvector_db_t** db);
+
+// Open flags - cvector_db_open_flags(path, 0, db) is cvector_db_open.
+// Opening a file with a damaged record fails with CVECTOR_ERROR_DB_CORRUPT
+// unless SKIP_CORRUPT is set; then the damaged records are left out, gets
+// of their IDs fail with CVECTOR_ERROR_DB_CORRUPT, and the next compaction
+// drops them. A record torn off the end of the file by a crash is always
+// ignored.
+#define CVECTOR_OPEN_READ_ONLY 0x1     // As cvector_db_open_readonly
+#define CVECTOR_OPEN_SKIP_CORRUPT 0x2  // Serve the intact records of a damaged file
+#define CVECTOR_OPEN_DEFER_INDEX 0x4   // Leave the HNSW index for cvector_build_index
+
+cvector_error_t cvector_db_open_flags(const char* db_path, uint32_t flags, cvector_db_t** db);
+// Adds up to max_vectors of the vectors missing from the HNSW index, holding
+// the write lock only for that batch, and sets *remaining to how many are
+// still missing. After a CVECTOR_OPEN_DEFER_INDEX open, calling it until
+// *remaining is 0 builds the index while writes go on between batches;
+// until then inserts are left out of the index as well, and searches score
+// every vector missing from it exactly alongside the index results.
+cvector_error_t cvector_build_index(cvector_db_t* db, size_t max_vectors, size_t* remaining);
+// Reloads a read-only handle from the file, picking up what a writer has
+// flushed since it was opened. A no-op for writable handles.
+cvector_error_t cvector_db_refresh(cvector_db_t* db);
+// Closing a writable handle saves the HNSW index to <path>.hnsw, which the
+// next open loads instead of rebuilding the index from the records. A
+// saved index from another build's HNSW parameters, or older than the data
+// file, is ignored and the index rebuilt; drop deletes it with the file.
 cvector_error_t cvector_db_close(cvector_db_t* db);
 cvector_error_t cvector_db_drop(const char* db_path);
 
+// Cross-process locking - create, open, drop and migrate take an advisory
+// lock on <path>.lock and fail with CVECTOR_ERROR_LOCKED while another
+// handle, in this process or any other, has the database open for
+// writing. Read-only opens share a lock of their own that only drop and
+// migrate conflict with, so one writer and any number of readers can
+// have the file open at once. lock_holder reports the writer's PID, 0 when
+// the lock is free and -1 when the PID is unknown.
+// force_unlock deletes the lock file, for a holder that is hung or a
+// filesystem that keeps locks after their process exits.
+cvector_error_t cvector_lock_holder(const char* db_path, long* pid);
+cvector_error_t cvector_force_unlock(const char* db_path);
+
 // Vector CRUD Operations
 cvector_error_t cvector_insert(cvector_db_t* db, const cvector_t* vector);
 cvector_error_t cvector_insert_batch(cvector_db_t* db, const cvector_t* vectors, size_t count);
 cvector_error_t cvector_get(cvector_db_t* db, cvector_id_t id, cvector_t** vector);
-cvector_error_t cvector_update(cvector_db_t* db, const cvector_t* vector);
+cvector_error_t cvector_update(cvector_db_t* db, const cvector_t* vector);  // Replaces a live vector
 cvector_error_t cvector_delete(cvector_db_t* db, cvector_id_t id);
 
+// Optimistic concurrency - like update and delete, but fail with
+// CVECTOR_ERROR_VERSION_CONFLICT unless the live vector is at expected_version
+cvector_error_t cvector_update_if(cvector_db_t* db, const cvector_t* vector, uint32_t expected_version);
+cvector_error_t cvector_delete_if(cvector_db_t* db, cvector_id_t id, uint32_t expected_version);
+// Restores the vector last deleted under id, as it was, until a compaction
+// drops its record. Fails with CVECTOR_ERROR_DUPLICATE_ID if id is live
+// again and CVECTOR_ERROR_VECTOR_NOT_FOUND if no record is left.
+cvector_error_t cvector_undelete(cvector_db_t* db, cvector_id_t id);
+
+// Durability - writes the header and forces buffered records to stable
+// storage with fsync. Mutations otherwise reach the OS page cache only.
+cvector_error_t cvector_flush(cvector_db_t* db);
+
+// Size quota - caps the data file at max_size_bytes; inserts and updates
+// that would grow it further fail with CVECTOR_ERROR_QUOTA_EXCEEDED.
+// Compaction is always allowed since it only shrinks the file. 0 removes
+// the quota. It is not stored in the file and starts at 0 on open.
+cvector_error_t cvector_set_max_size(cvector_db_t* db, uint64_t max_size_bytes);
+
+// Read cache - keeps up to cache_bytes of recently read vectors in memory
+// in front of the data file, evicting the least recently used. 0 disables
+// it. The budget is not stored in the file and starts at 0 on open.
+cvector_error_t cvector_set_cache_size(cvector_db_t* db, size_t cache_bytes);
+
+// Block cache - keeps up to cache_bytes of 4 KiB data file blocks read by
+// Gets and brute-force scans, so both share one bounded budget instead of
+// relying on the OS page cache alone. Sits below the read cache; 0
+// disables it and it starts at 0 on open.
+cvector_error_t cvector_set_block_cache_size(cvector_db_t* db, size_t cache_bytes);
+
+// Search breadth - sets the HNSW candidate list size for searches whose
+// query leaves ef_search at 0. Larger lists find more of the true nearest
+// neighbors at the cost of latency; the list never drops below top_k. 0
+// restores the default of twice top_k. It is not stored in the file and
+// starts at 0 on open.
+cvector_error_t cvector_set_ef_search(cvector_db_t* db, uint32_t ef_search);
+
+// Memory limit - caps the bytes held by read caches and HNSW indexes across
+// every open database in the process. Index inserts that would exceed it
+// fail with CVECTOR_ERROR_OUT_OF_MEMORY; caches evict or skip entries
+// instead. 0, the default, removes the limit. Lowering it below the
+// current charge frees nothing, but blocks growth until usage drops.
+void cvector_set_memory_limit(size_t bytes);
+size_t cvector_memory_limit(void);
+size_t cvector_memory_charged(void);  // Bytes currently counted against the limit
+
+// Compaction - rewrites the data file without tombstoned records and
+// stamps last_compaction. Searches and writes wait while it runs.
+cvector_error_t cvector_compact(cvector_db_t* db);
+
+// Capacity - changes the live vector limit; 0 removes it. Lowering it below
+// the current count blocks further inserts until vectors are deleted.
+cvector_error_t cvector_set_max_vectors(cvector_db_t* db, size_t max_vectors);
+
+// Clustering - k-means++ seeded Lloyd iterations over count row-major vectors.
+// centroids receives k * dimension floats and assignments one cluster index
+// per vector. inertia is the sum of squared distances to assigned centroids.
+cvector_error_t cvector_kmeans(const float* data, size_t count, uint32_t dimension, 
+                              uint32_t k, uint32_t max_iterations, uint64_t seed,
+                              float* centroids, uint32_t* assignments, 
+                              uint32_t* iterations_run, double* inertia);
+
+// Pairwise scores - out receives a_count * b_count floats, row i holding the
+// scores of a[i] against every row of b. Cosine and dot product give
+// similarities; Euclidean gives distances.
+cvector_error_t cvector_distance_matrix(const float* a, size_t a_count, 
+                                       const float* b, size_t b_count, 
+                                       uint32_t dimension, cvector_similarity_t metric, 
+                                       float* out);
+
+// Enumeration
+cvector_error_t cvector_list_ids(cvector_db_t* db, cvector_id_t** ids, size_t* count);
+// Whether id is a live vector, answered from memory without reading its record
+bool cvector_contains(cvector_db_t* db, cvector_id_t id);
+// Live vectors with from <= timestamp < to, oldest first and then by ID.
+// A to of 0 sets no upper bound.
+cvector_error_t cvector_list_ids_by_time(cvector_db_t* db, uint64_t from, uint64_t to, 
+                                        cvector_id_t** ids, size_t* count);
+void cvector_free_ids(cvector_id_t* ids);
+
+// Read views - the live vectors as of cvector_view_open, in ID order.
+// Inserts, updates, deletes and compactions made afterwards are not seen
+// through the view and are not held up by it. Close views promptly: each
+// keeps the data file it was opened on from being reclaimed.
+typedef struct cvector_view cvector_view_t;
+
+cvector_error_t cvector_view_open(cvector_db_t* db, cvector_view_t** view);
+size_t cvector_view_count(const cvector_view_t* view);
+cvector_error_t cvector_view_get(const cvector_view_t* view, size_t index, cvector_t** vector);
+void cvector_view_close(cvector_view_t* view);
+
 // Query Operations
+// Results of every search are ordered best first, with equal similarities
+// ordered by ascending ID
 cvector_error_t cvector_search(cvector_db_t* db, const cvector_query_t* query, 
                               cvector_result_t** results, size_t* result_count);
 
+// Radius search - exact scan returning every vector whose similarity is at
+// least min_similarity, best first. top_k caps the results; 0 returns all.
+cvector_error_t cvector_search_radius(cvector_db_t* db, const cvector_query_t* query, 
+                                     cvector_result_t** results, size_t* result_count);
+
+// Search diagnostics filled in by cvector_search_explain
+typedef struct {
+    bool used_index;                // Answered by the HNSW index
+    bool index_fallback;            // Index search failed and a full scan was used
+    size_t candidates_scanned;      // Vectors scored against the query
+    size_t index_nodes_visited;     // HNSW nodes expanded during traversal
+    size_t threshold_checked;       // Candidates tested against min_similarity
+    size_t threshold_rejected;      // Candidates dropped by min_similarity
+    uint32_t ef_search;             // HNSW candidate list size used, 0 without the index
+    uint64_t io_ns;                 // Time spent reading vectors from disk
+    uint64_t scoring_ns;            // Time spent computing similarities
+    uint64_t total_ns;
+} cvector_search_stats_t;
+
+cvector_error_t cvector_search_explain(cvector_db_t* db, const cvector_query_t* query, 
+                                      cvector_result_t** results, size_t* result_count,
+                                      cvector_search_stats_t* stats);
+
 // Utility Functions
 cvector_error_t cvector_create_vector(cvector_id_t id, uint32_t dimension, 
                                      const float* data, cvector_t** vector);
@@ -106,8 +283,105 @@ typedef struct {
     uint32_t dimension;
     cvector_similarity_t default_similarity;
     char db_path[CVECTOR_MAX_PATH];
+    size_t deleted_vectors;         // Tombstoned records still occupying file space
+    size_t unreadable_records;      // Damaged records skipped by CVECTOR_OPEN_SKIP_CORRUPT
+    size_t reclaimable_bytes;       // Bytes held by tombstoned records
+    float fragmentation;            // Percentage of record space held by tombstones
+    bool index_enabled;             // Whether an HNSW index is maintained
+    size_t indexed_vectors;         // Vectors currently present in the index
+    size_t unindexed_vectors;       // Live vectors missing from the index, scanned by searches
+    bool index_building;            // A deferred index build is under way
+    bool index_loaded;              // The index was read from its saved file rather than rebuilt
+    uint32_t ef_search;             // Default HNSW candidate list size, 0 for twice top_k
+    bool memory_mapped;
+    uint64_t last_compaction;       // Unix timestamp, 0 if never compacted
+    bool normalize_on_insert;       // Vectors are stored at unit length
+    size_t max_vectors;             // Live vector limit, 0 for none
+    uint64_t max_size_bytes;        // Data file quota, 0 for none
+    cvector_id_t next_id;           // One past the highest ID ever inserted
+    size_t cache_capacity_bytes;    // Read cache budget, 0 when disabled
+    size_t cache_used_bytes;
+    size_t cache_entries;
+    uint64_t cache_hits;            // Reads answered from the cache
+    uint64_t cache_misses;          // Reads that went to the data file
+    size_t block_cache_capacity_bytes;  // Block cache budget, 0 when disabled
+    size_t block_cache_used_bytes;
+    uint64_t block_cache_hits;
+    uint64_t block_cache_misses;        // Blocks read from the data file
 } cvector_db_stats_t;
 
 cvector_error_t cvector_db_stats(cvector_db_t* db, cvector_db_stats_t* stats);
 
+// Memory accounting - bytes allocated by the engine outside the Go heap
+typedef struct {
+    size_t database_bytes;          // Database handle and configuration
+    size_t lookup_table_bytes;      // ID hash table buckets and entries
+    size_t index_structure_bytes;   // HNSW index struct, node table and node headers
+    size_t index_graph_bytes;       // HNSW neighbor lists
+    size_t index_vector_bytes;      // Vector copies cached by the HNSW index
+    size_t io_buffer_bytes;         // stdio buffers for open database files
+    size_t mapped_bytes;            // Resident estimate of memory-mapped data
+    size_t cache_bytes;             // Read cache entries and buckets
+    size_t block_cache_bytes;       // Block cache entries and buckets
+    size_t total_bytes;
+} cvector_memory_usage_t;
+
+cvector_error_t cvector_memory_usage(cvector_db_t* db, cvector_memory_usage_t* usage);
+
+// File inspection - reads a database file without opening it, so it is safe
+// to call while another process holds the database open
+typedef struct {
+    uint32_t dimension;
+    cvector_similarity_t default_similarity;
+    size_t live_records;
+    size_t deleted_records;
+    size_t updated_records;    // Records written by updates, live or superseded
+    size_t file_size_bytes;
+    uint32_t format_version;
+} cvector_file_info_t;
+
+cvector_error_t cvector_file_info(const char* db_path, cvector_file_info_t* info);
+
+// Snapshot - copies the data file of an open database to dst_path while
+// holding off writes, so the copy is consistent. Searches keep running.
+// A writable handle with a complete index also saves it as
+// <dst_path>.hnsw, so the copy opens without rebuilding it.
+cvector_error_t cvector_snapshot(cvector_db_t* db, const char* dst_path);
+
+// Format migration - upgrades a closed database file in place to
+// CVECTOR_FILE_VERSION, first copying it to backup_path unless that is NULL.
+// from_version receives the version found; a current file is left untouched
+// and no backup is made.
+cvector_error_t cvector_migrate(const char* db_path, const char* backup_path, uint32_t* from_version);
+
+// Repair - salvages a damaged database file into a new one at dst_path,
+// which must not exist. Records are found by their fixed stride, so a
+// damaged record is skipped without losing the ones after it; only the
+// header must be intact. lost_ids receives the sorted IDs of damaged
+// records with no intact copy, to be freed with cvector_free_ids.
+typedef struct {
+    size_t records_scanned;
+    size_t recovered_vectors;       // Live vectors written to dst_path
+    size_t deleted_records;         // Intact tombstones and superseded copies, dropped
+    size_t unreadable_records;      // Damaged or truncated records, skipped
+} cvector_repair_report_t;
+
+cvector_error_t cvector_repair(const char* src_path, const char* dst_path, cvector_repair_report_t* report,
+                               cvector_id_t** lost_ids, size_t* lost_count);
+
+// Record inspection for debugging storage issues
+typedef struct {
+    cvector_id_t id;
+    uint64_t file_offset;
+    uint64_t record_length;         // Record header plus vector data, in bytes
+    uint32_t dimension;
+    uint64_t timestamp;
+    bool is_deleted;
+    uint32_t version;               // Per-vector version, 1 for an insert
+    uint32_t checksum;              // CRC-32 of the record bytes, computed when read
+    uint32_t format_version;        // File format version the record was read with
+} cvector_record_info_t;
+
+cvector_error_t cvector_describe(cvector_db_t* db, cvector_id_t id, cvector_record_info_t* info);
+
 #endif // CVECTOR_H
\ No newline at end of file
@@ -1,4 +1,5 @@
 #include "hnsw.h"
+#include "memory.h"
 #include "similarity.h"
 #include <stdlib.h>
 #include <string.h>
@@ -93,7 +94,7 @@ static cvector_error_t hnsw_resize_index(hnsw_index_t* index);
 static cvector_error_t hnsw_connect_layers_safe(hnsw_index_t* index, uint32_t node_id, uint32_t max_level);
 static cvector_error_t hnsw_search_layer(hnsw_index_t* index, const float* query_vector,
                                         hnsw_priority_queue_t* entry_points, uint32_t num_closest,
-                                        uint32_t level);
+                                        uint32_t level, hnsw_search_result_t* trace);
 static void hnsw_heap_up(hnsw_priority_queue_t* pq, uint32_t idx);
 static void hnsw_heap_down(hnsw_priority_queue_t* pq, uint32_t idx);
 static cvector_error_t hnsw_select_neighbors_simple(hnsw_index_t* index, uint32_t node_id, 
@@ -315,6 +316,19 @@ cvector_error_t hnsw_create_index(uint32_t dimension, cvector_similarity_t simil
     return CVECTOR_SUCCESS;
 }
 
+// Bytes a node counts against the process memory limit: its header,
+// vector copy and allocated neighbor lists
+static size_t hnsw_node_bytes(const hnsw_index_t* index, const hnsw_node_t* node) {
+    size_t bytes = sizeof(hnsw_node_t) + (size_t)node->dimension * sizeof(float);
+    for (uint32_t level = 0; level <= node->level && level < HNSW_MAX_LEVEL; level++) {
+        if (node->connections[level]) {
+            uint32_t max_connections = (level == 0) ? index->M * 2 : index->M;
+            bytes += (size_t)max_connections * sizeof(uint32_t);
+        }
+    }
+    return bytes;
+}
+
 cvector_error_t hnsw_destroy_index(hnsw_index_t* index) {
     if (!index) {
         return CVECTOR_SUCCESS;
@@ -328,6 +342,8 @@ cvector_error_t hnsw_destroy_index(hnsw_index_t* index) {
     // Free all nodes
     for (uint32_t i = 0; i < index->node_count; i++) {
         if (index->nodes[i]) {
+            cvector_memory_release(hnsw_node_bytes(index, index->nodes[i]));
+            
             // Free connection arrays
             for (uint32_t level = 0; level < HNSW_MAX_LEVEL; level++) {
                 free(index->nodes[i]->connections[level]);
@@ -367,17 +383,22 @@ float hnsw_calculate_similarity(const float* a, const float* b, uint32_t dimensi
 }
 
 // Search within a single layer
+// When trace is non-NULL, traversal counters are accumulated into it
 static cvector_error_t hnsw_search_layer(hnsw_index_t* index, const float* query_vector,
                                         hnsw_priority_queue_t* entry_points, uint32_t num_closest,
-                                        uint32_t level) {
-    // This is a simplified greedy search - in production HNSW, this would be more sophisticated
+                                        uint32_t level, hnsw_search_result_t* trace) {
+    // Scores are similarities, higher is closer. candidates pops the closest
+    // unexpanded node first; w keeps the num_closest best found so far with
+    // the furthest of them on top, so it is the one dropped.
     hnsw_priority_queue_t* candidates;
     hnsw_priority_queue_t* w; // Dynamic candidate set
     
-    cvector_error_t err = hnsw_pq_create(index->ef_construction, false, &candidates);
+    // Every node enters candidates at most once, as visited guards it
+    cvector_error_t err = hnsw_pq_create(index->node_count, true, &candidates);
     if (err != CVECTOR_SUCCESS) return err;
     
-    err = hnsw_pq_create(index->ef_construction, true, &w);
+    uint32_t w_capacity = (entry_points->count > num_closest ? entry_points->count : num_closest) + 1;
+    err = hnsw_pq_create(w_capacity, false, &w);
     if (err != CVECTOR_SUCCESS) {
         hnsw_pq_destroy(candidates);
         return err;
@@ -392,6 +413,12 @@ static cvector_error_t hnsw_search_layer(hnsw_index_t* index, const float* query
         hnsw_pq_push(candidates, node_id, distance);
         hnsw_pq_push(w, node_id, distance);
     }
+    while (w->count > num_closest) {
+        hnsw_pq_pop(w, NULL, NULL);
+    }
+    if (trace) {
+        trace->distance_computations += entry_points->count;
+    }
     
     bool* visited = calloc(index->node_count, sizeof(bool));
     if (!visited) {
@@ -416,11 +443,14 @@ static cvector_error_t hnsw_search_layer(hnsw_index_t* index, const float* query
         // Get the furthest element in w
         float furthest_in_w = w->count > 0 ? w->items[0].distance : -FLT_MAX;
         
-        if (current_dist > furthest_in_w) {
+        if (current_dist < furthest_in_w && w->count >= num_closest) {
             break; // All remaining elements are further than the current furthest
         }
         
         hnsw_node_t* node = index->nodes[current_node];
+        if (trace) {
+            trace->nodes_visited++;
+        }
         
         // Examine neighbors at this level
         for (uint32_t i = 0; i < node->connection_count[level]; i++) {
@@ -437,15 +467,17 @@ static cvector_error_t hnsw_search_layer(hnsw_index_t* index, const float* query
                 float neighbor_dist = hnsw_calculate_similarity(query_vector,
                                                               index->nodes[neighbor_id]->vector_data,
                                                               index->dimension, index->similarity_type);
+                if (trace) {
+                    trace->distance_computations++;
+                }
                 
+                furthest_in_w = w->count > 0 ? w->items[0].distance : -FLT_MAX;
                 if (neighbor_dist > furthest_in_w || w->count < num_closest) {
                     hnsw_pq_push(candidates, neighbor_id, neighbor_dist);
                     hnsw_pq_push(w, neighbor_id, neighbor_dist);
                     
                     if (w->count > num_closest) {
-                        uint32_t dummy;
-                        float dummy_dist;
-                        hnsw_pq_pop(w, &dummy, &dummy_dist); // Remove furthest
+                        hnsw_pq_pop(w, NULL, NULL); // Remove furthest
                     }
                 }
             }
@@ -493,7 +525,13 @@ cvector_error_t hnsw_add_vector(hnsw_index_t* index, cvector_id_t id, const floa
         return CVECTOR_ERROR_DB_CORRUPT;
     }
     
-    // Debug info removed
+    // Each ID appears at most once in the graph
+    for (uint32_t i = 0; i < index->node_count; i++) {
+        if (index->nodes[i] && index->nodes[i]->id == id) {
+            pthread_mutex_unlock(&index->write_mutex);
+            return CVECTOR_ERROR_DUPLICATE_ID;
+        }
+    }
     
     // Resize if needed
     if (index->node_count >= index->node_capacity) {
@@ -517,9 +555,21 @@ cvector_error_t hnsw_add_vector(hnsw_index_t* index, cvector_id_t id, const floa
     node->level = hnsw_random_level(index->ml);
     node->dimension = index->dimension;
     
+    // Charge the node in full before allocating it
+    size_t node_bytes = sizeof(hnsw_node_t) + index->dimension * sizeof(float);
+    for (uint32_t level = 0; level <= node->level; level++) {
+        node_bytes += ((level == 0) ? index->M * 2 : index->M) * sizeof(uint32_t);
+    }
+    if (!cvector_memory_reserve(node_bytes)) {
+        free(node);
+        pthread_mutex_unlock(&index->write_mutex);
+        return CVECTOR_ERROR_OUT_OF_MEMORY;
+    }
+    
     // Copy vector data
     node->vector_data = malloc(index->dimension * sizeof(float));
     if (!node->vector_data) {
+        cvector_memory_release(node_bytes);
         free(node);
         pthread_mutex_unlock(&index->write_mutex);
         return CVECTOR_ERROR_OUT_OF_MEMORY;
@@ -535,6 +585,7 @@ cvector_error_t hnsw_add_vector(hnsw_index_t* index, cvector_id_t id, const floa
             for (uint32_t l = 0; l < level; l++) {
                 free(node->connections[l]);
             }
+            cvector_memory_release(node_bytes);
             free(node->vector_data);
             free(node);
             pthread_mutex_unlock(&index->write_mutex);
@@ -575,6 +626,7 @@ cvector_error_t hnsw_add_vector(hnsw_index_t* index, cvector_id_t id, const floa
         for (uint32_t level = 0; level <= node->level; level++) {
             free(node->connections[level]);
         }
+        cvector_memory_release(node_bytes);
         free(node->vector_data);
         free(node);
         index->node_count--;
@@ -644,9 +696,10 @@ static cvector_error_t hnsw_connect_layers_safe(hnsw_index_t* index, uint32_t no
         return CVECTOR_SUCCESS;
     }
     
-    // For larger graphs, use proper HNSW algorithm
+    // For larger graphs, use proper HNSW algorithm. entry_points pops the
+    // closest first, so neighbor selection takes the best candidates.
     hnsw_priority_queue_t* entry_points;
-    cvector_error_t err = hnsw_pq_create(index->ef_construction, false, &entry_points);
+    cvector_error_t err = hnsw_pq_create(index->ef_construction, true, &entry_points);
     if (err != CVECTOR_SUCCESS) return err;
     
     // Start from entry point
@@ -659,7 +712,7 @@ static cvector_error_t hnsw_connect_layers_safe(hnsw_index_t* index, uint32_t no
     
     // Search from top level down to max_level + 1
     for (uint32_t level = index->max_level; level > max_level; level--) {
-        err = hnsw_search_layer(index, index->nodes[node_id]->vector_data, entry_points, 1, level);
+        err = hnsw_search_layer(index, index->nodes[node_id]->vector_data, entry_points, 1, level, NULL);
         if (err != CVECTOR_SUCCESS) {
             hnsw_pq_destroy(entry_points);
             return err;
@@ -670,7 +723,7 @@ static cvector_error_t hnsw_connect_layers_safe(hnsw_index_t* index, uint32_t no
     for (uint32_t level = max_level; level != UINT32_MAX; level--) {
         uint32_t ef = (level == 0) ? index->ef_construction : index->M;
         
-        err = hnsw_search_layer(index, index->nodes[node_id]->vector_data, entry_points, ef, level);
+        err = hnsw_search_layer(index, index->nodes[node_id]->vector_data, entry_points, ef, level, NULL);
         if (err != CVECTOR_SUCCESS) {
             hnsw_pq_destroy(entry_points);
             return err;
@@ -697,12 +750,20 @@ static cvector_error_t hnsw_select_neighbors_simple(hnsw_index_t* index, uint32_
     hnsw_node_t* node = index->nodes[node_id];
     uint32_t max_connections = (level == 0) ? M * 2 : M;
     
+    // Select from a copy: the caller goes on to use candidates as the entry
+    // points of the next layer down
+    hnsw_priority_queue_t* pending;
+    cvector_error_t err = hnsw_pq_create(candidates->capacity, candidates->is_max_heap, &pending);
+    if (err != CVECTOR_SUCCESS) return err;
+    memcpy(pending->items, candidates->items, candidates->count * sizeof(hnsw_pq_item_t));
+    pending->count = candidates->count;
+    
     // Simple selection: take the M closest candidates
     uint32_t selected = 0;
-    while (!hnsw_pq_is_empty(candidates) && selected < M && node->connection_count[level] < max_connections) {
+    while (!hnsw_pq_is_empty(pending) && selected < M && node->connection_count[level] < max_connections) {
         uint32_t neighbor_id;
         float distance;
-        if (!hnsw_pq_pop(candidates, &neighbor_id, &distance)) break;
+        if (!hnsw_pq_pop(pending, &neighbor_id, &distance)) break;
         
         // Skip self-connections
         if (neighbor_id == node_id) continue;
@@ -710,6 +771,9 @@ static cvector_error_t hnsw_select_neighbors_simple(hnsw_index_t* index, uint32_
         // Verify neighbor exists and is valid
         if (neighbor_id >= index->node_count || !index->nodes[neighbor_id]) continue;
         
+        // Neighbors carried over from an upper layer may not exist on this one
+        if (index->nodes[neighbor_id]->level < level) continue;
+        
         // Check if connection already exists
         bool already_connected = false;
         for (uint32_t i = 0; i < node->connection_count[level]; i++) {
@@ -724,26 +788,48 @@ static cvector_error_t hnsw_select_neighbors_simple(hnsw_index_t* index, uint32_
         node->connections[level][node->connection_count[level]] = neighbor_id;
         node->connection_count[level]++;
         
-        // Add reverse connection from neighbor to node
+        // Add reverse connection from neighbor to node. A full neighbor
+        // gives up its furthest connection if node is closer, otherwise
+        // nodes inserted late would never be reachable.
         hnsw_node_t* neighbor = index->nodes[neighbor_id];
-        if (neighbor->connection_count[level] < max_connections) {
-            // Check if reverse connection already exists
-            bool reverse_exists = false;
-            for (uint32_t i = 0; i < neighbor->connection_count[level]; i++) {
-                if (neighbor->connections[level][i] == node_id) {
-                    reverse_exists = true;
-                    break;
-                }
+        bool reverse_exists = false;
+        for (uint32_t i = 0; i < neighbor->connection_count[level]; i++) {
+            if (neighbor->connections[level][i] == node_id) {
+                reverse_exists = true;
+                break;
             }
-            if (!reverse_exists) {
+        }
+        if (!reverse_exists) {
+            if (neighbor->connection_count[level] < max_connections) {
                 neighbor->connections[level][neighbor->connection_count[level]] = node_id;
                 neighbor->connection_count[level]++;
+            } else {
+                uint32_t furthest = UINT32_MAX;
+                float furthest_similarity = distance;
+                for (uint32_t i = 0; i < neighbor->connection_count[level]; i++) {
+                    uint32_t other = neighbor->connections[level][i];
+                    if (other >= index->node_count || !index->nodes[other]) {
+                        furthest = i;
+                        break;
+                    }
+                    float similarity = hnsw_calculate_similarity(neighbor->vector_data,
+                                                                 index->nodes[other]->vector_data,
+                                                                 index->dimension, index->similarity_type);
+                    if (similarity < furthest_similarity) {
+                        furthest_similarity = similarity;
+                        furthest = i;
+                    }
+                }
+                if (furthest != UINT32_MAX) {
+                    neighbor->connections[level][furthest] = node_id;
+                }
             }
         }
         
         selected++;
     }
     
+    hnsw_pq_destroy(pending);
     return CVECTOR_SUCCESS;
 }
 
@@ -810,8 +896,10 @@ cvector_error_t hnsw_search_with_ef(hnsw_index_t* index, const float* query_vect
     
     hnsw_atomic_inc_u64(&index->search_count);
     
+    // Popped closest first, so the top_k results are taken from the front
+    hnsw_search_result_t trace = {0};
     hnsw_priority_queue_t* entry_points;
-    err = hnsw_pq_create(ef, false, &entry_points);
+    err = hnsw_pq_create(ef, true, &entry_points);
     if (err != CVECTOR_SUCCESS) {
         pthread_rwlock_unlock(&index->search_lock);
         return err;
@@ -822,10 +910,11 @@ cvector_error_t hnsw_search_with_ef(hnsw_index_t* index, const float* query_vect
                                                 index->nodes[index->entry_point]->vector_data,
                                                 index->dimension, index->similarity_type);
     hnsw_pq_push(entry_points, index->entry_point, entry_dist);
+    trace.distance_computations++;
     
     // Search from top level down to level 1
     for (uint32_t level = index->max_level; level > 0; level--) {
-        err = hnsw_search_layer(index, query_vector, entry_points, 1, level);
+        err = hnsw_search_layer(index, query_vector, entry_points, 1, level, &trace);
         if (err != CVECTOR_SUCCESS) {
             hnsw_pq_destroy(entry_points);
             pthread_rwlock_unlock(&index->search_lock);
@@ -834,7 +923,7 @@ cvector_error_t hnsw_search_with_ef(hnsw_index_t* index, const float* query_vect
     }
     
     // Search at level 0 with ef
-    err = hnsw_search_layer(index, query_vector, entry_points, ef, 0);
+    err = hnsw_search_layer(index, query_vector, entry_points, ef, 0, &trace);
     if (err != CVECTOR_SUCCESS) {
         hnsw_pq_destroy(entry_points);
         pthread_rwlock_unlock(&index->search_lock);
@@ -852,6 +941,8 @@ cvector_error_t hnsw_search_with_ef(hnsw_index_t* index, const float* query_vect
     uint32_t result_count = (entry_points->count < top_k) ? entry_points->count : top_k;
     (*result)->capacity = result_count;
     (*result)->count = result_count;
+    (*result)->nodes_visited = trace.nodes_visited;
+    (*result)->distance_computations = trace.distance_computations;
     
     if (result_count > 0) {
         (*result)->ids = malloc(result_count * sizeof(cvector_id_t));
@@ -895,10 +986,13 @@ cvector_error_t hnsw_search_with_ef(hnsw_index_t* index, const float* query_vect
             }
         }
         
-        // Sort results by similarity (descending - higher similarity first)
+        // Sort results by similarity (descending - higher similarity first),
+        // breaking ties by ascending ID so equal scores keep a stable order
         for (uint32_t i = 0; i < result_count - 1; i++) {
             for (uint32_t j = i + 1; j < result_count; j++) {
-                if (temp_results[j].similarity > temp_results[i].similarity) {
+                if (temp_results[j].similarity > temp_results[i].similarity ||
+                    (temp_results[j].similarity == temp_results[i].similarity &&
+                     temp_results[j].id < temp_results[i].id)) {
                     result_item_t temp = temp_results[i];
                     temp_results[i] = temp_results[j];
                     temp_results[j] = temp;
@@ -934,6 +1028,39 @@ void hnsw_free_search_result(hnsw_search_result_t* result) {
     }
 }
 
+cvector_error_t hnsw_get_memory_usage(hnsw_index_t* index, hnsw_memory_usage_t* usage) {
+    if (!index || !usage) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    memset(usage, 0, sizeof(*usage));
+    
+    if (pthread_mutex_lock(&index->write_mutex) != 0) {
+        return CVECTOR_ERROR_DB_CORRUPT;
+    }
+    
+    usage->structure_bytes = sizeof(hnsw_index_t) + 
+                             (size_t)index->node_capacity * sizeof(hnsw_node_t*);
+    
+    for (uint32_t i = 0; i < index->node_count; i++) {
+        hnsw_node_t* node = index->nodes[i];
+        if (!node) continue;
+        
+        usage->structure_bytes += sizeof(hnsw_node_t);
+        usage->vector_bytes += (size_t)node->dimension * sizeof(float);
+        
+        // Neighbor lists are allocated at full capacity, not connection_count
+        for (uint32_t level = 0; level <= node->level; level++) {
+            if (!node->connections[level]) continue;
+            uint32_t max_connections = (level == 0) ? index->M * 2 : index->M;
+            usage->graph_bytes += (size_t)max_connections * sizeof(uint32_t);
+        }
+    }
+    
+    pthread_mutex_unlock(&index->write_mutex);
+    return CVECTOR_SUCCESS;
+}
+
 cvector_error_t hnsw_get_stats(hnsw_index_t* index, hnsw_stats_t* stats) {
     if (!index || !stats) {
         return CVECTOR_ERROR_INVALID_ARGS;
@@ -991,30 +1118,25 @@ cvector_error_t hnsw_get_config(hnsw_index_t* index, hnsw_config_t* config) {
 }
 
 // Production-grade HNSW persistence implementation
-cvector_error_t hnsw_save_index(hnsw_index_t* index, const char* filepath) {
+//
+// Version 2 files mark each node slot present or empty, so an index with
+// removed vectors can be saved; version 1 files hold only present slots.
+#define HNSW_FILE_MAGIC 0x484E5357 // "HNSW"
+#define HNSW_FILE_VERSION 2
+
+cvector_error_t hnsw_write_index(hnsw_index_t* index, FILE* file) {
     cvector_error_t err = hnsw_validate_index(index);
     if (err != CVECTOR_SUCCESS) return err;
     
-    if (!filepath) {
-        // Error logged;
-        return CVECTOR_ERROR_INVALID_ARGS;
-    }
-    
-    // Info logged;
-    
-    FILE* file = fopen(filepath, "wb");
     if (!file) {
-        // Error logged;
-        return CVECTOR_ERROR_FILE_IO;
+        return CVECTOR_ERROR_INVALID_ARGS;
     }
     
     // Write header with magic number and version
-    uint32_t magic = 0x484E5357; // "HNSW"
-    uint32_t version = 1;
+    uint32_t magic = HNSW_FILE_MAGIC;
+    uint32_t version = HNSW_FILE_VERSION;
     if (fwrite(&magic, sizeof(magic), 1, file) != 1 ||
         fwrite(&version, sizeof(version), 1, file) != 1) {
-        // Error logged;
-        fclose(file);
         return CVECTOR_ERROR_FILE_IO;
     }
     
@@ -1028,93 +1150,137 @@ cvector_error_t hnsw_save_index(hnsw_index_t* index, const char* filepath) {
         fwrite(&index->node_count, sizeof(index->node_count), 1, file) != 1 ||
         fwrite(&index->entry_point, sizeof(index->entry_point), 1, file) != 1 ||
         fwrite(&index->max_level, sizeof(index->max_level), 1, file) != 1) {
-        // Error logged;
-        fclose(file);
         return CVECTOR_ERROR_FILE_IO;
     }
     
     // Write nodes
     for (uint32_t i = 0; i < index->node_count; i++) {
-        if (!index->nodes[i]) {
-            // Error logged;
-            fclose(file);
-            return CVECTOR_ERROR_DB_CORRUPT;
-        }
-        
         hnsw_node_t* node = index->nodes[i];
+        uint8_t present = node != NULL;
+        if (fwrite(&present, sizeof(present), 1, file) != 1) {
+            return CVECTOR_ERROR_FILE_IO;
+        }
+        if (!node) {
+            continue;
+        }
         
         // Write node metadata
         if (fwrite(&node->id, sizeof(node->id), 1, file) != 1 ||
             fwrite(&node->level, sizeof(node->level), 1, file) != 1 ||
             fwrite(&node->dimension, sizeof(node->dimension), 1, file) != 1) {
-            // Error logged;
-            fclose(file);
             return CVECTOR_ERROR_FILE_IO;
         }
         
         // Write vector data
         if (fwrite(node->vector_data, sizeof(float), node->dimension, file) != node->dimension) {
-            // Error logged;
-            fclose(file);
             return CVECTOR_ERROR_FILE_IO;
         }
         
         // Write connections for each level
         for (uint32_t level = 0; level <= node->level; level++) {
             if (fwrite(&node->connection_count[level], sizeof(node->connection_count[level]), 1, file) != 1) {
-                // Error logged;
-                fclose(file);
                 return CVECTOR_ERROR_FILE_IO;
             }
             
             if (node->connection_count[level] > 0) {
                 if (fwrite(node->connections[level], sizeof(uint32_t), 
                           node->connection_count[level], file) != node->connection_count[level]) {
-                    // Error logged;
-                    fclose(file);
                     return CVECTOR_ERROR_FILE_IO;
                 }
             }
         }
     }
     
-    fclose(file);
-    // Info logged;
     return CVECTOR_SUCCESS;
 }
 
-cvector_error_t hnsw_load_index(const char* filepath, hnsw_index_t** index) {
-    if (!filepath || !index) {
-        // Error logged;
-        return CVECTOR_ERROR_INVALID_ARGS;
+// Reads one node, checking it against the index so a damaged file cannot
+// send later traversals out of bounds
+static cvector_error_t hnsw_read_node(FILE* file, const hnsw_index_t* idx, hnsw_node_t** out) {
+    hnsw_node_t* node = calloc(1, sizeof(hnsw_node_t));
+    if (!node) {
+        return CVECTOR_ERROR_OUT_OF_MEMORY;
     }
     
-    // Info logged;
+    cvector_error_t err = CVECTOR_SUCCESS;
     
-    FILE* file = fopen(filepath, "rb");
-    if (!file) {
-        // Error logged;
-        return CVECTOR_ERROR_FILE_IO;
+    // Read node metadata
+    if (fread(&node->id, sizeof(node->id), 1, file) != 1 ||
+        fread(&node->level, sizeof(node->level), 1, file) != 1 ||
+        fread(&node->dimension, sizeof(node->dimension), 1, file) != 1) {
+        err = CVECTOR_ERROR_FILE_IO;
+    } else if (node->level >= HNSW_MAX_LEVEL || node->dimension != idx->dimension) {
+        err = CVECTOR_ERROR_DB_CORRUPT;
+    }
+    
+    // Allocate and read vector data
+    if (err == CVECTOR_SUCCESS) {
+        node->vector_data = malloc(node->dimension * sizeof(float));
+        if (!node->vector_data) {
+            err = CVECTOR_ERROR_OUT_OF_MEMORY;
+        } else if (fread(node->vector_data, sizeof(float), node->dimension, file) != node->dimension) {
+            err = CVECTOR_ERROR_FILE_IO;
+        }
+    }
+    
+    // Read connections for each level
+    for (uint32_t level = 0; err == CVECTOR_SUCCESS && level <= node->level; level++) {
+        uint32_t max_connections = (level == 0) ? idx->M * 2 : idx->M;
+        if (fread(&node->connection_count[level], sizeof(node->connection_count[level]), 1, file) != 1) {
+            err = CVECTOR_ERROR_FILE_IO;
+            break;
+        }
+        if (node->connection_count[level] > max_connections) {
+            err = CVECTOR_ERROR_DB_CORRUPT;
+            break;
+        }
+        
+        // Every level gets its full array, as hnsw_add_vector allocates
+        // them, since later inserts link to the node
+        node->connections[level] = malloc(max_connections * sizeof(uint32_t));
+        if (!node->connections[level]) {
+            err = CVECTOR_ERROR_OUT_OF_MEMORY;
+            break;
+        }
+        if (fread(node->connections[level], sizeof(uint32_t), 
+                 node->connection_count[level], file) != node->connection_count[level]) {
+            err = CVECTOR_ERROR_FILE_IO;
+            break;
+        }
+        for (uint32_t j = 0; j < node->connection_count[level]; j++) {
+            if (node->connections[level][j] >= idx->node_count) {
+                err = CVECTOR_ERROR_DB_CORRUPT;
+                break;
+            }
+        }
+    }
+    
+    if (err != CVECTOR_SUCCESS) {
+        for (uint32_t level = 0; level < HNSW_MAX_LEVEL; level++) {
+            free(node->connections[level]);
+        }
+        free(node->vector_data);
+        free(node);
+        return err;
+    }
+    
+    *out = node;
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t hnsw_read_index(FILE* file, hnsw_index_t** index) {
+    if (!file || !index) {
+        return CVECTOR_ERROR_INVALID_ARGS;
     }
     
     // Read and verify header
     uint32_t magic, version;
     if (fread(&magic, sizeof(magic), 1, file) != 1 ||
         fread(&version, sizeof(version), 1, file) != 1) {
-        // Error logged;
-        fclose(file);
         return CVECTOR_ERROR_FILE_IO;
     }
     
-    if (magic != 0x484E5357) {
-        // Error logged;
-        fclose(file);
-        return CVECTOR_ERROR_DB_CORRUPT;
-    }
-    
-    if (version != 1) {
-        // Error logged;
-        fclose(file);
+    if (magic != HNSW_FILE_MAGIC || version < 1 || version > HNSW_FILE_VERSION) {
         return CVECTOR_ERROR_DB_CORRUPT;
     }
     
@@ -1123,144 +1289,116 @@ cvector_error_t hnsw_load_index(const char* filepath, hnsw_index_t** index) {
     cvector_similarity_t similarity_type;
     if (fread(&dimension, sizeof(dimension), 1, file) != 1 ||
         fread(&similarity_type, sizeof(similarity_type), 1, file) != 1) {
-        // Error logged;
-        fclose(file);
         return CVECTOR_ERROR_FILE_IO;
     }
     
     // Create index
     cvector_error_t err = hnsw_create_index(dimension, similarity_type, index);
     if (err != CVECTOR_SUCCESS) {
-        // Error logged;
-        fclose(file);
         return err;
     }
     
     hnsw_index_t* idx = *index;
     
     // Read remaining metadata
+    uint32_t node_count;
     if (fread(&idx->M, sizeof(idx->M), 1, file) != 1 ||
         fread(&idx->ef_construction, sizeof(idx->ef_construction), 1, file) != 1 ||
         fread(&idx->ef_search, sizeof(idx->ef_search), 1, file) != 1 ||
         fread(&idx->ml, sizeof(idx->ml), 1, file) != 1 ||
-        fread(&idx->node_count, sizeof(idx->node_count), 1, file) != 1 ||
+        fread(&node_count, sizeof(node_count), 1, file) != 1 ||
         fread(&idx->entry_point, sizeof(idx->entry_point), 1, file) != 1 ||
         fread(&idx->max_level, sizeof(idx->max_level), 1, file) != 1) {
-        // Error logged;
-        hnsw_destroy_index(idx);
-        *index = NULL;
-        fclose(file);
-        return CVECTOR_ERROR_FILE_IO;
+        err = CVECTOR_ERROR_FILE_IO;
+    } else if (idx->M == 0 || idx->max_level >= HNSW_MAX_LEVEL ||
+               (idx->entry_point != UINT32_MAX && idx->entry_point >= node_count)) {
+        err = CVECTOR_ERROR_DB_CORRUPT;
     }
     
-    // Ensure capacity is sufficient
-    while (idx->node_capacity < idx->node_count) {
+    // Ensure capacity is sufficient. Slots start out empty, so an index
+    // that fails part way is destroyed with the nodes it has.
+    while (err == CVECTOR_SUCCESS && idx->node_capacity < node_count) {
         err = hnsw_resize_index(idx);
-        if (err != CVECTOR_SUCCESS) {
-            // Error logged;
-            hnsw_destroy_index(idx);
-            *index = NULL;
-            fclose(file);
-            return err;
-        }
+    }
+    if (err == CVECTOR_SUCCESS) {
+        idx->node_count = node_count;
     }
     
     // Read nodes
-    for (uint32_t i = 0; i < idx->node_count; i++) {
-        hnsw_node_t* node = calloc(1, sizeof(hnsw_node_t));
-        if (!node) {
-            // Error logged;
-            hnsw_destroy_index(idx);
-            *index = NULL;
-            fclose(file);
-            return CVECTOR_ERROR_OUT_OF_MEMORY;
-        }
-        
-        // Read node metadata
-        if (fread(&node->id, sizeof(node->id), 1, file) != 1 ||
-            fread(&node->level, sizeof(node->level), 1, file) != 1 ||
-            fread(&node->dimension, sizeof(node->dimension), 1, file) != 1) {
-            // Error logged;
-            free(node);
-            hnsw_destroy_index(idx);
-            *index = NULL;
-            fclose(file);
-            return CVECTOR_ERROR_FILE_IO;
+    uint64_t present_count = 0;
+    for (uint32_t i = 0; i < node_count && err == CVECTOR_SUCCESS; i++) {
+        uint8_t present = 1;
+        if (version >= 2 && fread(&present, sizeof(present), 1, file) != 1) {
+            err = CVECTOR_ERROR_FILE_IO;
+            break;
         }
-        
-        // Allocate and read vector data
-        node->vector_data = malloc(node->dimension * sizeof(float));
-        if (!node->vector_data) {
-            // Error logged;
-            free(node);
-            hnsw_destroy_index(idx);
-            *index = NULL;
-            fclose(file);
-            return CVECTOR_ERROR_OUT_OF_MEMORY;
+        if (!present) {
+            continue;
         }
         
-        if (fread(node->vector_data, sizeof(float), node->dimension, file) != node->dimension) {
-            // Error logged;
-            free(node->vector_data);
-            free(node);
-            hnsw_destroy_index(idx);
-            *index = NULL;
-            fclose(file);
-            return CVECTOR_ERROR_FILE_IO;
-        }
-        
-        // Read connections for each level
-        for (uint32_t level = 0; level <= node->level; level++) {
-            if (fread(&node->connection_count[level], sizeof(node->connection_count[level]), 1, file) != 1) {
-                // Error logged;
-                free(node->vector_data);
-                free(node);
-                hnsw_destroy_index(idx);
-                *index = NULL;
-                fclose(file);
-                return CVECTOR_ERROR_FILE_IO;
-            }
-            
-            if (node->connection_count[level] > 0) {
-                uint32_t max_connections = (level == 0) ? idx->M * 2 : idx->M;
-                node->connections[level] = malloc(max_connections * sizeof(uint32_t));
-                if (!node->connections[level]) {
-                    // Error logged;
-                    for (uint32_t l = 0; l < level; l++) {
-                        free(node->connections[l]);
-                    }
-                    free(node->vector_data);
-                    free(node);
-                    hnsw_destroy_index(idx);
-                    *index = NULL;
-                    fclose(file);
-                    return CVECTOR_ERROR_OUT_OF_MEMORY;
-                }
-                
-                if (fread(node->connections[level], sizeof(uint32_t), 
-                         node->connection_count[level], file) != node->connection_count[level]) {
-                    // Error logged;
-                    for (uint32_t l = 0; l <= level; l++) {
-                        free(node->connections[l]);
-                    }
-                    free(node->vector_data);
-                    free(node);
-                    hnsw_destroy_index(idx);
-                    *index = NULL;
-                    fclose(file);
-                    return CVECTOR_ERROR_FILE_IO;
-                }
-            }
+        hnsw_node_t* node = NULL;
+        err = hnsw_read_node(file, idx, &node);
+        if (err != CVECTOR_SUCCESS) {
+            break;
         }
         
+        // Loaded indexes are charged but never refused; the limit governs
+        // growth, and a reload only restores memory that was admitted once
+        cvector_memory_charge(hnsw_node_bytes(idx, node));
         idx->nodes[i] = node;
+        present_count++;
     }
     
-    fclose(file);
-    // Info logged;
+    if (err == CVECTOR_SUCCESS && present_count > 0 && 
+        (idx->entry_point == UINT32_MAX || !idx->nodes[idx->entry_point])) {
+        err = CVECTOR_ERROR_DB_CORRUPT;
+    }
+    if (err != CVECTOR_SUCCESS) {
+        hnsw_destroy_index(idx);
+        *index = NULL;
+        return err;
+    }
+    
+    // Removed slots are not counted as deletions; the counters describe
+    // the vectors the index holds now
+    idx->insert_count = present_count;
+    idx->checksum = hnsw_calculate_checksum(idx);
+    idx->last_modified = hnsw_get_timestamp_s();
     return CVECTOR_SUCCESS;
 }
 
+cvector_error_t hnsw_save_index(hnsw_index_t* index, const char* filepath) {
+    if (!index || !filepath) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    FILE* file = fopen(filepath, "wb");
+    if (!file) {
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    
+    cvector_error_t err = hnsw_write_index(index, file);
+    if (fclose(file) != 0 && err == CVECTOR_SUCCESS) {
+        err = CVECTOR_ERROR_FILE_IO;
+    }
+    return err;
+}
+
+cvector_error_t hnsw_load_index(const char* filepath, hnsw_index_t** index) {
+    if (!filepath || !index) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    FILE* file = fopen(filepath, "rb");
+    if (!file) {
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    
+    cvector_error_t err = hnsw_read_index(file, index);
+    fclose(file);
+    return err;
+}
+
 cvector_error_t hnsw_remove_vector(hnsw_index_t* index, cvector_id_t id) {
     if (!index) {
         return CVECTOR_ERROR_INVALID_ARGS;
@@ -1301,6 +1439,7 @@ cvector_error_t hnsw_remove_vector(hnsw_index_t* index, cvector_id_t id) {
     }
     
     // Free the node
+    cvector_memory_release(hnsw_node_bytes(index, node));
     for (uint32_t level = 0; level <= node->level; level++) {
         free(node->connections[level]);
     }
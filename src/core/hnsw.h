@@ -5,6 +5,7 @@
 #include <stdbool.h>
 #include <stdint.h>
 #include <pthread.h>
+#include <stdio.h>
 
 // HNSW Configuration
 #define HNSW_DEFAULT_M 16                  // Max connections per node
@@ -66,6 +67,8 @@ typedef struct hnsw_search_result {
     float* similarities;                   // Similarity scores
     uint32_t count;                        // Number of results
     uint32_t capacity;                     // Allocated capacity
+    uint64_t nodes_visited;                // Nodes expanded during traversal
+    uint64_t distance_computations;        // Similarities computed during traversal
 } hnsw_search_result_t;
 
 // Priority queue item
@@ -136,9 +139,21 @@ typedef struct {
 // Statistics Functions
 cvector_error_t hnsw_get_stats(hnsw_index_t* index, hnsw_stats_t* stats);
 
-// Persistence
+// Memory accounting - bytes currently allocated by the index
+typedef struct {
+    size_t structure_bytes;               // Index struct, node table and node headers
+    size_t graph_bytes;                   // Neighbor lists across all levels
+    size_t vector_bytes;                  // Cached vector copies
+} hnsw_memory_usage_t;
+
+cvector_error_t hnsw_get_memory_usage(hnsw_index_t* index, hnsw_memory_usage_t* usage);
+
+// Persistence. The FILE variants read and write at the current position,
+// for callers that keep the index inside a file of their own.
 cvector_error_t hnsw_save_index(hnsw_index_t* index, const char* filepath);
 cvector_error_t hnsw_load_index(const char* filepath, hnsw_index_t** index);
+cvector_error_t hnsw_write_index(hnsw_index_t* index, FILE* file);
+cvector_error_t hnsw_read_index(FILE* file, hnsw_index_t** index);
 
 // Production-grade Integrity and Recovery
 cvector_error_t hnsw_validate_integrity(hnsw_index_t* index);
@@ -0,0 +1,184 @@
+#include "cvector.h"
+#include "similarity.h"
+#include <stdlib.h>
+#include <string.h>
+#include <float.h>
+
+// xorshift64* - small, seedable and good enough for centroid seeding
+static uint64_t kmeans_next_random(uint64_t* state) {
+    uint64_t x = *state;
+    x ^= x >> 12;
+    x ^= x << 25;
+    x ^= x >> 27;
+    *state = x;
+    return x * 0x2545F4914F6CDD1DULL;
+}
+
+static double kmeans_random_unit(uint64_t* state) {
+    return (double)(kmeans_next_random(state) >> 11) / (double)(1ULL << 53);
+}
+
+static float kmeans_squared_distance(const float* a, const float* b, uint32_t dimension) {
+    float distance = cvector_euclidean_distance(a, b, dimension);
+    return distance * distance;
+}
+
+// Picks initial centroids with k-means++: each new centroid is drawn with
+// probability proportional to its squared distance from the nearest one
+static void kmeans_seed_centroids(const float* data, size_t count, uint32_t dimension, 
+                                  uint32_t k, uint64_t* rng, float* centroids, float* nearest) {
+    size_t first = (size_t)(kmeans_next_random(rng) % count);
+    memcpy(centroids, data + first * dimension, dimension * sizeof(float));
+    
+    for (size_t i = 0; i < count; i++) {
+        nearest[i] = kmeans_squared_distance(data + i * dimension, centroids, dimension);
+    }
+    
+    for (uint32_t c = 1; c < k; c++) {
+        double total = 0.0;
+        for (size_t i = 0; i < count; i++) {
+            total += nearest[i];
+        }
+        
+        size_t chosen = count - 1;
+        if (total > 0.0) {
+            double target = kmeans_random_unit(rng) * total;
+            for (size_t i = 0; i < count; i++) {
+                target -= nearest[i];
+                if (target <= 0.0) {
+                    chosen = i;
+                    break;
+                }
+            }
+        } else {
+            // Every point coincides with a centroid already
+            chosen = (size_t)(kmeans_next_random(rng) % count);
+        }
+        
+        float* centroid = centroids + (size_t)c * dimension;
+        memcpy(centroid, data + chosen * dimension, dimension * sizeof(float));
+        
+        for (size_t i = 0; i < count; i++) {
+            float d = kmeans_squared_distance(data + i * dimension, centroid, dimension);
+            if (d < nearest[i]) {
+                nearest[i] = d;
+            }
+        }
+    }
+}
+
+cvector_error_t cvector_kmeans(const float* data, size_t count, uint32_t dimension, 
+                              uint32_t k, uint32_t max_iterations, uint64_t seed,
+                              float* centroids, uint32_t* assignments, 
+                              uint32_t* iterations_run, double* inertia) {
+    if (!data || !centroids || !assignments || count == 0 || dimension == 0 || 
+        k == 0 || k > count || max_iterations == 0) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    float* nearest = malloc(count * sizeof(float));
+    double* sums = malloc((size_t)k * dimension * sizeof(double));
+    size_t* sizes = malloc(k * sizeof(size_t));
+    if (!nearest || !sums || !sizes) {
+        free(nearest);
+        free(sums);
+        free(sizes);
+        return CVECTOR_ERROR_OUT_OF_MEMORY;
+    }
+    
+    uint64_t rng = seed ? seed : 0x9E3779B97F4A7C15ULL;
+    kmeans_seed_centroids(data, count, dimension, k, &rng, centroids, nearest);
+    
+    for (size_t i = 0; i < count; i++) {
+        assignments[i] = UINT32_MAX;
+    }
+    
+    uint32_t iteration = 0;
+    while (iteration < max_iterations) {
+        iteration++;
+        
+        // Assignment step
+        size_t changed = 0;
+        for (size_t i = 0; i < count; i++) {
+            const float* point = data + i * dimension;
+            uint32_t best = 0;
+            float best_distance = FLT_MAX;
+            for (uint32_t c = 0; c < k; c++) {
+                float d = kmeans_squared_distance(point, centroids + (size_t)c * dimension, dimension);
+                if (d < best_distance) {
+                    best_distance = d;
+                    best = c;
+                }
+            }
+            if (assignments[i] != best) {
+                assignments[i] = best;
+                changed++;
+            }
+            nearest[i] = best_distance;
+        }
+        
+        if (changed == 0) {
+            break;
+        }
+        
+        // Update step
+        memset(sums, 0, (size_t)k * dimension * sizeof(double));
+        memset(sizes, 0, k * sizeof(size_t));
+        for (size_t i = 0; i < count; i++) {
+            double* sum = sums + (size_t)assignments[i] * dimension;
+            const float* point = data + i * dimension;
+            for (uint32_t d = 0; d < dimension; d++) {
+                sum[d] += point[d];
+            }
+            sizes[assignments[i]]++;
+        }
+        
+        for (uint32_t c = 0; c < k; c++) {
+            float* centroid = centroids + (size_t)c * dimension;
+            if (sizes[c] == 0) {
+                // Re-seed an empty cluster with the point furthest from its centroid
+                size_t furthest = 0;
+                for (size_t i = 1; i < count; i++) {
+                    if (nearest[i] > nearest[furthest]) {
+                        furthest = i;
+                    }
+                }
+                memcpy(centroid, data + furthest * dimension, dimension * sizeof(float));
+                nearest[furthest] = 0.0f;
+                continue;
+            }
+            for (uint32_t d = 0; d < dimension; d++) {
+                centroid[d] = (float)(sums[(size_t)c * dimension + d] / (double)sizes[c]);
+            }
+        }
+    }
+    
+    // Final assignment against the last centroids
+    double total = 0.0;
+    for (size_t i = 0; i < count; i++) {
+        const float* point = data + i * dimension;
+        uint32_t best = 0;
+        float best_distance = FLT_MAX;
+        for (uint32_t c = 0; c < k; c++) {
+            float d = kmeans_squared_distance(point, centroids + (size_t)c * dimension, dimension);
+            if (d < best_distance) {
+                best_distance = d;
+                best = c;
+            }
+        }
+        assignments[i] = best;
+        total += best_distance;
+    }
+    
+    if (iterations_run) {
+        *iterations_run = iteration;
+    }
+    if (inertia) {
+        *inertia = total;
+    }
+    
+    free(nearest);
+    free(sums);
+    free(sizes);
+    return CVECTOR_SUCCESS;
+}
@@ -0,0 +1,123 @@
+#include "cvector.h"
+#include <math.h>
+#include <float.h>
+#include <stdlib.h>
+
+// Rows of b scored against each row of a before moving on, sized so a tile
+// of 512-dimensional vectors stays in L2 cache
+#define MATRIX_TILE_ROWS 64
+
+// Eight independent accumulators break the loop-carried dependency on a
+// single sum, which lets the compiler keep them in one vector register
+#define MATRIX_LANES 8
+
+static float matrix_dot(const float* a, const float* b, uint32_t dimension) {
+    float lanes[MATRIX_LANES] = {0};
+    uint32_t i = 0;
+    
+    for (; i + MATRIX_LANES <= dimension; i += MATRIX_LANES) {
+        for (uint32_t l = 0; l < MATRIX_LANES; l++) {
+            lanes[l] += a[i + l] * b[i + l];
+        }
+    }
+    
+    float sum = 0.0f;
+    for (uint32_t l = 0; l < MATRIX_LANES; l++) {
+        sum += lanes[l];
+    }
+    for (; i < dimension; i++) {
+        sum += a[i] * b[i];
+    }
+    return sum;
+}
+
+static float matrix_squared_distance(const float* a, const float* b, uint32_t dimension) {
+    float lanes[MATRIX_LANES] = {0};
+    uint32_t i = 0;
+    
+    for (; i + MATRIX_LANES <= dimension; i += MATRIX_LANES) {
+        for (uint32_t l = 0; l < MATRIX_LANES; l++) {
+            float diff = a[i + l] - b[i + l];
+            lanes[l] += diff * diff;
+        }
+    }
+    
+    float sum = 0.0f;
+    for (uint32_t l = 0; l < MATRIX_LANES; l++) {
+        sum += lanes[l];
+    }
+    for (; i < dimension; i++) {
+        float diff = a[i] - b[i];
+        sum += diff * diff;
+    }
+    return sum;
+}
+
+// Norms are computed once per row instead of once per pair
+static float* matrix_norms(const float* data, size_t count, uint32_t dimension) {
+    float* norms = malloc((count > 0 ? count : 1) * sizeof(float));
+    if (!norms) {
+        return NULL;
+    }
+    for (size_t i = 0; i < count; i++) {
+        const float* row = data + i * dimension;
+        norms[i] = sqrtf(matrix_dot(row, row, dimension));
+    }
+    return norms;
+}
+
+cvector_error_t cvector_distance_matrix(const float* a, size_t a_count, 
+                                       const float* b, size_t b_count, 
+                                       uint32_t dimension, cvector_similarity_t metric, 
+                                       float* out) {
+    if (!a || !b || !out || dimension == 0 || dimension > CVECTOR_MAX_DIMENSION) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    if (metric != CVECTOR_SIMILARITY_COSINE && metric != CVECTOR_SIMILARITY_DOT_PRODUCT && 
+        metric != CVECTOR_SIMILARITY_EUCLIDEAN) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    float* a_norms = NULL;
+    float* b_norms = NULL;
+    if (metric == CVECTOR_SIMILARITY_COSINE) {
+        a_norms = matrix_norms(a, a_count, dimension);
+        b_norms = matrix_norms(b, b_count, dimension);
+        if (!a_norms || !b_norms) {
+            free(a_norms);
+            free(b_norms);
+            return CVECTOR_ERROR_OUT_OF_MEMORY;
+        }
+    }
+    
+    for (size_t tile = 0; tile < b_count; tile += MATRIX_TILE_ROWS) {
+        size_t tile_end = tile + MATRIX_TILE_ROWS < b_count ? tile + MATRIX_TILE_ROWS : b_count;
+        
+        for (size_t i = 0; i < a_count; i++) {
+            const float* row = a + i * dimension;
+            float* out_row = out + i * b_count;
+            
+            for (size_t j = tile; j < tile_end; j++) {
+                const float* col = b + j * dimension;
+                
+                switch (metric) {
+                    case CVECTOR_SIMILARITY_COSINE: {
+                        float norms = a_norms[i] * b_norms[j];
+                        out_row[j] = norms < FLT_EPSILON ? 0.0f : matrix_dot(row, col, dimension) / norms;
+                        break;
+                    }
+                    case CVECTOR_SIMILARITY_DOT_PRODUCT:
+                        out_row[j] = matrix_dot(row, col, dimension);
+                        break;
+                    case CVECTOR_SIMILARITY_EUCLIDEAN:
+                        out_row[j] = sqrtf(matrix_squared_distance(row, col, dimension));
+                        break;
+                }
+            }
+        }
+    }
+    
+    free(a_norms);
+    free(b_norms);
+    return CVECTOR_SUCCESS;
+}
@@ -0,0 +1,37 @@
+#include "cvector.h"
+#include "memory.h"
+
+static size_t memory_limit;    // 0 for no limit
+static size_t memory_charged;
+
+void cvector_set_memory_limit(size_t bytes) {
+    __atomic_store_n(&memory_limit, bytes, __ATOMIC_SEQ_CST);
+}
+
+size_t cvector_memory_limit(void) {
+    return __atomic_load_n(&memory_limit, __ATOMIC_SEQ_CST);
+}
+
+size_t cvector_memory_charged(void) {
+    return __atomic_load_n(&memory_charged, __ATOMIC_SEQ_CST);
+}
+
+bool cvector_memory_reserve(size_t bytes) {
+    size_t limit = cvector_memory_limit();
+    size_t current = __atomic_load_n(&memory_charged, __ATOMIC_SEQ_CST);
+    do {
+        if (limit > 0 && current + bytes > limit) {
+            return false;
+        }
+    } while (!__atomic_compare_exchange_n(&memory_charged, &current, current + bytes, 
+                                          false, __ATOMIC_SEQ_CST, __ATOMIC_SEQ_CST));
+    return true;
+}
+
+void cvector_memory_charge(size_t bytes) {
+    __atomic_fetch_add(&memory_charged, bytes, __ATOMIC_SEQ_CST);
+}
+
+void cvector_memory_release(size_t bytes) {
+    __atomic_fetch_sub(&memory_charged, bytes, __ATOMIC_SEQ_CST);
+}
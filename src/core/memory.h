@@ -0,0 +1,18 @@
+#ifndef CVECTOR_MEMORY_H
+#define CVECTOR_MEMORY_H
+
+#include <stdbool.h>
+#include <stddef.h>
+
+// Process-wide accounting behind cvector_set_memory_limit. Caches and HNSW
+// nodes charge their allocations here and release them when freed.
+
+// Charges bytes if that stays within the limit; returns false otherwise
+bool cvector_memory_reserve(size_t bytes);
+
+// Charges bytes regardless of the limit, for memory that must be held
+void cvector_memory_charge(size_t bytes);
+
+void cvector_memory_release(size_t bytes);
+
+#endif // CVECTOR_MEMORY_H
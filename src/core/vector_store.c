@@ -1,15 +1,20 @@
 #include "cvector.h"
 #include "vector_store.h"
 #include "hnsw.h"
+#include "cache.h"
 #include "similarity.h"
 #include "../utils/file_utils.h"
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
+#include <math.h>
 #include <time.h>
 #include <sys/stat.h>
 #include <unistd.h>
 #include <pthread.h>
+#include <errno.h>
+#include <fcntl.h>
+#include <sys/file.h>
 
 // Internal database structure
 struct cvector_db {
@@ -19,9 +24,16 @@ struct cvector_db {
     FILE* metadata_file;
     cvector_id_t next_id;
     size_t vector_count;
+    size_t deleted_count;           // Tombstoned records not yet reclaimed
+    uint64_t dead_bytes;            // File bytes held by tombstoned records
+    uint64_t last_compaction;       // Unix timestamp, 0 if never compacted
     pthread_mutex_t mutex;          // Thread safety mutex
     pthread_rwlock_t search_lock;   // Read-write lock for searches
     bool is_open;
+    bool read_only;                 // Opened with cvector_db_open_readonly
+    int lock_fd;                    // Holds the lock file, -1 for read-only opens
+    bool skip_corrupt;              // Opened with CVECTOR_OPEN_SKIP_CORRUPT
+    uint64_t max_size_bytes;        // Data file quota, 0 for none
     
     // Simple hash table for vector lookup (in-memory for now)
     cvector_vector_entry_t** hash_table;
@@ -29,14 +41,35 @@ struct cvector_db {
     
     // HNSW index for similarity search
     hnsw_index_t* hnsw_index;
+    size_t unindexed_count;         // Live entries missing from the index, which searches scan
+    bool index_building;            // Deferred build under way; new vectors wait for it too
+    size_t index_cursor;            // Hash bucket cvector_build_index resumes from
+    bool index_loaded;              // The index was read from <path>.hnsw, not rebuilt
+    bool index_dirty;               // Index or data changed since <path>.hnsw was read or saved
+    uint32_t ef_search;             // Candidate list size for queries that set none, 0 for twice top_k
+    
+    // IDs of damaged records skipped by a CVECTOR_OPEN_SKIP_CORRUPT open,
+    // sorted, until a compaction drops the records
+    cvector_id_t* unreadable_ids;
+    size_t unreadable_count;
+    
+    // Recently read vector records keyed by ID, sized by cvector_set_cache_size
+    cvector_cache_t cache;
+    
+    // Data file blocks keyed by block number, sized by
+    // cvector_set_block_cache_size
+    cvector_cache_t block_cache;
 };
 
 // File format constants
 #define CVECTOR_MAGIC_NUMBER 0x43564543  // "CVEC"
-#define CVECTOR_FILE_VERSION 1
+#define CVECTOR_FILE_VERSION_MIN 1  // Oldest version cvector_migrate upgrades
 #define CVECTOR_BLOCK_SIZE 4096
 #define CVECTOR_HASH_TABLE_SIZE 10007  // Prime number for good distribution
 
+// File header flags
+#define CVECTOR_FLAG_NORMALIZED 0x1  // Vectors are normalized on insert
+
 // File header structure
 typedef struct {
     uint32_t magic;
@@ -47,7 +80,11 @@ typedef struct {
     uint64_t next_id;
     uint64_t created_timestamp;
     uint64_t modified_timestamp;
-    uint8_t reserved[32];  // For future use
+    uint64_t last_compaction_timestamp;
+    uint32_t flags;        // CVECTOR_FLAG_* bits
+    uint8_t reserved_pad[4];
+    uint64_t max_vectors;  // 0 for no limit
+    uint8_t reserved[8];   // For future use
 } cvector_file_header_t;
 
 // Vector file record structure
@@ -56,7 +93,8 @@ typedef struct {
     uint32_t dimension;
     uint64_t timestamp;
     uint8_t is_deleted;
-    uint8_t reserved[7];
+    uint8_t reserved[3];
+    uint32_t version;      // Bumped by every update; 0 in files before version 3
     // Followed by dimension * sizeof(float) bytes of vector data
 } cvector_vector_record_t;
 
@@ -69,6 +107,30 @@ static uint64_t cvector_get_timestamp(void) {
     return (uint64_t)time(NULL);
 }
 
+// A single NaN or infinity makes every score it touches meaningless
+static bool cvector_is_finite(const float* data, uint32_t dimension) {
+    for (uint32_t i = 0; i < dimension; i++) {
+        if (!isfinite(data[i])) {
+            return false;
+        }
+    }
+    return true;
+}
+
+// Checks a record read from its slot against what the header promises.
+// Tombstones pass whatever their data holds, since it is never read again.
+static bool cvector_record_intact(const cvector_vector_record_t* record, const float* data, 
+                                  uint32_t dimension) {
+    return record->dimension == dimension && record->is_deleted <= 1 &&
+           (record->is_deleted || cvector_is_finite(data, dimension));
+}
+
+static int cvector_compare_ids(const void* a, const void* b) {
+    cvector_id_t id_a = *(const cvector_id_t*)a;
+    cvector_id_t id_b = *(const cvector_id_t*)b;
+    return (id_a > id_b) - (id_a < id_b);
+}
+
 static cvector_error_t cvector_init_hash_table(cvector_db_t* db) {
     db->hash_table_size = CVECTOR_HASH_TABLE_SIZE;
     db->hash_table = calloc(db->hash_table_size, sizeof(cvector_vector_entry_t*));
@@ -90,8 +152,8 @@ static void cvector_free_hash_table(cvector_db_t* db) {
     db->hash_table = NULL;
 }
 
-static cvector_error_t cvector_hash_insert(cvector_db_t* db, cvector_id_t id, 
-                                          uint64_t file_offset, uint32_t dimension) {
+static cvector_error_t cvector_hash_insert(cvector_db_t* db, cvector_id_t id, uint64_t file_offset, 
+                                          uint32_t dimension, uint32_t version, uint64_t timestamp) {
     uint64_t hash_idx = cvector_hash(id);
     cvector_vector_entry_t* entry = malloc(sizeof(cvector_vector_entry_t));
     if (!entry) return CVECTOR_ERROR_OUT_OF_MEMORY;
@@ -99,10 +161,13 @@ static cvector_error_t cvector_hash_insert(cvector_db_t* db, cvector_id_t id,
     entry->id = id;
     entry->file_offset = file_offset;
     entry->dimension = dimension;
-    entry->timestamp = cvector_get_timestamp();
+    entry->timestamp = timestamp;
+    entry->version = version;
     entry->is_deleted = false;
+    entry->indexed = false;
     entry->next = db->hash_table[hash_idx];
     db->hash_table[hash_idx] = entry;
+    db->unindexed_count++;
     
     return CVECTOR_SUCCESS;
 }
@@ -128,6 +193,100 @@ static cvector_vector_entry_t* cvector_hash_find(cvector_db_t* db, cvector_id_t
     return NULL;
 }
 
+// Finds the most recent tombstoned entry for id. Deletes leave their entry
+// in the table, and new entries are linked at the head of the chain.
+static cvector_vector_entry_t* cvector_hash_find_deleted(cvector_db_t* db, cvector_id_t id) {
+    for (cvector_vector_entry_t* entry = db->hash_table[cvector_hash(id)]; entry; entry = entry->next) {
+        if (entry->id == id && entry->is_deleted) {
+            return entry;
+        }
+    }
+    return NULL;
+}
+
+// Records whether a live entry's vector is in the HNSW index
+static void cvector_set_indexed(cvector_db_t* db, cvector_vector_entry_t* entry, bool indexed) {
+    if (entry->indexed == indexed) {
+        return;
+    }
+    entry->indexed = indexed;
+    db->index_dirty = true;
+    if (indexed) {
+        db->unindexed_count--;
+    } else {
+        db->unindexed_count++;
+    }
+}
+
+// Marks a live entry deleted, or a deleted one live again. Either way its
+// vector is out of the index at that point.
+static void cvector_set_deleted(cvector_db_t* db, cvector_vector_entry_t* entry, bool deleted) {
+    cvector_set_indexed(db, entry, false);
+    db->index_dirty = true;
+    if (deleted) {
+        db->unindexed_count--;
+    } else {
+        db->unindexed_count++;
+    }
+    entry->is_deleted = deleted;
+}
+
+// Drops cached blocks overlapping a write of length bytes at offset
+static void cvector_invalidate_blocks(cvector_db_t* db, uint64_t offset, size_t length) {
+    if (db->block_cache.capacity_bytes == 0 || length == 0) {
+        return;
+    }
+    for (uint64_t block = offset / CVECTOR_BLOCK_SIZE; 
+         block <= (offset + length - 1) / CVECTOR_BLOCK_SIZE; block++) {
+        cvector_cache_remove(&db->block_cache, block);
+    }
+}
+
+// Reads length bytes at offset, through the block cache when one is
+// configured. Callers hold db->mutex.
+static cvector_error_t cvector_read_at(cvector_db_t* db, uint64_t offset, void* buffer, size_t length) {
+    if (db->block_cache.capacity_bytes == 0) {
+        if (fseek(db->data_file, offset, SEEK_SET) != 0 || 
+            fread(buffer, 1, length, db->data_file) != length) {
+            return CVECTOR_ERROR_FILE_IO;
+        }
+        return CVECTOR_SUCCESS;
+    }
+    
+    unsigned char* out = buffer;
+    unsigned char block[CVECTOR_BLOCK_SIZE];
+    while (length > 0) {
+        uint64_t number = offset / CVECTOR_BLOCK_SIZE;
+        size_t within = offset % CVECTOR_BLOCK_SIZE;
+        
+        const unsigned char* bytes;
+        size_t size;
+        const cvector_cache_entry_t* cached = cvector_cache_get(&db->block_cache, number);
+        if (cached) {
+            bytes = cached->data;
+            size = cached->size;
+        } else {
+            // The last block may be short; appends invalidate it
+            if (fseek(db->data_file, number * CVECTOR_BLOCK_SIZE, SEEK_SET) != 0) {
+                return CVECTOR_ERROR_FILE_IO;
+            }
+            size = fread(block, 1, sizeof(block), db->data_file);
+            cvector_cache_put(&db->block_cache, number, block, size);
+            bytes = block;
+        }
+        
+        if (within >= size) {
+            return CVECTOR_ERROR_FILE_IO;
+        }
+        size_t n = size - within < length ? size - within : length;
+        memcpy(out, bytes + within, n);
+        out += n;
+        offset += n;
+        length -= n;
+    }
+    return CVECTOR_SUCCESS;
+}
+
 static cvector_error_t cvector_write_header(cvector_db_t* db) {
     cvector_file_header_t header = {0};
     header.magic = CVECTOR_MAGIC_NUMBER;
@@ -138,7 +297,13 @@ static cvector_error_t cvector_write_header(cvector_db_t* db) {
     header.next_id = db->next_id;
     header.created_timestamp = cvector_get_timestamp();
     header.modified_timestamp = header.created_timestamp;
+    header.last_compaction_timestamp = db->last_compaction;
+    if (db->config.normalize_on_insert) {
+        header.flags |= CVECTOR_FLAG_NORMALIZED;
+    }
+    header.max_vectors = db->config.max_vectors;
     
+    cvector_invalidate_blocks(db, 0, sizeof(header));
     fseek(db->data_file, 0, SEEK_SET);
     size_t written = fwrite(&header, sizeof(header), 1, db->data_file);
     if (written != 1) {
@@ -149,6 +314,8 @@ static cvector_error_t cvector_write_header(cvector_db_t* db) {
     return CVECTOR_SUCCESS;
 }
 
+static cvector_error_t cvector_migrate_step(cvector_file_header_t* header);
+
 static cvector_error_t cvector_read_header(cvector_db_t* db) {
     cvector_file_header_t header;
     
@@ -162,21 +329,320 @@ static cvector_error_t cvector_read_header(cvector_db_t* db) {
         return CVECTOR_ERROR_DB_CORRUPT;
     }
     
-    if (header.version != CVECTOR_FILE_VERSION) {
+    if (header.version > CVECTOR_FILE_VERSION) {
+        return CVECTOR_ERROR_VERSION_TOO_NEW;
+    }
+    if (header.version < CVECTOR_FILE_VERSION_MIN) {
         return CVECTOR_ERROR_DB_CORRUPT;
     }
     
+    // Older versions differ only in their headers, so they are upgraded as
+    // they are read. Writers, who hold the lock file, save the upgrade;
+    // readers leave the file as it is.
+    bool upgraded = header.version < CVECTOR_FILE_VERSION;
+    while (header.version < CVECTOR_FILE_VERSION) {
+        cvector_error_t err = cvector_migrate_step(&header);
+        if (err != CVECTOR_SUCCESS) {
+            return err;
+        }
+    }
+    
     db->config.dimension = header.dimension;
     db->config.default_similarity = header.default_similarity;
     db->vector_count = header.vector_count;
     db->next_id = header.next_id;
+    db->last_compaction = header.last_compaction_timestamp;
+    db->config.normalize_on_insert = (header.flags & CVECTOR_FLAG_NORMALIZED) != 0;
+    db->config.max_vectors = header.max_vectors;
     
+    if (upgraded && !db->read_only) {
+        return cvector_write_header(db);
+    }
     return CVECTOR_SUCCESS;
 }
 
 // Public API Implementation
 
-cvector_error_t cvector_db_create(const cvector_db_config_t* config, cvector_db_t** db) {
+// Writers take the search lock ahead of the mutex, so a search runs
+// entirely between two writes and never sees one half applied
+static void cvector_write_lock(cvector_db_t* db) {
+    pthread_rwlock_wrlock(&db->search_lock);
+    pthread_mutex_lock(&db->mutex);
+}
+
+static void cvector_write_unlock(cvector_db_t* db) {
+    pthread_mutex_unlock(&db->mutex);
+    pthread_rwlock_unlock(&db->search_lock);
+}
+
+// Writers lock a <path>.lock file next to the database rather than the
+// data file itself, which compaction replaces. The holder writes its PID
+// there so others can report who has it. flock locks go away with the
+// process, so a lock file left behind by a crash is simply reused.
+static void cvector_lock_path(const char* db_path, char* lock_path, size_t size) {
+    snprintf(lock_path, size, "%s.lock", db_path);
+}
+
+static cvector_error_t cvector_lock_acquire(const char* db_path, int* lock_fd) {
+    char lock_path[CVECTOR_MAX_PATH + 8];
+    cvector_lock_path(db_path, lock_path, sizeof(lock_path));
+    
+    int fd = open(lock_path, O_RDWR | O_CREAT, 0644);
+    if (fd < 0) {
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    if (flock(fd, LOCK_EX | LOCK_NB) != 0) {
+        int lock_errno = errno;
+        close(fd);
+        return lock_errno == EWOULDBLOCK ? CVECTOR_ERROR_LOCKED : CVECTOR_ERROR_FILE_IO;
+    }
+    
+    char pid[32];
+    int length = snprintf(pid, sizeof(pid), "%ld\n", (long)getpid());
+    if (ftruncate(fd, 0) != 0 || pwrite(fd, pid, length, 0) != length) {
+        close(fd);
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    
+    *lock_fd = fd;
+    return CVECTOR_SUCCESS;
+}
+
+static void cvector_lock_release(int lock_fd) {
+    if (lock_fd >= 0) {
+        close(lock_fd);
+    }
+}
+
+cvector_error_t cvector_lock_holder(const char* db_path, long* pid) {
+    if (!db_path || !pid) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    *pid = 0;
+    
+    char lock_path[CVECTOR_MAX_PATH + 8];
+    cvector_lock_path(db_path, lock_path, sizeof(lock_path));
+    int fd = open(lock_path, O_RDONLY);
+    if (fd < 0) {
+        return errno == ENOENT ? CVECTOR_SUCCESS : CVECTOR_ERROR_FILE_IO;
+    }
+    
+    // Probing with a shared lock tells a held lock from a leftover file
+    if (flock(fd, LOCK_SH | LOCK_NB) == 0) {
+        close(fd);
+        return CVECTOR_SUCCESS;
+    }
+    
+    char buffer[32] = {0};
+    ssize_t length = pread(fd, buffer, sizeof(buffer) - 1, 0);
+    close(fd);
+    if (length > 0) {
+        *pid = strtol(buffer, NULL, 10);
+    }
+    if (*pid <= 0) {
+        *pid = -1;  // Held, but the holder has not written its PID yet
+    }
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_force_unlock(const char* db_path) {
+    if (!db_path) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    char lock_path[CVECTOR_MAX_PATH + 8];
+    cvector_lock_path(db_path, lock_path, sizeof(lock_path));
+    if (unlink(lock_path) != 0 && errno != ENOENT) {
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    return CVECTOR_SUCCESS;
+}
+
+// The HNSW index is saved next to the data file as <path>.hnsw when a
+// writer closes, and read back by the next open instead of re-inserting
+// every vector. Its header ties it to the data file it was saved from; an
+// index whose data file has changed since, or whose HNSW parameters differ
+// from what this build would construct, is ignored and rebuilt.
+#define CVECTOR_INDEX_MAGIC 0x43564958  // "CVIX"
+#define CVECTOR_INDEX_VERSION 1
+
+typedef struct {
+    uint32_t magic;
+    uint32_t version;
+    uint64_t data_size;     // Data file size when saved
+    uint64_t vector_count;  // Live vectors when saved
+    uint64_t next_id;
+} cvector_index_header_t;
+
+static void cvector_index_path(const char* db_path, char* index_path, size_t size) {
+    snprintf(index_path, size, "%s.hnsw", db_path);
+}
+
+// Writes the index, as the index of a data file data_size bytes long, to
+// a temporary file and renames it to index_path, so a crash mid-save
+// leaves the previous file or none. Callers hold db->mutex or are closing
+// the handle.
+static cvector_error_t cvector_write_index(cvector_db_t* db, const char* index_path, uint64_t data_size) {
+    char tmp_path[CVECTOR_MAX_PATH + 16];
+    snprintf(tmp_path, sizeof(tmp_path), "%s.tmp", index_path);
+    
+    cvector_index_header_t header = {
+        .magic = CVECTOR_INDEX_MAGIC,
+        .version = CVECTOR_INDEX_VERSION,
+        .data_size = data_size,
+        .vector_count = db->vector_count,
+        .next_id = db->next_id,
+    };
+    
+    FILE* file = fopen(tmp_path, "wb");
+    if (!file) {
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    cvector_error_t err = CVECTOR_SUCCESS;
+    if (fwrite(&header, sizeof(header), 1, file) != 1) {
+        err = CVECTOR_ERROR_FILE_IO;
+    } else {
+        err = hnsw_write_index(db->hnsw_index, file);
+    }
+    if (fclose(file) != 0 && err == CVECTOR_SUCCESS) {
+        err = CVECTOR_ERROR_FILE_IO;
+    }
+    if (err == CVECTOR_SUCCESS && rename(tmp_path, index_path) != 0) {
+        err = CVECTOR_ERROR_FILE_IO;
+    }
+    if (err != CVECTOR_SUCCESS) {
+        unlink(tmp_path);
+    }
+    return err;
+}
+
+// Saves the index next to the data file for the next open
+static cvector_error_t cvector_save_index(cvector_db_t* db) {
+    char index_path[CVECTOR_MAX_PATH + 8];
+    cvector_index_path(db->config.data_path, index_path, sizeof(index_path));
+    
+    struct stat st;
+    if (fflush(db->data_file) != 0 || fstat(fileno(db->data_file), &st) != 0) {
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    cvector_error_t err = cvector_write_index(db, index_path, (uint64_t)st.st_size);
+    if (err == CVECTOR_SUCCESS) {
+        db->index_dirty = false;
+    }
+    return err;
+}
+
+// Reads the saved index of the data file at db_path, which is data_size
+// bytes long, into *saved. Returns false, leaving nothing to free, when
+// there is no saved index or it cannot be used with fresh's parameters.
+static bool cvector_load_index(const char* db_path, uint64_t data_size, const hnsw_index_t* fresh, 
+                               hnsw_index_t** saved, cvector_index_header_t* header) {
+    char index_path[CVECTOR_MAX_PATH + 8];
+    cvector_index_path(db_path, index_path, sizeof(index_path));
+    
+    FILE* file = fopen(index_path, "rb");
+    if (!file) {
+        return false;
+    }
+    if (fread(header, sizeof(*header), 1, file) != 1 || header->magic != CVECTOR_INDEX_MAGIC ||
+        header->version != CVECTOR_INDEX_VERSION || header->data_size != data_size ||
+        hnsw_read_index(file, saved) != CVECTOR_SUCCESS) {
+        fclose(file);
+        return false;
+    }
+    fclose(file);
+    
+    // Search settings such as ef_search are free to differ; the graph's
+    // shape is not
+    const hnsw_index_t* index = *saved;
+    if (index->dimension != fresh->dimension || index->similarity_type != fresh->similarity_type ||
+        index->M != fresh->M || index->ef_construction != fresh->ef_construction || index->ml != fresh->ml) {
+        printf("Warning: HNSW parameters changed; rebuilding the index\n");
+        hnsw_destroy_index(*saved);
+        *saved = NULL;
+        return false;
+    }
+    return true;
+}
+
+// Adopts a loaded index if it holds exactly the live vectors the open
+// found, marking their entries indexed. Returns false, with every entry
+// still unindexed, when the data file has moved on since the save.
+static bool cvector_attach_index(cvector_db_t* db, hnsw_index_t* saved, const cvector_index_header_t* header) {
+    bool matches = header->vector_count == db->vector_count && header->next_id == db->next_id &&
+                   saved->insert_count - saved->delete_count == db->vector_count;
+    
+    for (uint32_t i = 0; i < saved->node_count && matches; i++) {
+        if (!saved->nodes[i]) {
+            continue;
+        }
+        cvector_vector_entry_t* entry = cvector_hash_find(db, saved->nodes[i]->id);
+        if (!entry || entry->indexed) {
+            matches = false;
+            break;
+        }
+        cvector_set_indexed(db, entry, true);
+    }
+    
+    if (!matches) {
+        for (size_t i = 0; i < db->hash_table_size; i++) {
+            for (cvector_vector_entry_t* entry = db->hash_table[i]; entry; entry = entry->next) {
+                if (!entry->is_deleted) {
+                    cvector_set_indexed(db, entry, false);
+                }
+            }
+        }
+        return false;
+    }
+    
+    hnsw_destroy_index(db->hnsw_index);
+    db->hnsw_index = saved;
+    return true;
+}
+
+// Adds up to max_vectors live vectors missing from the index, resuming
+// from the hash bucket the last call stopped at. Vectors inserted
+// meanwhile into buckets already passed are found on the next lap.
+// Callers hold the write lock or have the handle to themselves.
+static cvector_error_t cvector_index_batch(cvector_db_t* db, size_t max_vectors) {
+    float* data = malloc((db->config.dimension ? db->config.dimension : 1) * sizeof(float));
+    if (!data) {
+        return CVECTOR_ERROR_OUT_OF_MEMORY;
+    }
+    
+    cvector_error_t err = CVECTOR_SUCCESS;
+    size_t added = 0;
+    for (size_t scanned = 0; scanned < db->hash_table_size && added < max_vectors && 
+         db->unindexed_count > 0 && err == CVECTOR_SUCCESS; scanned++) {
+        for (cvector_vector_entry_t* entry = db->hash_table[db->index_cursor]; entry; entry = entry->next) {
+            if (entry->is_deleted || entry->indexed) {
+                continue;
+            }
+            fseek(db->data_file, entry->file_offset + sizeof(cvector_vector_record_t), SEEK_SET);
+            if (fread(data, sizeof(float), entry->dimension, db->data_file) != entry->dimension) {
+                err = CVECTOR_ERROR_FILE_IO;
+                break;
+            }
+            err = hnsw_add_vector(db->hnsw_index, entry->id, data);
+            if (err != CVECTOR_SUCCESS) {
+                break;
+            }
+            cvector_set_indexed(db, entry, true);
+            added++;
+        }
+        if (err == CVECTOR_SUCCESS) {
+            db->index_cursor = (db->index_cursor + 1) % db->hash_table_size;
+        }
+    }
+    free(data);
+    
+    if (db->unindexed_count == 0) {
+        db->index_cursor = 0;
+    }
+    return err;
+}
+
+static cvector_error_t cvector_db_create_unlocked(const cvector_db_config_t* config, cvector_db_t** db) {
     if (!config || !db) {
         return CVECTOR_ERROR_INVALID_ARGS;
     }
@@ -202,6 +668,11 @@ cvector_error_t cvector_db_create(const cvector_db_config_t* config, cvector_db_
         return CVECTOR_ERROR_FILE_IO;  // Database already exists
     }
     
+    // An index saved for an earlier database at this path is stale
+    char index_path[CVECTOR_MAX_PATH + 8];
+    cvector_index_path(config->data_path, index_path, sizeof(index_path));
+    unlink(index_path);
+    
     // Create database directory if it doesn't exist
     char dir_path[CVECTOR_MAX_PATH];
     strncpy(dir_path, config->data_path, sizeof(dir_path) - 1);
@@ -280,7 +751,32 @@ cvector_error_t cvector_db_create(const cvector_db_config_t* config, cvector_db_
     return CVECTOR_SUCCESS;
 }
 
-cvector_error_t cvector_db_open(const char* db_path, cvector_db_t** db) {
+cvector_error_t cvector_db_create(const cvector_db_config_t* config, cvector_db_t** db) {
+    if (!config || !db || strlen(config->data_path) == 0) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    int lock_fd;
+    cvector_error_t err = cvector_lock_acquire(config->data_path, &lock_fd);
+    if (err != CVECTOR_SUCCESS) {
+        return err;
+    }
+    
+    err = cvector_db_create_unlocked(config, db);
+    if (err != CVECTOR_SUCCESS) {
+        // Leave no lock file behind for a database that was never created
+        if (!cvector_file_exists(config->data_path)) {
+            cvector_force_unlock(config->data_path);
+        }
+        cvector_lock_release(lock_fd);
+        return err;
+    }
+    (*db)->lock_fd = lock_fd;
+    return CVECTOR_SUCCESS;
+}
+
+static cvector_error_t cvector_db_open_mode(const char* db_path, bool read_only, bool skip_corrupt,
+                                            bool defer_index, cvector_db_t** db) {
     if (!db_path || !db) {
         return CVECTOR_ERROR_INVALID_ARGS;
     }
@@ -298,6 +794,7 @@ cvector_error_t cvector_db_open(const char* db_path, cvector_db_t** db) {
     }
     
     cvector_db_t* database = *db;
+    database->lock_fd = -1;
     strncpy(database->config.data_path, db_path, sizeof(database->config.data_path) - 1);
     database->config.data_path[sizeof(database->config.data_path) - 1] = '\0';
     
@@ -310,7 +807,9 @@ cvector_error_t cvector_db_open(const char* db_path, cvector_db_t** db) {
     }
     
     // Open data file
-    database->data_file = fopen(db_path, "r+b");
+    database->read_only = read_only;
+    database->skip_corrupt = skip_corrupt;
+    database->data_file = fopen(db_path, read_only ? "rb" : "r+b");
     if (!database->data_file) {
         cvector_free_hash_table(database);
         free(database);
@@ -318,6 +817,18 @@ cvector_error_t cvector_db_open(const char* db_path, cvector_db_t** db) {
         return CVECTOR_ERROR_FILE_IO;
     }
     
+    // Readers share a lock on the data file they read, which drop and
+    // migrate take exclusively. It does not conflict with the writer's
+    // lock file, and compaction swaps in a new file without touching it.
+    if (read_only && flock(fileno(database->data_file), LOCK_SH | LOCK_NB) != 0) {
+        err = errno == EWOULDBLOCK ? CVECTOR_ERROR_LOCKED : CVECTOR_ERROR_FILE_IO;
+        fclose(database->data_file);
+        cvector_free_hash_table(database);
+        free(database);
+        *db = NULL;
+        return err;
+    }
+    
     // Read and validate header
     err = cvector_read_header(database);
     if (err != CVECTOR_SUCCESS) {
@@ -338,150 +849,520 @@ cvector_error_t cvector_db_open(const char* db_path, cvector_db_t** db) {
         return err;
     }
     
-    // Rebuild hash table and HNSW index from existing vectors in the file
-    fseek(database->data_file, sizeof(cvector_file_header_t), SEEK_SET);
+    // A saved index spares re-inserting every vector. It is only adopted
+    // once the records below turn out to be the ones it was saved with.
+    hnsw_index_t* saved_index = NULL;
+    cvector_index_header_t saved_header;
+    bool from_saved = cvector_load_index(db_path, (uint64_t)st.st_size, database->hnsw_index, 
+                                         &saved_index, &saved_header);
+    
+    // Rebuild hash table and HNSW index from existing vectors in the file.
+    // Counts are recomputed from the records since the header copy is only
+    // written on a clean close. Every record has the header's dimension, so
+    // records sit at a fixed stride and a damaged one can be stepped over.
+    uint32_t dimension = database->config.dimension;
+    uint64_t stride = sizeof(cvector_vector_record_t) + (uint64_t)dimension * sizeof(float);
+    float* vector_data = malloc((dimension ? dimension : 1) * sizeof(float));
+    if (!vector_data) {
+        hnsw_destroy_index(saved_index);
+        hnsw_destroy_index(database->hnsw_index);
+        fclose(database->data_file);
+        cvector_free_hash_table(database);
+        free(database);
+        *db = NULL;
+        return CVECTOR_ERROR_OUT_OF_MEMORY;
+    }
+    database->vector_count = 0;
+    database->deleted_count = 0;
+    database->dead_bytes = 0;
+    bool index_full = false;
     
-    while (true) {
-        uint64_t record_start = ftell(database->data_file);
+    for (uint64_t record_start = sizeof(cvector_file_header_t); ; record_start += stride) {
         cvector_vector_record_t record;
-        size_t read = fread(&record, sizeof(record), 1, database->data_file);
-        if (read != 1) break; // End of file or error
+        fseek(database->data_file, record_start, SEEK_SET);
+        size_t got = fread(&record, 1, sizeof(record), database->data_file);
         
-        if (!record.is_deleted) {
-            // Read vector data
-            float* vector_data = malloc(record.dimension * sizeof(float));
-            if (vector_data) {
-                read = fread(vector_data, sizeof(float), record.dimension, database->data_file);
-                if (read == record.dimension) {
-                    // Add to hash table
-                    cvector_hash_insert(database, record.id, record_start, record.dimension);
-                    
-                    // Rebuild HNSW index - add vector back to HNSW
-                    if (database->hnsw_index) {
-                        cvector_error_t hnsw_err = hnsw_add_vector(database->hnsw_index, record.id, vector_data);
-                        if (hnsw_err != CVECTOR_SUCCESS) {
-                            printf("Warning: Failed to rebuild HNSW vector %llu: %s\n", 
-                                   (unsigned long long)record.id, cvector_error_string(hnsw_err));
-                        }
-                    }
+        // A record torn by a crash mid-append ends the file
+        if (got != sizeof(record) || 
+            fread(vector_data, sizeof(float), dimension, database->data_file) != dimension) {
+            break;
+        }
+        
+        if (!cvector_record_intact(&record, vector_data, dimension)) {
+            if (!skip_corrupt) {
+                err = CVECTOR_ERROR_DB_CORRUPT;
+                break;
+            }
+            cvector_id_t* ids = realloc(database->unreadable_ids, 
+                                        (database->unreadable_count + 1) * sizeof(*ids));
+            if (!ids) {
+                err = CVECTOR_ERROR_OUT_OF_MEMORY;
+                break;
+            }
+            database->unreadable_ids = ids;
+            database->unreadable_ids[database->unreadable_count++] = record.id;
+            database->dead_bytes += stride;
+            continue;
+        }
+        
+        // Records written before format version 3 carry no version; they
+        // count as the first one
+        uint32_t version = record.version ? record.version : 1;
+        
+        if (record.is_deleted) {
+            database->deleted_count++;
+            database->dead_bytes += stride;
+            
+            // Track the newest tombstone of each ID, which cvector_undelete
+            // can restore until the next compaction
+            cvector_vector_entry_t* tombstone = cvector_hash_find_deleted(database, record.id);
+            if (tombstone) {
+                tombstone->file_offset = record_start;
+                tombstone->dimension = record.dimension;
+                tombstone->version = version;
+                tombstone->timestamp = record.timestamp;
+            } else {
+                err = cvector_hash_insert(database, record.id, record_start, record.dimension, 
+                                          version, record.timestamp);
+                if (err != CVECTOR_SUCCESS) {
+                    break;
                 }
-                free(vector_data);
+                cvector_set_deleted(database, database->hash_table[cvector_hash(record.id)], true);
+            }
+            continue;
+        }
+        
+        // A second live record for an ID is left behind when an update is
+        // interrupted before the old record is tombstoned. The later record
+        // wins; the earlier one is counted as dead space.
+        cvector_vector_entry_t* existing = cvector_hash_find(database, record.id);
+        if (existing) {
+            database->deleted_count++;
+            database->dead_bytes += stride;
+            existing->file_offset = record_start;
+            existing->dimension = record.dimension;
+            existing->version = version;
+            existing->timestamp = record.timestamp;
+            if (existing->indexed) {
+                hnsw_remove_vector(database->hnsw_index, record.id);
+                cvector_set_indexed(database, existing, false);
             }
         } else {
-            // Skip deleted vector data
-            fseek(database->data_file, record.dimension * sizeof(float), SEEK_CUR);
+            err = cvector_hash_insert(database, record.id, record_start, record.dimension, version, record.timestamp);
+            if (err != CVECTOR_SUCCESS) {
+                break;
+            }
+            existing = database->hash_table[cvector_hash(record.id)];
+            database->vector_count++;
+        }
+        if (record.id >= database->next_id) {
+            database->next_id = record.id + 1;
+        }
+        
+        // Rebuild HNSW index - add vector back to HNSW, unless the build is
+        // deferred or the saved index is expected to hold it. Past the
+        // memory limit the index stays partial and searches scan the
+        // vectors left out.
+        if (database->hnsw_index && !index_full && !defer_index && !from_saved) {
+            cvector_error_t hnsw_err = hnsw_add_vector(database->hnsw_index, record.id, vector_data);
+            if (hnsw_err == CVECTOR_SUCCESS) {
+                cvector_set_indexed(database, existing, true);
+            } else if (hnsw_err == CVECTOR_ERROR_OUT_OF_MEMORY) {
+                printf("Warning: Memory limit reached; HNSW index left partial\n");
+                index_full = true;
+            } else {
+                printf("Warning: Failed to rebuild HNSW vector %llu: %s\n", 
+                       (unsigned long long)record.id, cvector_error_string(hnsw_err));
+            }
+        }
+    }
+    free(vector_data);
+    
+    // A saved index that does not match is dropped and, like vectors it
+    // lacks, built here unless the build is deferred
+    if (err == CVECTOR_SUCCESS && from_saved) {
+        database->index_loaded = cvector_attach_index(database, saved_index, &saved_header);
+        if (!database->index_loaded) {
+            hnsw_destroy_index(saved_index);
+        }
+        saved_index = NULL;
+        if (!defer_index && database->unindexed_count > 0) {
+            cvector_error_t hnsw_err = cvector_index_batch(database, SIZE_MAX);
+            if (hnsw_err != CVECTOR_SUCCESS) {
+                printf("Warning: HNSW index left partial: %s\n", cvector_error_string(hnsw_err));
+            }
         }
     }
+    database->index_building = defer_index && database->unindexed_count > 0;
+    database->index_dirty = !database->index_loaded;
+    
+    if (err != CVECTOR_SUCCESS) {
+        free(database->unreadable_ids);
+        hnsw_destroy_index(saved_index);
+        hnsw_destroy_index(database->hnsw_index);
+        fclose(database->data_file);
+        cvector_free_hash_table(database);
+        free(database);
+        *db = NULL;
+        return err;
+    }
+    
+    // Sorted so reads can tell a damaged ID from a missing one
+    qsort(database->unreadable_ids, database->unreadable_count, sizeof(cvector_id_t), cvector_compare_ids);
     
     database->is_open = true;
     return CVECTOR_SUCCESS;
 }
 
-cvector_error_t cvector_db_close(cvector_db_t* db) {
-    if (!db || !db->is_open) {
+cvector_error_t cvector_db_open(const char* db_path, cvector_db_t** db) {
+    return cvector_db_open_flags(db_path, 0, db);
+}
+
+cvector_error_t cvector_db_open_readonly(const char* db_path, cvector_db_t** db) {
+    return cvector_db_open_flags(db_path, CVECTOR_OPEN_READ_ONLY, db);
+}
+
+cvector_error_t cvector_db_open_flags(const char* db_path, uint32_t flags, cvector_db_t** db) {
+    if (!db_path || !db) {
         return CVECTOR_ERROR_INVALID_ARGS;
     }
     
-    // Update header with final stats
-    cvector_write_header(db);
-    
-    // Close files
-    if (db->data_file) {
-        fclose(db->data_file);
-        db->data_file = NULL;
+    bool skip_corrupt = (flags & CVECTOR_OPEN_SKIP_CORRUPT) != 0;
+    bool defer_index = (flags & CVECTOR_OPEN_DEFER_INDEX) != 0;
+    if (flags & CVECTOR_OPEN_READ_ONLY) {
+        return cvector_db_open_mode(db_path, true, skip_corrupt, defer_index, db);
     }
     
-    // Free hash table
-    cvector_free_hash_table(db);
-    
-    // Destroy HNSW index
-    if (db->hnsw_index) {
-        hnsw_destroy_index(db->hnsw_index);
-        db->hnsw_index = NULL;
+    if (!cvector_file_exists(db_path)) {
+        return CVECTOR_ERROR_DB_NOT_FOUND;
     }
     
-    // Cleanup thread safety mechanisms
-    pthread_mutex_destroy(&db->mutex);
-    pthread_rwlock_destroy(&db->search_lock);
-    
-    db->is_open = false;
-    free(db);
+    int lock_fd;
+    cvector_error_t err = cvector_lock_acquire(db_path, &lock_fd);
+    if (err != CVECTOR_SUCCESS) {
+        return err;
+    }
     
+    err = cvector_db_open_mode(db_path, false, skip_corrupt, defer_index, db);
+    if (err != CVECTOR_SUCCESS) {
+        cvector_lock_release(lock_fd);
+        return err;
+    }
+    (*db)->lock_fd = lock_fd;
     return CVECTOR_SUCCESS;
 }
 
-cvector_error_t cvector_db_drop(const char* db_path) {
-    if (!db_path) {
+cvector_error_t cvector_build_index(cvector_db_t* db, size_t max_vectors, size_t* remaining) {
+    if (!db || !db->is_open || !remaining || max_vectors == 0) {
         return CVECTOR_ERROR_INVALID_ARGS;
     }
     
-    if (unlink(db_path) != 0) {
-        return CVECTOR_ERROR_FILE_IO;
+    cvector_write_lock(db);
+    
+    if (!db->hnsw_index) {
+        *remaining = 0;
+        cvector_write_unlock(db);
+        return CVECTOR_SUCCESS;
     }
     
-    return CVECTOR_SUCCESS;
+    cvector_error_t err = cvector_index_batch(db, max_vectors);
+    if (db->unindexed_count == 0) {
+        db->index_building = false;
+    }
+    *remaining = db->unindexed_count;
+    cvector_write_unlock(db);
+    return err;
 }
 
-cvector_error_t cvector_insert(cvector_db_t* db, const cvector_t* vector) {
-    if (!db || !db->is_open || !vector || !vector->data) {
+cvector_error_t cvector_db_refresh(cvector_db_t* db) {
+    if (!db || !db->is_open) {
         return CVECTOR_ERROR_INVALID_ARGS;
     }
     
-    if (vector->dimension != db->config.dimension) {
-        return CVECTOR_ERROR_DIMENSION_MISMATCH;
+    // A writer's handle is always current
+    if (!db->read_only) {
+        return CVECTOR_SUCCESS;
     }
     
-    // Thread safety: acquire write lock
-    pthread_mutex_lock(&db->mutex);
-    
-    // Check if vector with this ID already exists
-    if (cvector_hash_find(db, vector->id)) {
-        pthread_mutex_unlock(&db->mutex);
-        return CVECTOR_ERROR_INVALID_ARGS;  // Vector already exists
+    // Load the file as it is now into a second handle, then trade contents
+    // with it so callers keep their pointer and their cache settings
+    cvector_db_t* fresh = NULL;
+    cvector_error_t err = cvector_db_open_mode(db->config.data_path, true, db->skip_corrupt, false, &fresh);
+    if (err != CVECTOR_SUCCESS) {
+        return err;
+    }
+    
+    cvector_write_lock(db);
+    
+    cvector_db_config_t config = db->config;
+    FILE* data_file = db->data_file;
+    cvector_vector_entry_t** hash_table = db->hash_table;
+    size_t hash_table_size = db->hash_table_size;
+    hnsw_index_t* hnsw_index = db->hnsw_index;
+    cvector_id_t* unreadable_ids = db->unreadable_ids;
+    
+    db->config = fresh->config;
+    db->data_file = fresh->data_file;
+    db->next_id = fresh->next_id;
+    db->vector_count = fresh->vector_count;
+    db->deleted_count = fresh->deleted_count;
+    db->dead_bytes = fresh->dead_bytes;
+    db->last_compaction = fresh->last_compaction;
+    db->hash_table = fresh->hash_table;
+    db->hash_table_size = fresh->hash_table_size;
+    db->hnsw_index = fresh->hnsw_index;
+    db->unindexed_count = fresh->unindexed_count;
+    db->index_building = false;
+    db->index_cursor = 0;
+    db->index_loaded = fresh->index_loaded;
+    db->index_dirty = fresh->index_dirty;
+    db->unreadable_ids = fresh->unreadable_ids;
+    db->unreadable_count = fresh->unreadable_count;
+    cvector_cache_clear(&db->cache);
+    cvector_cache_clear(&db->block_cache);
+    
+    cvector_write_unlock(db);
+    
+    // Closing the spare handle releases the old file and index
+    fresh->config = config;
+    fresh->data_file = data_file;
+    fresh->hash_table = hash_table;
+    fresh->hash_table_size = hash_table_size;
+    fresh->hnsw_index = hnsw_index;
+    fresh->unreadable_ids = unreadable_ids;
+    cvector_db_close(fresh);
+    
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_db_close(cvector_db_t* db) {
+    if (!db || !db->is_open) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    // Update header with final stats, and save the index for the next open
+    // if it changed. One still missing vectors, from a deferred build or a
+    // failed insert, would not match the file and is not saved; a stale
+    // one would only be rebuilt, but none is left behind.
+    if (!db->read_only) {
+        cvector_write_header(db);
+        if (db->hnsw_index && db->index_dirty) {
+            char index_path[CVECTOR_MAX_PATH + 8];
+            cvector_index_path(db->config.data_path, index_path, sizeof(index_path));
+            if (db->unindexed_count > 0) {
+                unlink(index_path);
+            } else if (cvector_save_index(db) != CVECTOR_SUCCESS) {
+                unlink(index_path);
+                printf("Warning: Failed to save HNSW index; the next open rebuilds it\n");
+            }
+        }
+    }
+    
+    // Close files
+    if (db->data_file) {
+        fclose(db->data_file);
+        db->data_file = NULL;
+    }
+    
+    // Free hash table
+    cvector_free_hash_table(db);
+    free(db->unreadable_ids);
+    cvector_cache_destroy(&db->cache);
+    cvector_cache_destroy(&db->block_cache);
+    
+    // Destroy HNSW index
+    if (db->hnsw_index) {
+        hnsw_destroy_index(db->hnsw_index);
+        db->hnsw_index = NULL;
     }
     
+    // Cleanup thread safety mechanisms
+    pthread_mutex_destroy(&db->mutex);
+    pthread_rwlock_destroy(&db->search_lock);
+    
+    cvector_lock_release(db->lock_fd);
+    db->is_open = false;
+    free(db);
+    
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_db_drop(const char* db_path) {
+    if (!db_path) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    // Refuse to pull the file out from under a writer or reader that has
+    // it open
+    int lock_fd;
+    cvector_error_t err = cvector_lock_acquire(db_path, &lock_fd);
+    if (err != CVECTOR_SUCCESS) {
+        return err;
+    }
+    
+    int data_fd = open(db_path, O_RDONLY);
+    if (data_fd < 0) {
+        err = CVECTOR_ERROR_FILE_IO;
+    } else if (flock(data_fd, LOCK_EX | LOCK_NB) != 0) {
+        err = errno == EWOULDBLOCK ? CVECTOR_ERROR_LOCKED : CVECTOR_ERROR_FILE_IO;
+    } else if (unlink(db_path) != 0) {
+        err = CVECTOR_ERROR_FILE_IO;
+    } else {
+        char index_path[CVECTOR_MAX_PATH + 8];
+        cvector_index_path(db_path, index_path, sizeof(index_path));
+        unlink(index_path);
+    }
+    if (data_fd >= 0) {
+        close(data_fd);
+    }
+    if (err != CVECTOR_ERROR_LOCKED) {
+        cvector_force_unlock(db_path);
+    }
+    cvector_lock_release(lock_fd);
+    
+    return err;
+}
+
+// Fails with CVECTOR_ERROR_QUOTA_EXCEEDED when appending a record of
+// dimension floats would grow the file past its quota. Callers hold
+// db->mutex.
+static cvector_error_t cvector_check_quota(cvector_db_t* db, uint32_t dimension) {
+    if (db->max_size_bytes == 0) {
+        return CVECTOR_SUCCESS;
+    }
+    
+    fseek(db->data_file, 0, SEEK_END);
+    uint64_t size = ftell(db->data_file);
+    uint64_t record_bytes = sizeof(cvector_vector_record_t) + (uint64_t)dimension * sizeof(float);
+    if (size + record_bytes > db->max_size_bytes) {
+        return CVECTOR_ERROR_QUOTA_EXCEEDED;
+    }
+    return CVECTOR_SUCCESS;
+}
+
+// Appends a live record to the end of the data file. Callers hold db->mutex.
+static cvector_error_t cvector_append_record(cvector_db_t* db, cvector_id_t id, uint32_t dimension,
+                                             uint32_t version, uint64_t timestamp, const float* data, 
+                                             uint64_t* file_offset) {
     // Seek to end of file
     fseek(db->data_file, 0, SEEK_END);
-    uint64_t file_offset = ftell(db->data_file);
+    *file_offset = ftell(db->data_file);
     
     // Create record
     cvector_vector_record_t record = {0};
-    record.id = vector->id;
-    record.dimension = vector->dimension;
-    record.timestamp = cvector_get_timestamp();
+    record.id = id;
+    record.dimension = dimension;
+    record.timestamp = timestamp;
     record.is_deleted = 0;
+    record.version = version;
     
     // Write record header
     size_t written = fwrite(&record, sizeof(record), 1, db->data_file);
     if (written != 1) {
-        pthread_mutex_unlock(&db->mutex);
         return CVECTOR_ERROR_FILE_IO;
     }
     
     // Write vector data
-    written = fwrite(vector->data, sizeof(float), vector->dimension, db->data_file);
-    if (written != vector->dimension) {
-        pthread_mutex_unlock(&db->mutex);
+    written = fwrite(data, sizeof(float), dimension, db->data_file);
+    if (written != dimension) {
         return CVECTOR_ERROR_FILE_IO;
     }
     
-    // Add to hash table
-    cvector_error_t err = cvector_hash_insert(db, vector->id, file_offset, vector->dimension);
+    cvector_invalidate_blocks(db, *file_offset, sizeof(record) + dimension * sizeof(float));
+    db->index_dirty = true;
+    
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_insert(cvector_db_t* db, const cvector_t* vector) {
+    if (!db || !db->is_open || !vector || !vector->data) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (db->read_only) {
+        return CVECTOR_ERROR_READ_ONLY;
+    }
+    
+    if (vector->dimension != db->config.dimension) {
+        return CVECTOR_ERROR_DIMENSION_MISMATCH;
+    }
+    
+    if (!cvector_is_finite(vector->data, vector->dimension)) {
+        return CVECTOR_ERROR_INVALID_VECTOR_DATA;
+    }
+    
+    // Normalized databases store a unit-length copy of the input
+    const float* data = vector->data;
+    float* normalized = NULL;
+    if (db->config.normalize_on_insert) {
+        normalized = malloc(vector->dimension * sizeof(float));
+        if (!normalized) {
+            return CVECTOR_ERROR_OUT_OF_MEMORY;
+        }
+        memcpy(normalized, vector->data, vector->dimension * sizeof(float));
+        cvector_normalize_vector(normalized, vector->dimension);
+        data = normalized;
+    }
+    
+    // Thread safety: acquire write lock
+    cvector_write_lock(db);
+    
+    // Check if vector with this ID already exists
+    if (cvector_hash_find(db, vector->id)) {
+        cvector_write_unlock(db);
+        free(normalized);
+        return CVECTOR_ERROR_DUPLICATE_ID;
+    }
+    
+    if (db->config.max_vectors > 0 && db->vector_count >= db->config.max_vectors) {
+        cvector_write_unlock(db);
+        free(normalized);
+        return CVECTOR_ERROR_DB_FULL;
+    }
+    
+    cvector_error_t err = cvector_check_quota(db, vector->dimension);
     if (err != CVECTOR_SUCCESS) {
-        pthread_mutex_unlock(&db->mutex);
+        cvector_write_unlock(db);
+        free(normalized);
         return err;
     }
     
-    // Add to HNSW index
-    if (db->hnsw_index) {
-        err = hnsw_add_vector(db->hnsw_index, vector->id, vector->data);
+    // Add to HNSW index first: the memory limit can refuse it, and nothing
+    // has reached the file yet when it does. During a deferred build the
+    // vector waits for cvector_build_index instead.
+    bool indexed = false;
+    if (db->hnsw_index && !db->index_building) {
+        err = hnsw_add_vector(db->hnsw_index, vector->id, data);
+        if (err == CVECTOR_ERROR_OUT_OF_MEMORY) {
+            cvector_write_unlock(db);
+            free(normalized);
+            return err;
+        }
         if (err != CVECTOR_SUCCESS) {
             // Note: In production, we might want to rollback the hash table entry
             // For now, we'll log the error but continue
             printf("Warning: Failed to add vector %llu to HNSW index: %s\n", 
-                   vector->id, cvector_error_string(err));
+                   (unsigned long long)vector->id, cvector_error_string(err));
+        }
+        indexed = err == CVECTOR_SUCCESS;
+    }
+    
+    uint64_t file_offset;
+    uint64_t timestamp = cvector_get_timestamp();
+    err = cvector_append_record(db, vector->id, vector->dimension, 1, timestamp, data, &file_offset);
+    if (err == CVECTOR_SUCCESS) {
+        // Add to hash table
+        err = cvector_hash_insert(db, vector->id, file_offset, vector->dimension, 1, timestamp);
+    }
+    if (err != CVECTOR_SUCCESS) {
+        if (indexed) {
+            hnsw_remove_vector(db->hnsw_index, vector->id);
         }
+        cvector_write_unlock(db);
+        free(normalized);
+        return err;
     }
+    cvector_set_indexed(db, db->hash_table[cvector_hash(vector->id)], indexed);
     
     // Update counters
     db->vector_count++;
@@ -492,11 +1373,14 @@ cvector_error_t cvector_insert(cvector_db_t* db, const cvector_t* vector) {
     fflush(db->data_file);
     
     // Thread safety: release write lock
-    pthread_mutex_unlock(&db->mutex);
+    cvector_write_unlock(db);
     
+    free(normalized);
     return CVECTOR_SUCCESS;
 }
 
+static cvector_error_t cvector_read_vector(cvector_db_t* db, cvector_id_t id, cvector_t** vector);
+
 cvector_error_t cvector_get(cvector_db_t* db, cvector_id_t id, cvector_t** vector) {
     // Comprehensive input validation
     if (!db) {
@@ -515,20 +1399,48 @@ cvector_error_t cvector_get(cvector_db_t* db, cvector_id_t id, cvector_t** vecto
         return CVECTOR_ERROR_INVALID_ARGS;
     }
     
+    // Compaction moves records and swaps the data file, so reads hold the
+    // write lock too
+    pthread_mutex_lock(&db->mutex);
+    cvector_error_t err = cvector_read_vector(db, id, vector);
+    pthread_mutex_unlock(&db->mutex);
+    
+    return err;
+}
+
+// Reads the live record for id, through the cache when one is configured.
+// Callers hold db->mutex.
+static cvector_error_t cvector_read_vector(cvector_db_t* db, cvector_id_t id, cvector_t** vector) {
     // Find in hash table
     cvector_vector_entry_t* entry = cvector_hash_find(db, id);
     if (!entry) {
+        // A record skipped as damaged is reported as such, not as missing
+        if (db->unreadable_count > 0 && 
+            bsearch(&id, db->unreadable_ids, db->unreadable_count, sizeof(cvector_id_t), cvector_compare_ids)) {
+            return CVECTOR_ERROR_DB_CORRUPT;
+        }
         return CVECTOR_ERROR_VECTOR_NOT_FOUND;
     }
     
-    // Seek to record position
-    fseek(db->data_file, entry->file_offset, SEEK_SET);
+    // Cached entries hold the record header followed by the vector data
+    const cvector_cache_entry_t* cached = cvector_cache_get(&db->cache, id);
+    if (cached) {
+        cvector_vector_record_t record;
+        memcpy(&record, cached->data, sizeof(record));
+        cvector_error_t err = cvector_create_vector(id, record.dimension, 
+                                                    (const float*)(cached->data + sizeof(record)), vector);
+        if (err == CVECTOR_SUCCESS) {
+            (*vector)->timestamp = record.timestamp;
+            (*vector)->version = entry->version;
+        }
+        return err;
+    }
     
     // Read record header
     cvector_vector_record_t record;
-    size_t read = fread(&record, sizeof(record), 1, db->data_file);
-    if (read != 1) {
-        return CVECTOR_ERROR_FILE_IO;
+    cvector_error_t err = cvector_read_at(db, entry->file_offset, &record, sizeof(record));
+    if (err != CVECTOR_SUCCESS) {
+        return err;
     }
     
     if (record.is_deleted) {
@@ -548,22 +1460,146 @@ cvector_error_t cvector_get(cvector_db_t* db, cvector_id_t id, cvector_t** vecto
     }
     
     // Read vector data
-    read = fread(result->data, sizeof(float), record.dimension, db->data_file);
-    if (read != record.dimension) {
+    size_t data_bytes = record.dimension * sizeof(float);
+    err = cvector_read_at(db, entry->file_offset + sizeof(record), result->data, data_bytes);
+    if (err != CVECTOR_SUCCESS) {
         free(result->data);
         free(result);
-        return CVECTOR_ERROR_FILE_IO;
+        return err;
     }
     
     result->id = record.id;
     result->dimension = record.dimension;
     result->timestamp = record.timestamp;
+    result->version = entry->version;
+    
+    if (db->cache.capacity_bytes > 0) {
+        unsigned char* copy = malloc(sizeof(record) + data_bytes);
+        if (copy) {
+            memcpy(copy, &record, sizeof(record));
+            memcpy(copy + sizeof(record), result->data, data_bytes);
+            cvector_cache_put(&db->cache, record.id, copy, sizeof(record) + data_bytes);
+            free(copy);
+        }
+    }
     
     *vector = result;
     return CVECTOR_SUCCESS;
 }
 
-cvector_error_t cvector_delete(cvector_db_t* db, cvector_id_t id) {
+// Replaces a live vector. With check set, fails unless the vector is at
+// expected_version.
+static cvector_error_t cvector_update_checked(cvector_db_t* db, const cvector_t* vector,
+                                              bool check, uint32_t expected_version) {
+    if (!db || !db->is_open || !vector || !vector->data) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (db->read_only) {
+        return CVECTOR_ERROR_READ_ONLY;
+    }
+    
+    if (vector->dimension != db->config.dimension) {
+        return CVECTOR_ERROR_DIMENSION_MISMATCH;
+    }
+    
+    if (!cvector_is_finite(vector->data, vector->dimension)) {
+        return CVECTOR_ERROR_INVALID_VECTOR_DATA;
+    }
+    
+    const float* data = vector->data;
+    float* normalized = NULL;
+    if (db->config.normalize_on_insert) {
+        normalized = malloc(vector->dimension * sizeof(float));
+        if (!normalized) {
+            return CVECTOR_ERROR_OUT_OF_MEMORY;
+        }
+        memcpy(normalized, vector->data, vector->dimension * sizeof(float));
+        cvector_normalize_vector(normalized, vector->dimension);
+        data = normalized;
+    }
+    
+    cvector_write_lock(db);
+    
+    cvector_vector_entry_t* entry = cvector_hash_find(db, vector->id);
+    if (!entry) {
+        cvector_write_unlock(db);
+        free(normalized);
+        return CVECTOR_ERROR_VECTOR_NOT_FOUND;
+    }
+    
+    if (check && entry->version != expected_version) {
+        cvector_write_unlock(db);
+        free(normalized);
+        return CVECTOR_ERROR_VERSION_CONFLICT;
+    }
+    
+    // Write the replacement before tombstoning the old record, so a failed
+    // write leaves the previous vector in place
+    uint64_t file_offset;
+    uint64_t timestamp = cvector_get_timestamp();
+    cvector_error_t err = cvector_check_quota(db, vector->dimension);
+    if (err == CVECTOR_SUCCESS) {
+        err = cvector_append_record(db, vector->id, vector->dimension, entry->version + 1, timestamp, 
+                                    data, &file_offset);
+    }
+    if (err != CVECTOR_SUCCESS) {
+        cvector_write_unlock(db);
+        free(normalized);
+        return err;
+    }
+    
+    uint64_t flag_offset = entry->file_offset + offsetof(cvector_vector_record_t, is_deleted);
+    cvector_invalidate_blocks(db, flag_offset, 1);
+    fseek(db->data_file, flag_offset, SEEK_SET);
+    uint8_t deleted_flag = 1;
+    if (fwrite(&deleted_flag, sizeof(deleted_flag), 1, db->data_file) != 1) {
+        cvector_write_unlock(db);
+        free(normalized);
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    
+    db->deleted_count++;
+    db->dead_bytes += sizeof(cvector_vector_record_t) + entry->dimension * sizeof(float);
+    cvector_cache_remove(&db->cache, vector->id);
+    entry->file_offset = file_offset;
+    entry->dimension = vector->dimension;
+    entry->timestamp = timestamp;
+    entry->version++;
+    
+    if (entry->indexed) {
+        hnsw_remove_vector(db->hnsw_index, vector->id);
+        cvector_set_indexed(db, entry, false);
+    }
+    if (db->hnsw_index && !db->index_building) {
+        err = hnsw_add_vector(db->hnsw_index, vector->id, data);
+        if (err == CVECTOR_SUCCESS) {
+            cvector_set_indexed(db, entry, true);
+        } else {
+            printf("Warning: Failed to re-index vector %llu: %s\n", 
+                   (unsigned long long)vector->id, cvector_error_string(err));
+        }
+    }
+    
+    fflush(db->data_file);
+    cvector_write_unlock(db);
+    
+    free(normalized);
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_update(cvector_db_t* db, const cvector_t* vector) {
+    return cvector_update_checked(db, vector, false, 0);
+}
+
+cvector_error_t cvector_update_if(cvector_db_t* db, const cvector_t* vector, uint32_t expected_version) {
+    return cvector_update_checked(db, vector, true, expected_version);
+}
+
+// Tombstones a live vector. With check set, fails unless the vector is at
+// expected_version.
+static cvector_error_t cvector_delete_checked(cvector_db_t* db, cvector_id_t id,
+                                              bool check, uint32_t expected_version) {
     // Comprehensive input validation
     if (!db) {
         return CVECTOR_ERROR_INVALID_ARGS;
@@ -577,21 +1613,32 @@ cvector_error_t cvector_delete(cvector_db_t* db, cvector_id_t id) {
         return CVECTOR_ERROR_INVALID_ARGS;
     }
     
+    if (db->read_only) {
+        return CVECTOR_ERROR_READ_ONLY;
+    }
+    
     // Thread safety: acquire write lock
-    pthread_mutex_lock(&db->mutex);
+    cvector_write_lock(db);
     
     // Find in hash table
     cvector_vector_entry_t* entry = cvector_hash_find(db, id);
     if (!entry) {
-        pthread_mutex_unlock(&db->mutex);
+        cvector_write_unlock(db);
         return CVECTOR_ERROR_VECTOR_NOT_FOUND;
     }
     
+    if (check && entry->version != expected_version) {
+        cvector_write_unlock(db);
+        return CVECTOR_ERROR_VERSION_CONFLICT;
+    }
+    
     // Mark as deleted in hash table
-    entry->is_deleted = true;
+    bool indexed = entry->indexed;
+    cvector_set_deleted(db, entry, true);
+    cvector_cache_remove(&db->cache, id);
     
     // Remove from HNSW index
-    if (db->hnsw_index) {
+    if (indexed) {
         cvector_error_t hnsw_err = hnsw_remove_vector(db->hnsw_index, id);
         if (hnsw_err != CVECTOR_SUCCESS) {
             printf("Warning: Failed to remove vector %llu from HNSW index: %s\n", 
@@ -600,159 +1647,1021 @@ cvector_error_t cvector_delete(cvector_db_t* db, cvector_id_t id) {
     }
     
     // Mark as deleted in file
-    fseek(db->data_file, entry->file_offset + offsetof(cvector_vector_record_t, is_deleted), SEEK_SET);
+    uint64_t flag_offset = entry->file_offset + offsetof(cvector_vector_record_t, is_deleted);
+    cvector_invalidate_blocks(db, flag_offset, 1);
+    fseek(db->data_file, flag_offset, SEEK_SET);
     uint8_t deleted_flag = 1;
     size_t written = fwrite(&deleted_flag, sizeof(deleted_flag), 1, db->data_file);
     if (written != 1) {
-        pthread_mutex_unlock(&db->mutex);
+        cvector_write_unlock(db);
         return CVECTOR_ERROR_FILE_IO;
     }
     
     db->vector_count--;
+    db->deleted_count++;
+    db->dead_bytes += sizeof(cvector_vector_record_t) + entry->dimension * sizeof(float);
     fflush(db->data_file);
     
     // Thread safety: release write lock
-    pthread_mutex_unlock(&db->mutex);
+    cvector_write_unlock(db);
     
     return CVECTOR_SUCCESS;
 }
 
-cvector_error_t cvector_search(cvector_db_t* db, const cvector_query_t* query, 
-                              cvector_result_t** results, size_t* result_count) {
-    if (!db || !db->is_open || !query || !results || !result_count) {
+cvector_error_t cvector_delete(cvector_db_t* db, cvector_id_t id) {
+    return cvector_delete_checked(db, id, false, 0);
+}
+
+cvector_error_t cvector_delete_if(cvector_db_t* db, cvector_id_t id, uint32_t expected_version) {
+    return cvector_delete_checked(db, id, true, expected_version);
+}
+
+cvector_error_t cvector_undelete(cvector_db_t* db, cvector_id_t id) {
+    if (!db) {
         return CVECTOR_ERROR_INVALID_ARGS;
     }
     
-    if (!query->query_vector || query->dimension != db->config.dimension) {
-        return CVECTOR_ERROR_INVALID_ARGS;
+    if (!db->is_open) {
+        return CVECTOR_ERROR_DB_NOT_FOUND;
     }
     
-    // Validate query parameters
-    if (query->top_k == 0 || query->top_k > 10000) {  // Reasonable limit
+    if (id == 0) {
         return CVECTOR_ERROR_INVALID_ARGS;
     }
     
-    if (query->min_similarity < -1.0f || query->min_similarity > 1.0f) {
-        return CVECTOR_ERROR_INVALID_ARGS;
+    if (db->read_only) {
+        return CVECTOR_ERROR_READ_ONLY;
     }
     
-    // Thread safety: acquire read lock for search operations
-    pthread_rwlock_rdlock(&db->search_lock);
+    cvector_write_lock(db);
     
-    *results = NULL;
-    *result_count = 0;
+    if (cvector_hash_find(db, id)) {
+        cvector_write_unlock(db);
+        return CVECTOR_ERROR_DUPLICATE_ID;
+    }
     
-    // If empty index, return empty results
-    if (db->vector_count == 0) {
-        return CVECTOR_SUCCESS;
+    cvector_vector_entry_t* entry = cvector_hash_find_deleted(db, id);
+    if (!entry) {
+        cvector_write_unlock(db);
+        return CVECTOR_ERROR_VECTOR_NOT_FOUND;
     }
     
-    // Try HNSW search first, fall back to brute force if needed
-    if (db->hnsw_index && db->vector_count > 0) {
-        hnsw_search_result_t* hnsw_result = NULL;
-        cvector_error_t hnsw_err = hnsw_search_with_ef(db->hnsw_index, query->query_vector, 
-                                                       query->top_k, query->top_k * 2, &hnsw_result);
-        
-        if (hnsw_err == CVECTOR_SUCCESS && hnsw_result && hnsw_result->count > 0) {
-            // Convert HNSW results to our format
-            *results = malloc(hnsw_result->count * sizeof(cvector_result_t));
-            if (*results) {
-                *result_count = 0;
-                for (uint32_t i = 0; i < hnsw_result->count && *result_count < query->top_k; i++) {
-                    float similarity = hnsw_result->similarities[i];
-                    
-                    // Apply similarity threshold
-                    if (query->min_similarity == 0.0f || similarity >= query->min_similarity) {
-                        (*results)[*result_count].id = hnsw_result->ids[i];
-                        (*results)[*result_count].similarity = similarity;
-                        (*results)[*result_count].vector = NULL;
-                        (*result_count)++;
-                    }
-                }
-                
-                // Resize results array if needed
-                if (*result_count < hnsw_result->count) {
-                    cvector_result_t* resized = realloc(*results, *result_count * sizeof(cvector_result_t));
-                    if (resized) {
-                        *results = resized;
-                    }
-                }
-                
-                hnsw_free_search_result(hnsw_result);
-                return CVECTOR_SUCCESS;
-            }
-        }
-        
-        if (hnsw_result) {
-            hnsw_free_search_result(hnsw_result);
-        }
-        
-        // If HNSW failed, fall back to brute force
-        printf("HNSW search failed, falling back to brute force\n");
+    if (db->config.max_vectors > 0 && db->vector_count >= db->config.max_vectors) {
+        cvector_write_unlock(db);
+        return CVECTOR_ERROR_DB_FULL;
     }
     
-    // Brute force search fallback
-    size_t max_results = (query->top_k < db->vector_count) ? query->top_k : db->vector_count;
-    cvector_result_t* temp_results = malloc(max_results * sizeof(cvector_result_t));
-    if (!temp_results) {
-        pthread_rwlock_unlock(&db->search_lock);
+    // The tombstoned record still holds the data; read it back for the index
+    float* data = malloc(entry->dimension * sizeof(float));
+    if (!data) {
+        cvector_write_unlock(db);
         return CVECTOR_ERROR_OUT_OF_MEMORY;
     }
+    fseek(db->data_file, entry->file_offset + sizeof(cvector_vector_record_t), SEEK_SET);
+    if (fread(data, sizeof(float), entry->dimension, db->data_file) != entry->dimension) {
+        cvector_write_unlock(db);
+        free(data);
+        return CVECTOR_ERROR_FILE_IO;
+    }
     
-    size_t valid_results = 0;
-    
-    // Iterate through all vectors and calculate similarities
-    for (size_t i = 0; i < db->hash_table_size && valid_results < max_results; i++) {
-        cvector_vector_entry_t* entry = db->hash_table[i];
-        
-        while (entry && valid_results < max_results) {
-            if (!entry->is_deleted) {
-                // Get the vector data
-                cvector_t* vector = NULL;
-                cvector_error_t get_err = cvector_get(db, entry->id, &vector);
-                if (get_err == CVECTOR_SUCCESS && vector) {
-                    // Calculate similarity
-                    float similarity = 0.0f;
-                    switch (query->similarity) {
-                        case CVECTOR_SIMILARITY_COSINE:
-                            similarity = cvector_cosine_similarity(query->query_vector, vector->data, query->dimension);
-                            break;
-                        case CVECTOR_SIMILARITY_DOT_PRODUCT:
-                            similarity = cvector_dot_product(query->query_vector, vector->data, query->dimension);
-                            break;
-                        case CVECTOR_SIMILARITY_EUCLIDEAN:
-                            similarity = -cvector_euclidean_distance(query->query_vector, vector->data, query->dimension);
-                            break;
-                        default:
-                            similarity = 0.0f;
-                    }
-                    
-                    // Check minimum similarity threshold
-                    if (query->min_similarity == 0.0f || similarity >= query->min_similarity) {
-                        temp_results[valid_results].id = entry->id;
-                        temp_results[valid_results].similarity = similarity;
-                        temp_results[valid_results].vector = NULL;
-                        valid_results++;
-                    }
-                    
-                    cvector_free_vector(vector);
-                }
-            }
-            entry = entry->next;
+    bool indexed = false;
+    cvector_error_t err = CVECTOR_SUCCESS;
+    if (db->hnsw_index && !db->index_building) {
+        err = hnsw_add_vector(db->hnsw_index, id, data);
+        if (err == CVECTOR_ERROR_OUT_OF_MEMORY) {
+            cvector_write_unlock(db);
+            free(data);
+            return err;
+        }
+        if (err != CVECTOR_SUCCESS) {
+            printf("Warning: Failed to add vector %llu to HNSW index: %s\n", 
+                   (unsigned long long)id, cvector_error_string(err));
+        }
+        indexed = err == CVECTOR_SUCCESS;
+    }
+    free(data);
+    
+    // Clear the deleted flag in the file
+    uint64_t flag_offset = entry->file_offset + offsetof(cvector_vector_record_t, is_deleted);
+    cvector_invalidate_blocks(db, flag_offset, 1);
+    fseek(db->data_file, flag_offset, SEEK_SET);
+    uint8_t deleted_flag = 0;
+    if (fwrite(&deleted_flag, sizeof(deleted_flag), 1, db->data_file) != 1) {
+        if (indexed) {
+            hnsw_remove_vector(db->hnsw_index, id);
         }
+        cvector_write_unlock(db);
+        return CVECTOR_ERROR_FILE_IO;
     }
     
-    // Sort results by similarity (descending) - only if we have results
-    if (valid_results > 1) {
-        for (size_t i = 0; i < valid_results - 1; i++) {
-            for (size_t j = 0; j < valid_results - i - 1; j++) {
-                if (temp_results[j].similarity < temp_results[j + 1].similarity) {
-                    cvector_result_t temp = temp_results[j];
-                    temp_results[j] = temp_results[j + 1];
-                    temp_results[j + 1] = temp;
+    cvector_set_deleted(db, entry, false);
+    cvector_set_indexed(db, entry, indexed);
+    db->vector_count++;
+    db->deleted_count--;
+    db->dead_bytes -= sizeof(cvector_vector_record_t) + entry->dimension * sizeof(float);
+    
+    fflush(db->data_file);
+    cvector_write_unlock(db);
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_flush(cvector_db_t* db) {
+    if (!db || !db->is_open) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (db->read_only) {
+        return CVECTOR_SUCCESS;
+    }
+    
+    pthread_mutex_lock(&db->mutex);
+    
+    // The header carries the counters and limits written on close; refresh
+    // it so a crash after a flush loses nothing that was flushed
+    cvector_error_t err = cvector_write_header(db);
+    if (err == CVECTOR_SUCCESS && fflush(db->data_file) != 0) {
+        err = CVECTOR_ERROR_FILE_IO;
+    }
+    if (err == CVECTOR_SUCCESS && fsync(fileno(db->data_file)) != 0) {
+        err = CVECTOR_ERROR_FILE_IO;
+    }
+    
+    pthread_mutex_unlock(&db->mutex);
+    return err;
+}
+
+cvector_error_t cvector_set_max_vectors(cvector_db_t* db, size_t max_vectors) {
+    if (!db || !db->is_open) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (db->read_only) {
+        return CVECTOR_ERROR_READ_ONLY;
+    }
+    
+    pthread_mutex_lock(&db->mutex);
+    db->config.max_vectors = max_vectors;
+    cvector_error_t err = cvector_write_header(db);
+    pthread_mutex_unlock(&db->mutex);
+    
+    return err;
+}
+
+// Copies every current live record into a fresh file and swaps it in place
+// of the data file. The hash table is only updated once the new file is in
+// place, so a failure leaves the database as it was. Callers hold the search
+// lock for writing and db->mutex.
+static cvector_error_t cvector_compact_locked(cvector_db_t* db) {
+    char tmp_path[CVECTOR_MAX_PATH + 16];
+    snprintf(tmp_path, sizeof(tmp_path), "%s.compact", db->config.data_path);
+    
+    FILE* out = fopen(tmp_path, "w+b");
+    if (!out) {
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    
+    cvector_vector_entry_t** moved = NULL;
+    uint64_t* offsets = NULL;
+    float* buffer = NULL;
+    size_t moved_count = 0;
+    cvector_error_t err = CVECTOR_SUCCESS;
+    
+    if (db->vector_count > 0) {
+        moved = malloc(db->vector_count * sizeof(*moved));
+        offsets = malloc(db->vector_count * sizeof(*offsets));
+        buffer = malloc(CVECTOR_MAX_DIMENSION * sizeof(float));
+        if (!moved || !offsets || !buffer) {
+            err = CVECTOR_ERROR_OUT_OF_MEMORY;
+        }
+    }
+    
+    // Leave room for the header, written last with the final counts
+    cvector_file_header_t blank = {0};
+    if (err == CVECTOR_SUCCESS && fwrite(&blank, sizeof(blank), 1, out) != 1) {
+        err = CVECTOR_ERROR_FILE_IO;
+    }
+    
+    // Copy in file order so records keep their relative order. A live
+    // record is only kept if the hash table still points at it; earlier
+    // copies left by an interrupted update are dropped with the tombstones.
+    uint64_t offset = sizeof(cvector_file_header_t);
+    fseek(db->data_file, offset, SEEK_SET);
+    while (err == CVECTOR_SUCCESS) {
+        cvector_vector_record_t record;
+        if (fread(&record, sizeof(record), 1, db->data_file) != 1) {
+            break;
+        }
+        // Step by the fixed record size, so a record damaged in a file
+        // opened with CVECTOR_OPEN_SKIP_CORRUPT cannot throw off the rest
+        uint64_t record_start = offset;
+        offset += sizeof(record) + db->config.dimension * sizeof(float);
+        
+        cvector_vector_entry_t* entry = record.is_deleted ? NULL : cvector_hash_find(db, record.id);
+        if (!entry || entry->file_offset != record_start || 
+            record.dimension > CVECTOR_MAX_DIMENSION || moved_count == db->vector_count) {
+            fseek(db->data_file, offset, SEEK_SET);
+            continue;
+        }
+        
+        if (fread(buffer, sizeof(float), record.dimension, db->data_file) != record.dimension) {
+            err = CVECTOR_ERROR_FILE_IO;
+            break;
+        }
+        
+        moved[moved_count] = entry;
+        offsets[moved_count] = (uint64_t)ftell(out);
+        moved_count++;
+        
+        if (fwrite(&record, sizeof(record), 1, out) != 1 ||
+            fwrite(buffer, sizeof(float), record.dimension, out) != record.dimension) {
+            err = CVECTOR_ERROR_FILE_IO;
+        }
+    }
+    free(buffer);
+    
+    if (err == CVECTOR_SUCCESS && moved_count != db->vector_count) {
+        err = CVECTOR_ERROR_DB_CORRUPT;
+    }
+    
+    // Write the header through the new file, then make it durable before
+    // it replaces the old one
+    FILE* old = db->data_file;
+    uint64_t previous_compaction = db->last_compaction;
+    if (err == CVECTOR_SUCCESS) {
+        db->data_file = out;
+        db->last_compaction = (uint64_t)time(NULL);
+        err = cvector_write_header(db);
+        db->data_file = old;
+        if (err == CVECTOR_SUCCESS && (fflush(out) != 0 || fsync(fileno(out)) != 0)) {
+            err = CVECTOR_ERROR_FILE_IO;
+        }
+        if (err == CVECTOR_SUCCESS && rename(tmp_path, db->config.data_path) != 0) {
+            err = CVECTOR_ERROR_FILE_IO;
+        }
+    }
+    
+    if (err != CVECTOR_SUCCESS) {
+        db->last_compaction = previous_compaction;
+        fclose(out);
+        unlink(tmp_path);
+        free(moved);
+        free(offsets);
+        return err;
+    }
+    
+    fclose(old);
+    db->data_file = out;
+    cvector_cache_clear(&db->block_cache);
+    
+    for (size_t i = 0; i < moved_count; i++) {
+        moved[i]->file_offset = offsets[i];
+    }
+    free(moved);
+    free(offsets);
+    
+    // Drop the tombstoned entries that only served to shadow deleted IDs
+    for (size_t i = 0; i < db->hash_table_size; i++) {
+        cvector_vector_entry_t** link = &db->hash_table[i];
+        while (*link) {
+            cvector_vector_entry_t* entry = *link;
+            if (entry->is_deleted) {
+                *link = entry->next;
+                free(entry);
+            } else {
+                link = &entry->next;
+            }
+        }
+    }
+    
+    // Damaged records are not copied, so the file is whole again
+    free(db->unreadable_ids);
+    db->unreadable_ids = NULL;
+    db->unreadable_count = 0;
+    
+    db->deleted_count = 0;
+    db->dead_bytes = 0;
+    db->index_dirty = true;
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_compact(cvector_db_t* db) {
+    if (!db || !db->is_open) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (db->read_only) {
+        return CVECTOR_ERROR_READ_ONLY;
+    }
+    
+    cvector_write_lock(db);
+    cvector_error_t err = cvector_compact_locked(db);
+    cvector_write_unlock(db);
+    
+    return err;
+}
+
+cvector_error_t cvector_snapshot(cvector_db_t* db, const char* dst_path) {
+    if (!db || !db->is_open || !dst_path) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    pthread_mutex_lock(&db->mutex);
+    cvector_error_t err = CVECTOR_SUCCESS;
+    // The copy's header carries the current counts, which the index's
+    // header has to match
+    if (!db->read_only) {
+        err = cvector_write_header(db);
+    }
+    if (err == CVECTOR_SUCCESS && 
+        (fflush(db->data_file) != 0 || !cvector_create_backup(db->config.data_path, dst_path))) {
+        err = CVECTOR_ERROR_FILE_IO;
+    }
+    
+    // The index is optional: without one the copy's first open builds it
+    if (err == CVECTOR_SUCCESS && !db->read_only && db->hnsw_index && db->unindexed_count == 0) {
+        char index_path[CVECTOR_MAX_PATH + 8];
+        cvector_index_path(dst_path, index_path, sizeof(index_path));
+        struct stat st;
+        if (stat(dst_path, &st) != 0 || 
+            cvector_write_index(db, index_path, (uint64_t)st.st_size) != CVECTOR_SUCCESS) {
+            unlink(index_path);
+        }
+    }
+    pthread_mutex_unlock(&db->mutex);
+    
+    return err;
+}
+
+cvector_error_t cvector_set_max_size(cvector_db_t* db, uint64_t max_size_bytes) {
+    if (!db || !db->is_open) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    pthread_mutex_lock(&db->mutex);
+    db->max_size_bytes = max_size_bytes;
+    pthread_mutex_unlock(&db->mutex);
+    
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_set_cache_size(cvector_db_t* db, size_t cache_bytes) {
+    if (!db || !db->is_open) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    pthread_mutex_lock(&db->mutex);
+    cvector_error_t err = cvector_cache_resize(&db->cache, cache_bytes);
+    pthread_mutex_unlock(&db->mutex);
+    
+    return err;
+}
+
+cvector_error_t cvector_set_ef_search(cvector_db_t* db, uint32_t ef_search) {
+    if (!db || !db->is_open || ef_search > CVECTOR_MAX_EF_SEARCH) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    // Searches read it under the search lock
+    cvector_write_lock(db);
+    db->ef_search = ef_search;
+    cvector_write_unlock(db);
+    
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_set_block_cache_size(cvector_db_t* db, size_t cache_bytes) {
+    if (!db || !db->is_open) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    pthread_mutex_lock(&db->mutex);
+    cvector_error_t err = cvector_cache_resize(&db->block_cache, cache_bytes);
+    pthread_mutex_unlock(&db->mutex);
+    
+    return err;
+}
+
+bool cvector_contains(cvector_db_t* db, cvector_id_t id) {
+    if (!db || !db->is_open) {
+        return false;
+    }
+    
+    pthread_mutex_lock(&db->mutex);
+    bool found = cvector_hash_find(db, id) != NULL;
+    pthread_mutex_unlock(&db->mutex);
+    return found;
+}
+
+cvector_error_t cvector_list_ids(cvector_db_t* db, cvector_id_t** ids, size_t* count) {
+    if (!db || !ids || !count) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (!db->is_open) {
+        return CVECTOR_ERROR_DB_NOT_FOUND;
+    }
+    
+    *ids = NULL;
+    *count = 0;
+    
+    pthread_mutex_lock(&db->mutex);
+    
+    // Count live entries first so the output can be allocated in one go
+    size_t live = 0;
+    for (size_t i = 0; i < db->hash_table_size; i++) {
+        for (cvector_vector_entry_t* entry = db->hash_table[i]; entry; entry = entry->next) {
+            if (!entry->is_deleted) {
+                live++;
+            }
+        }
+    }
+    
+    if (live == 0) {
+        pthread_mutex_unlock(&db->mutex);
+        return CVECTOR_SUCCESS;
+    }
+    
+    cvector_id_t* out = malloc(live * sizeof(cvector_id_t));
+    if (!out) {
+        pthread_mutex_unlock(&db->mutex);
+        return CVECTOR_ERROR_OUT_OF_MEMORY;
+    }
+    
+    size_t n = 0;
+    for (size_t i = 0; i < db->hash_table_size && n < live; i++) {
+        for (cvector_vector_entry_t* entry = db->hash_table[i]; entry && n < live; entry = entry->next) {
+            if (!entry->is_deleted) {
+                out[n++] = entry->id;
+            }
+        }
+    }
+    
+    pthread_mutex_unlock(&db->mutex);
+    
+    // Hash table order is arbitrary; callers expect a stable listing
+    qsort(out, n, sizeof(cvector_id_t), cvector_compare_ids);
+    
+    *ids = out;
+    *count = n;
+    return CVECTOR_SUCCESS;
+}
+
+typedef struct {
+    uint64_t timestamp;
+    cvector_id_t id;
+} cvector_timed_id_t;
+
+static int cvector_compare_timed_ids(const void* a, const void* b) {
+    const cvector_timed_id_t* ta = a;
+    const cvector_timed_id_t* tb = b;
+    if (ta->timestamp != tb->timestamp) {
+        return (ta->timestamp > tb->timestamp) - (ta->timestamp < tb->timestamp);
+    }
+    return (ta->id > tb->id) - (ta->id < tb->id);
+}
+
+cvector_error_t cvector_list_ids_by_time(cvector_db_t* db, uint64_t from, uint64_t to, 
+                                        cvector_id_t** ids, size_t* count) {
+    if (!db || !ids || !count) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (!db->is_open) {
+        return CVECTOR_ERROR_DB_NOT_FOUND;
+    }
+    
+    *ids = NULL;
+    *count = 0;
+    
+    cvector_timed_id_t* matches = NULL;
+    size_t n = 0;
+    size_t capacity = 0;
+    
+    pthread_mutex_lock(&db->mutex);
+    for (size_t i = 0; i < db->hash_table_size; i++) {
+        for (cvector_vector_entry_t* entry = db->hash_table[i]; entry; entry = entry->next) {
+            if (entry->is_deleted || entry->timestamp < from || (to != 0 && entry->timestamp >= to)) {
+                continue;
+            }
+            if (n == capacity) {
+                size_t new_capacity = capacity ? capacity * 2 : 64;
+                cvector_timed_id_t* grown = realloc(matches, new_capacity * sizeof(*matches));
+                if (!grown) {
+                    pthread_mutex_unlock(&db->mutex);
+                    free(matches);
+                    return CVECTOR_ERROR_OUT_OF_MEMORY;
+                }
+                matches = grown;
+                capacity = new_capacity;
+            }
+            matches[n].timestamp = entry->timestamp;
+            matches[n].id = entry->id;
+            n++;
+        }
+    }
+    pthread_mutex_unlock(&db->mutex);
+    
+    if (n == 0) {
+        free(matches);
+        return CVECTOR_SUCCESS;
+    }
+    
+    qsort(matches, n, sizeof(*matches), cvector_compare_timed_ids);
+    
+    cvector_id_t* out = malloc(n * sizeof(cvector_id_t));
+    if (!out) {
+        free(matches);
+        return CVECTOR_ERROR_OUT_OF_MEMORY;
+    }
+    for (size_t i = 0; i < n; i++) {
+        out[i] = matches[i].id;
+    }
+    free(matches);
+    
+    *ids = out;
+    *count = n;
+    return CVECTOR_SUCCESS;
+}
+
+void cvector_free_ids(cvector_id_t* ids) {
+    free(ids);
+}
+
+// One live vector as of the view's opening. id comes first so the entries
+// sort with cvector_compare_ids.
+typedef struct {
+    cvector_id_t id;
+    uint64_t file_offset;
+    uint32_t version;
+} cvector_view_entry_t;
+
+struct cvector_view {
+    int fd;                         // Duplicate of the data file descriptor
+    cvector_view_entry_t* entries;  // Ordered by ID
+    size_t count;
+};
+
+cvector_error_t cvector_view_open(cvector_db_t* db, cvector_view_t** view) {
+    if (!db || !view) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (!db->is_open) {
+        return CVECTOR_ERROR_DB_NOT_FOUND;
+    }
+    
+    cvector_view_t* v = calloc(1, sizeof(cvector_view_t));
+    if (!v) {
+        return CVECTOR_ERROR_OUT_OF_MEMORY;
+    }
+    
+    pthread_mutex_lock(&db->mutex);
+    
+    // Records are never rewritten in place apart from their deleted flag,
+    // which the view ignores, and compaction renames a new file over the
+    // old one. Holding its own descriptor keeps the file as it is now
+    // readable for as long as the view is open.
+    cvector_error_t err = CVECTOR_SUCCESS;
+    if (!db->read_only && fflush(db->data_file) != 0) {
+        err = CVECTOR_ERROR_FILE_IO;
+    }
+    v->fd = err == CVECTOR_SUCCESS ? dup(fileno(db->data_file)) : -1;
+    if (err == CVECTOR_SUCCESS && v->fd < 0) {
+        err = CVECTOR_ERROR_FILE_IO;
+    }
+    
+    if (err == CVECTOR_SUCCESS && db->vector_count > 0) {
+        v->entries = malloc(db->vector_count * sizeof(cvector_view_entry_t));
+        if (!v->entries) {
+            err = CVECTOR_ERROR_OUT_OF_MEMORY;
+        }
+    }
+    
+    for (size_t i = 0; err == CVECTOR_SUCCESS && i < db->hash_table_size; i++) {
+        for (cvector_vector_entry_t* entry = db->hash_table[i]; entry; entry = entry->next) {
+            if (!entry->is_deleted && v->count < db->vector_count) {
+                v->entries[v->count].id = entry->id;
+                v->entries[v->count].file_offset = entry->file_offset;
+                v->entries[v->count].version = entry->version;
+                v->count++;
+            }
+        }
+    }
+    
+    pthread_mutex_unlock(&db->mutex);
+    
+    if (err != CVECTOR_SUCCESS) {
+        cvector_view_close(v);
+        return err;
+    }
+    
+    qsort(v->entries, v->count, sizeof(cvector_view_entry_t), cvector_compare_ids);
+    *view = v;
+    return CVECTOR_SUCCESS;
+}
+
+size_t cvector_view_count(const cvector_view_t* view) {
+    return view ? view->count : 0;
+}
+
+cvector_error_t cvector_view_get(const cvector_view_t* view, size_t index, cvector_t** vector) {
+    if (!view || !vector || index >= view->count) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    const cvector_view_entry_t* entry = &view->entries[index];
+    cvector_vector_record_t record;
+    if (pread(view->fd, &record, sizeof(record), (off_t)entry->file_offset) != (ssize_t)sizeof(record)) {
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    if (record.id != entry->id || record.dimension == 0 || record.dimension > CVECTOR_MAX_DIMENSION) {
+        return CVECTOR_ERROR_DB_CORRUPT;
+    }
+    
+    cvector_t* result = malloc(sizeof(cvector_t));
+    if (!result) {
+        return CVECTOR_ERROR_OUT_OF_MEMORY;
+    }
+    size_t data_bytes = record.dimension * sizeof(float);
+    result->data = malloc(data_bytes);
+    if (!result->data) {
+        free(result);
+        return CVECTOR_ERROR_OUT_OF_MEMORY;
+    }
+    
+    if (pread(view->fd, result->data, data_bytes, (off_t)(entry->file_offset + sizeof(record))) != (ssize_t)data_bytes) {
+        free(result->data);
+        free(result);
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    
+    result->id = record.id;
+    result->dimension = record.dimension;
+    result->timestamp = record.timestamp;
+    result->version = entry->version;
+    *vector = result;
+    return CVECTOR_SUCCESS;
+}
+
+void cvector_view_close(cvector_view_t* view) {
+    if (view) {
+        if (view->fd >= 0) {
+            close(view->fd);
+        }
+        free(view->entries);
+        free(view);
+    }
+}
+
+static float cvector_score(cvector_similarity_t similarity, const float* a, const float* b, 
+                           uint32_t dimension) {
+    switch (similarity) {
+        case CVECTOR_SIMILARITY_COSINE:
+            return cvector_cosine_similarity(a, b, dimension);
+        case CVECTOR_SIMILARITY_DOT_PRODUCT:
+            return cvector_dot_product(a, b, dimension);
+        case CVECTOR_SIMILARITY_EUCLIDEAN:
+            return -cvector_euclidean_distance(a, b, dimension);
+        default:
+            return 0.0f;
+    }
+}
+
+// Resolves the vector and metric a query is scored with. Queries asking for
+// normalization get a unit-length copy in *owned, which the caller frees.
+// Cosine queries against a normalized database are normalized too, and then
+// scored as dot products since both sides have unit length.
+static cvector_error_t cvector_prepare_query(const cvector_db_t* db, const cvector_query_t* query, 
+                                             const float** vector, float** owned, 
+                                             cvector_similarity_t* similarity) {
+    *vector = query->query_vector;
+    *owned = NULL;
+    *similarity = query->similarity;
+    
+    bool unit_vectors = db->config.normalize_on_insert && query->similarity == CVECTOR_SIMILARITY_COSINE;
+    if (!query->normalize && !unit_vectors) {
+        return CVECTOR_SUCCESS;
+    }
+    
+    *owned = malloc(query->dimension * sizeof(float));
+    if (!*owned) {
+        return CVECTOR_ERROR_OUT_OF_MEMORY;
+    }
+    memcpy(*owned, query->query_vector, query->dimension * sizeof(float));
+    cvector_normalize_vector(*owned, query->dimension);
+    *vector = *owned;
+    
+    if (unit_vectors) {
+        *similarity = CVECTOR_SIMILARITY_DOT_PRODUCT;
+    }
+    return CVECTOR_SUCCESS;
+}
+
+static int cvector_compare_results(const void* a, const void* b) {
+    const cvector_result_t* ra = a;
+    const cvector_result_t* rb = b;
+    if (ra->similarity > rb->similarity) return -1;
+    if (ra->similarity < rb->similarity) return 1;
+    return (ra->id > rb->id) - (ra->id < rb->id);
+}
+
+// Appends a match to a growable result array
+static cvector_error_t cvector_results_append(cvector_result_t** results, size_t* count, 
+                                              size_t* capacity, cvector_id_t id, float similarity) {
+    if (*count == *capacity) {
+        size_t new_capacity = *capacity ? *capacity * 2 : 64;
+        cvector_result_t* grown = realloc(*results, new_capacity * sizeof(cvector_result_t));
+        if (!grown) {
+            return CVECTOR_ERROR_OUT_OF_MEMORY;
+        }
+        *results = grown;
+        *capacity = new_capacity;
+    }
+    (*results)[*count].id = id;
+    (*results)[*count].similarity = similarity;
+    (*results)[*count].vector = NULL;
+    (*count)++;
+    return CVECTOR_SUCCESS;
+}
+
+static uint64_t cvector_get_monotonic_ns(void) {
+    struct timespec ts;
+    clock_gettime(CLOCK_MONOTONIC, &ts);
+    return (uint64_t)ts.tv_sec * 1000000000ULL + (uint64_t)ts.tv_nsec;
+}
+
+// Scores the live vectors, or only those missing from the index, against
+// query_vector and appends those meeting the query's threshold to matches.
+// The caller holds search_lock.
+static cvector_error_t cvector_scan(cvector_db_t* db, const cvector_query_t* query, 
+                                    const float* query_vector, cvector_similarity_t similarity_type, 
+                                    bool unindexed_only, cvector_result_t** matches, size_t* count, 
+                                    size_t* capacity, cvector_search_stats_t* stats) {
+    cvector_error_t append_err = CVECTOR_SUCCESS;
+    
+    // Iterate through all vectors and calculate similarities
+    for (size_t i = 0; i < db->hash_table_size && append_err == CVECTOR_SUCCESS; i++) {
+        cvector_vector_entry_t* entry = db->hash_table[i];
+        
+        while (entry && append_err == CVECTOR_SUCCESS) {
+            if (!entry->is_deleted && !(unindexed_only && entry->indexed)) {
+                // Get the vector data
+                cvector_t* vector = NULL;
+                uint64_t io_start = cvector_get_monotonic_ns();
+                cvector_error_t get_err = cvector_get(db, entry->id, &vector);
+                uint64_t scoring_start = cvector_get_monotonic_ns();
+                stats->io_ns += scoring_start - io_start;
+                if (get_err == CVECTOR_SUCCESS && vector) {
+                    // Calculate similarity
+                    float similarity = cvector_score(similarity_type, query_vector, 
+                                                     vector->data, query->dimension);
+                    stats->scoring_ns += cvector_get_monotonic_ns() - scoring_start;
+                    stats->candidates_scanned++;
+                    stats->threshold_checked++;
+                    
+                    // Check minimum similarity threshold
+                    if (query->min_similarity == 0.0f || similarity >= query->min_similarity) {
+                        append_err = cvector_results_append(matches, count, capacity, 
+                                                            entry->id, similarity);
+                    } else {
+                        stats->threshold_rejected++;
+                    }
+                    
+                    cvector_free_vector(vector);
+                }
+            }
+            entry = entry->next;
+        }
+    }
+    return append_err;
+}
+
+cvector_error_t cvector_search_radius(cvector_db_t* db, const cvector_query_t* query, 
+                                     cvector_result_t** results, size_t* result_count) {
+    if (!db || !db->is_open || !query || !results || !result_count) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (!query->query_vector || query->dimension != db->config.dimension) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (!cvector_is_finite(query->query_vector, query->dimension)) {
+        return CVECTOR_ERROR_INVALID_VECTOR_DATA;
+    }
+    
+    *results = NULL;
+    *result_count = 0;
+    
+    const float* query_vector;
+    float* normalized;
+    cvector_similarity_t similarity_type;
+    cvector_error_t err = cvector_prepare_query(db, query, &query_vector, &normalized, &similarity_type);
+    if (err != CVECTOR_SUCCESS) {
+        return err;
+    }
+    
+    cvector_result_t* matches = NULL;
+    size_t count = 0;
+    size_t capacity = 0;
+    
+    // Holding the write mutex keeps inserts and deletes out for the whole scan
+    pthread_mutex_lock(&db->mutex);
+    
+    // The index caches every vector in memory; use it unless some inserts
+    // failed to reach it, in which case only the data file is complete
+    hnsw_index_t* index = db->hnsw_index;
+    if (index && index->insert_count - index->delete_count == db->vector_count) {
+        for (uint32_t i = 0; i < index->node_count && err == CVECTOR_SUCCESS; i++) {
+            hnsw_node_t* node = index->nodes[i];
+            if (!node) continue;
+            
+            float similarity = cvector_score(similarity_type, query_vector, 
+                                             node->vector_data, query->dimension);
+            if (similarity >= query->min_similarity) {
+                err = cvector_results_append(&matches, &count, &capacity, node->id, similarity);
+            }
+        }
+    } else {
+        for (size_t i = 0; i < db->hash_table_size && err == CVECTOR_SUCCESS; i++) {
+            for (cvector_vector_entry_t* entry = db->hash_table[i]; 
+                 entry && err == CVECTOR_SUCCESS; entry = entry->next) {
+                if (entry->is_deleted) continue;
+                
+                cvector_t* vector = NULL;
+                err = cvector_read_vector(db, entry->id, &vector);
+                if (err != CVECTOR_SUCCESS) break;
+                
+                float similarity = cvector_score(similarity_type, query_vector, 
+                                                 vector->data, query->dimension);
+                cvector_free_vector(vector);
+                if (similarity >= query->min_similarity) {
+                    err = cvector_results_append(&matches, &count, &capacity, entry->id, similarity);
+                }
+            }
+        }
+    }
+    
+    pthread_mutex_unlock(&db->mutex);
+    free(normalized);
+    
+    if (err != CVECTOR_SUCCESS) {
+        free(matches);
+        return err;
+    }
+    
+    if (count > 1) {
+        qsort(matches, count, sizeof(cvector_result_t), cvector_compare_results);
+    }
+    if (query->top_k > 0 && count > query->top_k) {
+        count = query->top_k;
+    }
+    
+    *results = matches;
+    *result_count = count;
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_search(cvector_db_t* db, const cvector_query_t* query, 
+                              cvector_result_t** results, size_t* result_count) {
+    return cvector_search_explain(db, query, results, result_count, NULL);
+}
+
+cvector_error_t cvector_search_explain(cvector_db_t* db, const cvector_query_t* query, 
+                                      cvector_result_t** results, size_t* result_count,
+                                      cvector_search_stats_t* stats) {
+    if (!db || !db->is_open || !query || !results || !result_count) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (!query->query_vector || query->dimension != db->config.dimension) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (!cvector_is_finite(query->query_vector, query->dimension)) {
+        return CVECTOR_ERROR_INVALID_VECTOR_DATA;
+    }
+    
+    // Validate query parameters
+    if (query->top_k == 0 || query->top_k > 10000) {  // Reasonable limit
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (query->min_similarity < -1.0f || query->min_similarity > 1.0f) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (query->ef_search > CVECTOR_MAX_EF_SEARCH) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    // Diagnostics are always collected; callers that don't want them pass NULL
+    cvector_search_stats_t local_stats;
+    if (!stats) {
+        stats = &local_stats;
+    }
+    memset(stats, 0, sizeof(*stats));
+    uint64_t search_start = cvector_get_monotonic_ns();
+    
+    const float* query_vector;
+    float* normalized;
+    cvector_similarity_t similarity_type;
+    cvector_error_t prepare_err = cvector_prepare_query(db, query, &query_vector, &normalized, &similarity_type);
+    if (prepare_err != CVECTOR_SUCCESS) {
+        return prepare_err;
+    }
+    
+    // Thread safety: acquire read lock for search operations
+    pthread_rwlock_rdlock(&db->search_lock);
+    
+    *results = NULL;
+    *result_count = 0;
+    
+    // If empty index, return empty results
+    if (db->vector_count == 0) {
+        pthread_rwlock_unlock(&db->search_lock);
+        free(normalized);
+        stats->total_ns = cvector_get_monotonic_ns() - search_start;
+        return CVECTOR_SUCCESS;
+    }
+    
+    cvector_result_t* matches = NULL;
+    size_t valid_results = 0;
+    size_t capacity = 0;
+    cvector_error_t append_err = CVECTOR_SUCCESS;
+    bool answered = false;
+    
+    // Try HNSW search first, fall back to brute force if needed. While the
+    // index is still being built it can be empty, which needs no fallback.
+    if (db->hnsw_index && db->unindexed_count < db->vector_count) {
+        // The query's candidate list size wins over the database's, and
+        // the list must hold top_k results
+        uint32_t ef = query->ef_search ? query->ef_search : db->ef_search;
+        if (ef == 0) {
+            ef = query->top_k * 2;
+        }
+        if (ef < query->top_k) {
+            ef = query->top_k;
+        }
+        
+        hnsw_search_result_t* hnsw_result = NULL;
+        uint64_t index_start = cvector_get_monotonic_ns();
+        cvector_error_t hnsw_err = hnsw_search_with_ef(db->hnsw_index, query_vector, 
+                                                       query->top_k, ef, &hnsw_result);
+        
+        if (hnsw_err == CVECTOR_SUCCESS && hnsw_result && hnsw_result->count > 0) {
+            // The index holds vectors in memory, so traversal time is all scoring
+            stats->used_index = true;
+            stats->scoring_ns = cvector_get_monotonic_ns() - index_start;
+            stats->index_nodes_visited = hnsw_result->nodes_visited;
+            stats->candidates_scanned = hnsw_result->distance_computations;
+            stats->ef_search = ef;
+            
+            // Convert HNSW results to our format
+            for (uint32_t i = 0; i < hnsw_result->count && append_err == CVECTOR_SUCCESS; i++) {
+                float similarity = hnsw_result->similarities[i];
+                stats->threshold_checked++;
+                
+                // Apply similarity threshold
+                if (query->min_similarity == 0.0f || similarity >= query->min_similarity) {
+                    append_err = cvector_results_append(&matches, &valid_results, &capacity, 
+                                                        hnsw_result->ids[i], similarity);
+                } else {
+                    stats->threshold_rejected++;
                 }
             }
+            answered = true;
+        }
+        
+        if (hnsw_result) {
+            hnsw_free_search_result(hnsw_result);
         }
+        
+        if (!answered) {
+            // If HNSW failed, fall back to brute force
+            memset(stats, 0, sizeof(*stats));
+            printf("HNSW search failed, falling back to brute force\n");
+            stats->index_fallback = true;
+        }
+    }
+    
+    // Brute force search: score every vector, or with index results in hand
+    // only those the index is missing, then keep the best top_k, ordered
+    // like the index results with ties broken by ID
+    if (append_err == CVECTOR_SUCCESS && (!answered || db->unindexed_count > 0)) {
+        append_err = cvector_scan(db, query, query_vector, similarity_type, answered, 
+                                  &matches, &valid_results, &capacity, stats);
+    }
+    
+    if (append_err != CVECTOR_SUCCESS) {
+        free(matches);
+        pthread_rwlock_unlock(&db->search_lock);
+        free(normalized);
+        return append_err;
+    }
+    
+    if (valid_results > 1) {
+        qsort(matches, valid_results, sizeof(cvector_result_t), cvector_compare_results);
     }
     
     // Limit to top_k results
@@ -761,24 +2670,28 @@ cvector_error_t cvector_search(cvector_db_t* db, const cvector_query_t* query,
     }
     
     if (valid_results == 0) {
-        free(temp_results);
+        free(matches);
         pthread_rwlock_unlock(&db->search_lock);
+        free(normalized);
+        stats->total_ns = cvector_get_monotonic_ns() - search_start;
         return CVECTOR_SUCCESS;
     }
     
     // Resize results array to actual size
-    if (valid_results < max_results) {
-        cvector_result_t* final_results = realloc(temp_results, valid_results * sizeof(cvector_result_t));
+    if (valid_results < capacity) {
+        cvector_result_t* final_results = realloc(matches, valid_results * sizeof(cvector_result_t));
         if (final_results) {
-            temp_results = final_results;
+            matches = final_results;
         }
     }
     
-    *results = temp_results;
+    *results = matches;
     *result_count = valid_results;
     
     // Thread safety: release read lock
     pthread_rwlock_unlock(&db->search_lock);
+    free(normalized);
+    stats->total_ns = cvector_get_monotonic_ns() - search_start;
     
     return CVECTOR_SUCCESS;
 }
@@ -805,6 +2718,7 @@ cvector_error_t cvector_create_vector(cvector_id_t id, uint32_t dimension,
     v->id = id;
     v->dimension = dimension;
     v->timestamp = cvector_get_timestamp();
+    v->version = 0;
     memcpy(v->data, data, dimension * sizeof(float));
     
     *vector = v;
@@ -839,6 +2753,15 @@ const char* cvector_error_string(cvector_error_t error) {
         case CVECTOR_ERROR_VECTOR_NOT_FOUND: return "Vector not found";
         case CVECTOR_ERROR_DIMENSION_MISMATCH: return "Dimension mismatch";
         case CVECTOR_ERROR_DB_CORRUPT: return "Database corrupt";
+        case CVECTOR_ERROR_INVALID_VECTOR_DATA: return "Invalid vector data";
+        case CVECTOR_ERROR_DB_FULL: return "Database full";
+        case CVECTOR_ERROR_DUPLICATE_ID: return "Duplicate vector ID";
+        case CVECTOR_ERROR_READ_ONLY: return "Database is read-only";
+        case CVECTOR_ERROR_VERSION_TOO_NEW: return "Database file format is newer than this build supports";
+        case CVECTOR_ERROR_NEEDS_MIGRATION: return "Database file format is outdated and must be migrated";
+        case CVECTOR_ERROR_QUOTA_EXCEEDED: return "Database size quota exceeded";
+        case CVECTOR_ERROR_VERSION_CONFLICT: return "Vector version does not match";
+        case CVECTOR_ERROR_LOCKED: return "Database is locked by another process";
         default: return "Unknown error";
     }
 }
@@ -849,14 +2772,529 @@ cvector_error_t cvector_db_stats(cvector_db_t* db, cvector_db_stats_t* stats) {
     }
     
     stats->total_vectors = db->vector_count;
+    stats->next_id = db->next_id;
     stats->dimension = db->config.dimension;
     stats->default_similarity = db->config.default_similarity;
     strncpy(stats->db_path, db->config.data_path, sizeof(stats->db_path) - 1);
     stats->db_path[sizeof(stats->db_path) - 1] = '\0';
     
     // Calculate total size
+    pthread_mutex_lock(&db->mutex);
     fseek(db->data_file, 0, SEEK_END);
     stats->total_size_bytes = ftell(db->data_file);
+    stats->cache_capacity_bytes = db->cache.capacity_bytes;
+    stats->cache_used_bytes = db->cache.used_bytes;
+    stats->cache_entries = db->cache.entry_count;
+    stats->cache_hits = db->cache.hits;
+    stats->cache_misses = db->cache.misses;
+    stats->block_cache_capacity_bytes = db->block_cache.capacity_bytes;
+    stats->block_cache_used_bytes = db->block_cache.used_bytes;
+    stats->block_cache_hits = db->block_cache.hits;
+    stats->block_cache_misses = db->block_cache.misses;
+    pthread_mutex_unlock(&db->mutex);
+    
+    stats->deleted_vectors = db->deleted_count;
+    stats->unreadable_records = db->unreadable_count;
+    stats->reclaimable_bytes = db->dead_bytes;
+    stats->fragmentation = 0.0f;
+    if (stats->total_size_bytes > sizeof(cvector_file_header_t)) {
+        size_t record_bytes = stats->total_size_bytes - sizeof(cvector_file_header_t);
+        stats->fragmentation = 100.0f * (float)db->dead_bytes / (float)record_bytes;
+    }
+    
+    stats->index_enabled = db->hnsw_index != NULL;
+    stats->indexed_vectors = 0;
+    if (db->hnsw_index) {
+        stats->indexed_vectors = db->hnsw_index->insert_count - db->hnsw_index->delete_count;
+    }
+    stats->unindexed_vectors = db->unindexed_count;
+    stats->index_building = db->index_building;
+    stats->index_loaded = db->index_loaded;
+    stats->ef_search = db->ef_search;
+    
+    stats->memory_mapped = db->config.memory_mapped;
+    stats->normalize_on_insert = db->config.normalize_on_insert;
+    stats->max_vectors = db->config.max_vectors;
+    stats->max_size_bytes = db->max_size_bytes;
+    stats->last_compaction = db->last_compaction;
+    
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_memory_usage(cvector_db_t* db, cvector_memory_usage_t* usage) {
+    if (!db || !db->is_open || !usage) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    memset(usage, 0, sizeof(*usage));
+    
+    pthread_mutex_lock(&db->mutex);
+    
+    usage->database_bytes = sizeof(struct cvector_db);
+    
+    usage->lookup_table_bytes = db->hash_table_size * sizeof(cvector_vector_entry_t*);
+    for (size_t i = 0; i < db->hash_table_size; i++) {
+        for (cvector_vector_entry_t* entry = db->hash_table[i]; entry; entry = entry->next) {
+            usage->lookup_table_bytes += sizeof(cvector_vector_entry_t);
+        }
+    }
+    
+    usage->cache_bytes = db->cache.used_bytes + db->cache.bucket_count * sizeof(cvector_cache_entry_t*);
+    usage->block_cache_bytes = db->block_cache.used_bytes + 
+                               db->block_cache.bucket_count * sizeof(cvector_cache_entry_t*);
+    
+    // Every open stream gets a default-sized stdio buffer
+    FILE* files[] = { db->data_file, db->index_file, db->metadata_file };
+    for (size_t i = 0; i < sizeof(files) / sizeof(files[0]); i++) {
+        if (files[i]) {
+            usage->io_buffer_bytes += BUFSIZ;
+        }
+    }
+    
+    // Records are read through stdio; nothing is mapped yet even when
+    // memory_mapped is requested
+    usage->mapped_bytes = 0;
+    
+    pthread_mutex_unlock(&db->mutex);
+    
+    if (db->hnsw_index) {
+        hnsw_memory_usage_t index_usage;
+        cvector_error_t err = hnsw_get_memory_usage(db->hnsw_index, &index_usage);
+        if (err != CVECTOR_SUCCESS) {
+            return err;
+        }
+        usage->index_structure_bytes = index_usage.structure_bytes;
+        usage->index_graph_bytes = index_usage.graph_bytes;
+        usage->index_vector_bytes = index_usage.vector_bytes;
+    }
+    
+    usage->total_bytes = usage->database_bytes + usage->lookup_table_bytes + 
+                         usage->index_structure_bytes + usage->index_graph_bytes + 
+                         usage->index_vector_bytes + usage->io_buffer_bytes + 
+                         usage->mapped_bytes + usage->cache_bytes + usage->block_cache_bytes;
+    
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_file_info(const char* db_path, cvector_file_info_t* info) {
+    if (!db_path || !info) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    memset(info, 0, sizeof(*info));
+    
+    FILE* file = fopen(db_path, "rb");
+    if (!file) {
+        return CVECTOR_ERROR_DB_NOT_FOUND;
+    }
+    
+    cvector_file_header_t header;
+    if (fread(&header, sizeof(header), 1, file) != 1) {
+        fclose(file);
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    
+    if (header.magic != CVECTOR_MAGIC_NUMBER || header.version < CVECTOR_FILE_VERSION_MIN) {
+        fclose(file);
+        return CVECTOR_ERROR_DB_CORRUPT;
+    }
+    if (header.version > CVECTOR_FILE_VERSION) {
+        fclose(file);
+        return CVECTOR_ERROR_VERSION_TOO_NEW;
+    }
+    
+    // Record layout is unchanged since version 1, so older files can be
+    // inspected before they are migrated
+    info->format_version = header.version;
+    info->dimension = header.dimension;
+    info->default_similarity = header.default_similarity;
+    
+    // Walk record headers only; the header's vector count is just written on
+    // close and is stale while a writer has the file open
+    cvector_vector_record_t record;
+    while (fread(&record, sizeof(record), 1, file) == 1) {
+        if (fseek(file, (long)record.dimension * sizeof(float), SEEK_CUR) != 0) {
+            break;
+        }
+        if (record.is_deleted) {
+            info->deleted_records++;
+        } else {
+            info->live_records++;
+        }
+        // Inserts write version 1, or 0 before format version 3
+        if (record.version > 1) {
+            info->updated_records++;
+        }
+    }
+    
+    fseek(file, 0, SEEK_END);
+    info->file_size_bytes = ftell(file);
     
+    fclose(file);
     return CVECTOR_SUCCESS;
-}
\ No newline at end of file
+}
+
+// Reads the record at offset and fills info, checksumming the raw bytes
+static cvector_error_t cvector_describe_at(cvector_db_t* db, uint64_t offset, cvector_record_info_t* info) {
+    cvector_vector_record_t record;
+    
+    fseek(db->data_file, offset, SEEK_SET);
+    if (fread(&record, sizeof(record), 1, db->data_file) != 1) {
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    
+    uint32_t crc = cvector_crc32(0, &record, sizeof(record));
+    float buffer[256];
+    uint32_t remaining = record.dimension;
+    while (remaining > 0) {
+        uint32_t chunk = remaining < 256 ? remaining : 256;
+        if (fread(buffer, sizeof(float), chunk, db->data_file) != chunk) {
+            return CVECTOR_ERROR_DB_CORRUPT;
+        }
+        crc = cvector_crc32(crc, buffer, chunk * sizeof(float));
+        remaining -= chunk;
+    }
+    
+    info->id = record.id;
+    info->file_offset = offset;
+    info->record_length = sizeof(record) + (uint64_t)record.dimension * sizeof(float);
+    info->dimension = record.dimension;
+    info->timestamp = record.timestamp;
+    info->is_deleted = record.is_deleted != 0;
+    info->version = record.version ? record.version : 1;
+    info->checksum = crc;
+    info->format_version = CVECTOR_FILE_VERSION;
+    
+    return CVECTOR_SUCCESS;
+}
+
+cvector_error_t cvector_describe(cvector_db_t* db, cvector_id_t id, cvector_record_info_t* info) {
+    if (!db || !info) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    if (!db->is_open) {
+        return CVECTOR_ERROR_DB_NOT_FOUND;
+    }
+    
+    pthread_mutex_lock(&db->mutex);
+    
+    // Prefer the live record over the tombstone of a deleted one
+    cvector_vector_entry_t* entry = cvector_hash_find(db, id);
+    if (!entry) {
+        entry = cvector_hash_find_deleted(db, id);
+    }
+    
+    // Every readable record is in the hash table, live or as its ID's
+    // newest tombstone. Only records a skip-corrupt open left out are not,
+    // and those are reported as damaged, as cvector_get reports them.
+    cvector_error_t err = CVECTOR_ERROR_VECTOR_NOT_FOUND;
+    if (entry) {
+        err = cvector_describe_at(db, entry->file_offset, info);
+    } else if (db->unreadable_count > 0 && 
+               bsearch(&id, db->unreadable_ids, db->unreadable_count, sizeof(cvector_id_t), cvector_compare_ids)) {
+        err = CVECTOR_ERROR_DB_CORRUPT;
+    }
+    
+    pthread_mutex_unlock(&db->mutex);
+    return err;
+}
+
+// Upgrades header from version to version + 1. Each step only rewrites what
+// its version changed; records are untouched while their layout stays put.
+static cvector_error_t cvector_migrate_step(cvector_file_header_t* header) {
+    switch (header->version) {
+        case 1:
+            // Version 2 gives meaning to the flags and max_vectors bytes.
+            // Version 1 always wrote them as zero, which reads as no flags
+            // and no limit, so only the version changes.
+            header->version = 2;
+            return CVECTOR_SUCCESS;
+        case 2:
+            // Version 3 stores a per-vector version in bytes that version 2
+            // reserved and wrote as zero. Loading reads zero as the first
+            // version, so records stay as they are.
+            header->version = 3;
+            return CVECTOR_SUCCESS;
+        default:
+            return CVECTOR_ERROR_DB_CORRUPT;
+    }
+}
+
+cvector_error_t cvector_migrate(const char* db_path, const char* backup_path, uint32_t* from_version) {
+    if (!db_path) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    FILE* file = fopen(db_path, "r+b");
+    if (!file) {
+        return cvector_file_exists(db_path) ? CVECTOR_ERROR_FILE_IO : CVECTOR_ERROR_DB_NOT_FOUND;
+    }
+    
+    cvector_file_header_t header;
+    if (fread(&header, sizeof(header), 1, file) != 1) {
+        fclose(file);
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    
+    if (header.magic != CVECTOR_MAGIC_NUMBER || header.version < CVECTOR_FILE_VERSION_MIN) {
+        fclose(file);
+        return CVECTOR_ERROR_DB_CORRUPT;
+    }
+    if (header.version > CVECTOR_FILE_VERSION) {
+        fclose(file);
+        return CVECTOR_ERROR_VERSION_TOO_NEW;
+    }
+    if (from_version) {
+        *from_version = header.version;
+    }
+    if (header.version == CVECTOR_FILE_VERSION) {
+        fclose(file);
+        return CVECTOR_SUCCESS;
+    }
+    
+    int lock_fd;
+    cvector_error_t err = cvector_lock_acquire(db_path, &lock_fd);
+    if (err != CVECTOR_SUCCESS) {
+        fclose(file);
+        return err;
+    }
+    if (flock(fileno(file), LOCK_EX | LOCK_NB) != 0) {
+        err = errno == EWOULDBLOCK ? CVECTOR_ERROR_LOCKED : CVECTOR_ERROR_FILE_IO;
+        cvector_lock_release(lock_fd);
+        fclose(file);
+        return err;
+    }
+    
+    if (backup_path && !cvector_create_backup(db_path, backup_path)) {
+        cvector_lock_release(lock_fd);
+        fclose(file);
+        return CVECTOR_ERROR_FILE_IO;
+    }
+    
+    while (header.version < CVECTOR_FILE_VERSION) {
+        err = cvector_migrate_step(&header);
+        if (err != CVECTOR_SUCCESS) {
+            cvector_lock_release(lock_fd);
+            fclose(file);
+            return err;
+        }
+    }
+    
+    // The header is the last thing written, so an interrupted migration
+    // leaves a file that still opens as its old version
+    if (fseek(file, 0, SEEK_SET) != 0 || fwrite(&header, sizeof(header), 1, file) != 1 ||
+        fflush(file) != 0 || fsync(fileno(file)) != 0) {
+        err = CVECTOR_ERROR_FILE_IO;
+    }
+    
+    cvector_lock_release(lock_fd);
+    fclose(file);
+    return err;
+}
+
+// An intact live record found by cvector_repair
+typedef struct {
+    cvector_id_t id;
+    uint64_t file_offset;
+} cvector_salvage_t;
+
+// Orders by ID, then file offset, so the last of each ID's run is the
+// record a normal open would have kept
+static int cvector_compare_salvage(const void* a, const void* b) {
+    const cvector_salvage_t* x = a;
+    const cvector_salvage_t* y = b;
+    if (x->id != y->id) {
+        return (x->id > y->id) - (x->id < y->id);
+    }
+    return (x->file_offset > y->file_offset) - (x->file_offset < y->file_offset);
+}
+
+static bool cvector_salvaged(const cvector_salvage_t* salvaged, size_t count, cvector_id_t id) {
+    size_t lo = 0, hi = count;
+    while (lo < hi) {
+        size_t mid = lo + (hi - lo) / 2;
+        if (salvaged[mid].id < id) {
+            lo = mid + 1;
+        } else {
+            hi = mid;
+        }
+    }
+    return lo < count && salvaged[lo].id == id;
+}
+
+cvector_error_t cvector_repair(const char* src_path, const char* dst_path, cvector_repair_report_t* report,
+                               cvector_id_t** lost_ids, size_t* lost_count) {
+    if (!src_path || !dst_path || !report || !lost_ids || !lost_count) {
+        return CVECTOR_ERROR_INVALID_ARGS;
+    }
+    
+    memset(report, 0, sizeof(*report));
+    *lost_ids = NULL;
+    *lost_count = 0;
+    
+    FILE* src = fopen(src_path, "rb");
+    if (!src) {
+        return cvector_file_exists(src_path) ? CVECTOR_ERROR_FILE_IO : CVECTOR_ERROR_DB_NOT_FOUND;
+    }
+    
+    // Without the header's dimension there is no way to tell where records
+    // start, so a damaged header is the one thing that cannot be repaired
+    cvector_file_header_t header;
+    if (fread(&header, sizeof(header), 1, src) != 1 || header.magic != CVECTOR_MAGIC_NUMBER ||
+        header.version < CVECTOR_FILE_VERSION_MIN || header.dimension == 0 ||
+        header.dimension > CVECTOR_MAX_DIMENSION) {
+        fclose(src);
+        return CVECTOR_ERROR_DB_CORRUPT;
+    }
+    if (header.version > CVECTOR_FILE_VERSION) {
+        fclose(src);
+        return CVECTOR_ERROR_VERSION_TOO_NEW;
+    }
+    if (header.version < 2) {
+        header.flags = 0;
+        header.max_vectors = 0;
+    }
+    
+    // Every record has the header's dimension, so records sit at a fixed
+    // stride and a damaged one can be stepped over without trusting it
+    uint64_t stride = sizeof(cvector_vector_record_t) + (uint64_t)header.dimension * sizeof(float);
+    fseek(src, 0, SEEK_END);
+    uint64_t body = (uint64_t)ftell(src) - sizeof(header);
+    size_t slots = body / stride;
+    bool torn = body % stride != 0;
+    
+    cvector_salvage_t* salvaged = malloc((slots + 1) * sizeof(*salvaged));
+    cvector_id_t* damaged = malloc((slots + 1) * sizeof(*damaged));
+    float* buffer = malloc(header.dimension * sizeof(float));
+    if (!salvaged || !damaged || !buffer) {
+        free(salvaged);
+        free(damaged);
+        free(buffer);
+        fclose(src);
+        return CVECTOR_ERROR_OUT_OF_MEMORY;
+    }
+    
+    size_t salvaged_count = 0, damaged_count = 0;
+    for (size_t i = 0; i <= slots; i++) {
+        if (i == slots && !torn) {
+            break;
+        }
+        uint64_t offset = sizeof(header) + i * stride;
+        cvector_vector_record_t record;
+        fseek(src, offset, SEEK_SET);
+        size_t got = fread(&record, 1, sizeof(record), src);
+        bool intact = got == sizeof(record) && i < slots &&
+                      fread(buffer, sizeof(float), header.dimension, src) == header.dimension &&
+                      cvector_record_intact(&record, buffer, header.dimension);
+        
+        report->records_scanned++;
+        if (!intact) {
+            // The ID of a damaged record may itself be garbage, but it is
+            // the best lead on what was lost, even from a torn last record
+            report->unreadable_records++;
+            if (got >= sizeof(record.id) && record.id != 0) {
+                damaged[damaged_count++] = record.id;
+            }
+        } else if (record.is_deleted) {
+            report->deleted_records++;
+        } else {
+            salvaged[salvaged_count].id = record.id;
+            salvaged[salvaged_count].file_offset = offset;
+            salvaged_count++;
+        }
+    }
+    free(buffer);
+    
+    // Keep the last intact copy of each ID, as opening the file would
+    qsort(salvaged, salvaged_count, sizeof(*salvaged), cvector_compare_salvage);
+    size_t kept = 0;
+    for (size_t i = 0; i < salvaged_count; i++) {
+        if (kept > 0 && salvaged[kept - 1].id == salvaged[i].id) {
+            report->deleted_records++;
+            kept--;
+        }
+        salvaged[kept++] = salvaged[i];
+    }
+    salvaged_count = kept;
+    
+    // A damaged record only loses its ID if no intact copy survived
+    qsort(damaged, damaged_count, sizeof(*damaged), cvector_compare_ids);
+    size_t lost = 0;
+    for (size_t i = 0; i < damaged_count; i++) {
+        if ((lost > 0 && damaged[lost - 1] == damaged[i]) || 
+            cvector_salvaged(salvaged, salvaged_count, damaged[i])) {
+            continue;
+        }
+        damaged[lost++] = damaged[i];
+    }
+    
+    // Exclusive create, so an existing database is never overwritten
+    cvector_error_t err = CVECTOR_SUCCESS;
+    FILE* dst = fopen(dst_path, "wbx");
+    if (!dst) {
+        err = CVECTOR_ERROR_FILE_IO;
+    }
+    
+    cvector_file_header_t blank = {0};
+    if (err == CVECTOR_SUCCESS && fwrite(&blank, sizeof(blank), 1, dst) != 1) {
+        err = CVECTOR_ERROR_FILE_IO;
+    }
+    
+    uint8_t* record_bytes = err == CVECTOR_SUCCESS ? malloc(stride) : NULL;
+    if (err == CVECTOR_SUCCESS && !record_bytes) {
+        err = CVECTOR_ERROR_OUT_OF_MEMORY;
+    }
+    cvector_id_t next_id = header.next_id;
+    for (size_t i = 0; i < salvaged_count && err == CVECTOR_SUCCESS; i++) {
+        fseek(src, salvaged[i].file_offset, SEEK_SET);
+        if (fread(record_bytes, stride, 1, src) != 1) {
+            err = CVECTOR_ERROR_FILE_IO;
+            break;
+        }
+        cvector_vector_record_t* record = (cvector_vector_record_t*)record_bytes;
+        if (record->version == 0) {
+            record->version = 1;
+        }
+        if (record->id >= next_id) {
+            next_id = record->id + 1;
+        }
+        if (fwrite(record_bytes, stride, 1, dst) != 1) {
+            err = CVECTOR_ERROR_FILE_IO;
+        }
+    }
+    free(record_bytes);
+    fclose(src);
+    
+    if (err == CVECTOR_SUCCESS) {
+        header.version = CVECTOR_FILE_VERSION;
+        header.vector_count = salvaged_count;
+        header.next_id = next_id;
+        header.modified_timestamp = cvector_get_timestamp();
+        if (fseek(dst, 0, SEEK_SET) != 0 || fwrite(&header, sizeof(header), 1, dst) != 1 ||
+            fflush(dst) != 0 || fsync(fileno(dst)) != 0) {
+            err = CVECTOR_ERROR_FILE_IO;
+        }
+    }
+    free(salvaged);
+    
+    if (dst) {
+        fclose(dst);
+        if (err != CVECTOR_SUCCESS) {
+            unlink(dst_path);
+        }
+    }
+    if (err != CVECTOR_SUCCESS) {
+        free(damaged);
+        return err;
+    }
+    
+    report->recovered_vectors = salvaged_count;
+    if (lost > 0) {
+        *lost_ids = damaged;
+        *lost_count = lost;
+    } else {
+        free(damaged);
+    }
+    return CVECTOR_SUCCESS;
+}
@@ -14,7 +14,9 @@ typedef struct cvector_vector_entry {
     uint64_t file_offset;
     uint32_t dimension;
     uint64_t timestamp;
+    uint32_t version;
     bool is_deleted;
+    bool indexed;                   // Present in the HNSW index
     struct cvector_vector_entry* next;
 } cvector_vector_entry_t;
 
@@ -26,9 +28,10 @@ static uint64_t cvector_hash(cvector_id_t id);
 static uint64_t cvector_get_timestamp(void);
 static cvector_error_t cvector_init_hash_table(cvector_db_t* db);
 static void cvector_free_hash_table(cvector_db_t* db);
-static cvector_error_t cvector_hash_insert(cvector_db_t* db, cvector_id_t id, 
-                                          uint64_t file_offset, uint32_t dimension);
+static cvector_error_t cvector_hash_insert(cvector_db_t* db, cvector_id_t id, uint64_t file_offset, 
+                                          uint32_t dimension, uint32_t version, uint64_t timestamp);
 static cvector_vector_entry_t* cvector_hash_find(cvector_db_t* db, cvector_id_t id);
+static cvector_vector_entry_t* cvector_hash_find_deleted(cvector_db_t* db, cvector_id_t id);
 static cvector_error_t cvector_write_header(cvector_db_t* db);
 static cvector_error_t cvector_read_header(cvector_db_t* db);
 
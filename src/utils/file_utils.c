@@ -81,4 +81,18 @@ int cvector_create_backup(const char* original_path, const char* backup_path) {
     }
     
     return success;
-}
\ No newline at end of file
+}
+
+// Bitwise CRC-32 (IEEE 802.3). Pass 0 to start and the previous result to
+// continue a checksum across several buffers.
+uint32_t cvector_crc32(uint32_t crc, const void* data, size_t length) {
+    const uint8_t* bytes = data;
+    crc = ~crc;
+    for (size_t i = 0; i < length; i++) {
+        crc ^= bytes[i];
+        for (int bit = 0; bit < 8; bit++) {
+            crc = (crc >> 1) ^ (0xEDB88320u & -(crc & 1));
+        }
+    }
+    return ~crc;
+}
@@ -10,4 +10,7 @@ int cvector_file_exists(const char* path);
 size_t cvector_file_size(const char* path);
 int cvector_create_backup(const char* original_path, const char* backup_path);
 
+// Checksums
+uint32_t cvector_crc32(uint32_t crc, const void* data, size_t length);
+
 #endif // CVECTOR_FILE_UTILS_H
@@ -1,12 +1,32 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/asmit-gupta/cvector/pkg/cvector"
+	"github.com/asmit-gupta/cvector/pkg/embed"
+	"github.com/asmit-gupta/cvector/pkg/rag"
+	"github.com/asmit-gupta/cvector/pkg/webhook"
 )
 
 const (
@@ -16,6 +36,9 @@ const (
 
 func cleanupTestDB(t *testing.T) {
 	os.Remove(testDBPath)
+	os.Remove(testDBPath + ".meta")
+	os.Remove(testDBPath + ".hnsw")
+	os.Remove(testDBPath + ".lock")
 	// Also remove directory if empty
 	dir := filepath.Dir(testDBPath)
 	os.Remove(dir)
@@ -77,6 +100,40 @@ func TestDatabaseCreate(t *testing.T) {
 	}
 }
 
+func TestDatabaseCreateConfig(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db, err := cvector.CreateDB(&cvector.DBConfig{
+		Name:              "test_db",
+		DataPath:          testDBPath,
+		Dimension:         testDimension,
+		DefaultSimilarity: cvector.SimilarityDotProduct,
+		MaxVectors:        50,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.DefaultSimilarity != cvector.SimilarityDotProduct {
+		t.Errorf("Expected the configured similarity, got %v", stats.DefaultSimilarity)
+	}
+	db.Close()
+
+	// The similarity is stored in the file
+	db, err = cvector.OpenDB(testDBPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	if stats, _ := db.Stats(); stats.DefaultSimilarity != cvector.SimilarityDotProduct {
+		t.Errorf("Expected the similarity to survive a reopen, got %v", stats.DefaultSimilarity)
+	}
+}
+
 func TestDatabaseOpen(t *testing.T) {
 	cleanupTestDB(t)
 	defer cleanupTestDB(t)
@@ -193,7 +250,7 @@ func TestVectorDelete(t *testing.T) {
 		t.Error("Expected error when getting deleted vector")
 	}
 
-	if err != cvector.ErrVectorNotFound {
+	if !errors.Is(err, cvector.ErrVectorNotFound) {
 		t.Errorf("Expected ErrVectorNotFound, got %v", err)
 	}
 }
@@ -239,6 +296,98 @@ func TestMultipleVectors(t *testing.T) {
 	}
 }
 
+func TestGraphInsert(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	// Enough vectors for the graph to grow several layers, so new nodes are
+	// offered neighbors found on layers above the ones those neighbors have
+	const numVectors = 500
+	for i := 1; i <= numVectors; i++ {
+		if err := db.Insert(createTestVector(uint64(i), testDimension)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i, err)
+		}
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.TotalVectors != numVectors {
+		t.Errorf("Expected %d vectors, got %d", numVectors, stats.TotalVectors)
+	}
+}
+
+func TestSearchRecall(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recall.cvdb")
+	const dimension, numVectors, topK = 16, 1000, 10
+	db, err := cvector.CreateDB(&cvector.DBConfig{Name: "recall", DataPath: path, Dimension: dimension})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	rng := rand.New(rand.NewSource(1))
+	random := func() []float32 {
+		data := make([]float32, dimension)
+		for i := range data {
+			data[i] = rng.Float32()*2 - 1
+		}
+		return data
+	}
+	cosine := func(a, b []float32) float64 {
+		var dot, na, nb float64
+		for i := range a {
+			dot += float64(a[i]) * float64(b[i])
+			na += float64(a[i]) * float64(a[i])
+			nb += float64(b[i]) * float64(b[i])
+		}
+		return dot / math.Sqrt(na*nb)
+	}
+
+	vectors := make([][]float32, numVectors)
+	for i := range vectors {
+		vectors[i] = random()
+		if err := db.Insert(cvector.NewVector(uint64(i+1), vectors[i])); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i+1, err)
+		}
+	}
+
+	// The index search must find most of the exact nearest neighbors
+	found := 0
+	const numQueries = 50
+	for q := 0; q < numQueries; q++ {
+		query := random()
+		ids := make([]int, numVectors)
+		for i := range ids {
+			ids[i] = i
+		}
+		sort.Slice(ids, func(a, b int) bool {
+			return cosine(query, vectors[ids[a]]) > cosine(query, vectors[ids[b]])
+		})
+		exact := make(map[uint64]bool, topK)
+		for _, i := range ids[:topK] {
+			exact[uint64(i+1)] = true
+		}
+
+		results, err := db.Search(&cvector.Query{QueryVector: query, TopK: topK, Similarity: cvector.SimilarityCosine})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		for _, r := range results {
+			if exact[r.ID] {
+				found++
+			}
+		}
+	}
+	if recall := float64(found) / (numQueries * topK); recall < 0.9 {
+		t.Errorf("Expected recall of at least 0.9 against brute force, got %.3f", recall)
+	}
+}
+
 func TestErrorConditions(t *testing.T) {
 	cleanupTestDB(t)
 	defer cleanupTestDB(t)
@@ -249,7 +398,7 @@ func TestErrorConditions(t *testing.T) {
 		t.Error("Expected error when opening non-existent database")
 	}
 
-	if err != cvector.ErrDBNotFound {
+	if !errors.Is(err, cvector.ErrDBNotFound) {
 		t.Errorf("Expected ErrDBNotFound, got %v", err)
 	}
 
@@ -276,7 +425,7 @@ func TestErrorConditions(t *testing.T) {
 		t.Error("Expected error when inserting vector with wrong dimension")
 	}
 
-	if err != cvector.ErrDimensionMismatch {
+	if !errors.Is(err, cvector.ErrDimensionMismatch) {
 		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
 	}
 
@@ -286,7 +435,7 @@ func TestErrorConditions(t *testing.T) {
 		t.Error("Expected error when getting non-existent vector")
 	}
 
-	if err != cvector.ErrVectorNotFound {
+	if !errors.Is(err, cvector.ErrVectorNotFound) {
 		t.Errorf("Expected ErrVectorNotFound, got %v", err)
 	}
 }
@@ -343,6 +492,5527 @@ func TestDatabaseDrop(t *testing.T) {
 	}
 }
 
+func TestListVectors(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	// Insert out of order to check the listing is sorted by ID
+	for _, id := range []uint64{5, 1, 3, 4, 2} {
+		if err := db.Insert(createTestVector(id, testDimension)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", id, err)
+		}
+	}
+	if err := db.Delete(4); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+
+	ids, err := db.IDs()
+	if err != nil {
+		t.Fatalf("Failed to list IDs: %v", err)
+	}
+	expected := []uint64{1, 2, 3, 5}
+	if len(ids) != len(expected) {
+		t.Fatalf("Expected %d IDs, got %d", len(expected), len(ids))
+	}
+	for i, id := range expected {
+		if ids[i] != id {
+			t.Errorf("Expected ID %d at position %d, got %d", id, i, ids[i])
+		}
+	}
+
+	page, err := db.List(1, 2)
+	if err != nil {
+		t.Fatalf("Failed to list vectors: %v", err)
+	}
+	if len(page) != 2 || page[0].ID != 2 || page[1].ID != 3 {
+		t.Errorf("Unexpected page contents: %v", page)
+	}
+
+	page, err = db.List(10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list vectors past the end: %v", err)
+	}
+	if len(page) != 0 {
+		t.Errorf("Expected empty page, got %d vectors", len(page))
+	}
+}
+
+func TestVectorMetadata(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+
+	vector := createTestVector(7, testDimension)
+	vector.Metadata = map[string]any{"category": "news", "rank": 3.0}
+	if err := db.Insert(vector); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if err := db.Insert(createTestVector(8, testDimension)); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	db.Close()
+
+	// Metadata must survive a reopen
+	db, err := cvector.OpenDB(testDBPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	retrieved, err := db.Get(7)
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if retrieved.Metadata["category"] != "news" || retrieved.Metadata["rank"] != 3.0 {
+		t.Errorf("Unexpected metadata: %v", retrieved.Metadata)
+	}
+
+	plain, err := db.Get(8)
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if plain.Metadata != nil {
+		t.Errorf("Expected no metadata, got %v", plain.Metadata)
+	}
+
+	if err := db.Delete(7); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	if err := db.Insert(createTestVector(7, testDimension)); err != nil {
+		t.Fatalf("Failed to reinsert vector: %v", err)
+	}
+	reinserted, err := db.Get(7)
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if reinserted.Metadata != nil {
+		t.Errorf("Expected deleted vector's metadata to be gone, got %v", reinserted.Metadata)
+	}
+}
+
+func TestCopyTo(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	const copyPath = "./test_go_copy.cvdb"
+	cvector.DropDB(copyPath)
+	defer cvector.DropDB(copyPath)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	for i := 1; i <= 6; i++ {
+		vector := createTestVector(uint64(i), testDimension)
+		vector.Metadata = map[string]any{"even": i%2 == 0}
+		if err := db.Insert(vector); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i, err)
+		}
+	}
+
+	copied, err := db.CopyTo(copyPath, func(v *cvector.Vector) bool {
+		return v.Metadata["even"] == true
+	})
+	if err != nil {
+		t.Fatalf("Failed to copy database: %v", err)
+	}
+	if copied != 3 {
+		t.Errorf("Expected 3 vectors copied, got %d", copied)
+	}
+
+	clone, err := cvector.OpenDB(copyPath)
+	if err != nil {
+		t.Fatalf("Failed to open copy: %v", err)
+	}
+	defer clone.Close()
+
+	ids, err := clone.IDs()
+	if err != nil {
+		t.Fatalf("Failed to list copy: %v", err)
+	}
+	if len(ids) != 3 || ids[0] != 2 || ids[1] != 4 || ids[2] != 6 {
+		t.Errorf("Unexpected IDs in copy: %v", ids)
+	}
+
+	vector, err := clone.Get(4)
+	if err != nil {
+		t.Fatalf("Failed to get copied vector: %v", err)
+	}
+	if vector.Metadata["even"] != true {
+		t.Errorf("Expected metadata to be copied, got %v", vector.Metadata)
+	}
+
+	// Copying onto an existing database must fail rather than merge
+	if _, err := db.CopyTo(copyPath, nil); err == nil {
+		t.Error("Expected error when copying onto an existing database")
+	}
+}
+
+func TestRenameAndDescription(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Name != "test_db" {
+		t.Errorf("Expected name test_db, got %q", stats.Name)
+	}
+
+	if err := db.Rename("renamed"); err != nil {
+		t.Fatalf("Failed to rename database: %v", err)
+	}
+	if err := db.SetDescription("staging copy"); err != nil {
+		t.Fatalf("Failed to set description: %v", err)
+	}
+	if err := db.Rename(""); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for empty name, got %v", err)
+	}
+	db.Close()
+
+	db, err = cvector.OpenDB(testDBPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	stats, err = db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Name != "renamed" || stats.Description != "staging copy" {
+		t.Errorf("Expected renamed/staging copy, got %q/%q", stats.Name, stats.Description)
+	}
+}
+
+func TestStatsTombstones(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+
+	for i := 1; i <= 4; i++ {
+		if err := db.Insert(createTestVector(uint64(i), testDimension)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i, err)
+		}
+	}
+	if err := db.Delete(2); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.TotalVectors != 3 || stats.DeletedVectors != 1 {
+		t.Errorf("Expected 3 live and 1 deleted, got %d and %d", stats.TotalVectors, stats.DeletedVectors)
+	}
+	if stats.Fragmentation < 24 || stats.Fragmentation > 26 {
+		t.Errorf("Expected fragmentation near 25%%, got %.2f", stats.Fragmentation)
+	}
+	if stats.IndexType != "hnsw" || stats.IndexStatus != cvector.IndexStatusReady || stats.IndexedVectors != 3 {
+		t.Errorf("Unexpected index state: %s/%s/%d", stats.IndexType, stats.IndexStatus, stats.IndexedVectors)
+	}
+	if !stats.LastCompaction.IsZero() {
+		t.Errorf("Expected no compaction, got %v", stats.LastCompaction)
+	}
+	db.Close()
+
+	// Tombstone counts are recovered from the file on open
+	db, err = cvector.OpenDB(testDBPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	reopened, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if reopened.DeletedVectors != 1 || reopened.ReclaimableBytes != stats.ReclaimableBytes {
+		t.Errorf("Expected tombstone stats to survive reopen, got %d/%d", reopened.DeletedVectors, reopened.ReclaimableBytes)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+
+	for i := 1; i <= 2; i++ {
+		if err := db.Insert(createTestVector(uint64(i), testDimension)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i, err)
+		}
+	}
+
+	first, err := db.Describe(1)
+	if err != nil {
+		t.Fatalf("Failed to describe vector: %v", err)
+	}
+	second, err := db.Describe(2)
+	if err != nil {
+		t.Fatalf("Failed to describe vector: %v", err)
+	}
+
+	if first.Length != second.Length || first.Dimension != testDimension {
+		t.Errorf("Unexpected record layout: %+v", first)
+	}
+	if second.Offset != first.Offset+int64(first.Length) {
+		t.Errorf("Expected records to be contiguous, got offsets %d and %d", first.Offset, second.Offset)
+	}
+	if first.Checksum == second.Checksum {
+		t.Error("Expected different checksums for different records")
+	}
+	if first.Version != 1 {
+		t.Errorf("Expected version 1 after insert, got %d", first.Version)
+	}
+
+	if err := db.UpdateIf(2, 1, createTestVector(2, testDimension).Data); err != nil {
+		t.Fatalf("Failed to update vector: %v", err)
+	}
+	if updated, err := db.Describe(2); err != nil || updated.Version != 2 || updated.Offset == second.Offset {
+		t.Errorf("Expected version 2 in a new record, got %+v (%v)", updated, err)
+	}
+
+	if err := db.Delete(1); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	db.Close()
+
+	// Deleted records stay inspectable until they are reclaimed
+	db, err = cvector.OpenDB(testDBPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	deleted, err := db.Describe(1)
+	if err != nil {
+		t.Fatalf("Failed to describe deleted vector: %v", err)
+	}
+	if !deleted.Deleted || deleted.Offset != first.Offset {
+		t.Errorf("Expected deleted record at offset %d, got %+v", first.Offset, deleted)
+	}
+
+	if _, err := db.Describe(99); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound, got %v", err)
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	before, err := db.MemoryUsage()
+	if err != nil {
+		t.Fatalf("Failed to get memory usage: %v", err)
+	}
+
+	for i := 1; i <= 20; i++ {
+		if err := db.Insert(createTestVector(uint64(i), testDimension)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i, err)
+		}
+	}
+
+	after, err := db.MemoryUsage()
+	if err != nil {
+		t.Fatalf("Failed to get memory usage: %v", err)
+	}
+
+	if after.LookupTable <= before.LookupTable {
+		t.Errorf("Expected lookup table to grow, got %d -> %d", before.LookupTable, after.LookupTable)
+	}
+	if want := int64(20 * testDimension * 4); after.IndexVectors != want {
+		t.Errorf("Expected %d bytes of indexed vectors, got %d", want, after.IndexVectors)
+	}
+
+	sum := after.Database + after.LookupTable + after.IndexStructure + after.IndexGraph +
+		after.IndexVectors + after.IOBuffers + after.Mapped
+	if after.Total != sum {
+		t.Errorf("Expected total %d to equal the sum of its parts %d", after.Total, sum)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	db, err := cvector.CreateDB(&cvector.DBConfig{
+		Name:              "test_db",
+		DataPath:          testDBPath,
+		Dimension:         testDimension,
+		DefaultSimilarity: cvector.SimilarityCosine,
+		Logger:            logger,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Close()
+
+	db, err = cvector.OpenDBWithConfig(&cvector.DBConfig{DataPath: testDBPath, Logger: logger})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := db.Get(42); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound, got %v", err)
+	}
+	if err := db.Insert(createTestVector(1, testDimension+1)); err == nil {
+		t.Error("Expected dimension mismatch error")
+	}
+	db.Close()
+
+	var messages []string
+	var sawInsertError bool
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var event map[string]any
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("Invalid log line %q: %v", line, err)
+		}
+		messages = append(messages, event["msg"].(string))
+		if event["op"] == "insert" && event["level"] == "ERROR" {
+			sawInsertError = true
+		}
+	}
+
+	want := []string{
+		"cvector database created",
+		"cvector database closed",
+		"cvector database opened",
+		"cvector engine error",
+		"cvector engine error",
+		"cvector database closed",
+	}
+	if strings.Join(messages, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected events %v, got %v", want, messages)
+	}
+	if !sawInsertError {
+		t.Error("Expected insert failure to be logged at error level")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	auditPath := testDBPath + ".audit"
+	os.Remove(auditPath)
+	defer os.Remove(auditPath)
+
+	db, err := cvector.CreateDB(&cvector.DBConfig{
+		Name:              "test_db",
+		DataPath:          testDBPath,
+		Dimension:         testDimension,
+		DefaultSimilarity: cvector.SimilarityCosine,
+		AuditLogPath:      auditPath,
+		AuditActor:        "loader",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	if err := db.Insert(createTestVector(1, testDimension)); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if err := db.InsertAs("alice", createTestVector(2, testDimension)); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	// Failed mutations are not recorded
+	if err := db.DeleteAs("alice", 99); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound, got %v", err)
+	}
+	if err := db.DeleteAs("bob", 1); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	db.Close()
+
+	// Reopening appends to the existing log
+	db, err = cvector.OpenDBWithConfig(&cvector.DBConfig{DataPath: testDBPath, AuditLogPath: auditPath})
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	if err := db.Delete(2); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	db.Close()
+
+	entries, err := cvector.ReadAuditLog(auditPath)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+
+	want := []cvector.AuditEntry{
+		{Actor: "loader", Op: cvector.AuditInsert, ID: 1, Dimension: testDimension},
+		{Actor: "alice", Op: cvector.AuditInsert, ID: 2, Dimension: testDimension},
+		{Actor: "bob", Op: cvector.AuditDelete, ID: 1},
+		{Actor: "", Op: cvector.AuditDelete, ID: 2},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Expected %d audit entries, got %d: %+v", len(want), len(entries), entries)
+	}
+	for i, entry := range entries {
+		if entry.Time.IsZero() {
+			t.Errorf("Entry %d has no timestamp", i)
+		}
+		entry.Time = time.Time{}
+		if entry != want[i] {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, want[i], entry)
+		}
+	}
+}
+
+func TestSearchExplain(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	for i := 1; i <= 20; i++ {
+		if err := db.Insert(createTestVector(uint64(i), testDimension)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i, err)
+		}
+	}
+
+	query := &cvector.Query{
+		QueryVector: createTestVector(0, testDimension).Data,
+		TopK:        5,
+		Similarity:  cvector.SimilarityCosine,
+	}
+
+	results, err := db.Search(query)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	for _, result := range results {
+		if result.Explain != nil {
+			t.Fatal("Expected no diagnostics without Query.Explain")
+		}
+	}
+
+	query.Explain = true
+	results, report, err := db.SearchExplain(query)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) == 0 {
+		t.Fatal("Expected search results")
+	}
+
+	if report.Strategy != cvector.SearchStrategyIndex {
+		t.Errorf("Expected index strategy, got %s", report.Strategy)
+	}
+	if report.CandidatesScanned < len(results) || report.IndexNodesVisited == 0 {
+		t.Errorf("Expected traversal counters to be populated, got %+v", report)
+	}
+	if report.FilterSelectivity != 1 || report.ThresholdRejected != 0 {
+		t.Errorf("Expected every candidate to pass without a threshold, got %+v", report)
+	}
+	if report.TotalTime <= 0 || report.TotalTime < report.ScoringTime {
+		t.Errorf("Unexpected timings: %+v", report)
+	}
+
+	for i, result := range results {
+		if result.Explain == nil {
+			t.Fatalf("Result %d has no diagnostics", i)
+		}
+		if result.Explain.Rank != i+1 || result.Explain.Search != report {
+			t.Errorf("Unexpected diagnostics for result %d: %+v", i, result.Explain)
+		}
+	}
+}
+
+func TestQueryStats(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	for i := 1; i <= 10; i++ {
+		if err := db.Insert(createTestVector(uint64(i), testDimension)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i, err)
+		}
+	}
+
+	query := &cvector.Query{
+		QueryVector: createTestVector(0, testDimension).Data,
+		TopK:        3,
+		Similarity:  cvector.SimilarityCosine,
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := db.Search(query); err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+	}
+	if _, err := db.Search(&cvector.Query{QueryVector: []float32{1, 2}, TopK: 3}); err == nil {
+		t.Error("Expected dimension mismatch to fail")
+	}
+
+	stats := db.QueryStats()
+	if stats.Searches != 3 || stats.IndexSearches != 3 || stats.Scans != 0 || stats.Errors != 1 {
+		t.Errorf("Unexpected counters: %+v", stats)
+	}
+	if stats.CandidatesScanned == 0 || stats.IndexNodesVisited == 0 || stats.TotalTime <= 0 {
+		t.Errorf("Expected work counters to accumulate, got %+v", stats)
+	}
+
+	before := stats.Since
+	time.Sleep(time.Millisecond)
+	db.ResetQueryStats()
+
+	stats = db.QueryStats()
+	if stats.Searches != 0 || stats.Errors != 0 || stats.CandidatesScanned != 0 {
+		t.Errorf("Expected counters to reset, got %+v", stats)
+	}
+	if !stats.Since.After(before) {
+		t.Error("Expected reset to restart the Since clock")
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	analysis, err := db.Analyze()
+	if err != nil {
+		t.Fatalf("Failed to analyze empty database: %v", err)
+	}
+	if analysis.Count != 0 {
+		t.Errorf("Expected empty analysis, got %d vectors", analysis.Count)
+	}
+
+	// Unit vectors on a circle in the first two dimensions: a 1-dimensional
+	// manifold whose other components are constant zero
+	const count = 200
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < count; i++ {
+		angle := 2 * math.Pi * rng.Float64()
+		data := make([]float32, testDimension)
+		data[0] = float32(math.Cos(angle))
+		data[1] = float32(math.Sin(angle))
+		if err := db.Insert(cvector.NewVector(uint64(i+1), data)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i, err)
+		}
+	}
+
+	analysis, err = db.Analyze()
+	if err != nil {
+		t.Fatalf("Failed to analyze database: %v", err)
+	}
+
+	if analysis.Count != count || analysis.Dimension != testDimension {
+		t.Errorf("Unexpected shape: %d vectors of dimension %d", analysis.Count, analysis.Dimension)
+	}
+	if !analysis.Normalized {
+		t.Errorf("Expected unit vectors to be reported as normalized, norms %+v", analysis.Norms)
+	}
+
+	total := 0
+	for _, bucket := range analysis.Norms.Histogram {
+		total += bucket.Count
+	}
+	if total != count {
+		t.Errorf("Expected histogram to cover %d vectors, got %d", count, total)
+	}
+
+	if math.Abs(analysis.DimensionMeans[0]) > 0.1 || math.Abs(analysis.DimensionVariances[0]-0.5) > 0.05 {
+		t.Errorf("Unexpected statistics for dimension 0: mean %f, variance %f",
+			analysis.DimensionMeans[0], analysis.DimensionVariances[0])
+	}
+	if analysis.DimensionVariances[2] != 0 {
+		t.Errorf("Expected zero variance for an unused dimension, got %f", analysis.DimensionVariances[2])
+	}
+
+	if analysis.IntrinsicDimension < 0.5 || analysis.IntrinsicDimension > 1.5 {
+		t.Errorf("Expected intrinsic dimension near 1, got %f", analysis.IntrinsicDimension)
+	}
+}
+
+func TestSearchRadius(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	// Vector i points along axis 0 with i units along axis 1, so similarity
+	// to the axis-0 query falls as i grows
+	for i := 0; i < 10; i++ {
+		data := make([]float32, testDimension)
+		data[0] = 1
+		data[1] = float32(i)
+		if err := db.Insert(cvector.NewVector(uint64(i+1), data)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i, err)
+		}
+	}
+
+	queryVector := make([]float32, testDimension)
+	queryVector[0] = 1
+
+	// cos(angle) >= 0.5 holds for i <= sqrt(3)
+	results, err := db.SearchRadius(&cvector.Query{
+		QueryVector:   queryVector,
+		Similarity:    cvector.SimilarityCosine,
+		MinSimilarity: 0.5,
+	})
+	if err != nil {
+		t.Fatalf("Radius search failed: %v", err)
+	}
+	var ids []uint64
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	if fmt.Sprint(ids) != "[1 2]" {
+		t.Errorf("Expected vectors [1 2] within radius, got %v", ids)
+	}
+
+	results, err = db.SearchRadius(&cvector.Query{
+		QueryVector:   queryVector,
+		Similarity:    cvector.SimilarityCosine,
+		MinSimilarity: -1,
+		TopK:          3,
+	})
+	if err != nil {
+		t.Fatalf("Radius search failed: %v", err)
+	}
+	if len(results) != 3 || results[0].ID != 1 {
+		t.Errorf("Expected the 3 best matches, got %d results", len(results))
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	base := createTestVector(0, testDimension).Data
+	nearCopy := append([]float32(nil), base...)
+	nearCopy[0] += 0.0001
+	other := make([]float32, testDimension)
+	for i := range other {
+		other[i] = float32(testDimension - i)
+	}
+	orthogonal := make([]float32, testDimension)
+	orthogonal[0] = 1
+
+	vectors := map[uint64][]float32{
+		1: base,
+		2: orthogonal,
+		3: nearCopy,
+		4: other,
+		5: base,
+		6: other,
+	}
+	for id, data := range vectors {
+		v := cvector.NewVector(id, data)
+		v.Metadata = map[string]any{"source": "test"}
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", id, err)
+		}
+	}
+
+	if _, err := db.FindDuplicates(0); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for zero threshold, got %v", err)
+	}
+
+	groups, err := db.FindDuplicates(0.999)
+	if err != nil {
+		t.Fatalf("Failed to find duplicates: %v", err)
+	}
+
+	want := []cvector.DuplicateGroup{
+		{Canonical: 1, Duplicates: []uint64{3, 5}},
+		{Canonical: 4, Duplicates: []uint64{6}},
+	}
+	if fmt.Sprint(groups) != fmt.Sprint(want) {
+		t.Fatalf("Expected groups %v, got %v", want, groups)
+	}
+
+	tagged, err := db.TagDuplicates(groups[:1], "duplicate_of")
+	if err != nil || tagged != 2 {
+		t.Fatalf("Expected to tag 2 vectors, got %d (%v)", tagged, err)
+	}
+	v, err := db.Get(3)
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if v.Metadata["duplicate_of"] != uint64(1) || v.Metadata["source"] != "test" {
+		t.Errorf("Expected tag to be merged into metadata, got %v", v.Metadata)
+	}
+
+	deleted, err := db.DeleteDuplicates(groups)
+	if err != nil || deleted != 3 {
+		t.Fatalf("Expected to delete 3 vectors, got %d (%v)", deleted, err)
+	}
+	for _, id := range []uint64{3, 5, 6} {
+		if _, err := db.Get(id); !errors.Is(err, cvector.ErrVectorNotFound) {
+			t.Errorf("Expected vector %d to be deleted, got %v", id, err)
+		}
+	}
+	for _, id := range []uint64{1, 2, 4} {
+		if _, err := db.Get(id); err != nil {
+			t.Errorf("Expected vector %d to remain, got %v", id, err)
+		}
+	}
+}
+
+func TestCluster(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	// Three tight groups around well separated centers
+	rng := rand.New(rand.NewSource(1))
+	centers := []float32{-10, 0, 10}
+	id := uint64(1)
+	groupOf := make(map[uint64]int)
+	for g, center := range centers {
+		for i := 0; i < 30; i++ {
+			data := make([]float32, testDimension)
+			for d := range data {
+				data[d] = center + float32(rng.NormFloat64()*0.1)
+			}
+			if err := db.Insert(cvector.NewVector(id, data)); err != nil {
+				t.Fatalf("Failed to insert vector %d: %v", id, err)
+			}
+			groupOf[id] = g
+			id++
+		}
+	}
+
+	if _, err := db.Cluster(0, 10); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for k=0, got %v", err)
+	}
+	if _, err := db.Cluster(1000, 10); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for k larger than the vector count, got %v", err)
+	}
+
+	clustering, err := db.Cluster(3, 20)
+	if err != nil {
+		t.Fatalf("Failed to cluster: %v", err)
+	}
+
+	if len(clustering.Centroids) != 3 || len(clustering.Assignments) != 90 {
+		t.Fatalf("Unexpected clustering shape: %d centroids, %d assignments",
+			len(clustering.Centroids), len(clustering.Assignments))
+	}
+
+	// Every input group must map onto exactly one cluster
+	clusterOf := make(map[int]int)
+	for id, cluster := range clustering.Assignments {
+		g := groupOf[id]
+		if c, ok := clusterOf[g]; ok && c != cluster {
+			t.Fatalf("Group %d split across clusters %d and %d", g, c, cluster)
+		}
+		clusterOf[g] = cluster
+	}
+	for c, size := range clustering.Sizes {
+		if size != 30 {
+			t.Errorf("Expected cluster %d to hold 30 vectors, got %d", c, size)
+		}
+	}
+
+	again, err := db.Cluster(3, 20)
+	if err != nil {
+		t.Fatalf("Failed to cluster: %v", err)
+	}
+	if again.Inertia != clustering.Inertia {
+		t.Errorf("Expected deterministic clustering, inertia %f vs %f", again.Inertia, clustering.Inertia)
+	}
+
+	tagged, err := db.TagClusters(clustering, "cluster")
+	if err != nil || tagged != 90 {
+		t.Fatalf("Expected to tag 90 vectors, got %d (%v)", tagged, err)
+	}
+	v, err := db.Get(1)
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if v.Metadata["cluster"] != clustering.Assignments[1] {
+		t.Errorf("Expected cluster tag %d, got %v", clustering.Assignments[1], v.Metadata["cluster"])
+	}
+}
+
+func TestPCA(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	reducedPath := "./test_go_pca.cvdb"
+	cvector.DropDB(reducedPath)
+	defer cvector.DropDB(reducedPath)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	// Vectors spanning a 4-dimensional subspace of the full space
+	rng := rand.New(rand.NewSource(1))
+	basis := make([][]float32, 4)
+	for i := range basis {
+		basis[i] = make([]float32, testDimension)
+		for d := range basis[i] {
+			basis[i][d] = float32(rng.NormFloat64())
+		}
+	}
+	vectors := make(map[uint64][]float32)
+	for id := uint64(1); id <= 200; id++ {
+		data := make([]float32, testDimension)
+		for _, b := range basis {
+			weight := float32(rng.NormFloat64())
+			for d := range data {
+				data[d] += weight * b[d]
+			}
+		}
+		if err := db.Insert(cvector.NewVector(id, data)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", id, err)
+		}
+		vectors[id] = data
+	}
+
+	if _, err := db.TrainPCA(0); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for target dimension 0, got %v", err)
+	}
+	if _, err := db.TrainPCA(testDimension + 1); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for target dimension above the source, got %v", err)
+	}
+
+	pca, err := db.TrainPCA(4)
+	if err != nil {
+		t.Fatalf("Failed to train PCA: %v", err)
+	}
+	if pca.TargetDimension() != 4 || pca.SourceDimension != testDimension {
+		t.Fatalf("Unexpected projection shape %d -> %d", pca.SourceDimension, pca.TargetDimension())
+	}
+	if pca.RetainedVariance < 0.999 {
+		t.Errorf("Expected a 4-dimensional subspace to retain all variance, got %f", pca.RetainedVariance)
+	}
+
+	reduced, err := db.ReduceTo(reducedPath, pca)
+	if err != nil {
+		t.Fatalf("Failed to reduce database: %v", err)
+	}
+
+	stats, err := reduced.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Dimension != 4 || stats.TotalVectors != 200 {
+		t.Errorf("Expected 200 vectors of dimension 4, got %d of dimension %d", stats.TotalVectors, stats.Dimension)
+	}
+
+	// Queries in the original space are projected before searching
+	results, err := reduced.SearchRadius(&cvector.Query{
+		QueryVector:   vectors[42],
+		Similarity:    cvector.SimilarityCosine,
+		MinSimilarity: 0.9999,
+	})
+	if err != nil {
+		t.Fatalf("Failed to search reduced database: %v", err)
+	}
+	if len(results) == 0 || results[0].ID != 42 {
+		t.Errorf("Expected vector 42 as the closest match, got %d results", len(results))
+	}
+	reduced.Close()
+
+	reopened, err := cvector.OpenDB(reducedPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen reduced database: %v", err)
+	}
+	defer reopened.Close()
+
+	if reopened.PCA() == nil || reopened.PCA().TargetDimension() != 4 {
+		t.Fatal("Expected projection to be loaded on reopen")
+	}
+	if err := reopened.Insert(cvector.NewVector(1000, vectors[7])); err != nil {
+		t.Fatalf("Failed to insert full-dimension vector: %v", err)
+	}
+	stored, err := reopened.Get(1000)
+	if err != nil {
+		t.Fatalf("Failed to get projected vector: %v", err)
+	}
+	if len(stored.Data) != 4 {
+		t.Errorf("Expected stored vector of dimension 4, got %d", len(stored.Data))
+	}
+}
+
+func TestCentroid(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	for id := uint64(1); id <= 4; id++ {
+		data := make([]float32, testDimension)
+		for d := range data {
+			data[d] = float32(id)
+		}
+		vector := cvector.NewVector(id, data)
+		vector.Metadata = map[string]any{"even": id%2 == 0}
+		if err := db.Insert(vector); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", id, err)
+		}
+	}
+
+	centroid, err := db.Centroid([]uint64{1, 2, 3})
+	if err != nil {
+		t.Fatalf("Failed to compute centroid: %v", err)
+	}
+	if len(centroid) != testDimension {
+		t.Fatalf("Expected centroid of dimension %d, got %d", testDimension, len(centroid))
+	}
+	for d, x := range centroid {
+		if x != 2 {
+			t.Fatalf("Expected component %d to be 2, got %f", d, x)
+		}
+	}
+
+	if _, err := db.Centroid(nil); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for no IDs, got %v", err)
+	}
+	if _, err := db.Centroid([]uint64{1, 99}); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound for a missing ID, got %v", err)
+	}
+
+	centroid, count, err := db.CentroidWhere(func(v *cvector.Vector) bool {
+		return v.Metadata["even"] == true
+	})
+	if err != nil {
+		t.Fatalf("Failed to compute filtered centroid: %v", err)
+	}
+	if count != 2 || centroid[0] != 3 {
+		t.Errorf("Expected mean 3 over 2 vectors, got %f over %d", centroid[0], count)
+	}
+
+	if _, _, err := db.CentroidWhere(func(*cvector.Vector) bool { return false }); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound when nothing matches, got %v", err)
+	}
+}
+
+func TestDistanceMatrix(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	a := [][]float32{{1, 0, 0}, {0, 2, 0}}
+	b := [][]float32{{1, 0, 0}, {0, 1, 0}, {3, 4, 0}}
+
+	cosine, err := cvector.DistanceMatrix(a, b, cvector.SimilarityCosine)
+	if err != nil {
+		t.Fatalf("Failed to compute cosine matrix: %v", err)
+	}
+	expectedCosine := [][]float32{{1, 0, 0.6}, {0, 1, 0.8}}
+	for i := range expectedCosine {
+		for j := range expectedCosine[i] {
+			if math.Abs(float64(cosine[i][j]-expectedCosine[i][j])) > 1e-6 {
+				t.Errorf("cosine[%d][%d] = %f, expected %f", i, j, cosine[i][j], expectedCosine[i][j])
+			}
+		}
+	}
+
+	dot, err := cvector.DistanceMatrix(a, b, cvector.SimilarityDotProduct)
+	if err != nil {
+		t.Fatalf("Failed to compute dot product matrix: %v", err)
+	}
+	if dot[1][2] != 8 {
+		t.Errorf("Expected dot product 8, got %f", dot[1][2])
+	}
+
+	euclidean, err := cvector.DistanceMatrix(a, b, cvector.SimilarityEuclidean)
+	if err != nil {
+		t.Fatalf("Failed to compute Euclidean matrix: %v", err)
+	}
+	if euclidean[0][0] != 0 || math.Abs(float64(euclidean[0][2])-math.Sqrt(20)) > 1e-5 {
+		t.Errorf("Unexpected Euclidean distances %v", euclidean[0])
+	}
+
+	if _, err := cvector.DistanceMatrix(a, [][]float32{{1, 0}}, cvector.SimilarityCosine); !errors.Is(err, cvector.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+	if _, err := cvector.DistanceMatrix(nil, b, cvector.SimilarityCosine); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for an empty input, got %v", err)
+	}
+
+	// The database variant must agree with the same vectors passed directly
+	db := createTestDB(t)
+	defer db.Close()
+
+	var vectors [][]float32
+	for id := uint64(1); id <= 5; id++ {
+		vector := createTestVector(id, testDimension)
+		if err := db.Insert(vector); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", id, err)
+		}
+		vectors = append(vectors, vector.Data)
+	}
+
+	fromDB, err := db.DistanceMatrix([]uint64{1, 2}, []uint64{3, 4, 5}, cvector.SimilarityEuclidean)
+	if err != nil {
+		t.Fatalf("Failed to compute matrix from IDs: %v", err)
+	}
+	direct, err := cvector.DistanceMatrix(vectors[:2], vectors[2:], cvector.SimilarityEuclidean)
+	if err != nil {
+		t.Fatalf("Failed to compute matrix: %v", err)
+	}
+	for i := range direct {
+		for j := range direct[i] {
+			if fromDB[i][j] != direct[i][j] {
+				t.Errorf("fromDB[%d][%d] = %f, expected %f", i, j, fromDB[i][j], direct[i][j])
+			}
+		}
+	}
+
+	if _, err := db.DistanceMatrix([]uint64{1, 99}, []uint64{2}, cvector.SimilarityCosine); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound for a missing ID, got %v", err)
+	}
+}
+
+func TestKNNGraph(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	// Points on a line, so each point's neighbors are known by position
+	for id := uint64(1); id <= 10; id++ {
+		data := make([]float32, testDimension)
+		data[0] = float32(id * id)
+		if err := db.Insert(cvector.NewVector(id, data)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", id, err)
+		}
+	}
+
+	if err := db.KNNGraph(0, cvector.SimilarityEuclidean, func(cvector.KNNEdge) error { return nil }); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for k=0, got %v", err)
+	}
+
+	edges := make(map[uint64][]cvector.KNNEdge)
+	err := db.KNNGraph(2, cvector.SimilarityEuclidean, func(e cvector.KNNEdge) error {
+		edges[e.Source] = append(edges[e.Source], e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to build k-NN graph: %v", err)
+	}
+
+	if len(edges) != 10 {
+		t.Fatalf("Expected edges for 10 vectors, got %d", len(edges))
+	}
+	for source, list := range edges {
+		if len(list) != 2 {
+			t.Fatalf("Expected 2 edges from %d, got %d", source, len(list))
+		}
+		for i, e := range list {
+			if e.Target == source {
+				t.Errorf("Vector %d links to itself", source)
+			}
+			if e.Rank != i+1 {
+				t.Errorf("Expected rank %d, got %d", i+1, e.Rank)
+			}
+		}
+		if list[0].Score > list[1].Score {
+			t.Errorf("Edges from %d not in distance order", source)
+		}
+	}
+
+	// Gaps grow along the line, so the nearest neighbor is the one before
+	if edges[5][0].Target != 4 || edges[5][1].Target != 6 {
+		t.Errorf("Expected neighbors 4 and 6 for vector 5, got %d and %d", edges[5][0].Target, edges[5][1].Target)
+	}
+	if edges[1][0].Target != 2 || edges[1][1].Target != 3 {
+		t.Errorf("Expected neighbors 2 and 3 for vector 1, got %d and %d", edges[1][0].Target, edges[1][1].Target)
+	}
+}
+
+// letterEmbedder embeds text as letter counts, so texts sharing letters
+// are similar under cosine
+type letterEmbedder struct {
+	calls int
+}
+
+func (e *letterEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float32, testDimension)
+		for _, r := range strings.ToLower(text) {
+			if r >= 'a' && r <= 'z' {
+				vectors[i][r-'a']++
+			}
+		}
+	}
+	return vectors, nil
+}
+
+func TestEmbedder(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := db.InsertText(ctx, 1, "hello", nil); !errors.Is(err, cvector.ErrNoEmbedder) {
+		t.Fatalf("Expected ErrNoEmbedder without an embedder, got %v", err)
+	}
+
+	embedder := &letterEmbedder{}
+	db.WithEmbedder(embedder)
+
+	texts := map[uint64]string{1: "aaaa", 2: "bbbb", 3: "cccc"}
+	for id, text := range texts {
+		if err := db.InsertText(ctx, id, text, map[string]any{"text": text}); err != nil {
+			t.Fatalf("Failed to insert text %d: %v", id, err)
+		}
+	}
+
+	stored, err := db.Get(2)
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if stored.Data[1] != 4 || stored.Metadata["text"] != "bbbb" {
+		t.Errorf("Unexpected stored vector %v with metadata %v", stored.Data[:3], stored.Metadata)
+	}
+
+	results, err := db.SearchText(ctx, "bb", 3)
+	if err != nil {
+		t.Fatalf("Failed to search text: %v", err)
+	}
+	found := false
+	for _, r := range results {
+		if r.ID == 2 {
+			found = r.Similarity > 0.999
+		}
+	}
+	if !found {
+		t.Errorf("Expected vector 2 as an exact match for query 'bb', got %d results", len(results))
+	}
+
+	if _, err := db.SearchText(ctx, "bb", 0); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for k=0, got %v", err)
+	}
+	if embedder.calls != 4 {
+		t.Errorf("Expected 4 embed calls, got %d", embedder.calls)
+	}
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	requests := 0
+	rateLimited := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v1/embeddings" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, "bad request target", http.StatusBadRequest)
+			return
+		}
+		if !rateLimited {
+			rateLimited = true
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		// Answer in reverse order to check embeddings are matched by index
+		type item struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}
+		var data []item
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			data = append(data, item{Index: i, Embedding: []float32{float32(len(req.Input[i])), 1}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer server.Close()
+
+	if _, err := embed.NewOpenAI(embed.OpenAIConfig{BaseURL: server.URL}); err == nil {
+		t.Error("Expected an error without a model")
+	}
+
+	embedder, err := embed.NewOpenAI(embed.OpenAIConfig{
+		BaseURL:    server.URL + "/v1/",
+		APIKey:     "test-key",
+		Model:      "test-model",
+		BatchSize:  2,
+		RetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create embedder: %v", err)
+	}
+
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	vectors, err := embedder.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("Failed to embed: %v", err)
+	}
+	if len(vectors) != len(texts) {
+		t.Fatalf("Expected %d vectors, got %d", len(texts), len(vectors))
+	}
+	for i, v := range vectors {
+		if v[0] != float32(len(texts[i])) {
+			t.Errorf("Vector %d out of order: %v", i, v)
+		}
+	}
+	// Three batches plus the rate-limited attempt
+	if requests != 4 {
+		t.Errorf("Expected 4 requests, got %d", requests)
+	}
+
+	// Client errors are returned without retrying
+	requests = 0
+	bad, _ := embed.NewOpenAI(embed.OpenAIConfig{BaseURL: server.URL + "/v1", Model: "test-model", RetryDelay: time.Millisecond})
+	_, err = bad.Embed(context.Background(), []string{"a"})
+	statusErr, ok := err.(*embed.StatusError)
+	if !ok || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a 400 StatusError, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected no retries for a client error, got %d requests", requests)
+	}
+}
+
+func TestOllamaEmbedder(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/api/embed" {
+			http.NotFound(w, r)
+			return
+		}
+		if requests == 1 {
+			http.Error(w, "model loading", http.StatusServiceUnavailable)
+			return
+		}
+
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "nomic-embed-text" {
+			http.Error(w, "unknown model", http.StatusNotFound)
+			return
+		}
+
+		embeddings := make([][]float32, len(req.Input))
+		for i, text := range req.Input {
+			embeddings[i] = []float32{float32(len(text))}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"embeddings": embeddings})
+	}))
+	defer server.Close()
+
+	embedder, err := embed.NewOllama(embed.OllamaConfig{
+		BaseURL:    server.URL,
+		Model:      "nomic-embed-text",
+		BatchSize:  2,
+		RetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create embedder: %v", err)
+	}
+
+	texts := []string{"a", "bb", "ccc"}
+	vectors, err := embedder.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("Failed to embed: %v", err)
+	}
+	for i, v := range vectors {
+		if len(v) != 1 || v[0] != float32(len(texts[i])) {
+			t.Errorf("Unexpected vector %d: %v", i, v)
+		}
+	}
+	// Two batches plus the retried unavailable response
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", requests)
+	}
+}
+
+func TestRAGSplitters(t *testing.T) {
+	text := "one two three four five six seven"
+
+	chunks := rag.TokenSplitter{ChunkSize: 3, Overlap: 1}.Split(text)
+	expected := []string{"one two three", "three four five", "five six seven"}
+	if len(chunks) != len(expected) {
+		t.Fatalf("Expected %d token chunks, got %d", len(expected), len(chunks))
+	}
+	for i, c := range chunks {
+		if c.Text != expected[i] || text[c.Start:c.End] != c.Text {
+			t.Errorf("Token chunk %d = %q at [%d:%d], expected %q", i, c.Text, c.Start, c.End, expected[i])
+		}
+	}
+
+	text = "First one here. Second is short. Third sentence is a bit longer! Fourth?"
+	chunks = rag.SentenceSplitter{ChunkSize: 7, Overlap: 1}.Split(text)
+	expected = []string{
+		"First one here. Second is short.",
+		"Third sentence is a bit longer! Fourth?",
+	}
+	if len(chunks) != len(expected) {
+		t.Fatalf("Expected %d sentence chunks, got %d: %v", len(expected), len(chunks), chunks)
+	}
+	for i, c := range chunks {
+		if c.Text != expected[i] {
+			t.Errorf("Sentence chunk %d = %q, expected %q", i, c.Text, expected[i])
+		}
+	}
+
+	// Overlap is kept when the next sentence still fits
+	chunks = rag.SentenceSplitter{ChunkSize: 4, Overlap: 1}.Split("A b. C d. E f.")
+	expected = []string{"A b. C d.", "C d. E f."}
+	if len(chunks) != len(expected) || chunks[0].Text != expected[0] || chunks[1].Text != expected[1] {
+		t.Errorf("Expected overlapping sentence chunks %q, got %v", expected, chunks)
+	}
+
+	if chunks := (rag.TokenSplitter{ChunkSize: 3}).Split("   "); len(chunks) != 0 {
+		t.Errorf("Expected no chunks for blank text, got %d", len(chunks))
+	}
+}
+
+func TestRAGStore(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	if err := db.Insert(createTestVector(10, testDimension)); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	store, err := rag.NewStore(db, &letterEmbedder{}, rag.TokenSplitter{ChunkSize: 4, Overlap: 2})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	docs := []rag.Document{
+		{ID: "alpha", Text: "apples and avocados are always available at the market", Metadata: map[string]any{"lang": "en"}},
+		{ID: "zulu", Text: "zebras zigzag through the zoo", Metadata: map[string]any{"lang": "en"}},
+	}
+	written, err := store.Ingest(context.Background(), docs...)
+	if err != nil {
+		t.Fatalf("Failed to ingest: %v", err)
+	}
+	if written != 6 {
+		t.Fatalf("Expected 6 chunks, got %d", written)
+	}
+
+	// Chunks are numbered after the existing vector
+	first, err := db.Get(11)
+	if err != nil {
+		t.Fatalf("Failed to get first chunk: %v", err)
+	}
+	if first.Metadata[rag.MetaDocID] != "alpha" || first.Metadata[rag.MetaText] != "apples and avocados are" || first.Metadata["lang"] != "en" {
+		t.Errorf("Unexpected chunk metadata %v", first.Metadata)
+	}
+
+	// A window covering every chunk stitches the whole document back
+	// together, whichever chunks matched, and each document is returned once
+	passages, err := store.Retrieve(context.Background(), "zebras in the zoo", 7, 10)
+	if err != nil {
+		t.Fatalf("Failed to retrieve: %v", err)
+	}
+	if len(passages) == 0 {
+		t.Fatal("Expected at least one passage")
+	}
+	texts := map[string]string{"alpha": docs[0].Text, "zulu": docs[1].Text}
+	seen := make(map[string]bool)
+	for _, p := range passages {
+		if seen[p.DocID] {
+			t.Errorf("Document %s returned in more than one passage", p.DocID)
+		}
+		seen[p.DocID] = true
+		if p.Text != texts[p.DocID] {
+			t.Errorf("Stitched passage %q, expected %q", p.Text, texts[p.DocID])
+		}
+	}
+
+	if _, err := store.Retrieve(context.Background(), "zoo", 0, 1); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for k=0, got %v", err)
+	}
+
+	if _, err := store.Ingest(context.Background(), rag.Document{ID: "empty"}); !errors.Is(err, rag.ErrEmptyDocument) {
+		t.Errorf("Expected ErrEmptyDocument, got %v", err)
+	}
+}
+
+func TestNormalizeOnInsert(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db, err := cvector.CreateDB(&cvector.DBConfig{
+		Name:              "normalized",
+		DataPath:          testDBPath,
+		Dimension:         4,
+		DefaultSimilarity: cvector.SimilarityCosine,
+		NormalizeOnInsert: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	if err := db.Insert(cvector.NewVector(1, []float32{3, 4, 0, 0})); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if err := db.Insert(cvector.NewVector(2, []float32{0, 0, 10, 0})); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	v, err := db.Get(1)
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if math.Abs(float64(v.Data[0])-0.6) > 1e-6 || math.Abs(float64(v.Data[1])-0.8) > 1e-6 {
+		t.Errorf("Expected stored vector (0.6, 0.8, 0, 0), got %v", v.Data)
+	}
+
+	// Cosine over unit vectors is unaffected by the query's length
+	results, err := db.SearchRadius(&cvector.Query{
+		QueryVector:   []float32{30, 40, 0, 0},
+		Similarity:    cvector.SimilarityCosine,
+		MinSimilarity: 0.5,
+	})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != 1 || math.Abs(float64(results[0].Similarity)-1) > 1e-6 {
+		t.Errorf("Expected vector 1 with similarity 1, got %d results", len(results))
+	}
+	db.Close()
+
+	// The setting is recorded in the file
+	db, err = cvector.OpenDB(testDBPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if !stats.NormalizeOnInsert {
+		t.Error("Expected NormalizeOnInsert to survive reopening")
+	}
+	if err := db.Insert(cvector.NewVector(3, []float32{0, 0, 0, 2})); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if v, _ := db.Get(3); v == nil || v.Data[3] != 1 {
+		t.Errorf("Expected vector inserted after reopening to be normalized")
+	}
+
+	// Per-query normalization makes dot products comparable to cosine
+	results, err = db.SearchRadius(&cvector.Query{
+		QueryVector:   []float32{0, 0, 5, 0},
+		Similarity:    cvector.SimilarityDotProduct,
+		MinSimilarity: 0.5,
+		Normalize:     true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != 2 || math.Abs(float64(results[0].Similarity)-1) > 1e-6 {
+		t.Errorf("Expected vector 2 with dot product 1, got %d results", len(results))
+	}
+}
+
+func TestInvalidVectorData(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db := createTestDB(t)
+	defer db.Close()
+
+	if err := db.Insert(createTestVector(1, testDimension)); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	cases := map[string]float32{
+		"NaN":  float32(math.NaN()),
+		"+Inf": float32(math.Inf(1)),
+		"-Inf": float32(math.Inf(-1)),
+	}
+	for name, bad := range cases {
+		vector := createTestVector(2, testDimension)
+		vector.Data[7] = bad
+
+		err := db.Insert(vector)
+		if !errors.Is(err, cvector.ErrInvalidVectorData) {
+			t.Fatalf("%s: expected ErrInvalidVectorData on insert, got %v", name, err)
+		}
+		var dataErr *cvector.VectorDataError
+		if !errors.As(err, &dataErr) || dataErr.Index != 7 {
+			t.Errorf("%s: expected the error to name component 7, got %v", name, err)
+		}
+
+		_, err = db.Search(&cvector.Query{QueryVector: vector.Data, TopK: 1, Similarity: cvector.SimilarityCosine})
+		if !errors.Is(err, cvector.ErrInvalidVectorData) {
+			t.Errorf("%s: expected ErrInvalidVectorData on search, got %v", name, err)
+		}
+		_, err = db.SearchRadius(&cvector.Query{QueryVector: vector.Data, Similarity: cvector.SimilarityCosine})
+		if !errors.Is(err, cvector.ErrInvalidVectorData) {
+			t.Errorf("%s: expected ErrInvalidVectorData on radius search, got %v", name, err)
+		}
+	}
+
+	if _, err := db.Get(2); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected rejected vector not to be stored, got %v", err)
+	}
+}
+
+func TestDimensionPolicy(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	config := &cvector.DBConfig{
+		DataPath:          testDBPath,
+		Dimension:         4,
+		DefaultSimilarity: cvector.SimilarityCosine,
+	}
+	db, err := cvector.CreateDB(config)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	// Strict is the default
+	if err := db.Insert(cvector.NewVector(1, []float32{1, 2, 3})); !errors.Is(err, cvector.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch under the strict policy, got %v", err)
+	}
+	db.Close()
+
+	config.DimensionPolicy = cvector.DimensionPad
+	db, err = cvector.OpenDBWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.Insert(cvector.NewVector(1, []float32{1, 2, 3})); err != nil {
+		t.Fatalf("Failed to insert short vector under the pad policy: %v", err)
+	}
+	if v, err := db.Get(1); err != nil || len(v.Data) != 4 || v.Data[2] != 3 || v.Data[3] != 0 {
+		t.Errorf("Expected vector padded to (1, 2, 3, 0), got %v (%v)", v, err)
+	}
+	if err := db.Insert(cvector.NewVector(2, []float32{1, 2, 3, 4, 5})); !errors.Is(err, cvector.ErrDimensionMismatch) {
+		t.Errorf("Expected long vectors to be rejected under the pad policy, got %v", err)
+	}
+	results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 2, 3}, Similarity: cvector.SimilarityCosine, MinSimilarity: 0.99})
+	if err != nil || len(results) != 1 || results[0].ID != 1 {
+		t.Errorf("Expected a short query to be padded and match vector 1, got %d results (%v)", len(results), err)
+	}
+	db.Close()
+
+	config.DimensionPolicy = cvector.DimensionTruncate
+	db, err = cvector.OpenDBWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Insert(cvector.NewVector(2, []float32{4, 3, 2, 1, 99})); err != nil {
+		t.Fatalf("Failed to insert long vector under the truncate policy: %v", err)
+	}
+	if v, err := db.Get(2); err != nil || len(v.Data) != 4 || v.Data[3] != 1 {
+		t.Errorf("Expected vector truncated to (4, 3, 2, 1), got %v (%v)", v, err)
+	}
+	if err := db.Insert(cvector.NewVector(3, []float32{1, 2})); !errors.Is(err, cvector.ErrDimensionMismatch) {
+		t.Errorf("Expected short vectors to be rejected under the truncate policy, got %v", err)
+	}
+}
+
+func TestMaxVectors(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	db, err := cvector.CreateDB(&cvector.DBConfig{
+		DataPath:          testDBPath,
+		Dimension:         testDimension,
+		DefaultSimilarity: cvector.SimilarityCosine,
+		MaxVectors:        3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err := db.Insert(createTestVector(uint64(i), testDimension)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i, err)
+		}
+	}
+	if err := db.Insert(createTestVector(4, testDimension)); !errors.Is(err, cvector.ErrDBFull) {
+		t.Errorf("Expected ErrDBFull at the limit, got %v", err)
+	}
+
+	// Deleting frees a slot
+	if err := db.Delete(1); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	if err := db.Insert(createTestVector(4, testDimension)); err != nil {
+		t.Errorf("Expected insert to succeed after a delete, got %v", err)
+	}
+
+	if err := db.SetMaxVectors(-1); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for a negative limit, got %v", err)
+	}
+	if err := db.SetMaxVectors(5); err != nil {
+		t.Fatalf("Failed to raise the limit: %v", err)
+	}
+	if err := db.Insert(createTestVector(5, testDimension)); err != nil {
+		t.Errorf("Expected insert to succeed after raising the limit, got %v", err)
+	}
+	db.Close()
+
+	// The limit is stored in the file
+	db, err = cvector.OpenDB(testDBPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.MaxVectors != 5 {
+		t.Errorf("Expected MaxVectors 5 after reopening, got %d", stats.MaxVectors)
+	}
+	if err := db.Insert(createTestVector(6, testDimension)); err != nil {
+		t.Fatalf("Failed to insert up to the limit: %v", err)
+	}
+	if err := db.Insert(createTestVector(7, testDimension)); !errors.Is(err, cvector.ErrDBFull) {
+		t.Errorf("Expected ErrDBFull after reopening, got %v", err)
+	}
+
+	if err := db.SetMaxVectors(0); err != nil {
+		t.Fatalf("Failed to remove the limit: %v", err)
+	}
+	if err := db.Insert(createTestVector(7, testDimension)); err != nil {
+		t.Errorf("Expected insert to succeed without a limit, got %v", err)
+	}
+}
+
+func TestOnConflict(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	config := &cvector.DBConfig{
+		DataPath:          testDBPath,
+		Dimension:         4,
+		DefaultSimilarity: cvector.SimilarityCosine,
+	}
+	db, err := cvector.CreateDB(config)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	original := cvector.NewVector(1, []float32{1, 0, 0, 0})
+	original.Metadata = map[string]any{"version": "1"}
+	if err := db.Insert(original); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	// ConflictError is the default
+	err = db.Insert(cvector.NewVector(1, []float32{0, 1, 0, 0}))
+	if !errors.Is(err, cvector.ErrDuplicateID) {
+		t.Errorf("Expected ErrDuplicateID, got %v", err)
+	}
+	db.Close()
+
+	config.OnConflict = cvector.ConflictIgnore
+	db, err = cvector.OpenDBWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.Insert(cvector.NewVector(1, []float32{0, 1, 0, 0})); err != nil {
+		t.Errorf("Expected duplicate to be ignored, got %v", err)
+	}
+	if v, err := db.Get(1); err != nil || v.Data[0] != 1 || v.Metadata["version"] != "1" {
+		t.Errorf("Expected the original vector to be kept, got %v (%v)", v, err)
+	}
+	db.Close()
+
+	config.OnConflict = cvector.ConflictOverwrite
+	db, err = cvector.OpenDBWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	replacement := cvector.NewVector(1, []float32{0, 1, 0, 0})
+	replacement.Metadata = map[string]any{"version": "2"}
+	if err := db.Insert(replacement); err != nil {
+		t.Fatalf("Failed to overwrite vector: %v", err)
+	}
+	if v, err := db.Get(1); err != nil || v.Data[1] != 1 || v.Metadata["version"] != "2" {
+		t.Errorf("Expected the replacement vector, got %v (%v)", v, err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.TotalVectors != 1 || stats.DeletedVectors != 1 {
+		t.Errorf("Expected 1 live and 1 tombstoned record, got %d and %d", stats.TotalVectors, stats.DeletedVectors)
+	}
+	results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{0, 1, 0, 0}, Similarity: cvector.SimilarityCosine, MinSimilarity: 0.99})
+	if err != nil || len(results) != 1 || results[0].ID != 1 {
+		t.Errorf("Expected search to find the replacement, got %d results (%v)", len(results), err)
+	}
+	db.Close()
+
+	// The replacement survives a reopen
+	db, err = cvector.OpenDB(testDBPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	if v, err := db.Get(1); err != nil || v.Data[1] != 1 {
+		t.Errorf("Expected the replacement after reopening, got %v (%v)", v, err)
+	}
+}
+
+func TestDuplicateID(t *testing.T) {
+	db := createTestDB(t)
+	defer cleanupTestDB(t)
+	defer db.Close()
+
+	for _, id := range []uint64{1, 7} {
+		if err := db.Insert(createTestVector(id, testDimension)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", id, err)
+		}
+	}
+
+	err := db.Insert(createTestVector(7, testDimension))
+	if !errors.Is(err, cvector.ErrDuplicateID) {
+		t.Fatalf("Expected ErrDuplicateID, got %v", err)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.TotalVectors != 2 || stats.IndexedVectors != 2 {
+		t.Errorf("Expected the rejected insert to leave 2 vectors and 2 index nodes, got %d and %d",
+			stats.TotalVectors, stats.IndexedVectors)
+	}
+	if stats.NextID != 8 {
+		t.Errorf("Expected NextID 8, got %d", stats.NextID)
+	}
+
+	// A deleted ID may be reused
+	if err := db.Delete(7); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	if err := db.Insert(createTestVector(7, testDimension)); err != nil {
+		t.Errorf("Expected a deleted ID to be reusable, got %v", err)
+	}
+	if err := db.Insert(createTestVector(stats.NextID, testDimension)); err != nil {
+		t.Errorf("Expected NextID to be free, got %v", err)
+	}
+}
+
+func TestOpError(t *testing.T) {
+	db := createTestDB(t)
+	defer cleanupTestDB(t)
+	defer db.Close()
+
+	_, err := db.Get(42)
+	if !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Fatalf("Expected errors.Is to match ErrVectorNotFound, got %v", err)
+	}
+
+	var opErr *cvector.OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("Expected an *OpError, got %T", err)
+	}
+	if opErr.Op != "get" || opErr.Path != testDBPath || opErr.ID != 42 || opErr.Code != cvector.ErrVectorNotFound {
+		t.Errorf("Unexpected error fields %+v", opErr)
+	}
+	if opErr.Detail != "Vector not found" {
+		t.Errorf("Expected the engine's message as Detail, got %q", opErr.Detail)
+	}
+	want := "cvector get " + testDBPath + " id 42: Vector not found"
+	if err.Error() != want {
+		t.Errorf("Expected message %q, got %q", want, err.Error())
+	}
+
+	// Errors from opening carry the path but no ID
+	_, err = cvector.OpenDB(filepath.Join(t.TempDir(), "missing.cvdb"))
+	if !errors.As(err, &opErr) || opErr.Op != "open" || opErr.ID != 0 || !strings.Contains(err.Error(), "missing.cvdb") {
+		t.Errorf("Expected an open error naming the path, got %v", err)
+	}
+}
+
+func TestSimilarityTypeText(t *testing.T) {
+	names := map[cvector.SimilarityType]string{
+		cvector.SimilarityCosine:     "cosine",
+		cvector.SimilarityDotProduct: "dot",
+		cvector.SimilarityEuclidean:  "euclidean",
+	}
+	for similarity, name := range names {
+		if similarity.String() != name {
+			t.Errorf("Expected %d to print as %q, got %q", int(similarity), name, similarity.String())
+		}
+		parsed, err := cvector.ParseSimilarity(strings.ToUpper(name))
+		if err != nil || parsed != similarity {
+			t.Errorf("Expected %q to parse as %v, got %v (%v)", name, similarity, parsed, err)
+		}
+	}
+
+	for alias, want := range map[string]cvector.SimilarityType{"dotproduct": cvector.SimilarityDotProduct, "l2": cvector.SimilarityEuclidean} {
+		if got, err := cvector.ParseSimilarity(alias); err != nil || got != want {
+			t.Errorf("Expected alias %q to parse as %v, got %v (%v)", alias, want, got, err)
+		}
+	}
+	if _, err := cvector.ParseSimilarity("manhattan"); err == nil {
+		t.Error("Expected an error for an unknown similarity name")
+	}
+
+	encoded, err := json.Marshal(cvector.Stats{DefaultSimilarity: cvector.SimilarityEuclidean})
+	if err != nil {
+		t.Fatalf("Failed to marshal stats: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"DefaultSimilarity":"euclidean"`) {
+		t.Errorf("Expected the similarity to be encoded by name, got %s", encoded)
+	}
+
+	var decoded struct{ Similarity cvector.SimilarityType }
+	if err := json.Unmarshal([]byte(`{"Similarity":"dot"}`), &decoded); err != nil || decoded.Similarity != cvector.SimilarityDotProduct {
+		t.Errorf("Expected \"dot\" to decode as SimilarityDotProduct, got %v (%v)", decoded.Similarity, err)
+	}
+	if _, err := json.Marshal(cvector.SimilarityType(9)); err == nil {
+		t.Error("Expected an error marshalling an unknown similarity type")
+	}
+}
+
+func TestOpenOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "options.cvdb")
+
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4), cvector.WithSimilarity(cvector.SimilarityEuclidean))
+	if err != nil {
+		t.Fatalf("Failed to create database with Open: %v", err)
+	}
+	if err := db.Insert(cvector.NewVector(1, []float32{1, 2, 3, 4})); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	stats, err := db.Stats()
+	if err != nil || stats.Dimension != 4 || stats.DefaultSimilarity != cvector.SimilarityEuclidean {
+		t.Errorf("Expected a 4-dimensional Euclidean database, got %+v (%v)", stats, err)
+	}
+	db.Close()
+
+	if _, err := cvector.Open(filepath.Join(t.TempDir(), "missing.cvdb")); !errors.Is(err, cvector.ErrDBNotFound) {
+		t.Errorf("Expected ErrDBNotFound without WithCreateIfMissing, got %v", err)
+	}
+
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read database file: %v", err)
+	}
+
+	db, err = cvector.Open(path, cvector.WithReadOnly(), cvector.WithSearchThreads(1))
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	if err := db.Insert(cvector.NewVector(2, []float32{4, 3, 2, 1})); !errors.Is(err, cvector.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from Insert, got %v", err)
+	}
+	if err := db.Delete(1); !errors.Is(err, cvector.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from Delete, got %v", err)
+	}
+	if err := db.Rename("other"); !errors.Is(err, cvector.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from Rename, got %v", err)
+	}
+
+	// Concurrent searches share the single slot
+	done := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 2, 3, 4}, Similarity: cvector.SimilarityCosine, MinSimilarity: 0.99})
+			if err == nil && len(results) != 1 {
+				err = fmt.Errorf("expected 1 result, got %d", len(results))
+			}
+			done <- err
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("Search failed: %v", err)
+		}
+	}
+	db.Close()
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read database file: %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("Expected a read-only session to leave the file unchanged")
+	}
+}
+
+func TestOpenOrCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ooc.cvdb")
+	config := &cvector.DBConfig{DataPath: path, Dimension: 4, DefaultSimilarity: cvector.SimilarityDotProduct}
+
+	db, err := cvector.OpenOrCreate(config)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if err := db.Insert(cvector.NewVector(1, []float32{1, 2, 3, 4})); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	db.Close()
+
+	db, err = cvector.OpenOrCreate(config)
+	if err != nil {
+		t.Fatalf("Failed to open existing database: %v", err)
+	}
+	if stats, err := db.Stats(); err != nil || stats.TotalVectors != 1 {
+		t.Errorf("Expected the existing vector to be kept, got %+v (%v)", stats, err)
+	}
+	db.Close()
+
+	wrongDim := *config
+	wrongDim.Dimension = 8
+	if _, err := cvector.OpenOrCreate(&wrongDim); !errors.Is(err, cvector.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+
+	wrongMetric := *config
+	wrongMetric.DefaultSimilarity = cvector.SimilarityCosine
+	if _, err := cvector.OpenOrCreate(&wrongMetric); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected a similarity mismatch error, got %v", err)
+	} else if !strings.Contains(err.Error(), "dot") {
+		t.Errorf("Expected the error to name the stored metric, got %v", err)
+	}
+
+	readOnly := *config
+	readOnly.DataPath = filepath.Join(t.TempDir(), "ro.cvdb")
+	readOnly.ReadOnly = true
+	db, err = cvector.OpenOrCreate(&readOnly)
+	if err != nil {
+		t.Fatalf("Failed to create read-only database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Insert(cvector.NewVector(1, []float32{1, 2, 3, 4})); !errors.Is(err, cvector.ErrReadOnly) {
+		t.Errorf("Expected a created read-only database to reject writes, got %v", err)
+	}
+}
+
+func TestCreateDBValidation(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	valid := cvector.DBConfig{DataPath: filepath.Join(dir, "valid.cvdb"), Dimension: 4}
+	tests := []struct {
+		name   string
+		modify func(*cvector.DBConfig)
+		field  string
+		reason string
+	}{
+		{"empty path", func(c *cvector.DBConfig) { c.DataPath = "" }, "DataPath", "must not be empty"},
+		{"long path", func(c *cvector.DBConfig) { c.DataPath = strings.Repeat("p", 2000) }, "DataPath", "shorter than"},
+		{"long name", func(c *cvector.DBConfig) { c.Name = strings.Repeat("n", 300) }, "Name", "shorter than 256"},
+		{"zero dimension", func(c *cvector.DBConfig) { c.Dimension = 0 }, "Dimension", "must be 1..4096, got 0"},
+		{"huge dimension", func(c *cvector.DBConfig) { c.Dimension = 70000 }, "Dimension", "got 70000"},
+		{"bad similarity", func(c *cvector.DBConfig) { c.DefaultSimilarity = 7 }, "DefaultSimilarity", "unknown"},
+		{"negative max vectors", func(c *cvector.DBConfig) { c.MaxVectors = -1 }, "MaxVectors", "negative"},
+		{"unwritable path", func(c *cvector.DBConfig) { c.DataPath = filepath.Join(blocker, "db.cvdb") }, "DataPath", "cannot create directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			db, err := cvector.CreateDB(&config)
+			if err == nil {
+				db.Close()
+				t.Fatal("Expected CreateDB to fail")
+			}
+			var configErr *cvector.ConfigError
+			if !errors.As(err, &configErr) || !errors.Is(err, cvector.ErrInvalidArgs) {
+				t.Fatalf("Expected a *ConfigError matching ErrInvalidArgs, got %T: %v", err, err)
+			}
+			if configErr.Field != tt.field || !strings.Contains(configErr.Reason, tt.reason) {
+				t.Errorf("Expected %s error containing %q, got %v", tt.field, tt.reason, err)
+			}
+		})
+	}
+
+	db, err := cvector.CreateDB(&valid)
+	if err != nil {
+		t.Fatalf("Expected the valid config to work, got %v", err)
+	}
+	db.Close()
+	if entries, _ := filepath.Glob(filepath.Join(dir, ".cvector-probe-*")); len(entries) != 0 {
+		t.Errorf("Expected the writability probe to be removed, found %v", entries)
+	}
+}
+
+func TestFlushAndSyncModes(t *testing.T) {
+	// The header's vector count sits after magic, version, dimension and
+	// similarity, and is only rewritten on close or flush
+	headerCount := func(path string) uint64 {
+		data, err := os.ReadFile(path)
+		if err != nil || len(data) < 24 {
+			t.Fatalf("Failed to read header: %v", err)
+		}
+		return binary.LittleEndian.Uint64(data[16:24])
+	}
+
+	dir := t.TempDir()
+	newDB := func(name string, opts ...cvector.Option) (*cvector.DB, string) {
+		path := filepath.Join(dir, name)
+		db, err := cvector.Open(path, append(opts, cvector.WithCreateIfMissing(4))...)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		if err := db.Insert(cvector.NewVector(1, []float32{1, 2, 3, 4})); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+		return db, path
+	}
+
+	db, path := newDB("os.cvdb")
+	if headerCount(path) != 0 {
+		t.Error("Expected SyncOS to leave the header alone until a flush")
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if headerCount(path) != 1 {
+		t.Error("Expected Flush to write the header")
+	}
+	db.Close()
+	if err := db.Flush(); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected Flush on a closed database to fail, got %v", err)
+	}
+
+	db, path = newDB("always.cvdb", cvector.WithSync(cvector.SyncAlways, 0))
+	if headerCount(path) != 1 {
+		t.Error("Expected SyncAlways to flush before Insert returns")
+	}
+	db.Close()
+
+	db, path = newDB("interval.cvdb", cvector.WithSync(cvector.SyncInterval, 5*time.Millisecond))
+	defer db.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for headerCount(path) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the background flush to write the header")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWriteBuffer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffered.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4),
+		cvector.WithWriteBuffer(16, time.Hour), cvector.WithSync(cvector.SyncAlways, 0))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	// A partial group waits for the delay, so the writes stay queued
+	for i := 1; i <= 10; i++ {
+		if err := db.Insert(cvector.NewVector(uint64(i), []float32{float32(i), 1, 1, 1})); err != nil {
+			t.Fatalf("Failed to queue vector %d: %v", i, err)
+		}
+	}
+	if n := db.Pending(); n != 10 {
+		t.Errorf("Expected 10 pending writes, got %d", n)
+	}
+	if err := db.Insert(cvector.NewVector(11, []float32{float32(math.NaN()), 1, 1, 1})); !errors.Is(err, cvector.ErrInvalidVectorData) {
+		t.Errorf("Expected invalid data to be rejected before queueing, got %v", err)
+	}
+
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if n := db.Pending(); n != 0 {
+		t.Errorf("Expected no pending writes after Flush, got %d", n)
+	}
+	if v, err := db.Get(10); err != nil || v.Data[0] != 10 {
+		t.Errorf("Expected vector 10 after Flush, got %v (%v)", v, err)
+	}
+
+	// Full groups commit without waiting, and failures surface on Flush
+	for i := 11; i <= 42; i++ {
+		db.Insert(cvector.NewVector(uint64(i), []float32{float32(i), 1, 1, 1}))
+	}
+	db.Insert(cvector.NewVector(5, []float32{1, 1, 1, 1}))
+	if err := db.Flush(); !errors.Is(err, cvector.ErrDuplicateID) {
+		t.Errorf("Expected the duplicate to be reported by Flush, got %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Errorf("Expected the error to be reported once, got %v", err)
+	}
+
+	// Deletes wait for queued inserts
+	db.Insert(cvector.NewVector(43, []float32{1, 2, 3, 4}))
+	if err := db.Delete(43); err != nil {
+		t.Errorf("Expected delete of a queued vector to succeed, got %v", err)
+	}
+
+	// Close applies whatever is still queued
+	db.Insert(cvector.NewVector(44, []float32{1, 2, 3, 4}))
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	db, err = cvector.OpenDB(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	if stats, err := db.Stats(); err != nil || stats.TotalVectors != 43 {
+		t.Errorf("Expected 43 vectors after reopening, got %+v (%v)", stats, err)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "compact.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4), cvector.WithOnConflict(cvector.ConflictOverwrite))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	for i := 1; i <= 20; i++ {
+		if err := db.Insert(cvector.NewVector(uint64(i), []float32{float32(i), 1, 1, 1})); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i, err)
+		}
+	}
+	for i := 1; i <= 5; i++ {
+		if err := db.Delete(uint64(i)); err != nil {
+			t.Fatalf("Failed to delete vector %d: %v", i, err)
+		}
+	}
+	db.Insert(cvector.NewVector(20, []float32{99, 1, 1, 1}))
+
+	before, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if before.DeletedVectors != 6 || math.Abs(before.DeadRatio-6.0/21.0) > 1e-9 {
+		t.Errorf("Expected 6 tombstones and a 6/21 dead ratio, got %d and %v", before.DeletedVectors, before.DeadRatio)
+	}
+
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	after, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if after.TotalVectors != 15 || after.DeletedVectors != 0 || after.DeadRatio != 0 || after.ReclaimableBytes != 0 {
+		t.Errorf("Expected 15 live vectors and no tombstones, got %+v", after)
+	}
+	if after.TotalSizeBytes != before.TotalSizeBytes-before.ReclaimableBytes {
+		t.Errorf("Expected the file to shrink by %d bytes, got %d -> %d", before.ReclaimableBytes, before.TotalSizeBytes, after.TotalSizeBytes)
+	}
+	if after.LastCompaction.IsZero() {
+		t.Error("Expected LastCompaction to be set")
+	}
+	if v, err := db.Get(20); err != nil || v.Data[0] != 99 {
+		t.Errorf("Expected the overwritten vector to survive compaction, got %v (%v)", v, err)
+	}
+	if _, err := db.Get(3); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected deleted vector to stay deleted, got %v", err)
+	}
+
+	// Deleted IDs can be reused once their tombstones are gone
+	if err := db.Insert(cvector.NewVector(3, []float32{3, 3, 3, 3})); err != nil {
+		t.Errorf("Failed to reinsert a compacted ID: %v", err)
+	}
+	db.Close()
+
+	db, err = cvector.OpenDB(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	if stats, err := db.Stats(); err != nil || stats.TotalVectors != 16 || stats.DeletedVectors != 0 {
+		t.Errorf("Expected 16 vectors and no tombstones after reopening, got %+v (%v)", stats, err)
+	}
+	if v, err := db.Get(12); err != nil || v.Data[0] != 12 {
+		t.Errorf("Expected vector 12 after reopening, got %v (%v)", v, err)
+	}
+	db.Close()
+
+	readOnly, err := cvector.Open(path, cvector.WithReadOnly())
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer readOnly.Close()
+	if err := readOnly.Compact(); !errors.Is(err, cvector.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly compacting a read-only database, got %v", err)
+	}
+}
+
+func TestGCPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gc.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4), cvector.WithGC(0.25, 0))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	for i := 1; i <= 8; i++ {
+		db.Insert(cvector.NewVector(uint64(i), []float32{float32(i), 1, 1, 1}))
+	}
+	db.Delete(1)
+	if stats, _ := db.Stats(); stats.DeletedVectors != 1 {
+		t.Errorf("Expected the tombstone to stay below the ratio, got %d", stats.DeletedVectors)
+	}
+
+	// The second delete crosses 25% and schedules a compaction
+	db.Delete(2)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats, err := db.Stats()
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.DeletedVectors == 0 && !stats.LastCompaction.IsZero() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected background compaction, stats %+v", stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	db.Close()
+
+	// The age trigger fires without further writes
+	db, err = cvector.Open(path, cvector.WithGC(0, 50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	db.Delete(3)
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		stats, _ := db.Stats()
+		if stats.DeletedVectors == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected compaction after GCMaxAge, stats %+v", stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := cvector.CreateDB(&cvector.DBConfig{DataPath: filepath.Join(t.TempDir(), "bad.cvdb"), Dimension: 4, GCDeadRatio: 1.5}); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected an out of range GCDeadRatio to be rejected, got %v", err)
+	}
+}
+
+func TestFormatMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "migrate.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		db.Insert(cvector.NewVector(uint64(i), []float32{float32(i), 1, 1, 1}))
+	}
+	db.Close()
+
+	if info, err := cvector.ReadFileInfo(path); err != nil || info.FormatVersion != cvector.FormatVersion {
+		t.Fatalf("Expected format version %d, got %+v (%v)", cvector.FormatVersion, info, err)
+	}
+	if result, err := cvector.Migrate(path); err != nil || result.BackupPath != "" {
+		t.Errorf("Expected a current file to be left alone, got %+v (%v)", result, err)
+	}
+
+	setVersion := func(version uint32) {
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatalf("Failed to open file: %v", err)
+		}
+		defer f.Close()
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], version)
+		if _, err := f.WriteAt(buf[:], 4); err != nil {
+			t.Fatalf("Failed to write version: %v", err)
+		}
+	}
+
+	// Newer files are refused rather than misread
+	setVersion(cvector.FormatVersion + 1)
+	if _, err := cvector.OpenDB(path); !errors.Is(err, cvector.ErrVersionTooNew) {
+		t.Errorf("Expected ErrVersionTooNew opening a newer file, got %v", err)
+	}
+	if _, err := cvector.Migrate(path); !errors.Is(err, cvector.ErrVersionTooNew) {
+		t.Errorf("Expected ErrVersionTooNew migrating a newer file, got %v", err)
+	}
+
+	// Readers open older files without changing them
+	setVersion(1)
+	reader, err := cvector.Open(path, cvector.WithReadOnly())
+	if err != nil {
+		t.Fatalf("Failed to open an old file read-only: %v", err)
+	}
+	if v, err := reader.Get(3); err != nil || v.Data[0] != 3 || v.Version != 1 {
+		t.Errorf("Expected vector 3 at version 1 from an old file, got %+v (%v)", v, err)
+	}
+	reader.Close()
+	if info, err := cvector.ReadFileInfo(path); err != nil || info.FormatVersion != 1 {
+		t.Errorf("Expected a read-only open to leave version 1, got %+v (%v)", info, err)
+	}
+
+	// Writers upgrade them in place
+	db, err = cvector.OpenDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open an old file: %v", err)
+	}
+	if info, err := cvector.ReadFileInfo(path); err != nil || info.FormatVersion != cvector.FormatVersion {
+		t.Errorf("Expected opening to upgrade the file to version %d, got %+v (%v)", cvector.FormatVersion, info, err)
+	}
+	db.Close()
+
+	// Migrate does the same ahead of time and keeps a backup
+	setVersion(1)
+	result, err := cvector.Migrate(path)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if result.FromVersion != 1 || result.ToVersion != cvector.FormatVersion {
+		t.Errorf("Expected migration from 1 to %d, got %+v", cvector.FormatVersion, result)
+	}
+	if info, err := cvector.ReadFileInfo(result.BackupPath); err != nil || info.FormatVersion != 1 || info.LiveRecords != 3 {
+		t.Errorf("Expected a version 1 backup with 3 records, got %+v (%v)", info, err)
+	}
+
+	db, err = cvector.OpenDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open migrated database: %v", err)
+	}
+	defer db.Close()
+	if v, err := db.Get(2); err != nil || v.Data[0] != 2 {
+		t.Errorf("Expected vector 2 after migration, got %v (%v)", v, err)
+	}
+}
+
+func TestReadCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4), cvector.WithCache(1<<20),
+		cvector.WithOnConflict(cvector.ConflictOverwrite))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 10; i++ {
+		db.Insert(cvector.NewVector(uint64(i), []float32{float32(i), 1, 1, 1}))
+	}
+
+	for round := 0; round < 3; round++ {
+		if v, err := db.Get(5); err != nil || v.Data[0] != 5 {
+			t.Fatalf("Expected vector 5, got %v (%v)", v, err)
+		}
+	}
+	stats, _ := db.Stats()
+	if stats.CacheMisses != 1 || stats.CacheHits != 2 || stats.CacheEntries != 1 {
+		t.Errorf("Expected 1 miss then 2 hits, got %d misses, %d hits, %d entries", stats.CacheMisses, stats.CacheHits, stats.CacheEntries)
+	}
+	entrySize := stats.CacheBytes
+
+	// Writes invalidate the cached copy
+	db.Insert(cvector.NewVector(5, []float32{50, 1, 1, 1}))
+	if v, err := db.Get(5); err != nil || v.Data[0] != 50 {
+		t.Errorf("Expected the overwritten vector, got %v (%v)", v, err)
+	}
+	db.Delete(5)
+	if _, err := db.Get(5); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected deleted vector to miss the cache, got %v", err)
+	}
+
+	// A budget for two entries keeps only the most recently read
+	if err := db.SetCacheSize(2 * entrySize); err != nil {
+		t.Fatalf("SetCacheSize failed: %v", err)
+	}
+	for _, id := range []uint64{1, 2, 3, 2} {
+		db.Get(id)
+	}
+	stats, _ = db.Stats()
+	if stats.CacheEntries != 2 || stats.CacheBytes > stats.CacheCapacity {
+		t.Errorf("Expected 2 entries within budget, got %d entries, %d of %d bytes", stats.CacheEntries, stats.CacheBytes, stats.CacheCapacity)
+	}
+	hits := stats.CacheHits
+	db.Get(3)
+	db.Get(1)
+	stats, _ = db.Stats()
+	if stats.CacheHits != hits+1 {
+		t.Errorf("Expected 3 to be cached and 1 evicted, got %d new hits", stats.CacheHits-hits)
+	}
+
+	if usage, err := db.MemoryUsage(); err != nil || usage.Cache < int64(stats.CacheBytes) {
+		t.Errorf("Expected memory usage to include the cache, got %+v (%v)", usage, err)
+	}
+	if err := db.SetCacheSize(0); err != nil {
+		t.Fatalf("SetCacheSize(0) failed: %v", err)
+	}
+	if stats, _ := db.Stats(); stats.CacheEntries != 0 || stats.CacheBytes != 0 {
+		t.Errorf("Expected a disabled cache to be empty, got %d entries", stats.CacheEntries)
+	}
+}
+
+func TestBlockCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(64), cvector.WithBlockCache(1<<20))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 50; i++ {
+		if err := db.Insert(createTestVector(uint64(i), 64)); err != nil {
+			t.Fatalf("Failed to insert vector %d: %v", i, err)
+		}
+	}
+
+	// 50 records of 288 bytes span 4 blocks, each read from the file once
+	for i := 1; i <= 50; i++ {
+		if v, err := db.Get(uint64(i)); err != nil || v.Data[0] != createTestVector(uint64(i), 64).Data[0] {
+			t.Fatalf("Expected vector %d, got %v (%v)", i, v, err)
+		}
+	}
+	stats, _ := db.Stats()
+	if stats.BlockCacheMisses != 4 || stats.BlockCacheHits == 0 {
+		t.Errorf("Expected 4 block misses and some hits, got %d misses, %d hits", stats.BlockCacheMisses, stats.BlockCacheHits)
+	}
+	misses := stats.BlockCacheMisses
+	for i := 1; i <= 50; i++ {
+		db.Get(uint64(i))
+	}
+	if stats, _ := db.Stats(); stats.BlockCacheMisses != misses {
+		t.Errorf("Expected a second pass to be served from cache, got %d new misses", stats.BlockCacheMisses-misses)
+	}
+
+	// Appends, tombstones and compaction must not leave stale blocks behind
+	appended := createTestVector(51, 64)
+	db.Insert(appended)
+	if v, err := db.Get(51); err != nil || v.Data[0] != appended.Data[0] {
+		t.Errorf("Expected the appended vector, got %v (%v)", v, err)
+	}
+	db.Delete(10)
+	if _, err := db.Get(10); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected deleted vector to be gone, got %v", err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	for _, id := range []uint64{1, 25, 51} {
+		if v, err := db.Get(id); err != nil || v.Data[0] != createTestVector(id, 64).Data[0] {
+			t.Errorf("Expected vector %d after compaction, got %v (%v)", id, v, err)
+		}
+	}
+
+	if err := db.SetBlockCacheSize(8192); err != nil {
+		t.Fatalf("SetBlockCacheSize failed: %v", err)
+	}
+	for i := 1; i <= 51; i++ {
+		db.Get(uint64(i))
+	}
+	if stats, _ := db.Stats(); stats.BlockCacheBytes > stats.BlockCacheCapacity {
+		t.Errorf("Expected the cache to stay within %d bytes, got %d", stats.BlockCacheCapacity, stats.BlockCacheBytes)
+	}
+	if usage, err := db.MemoryUsage(); err != nil || usage.BlockCache == 0 {
+		t.Errorf("Expected memory usage to include the block cache, got %+v (%v)", usage, err)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "warmup.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(8))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for i := 1; i <= 20; i++ {
+		db.Insert(createTestVector(uint64(i), 8))
+	}
+	db.Close()
+
+	db, err = cvector.Open(path, cvector.WithCache(1<<20))
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := db.Warmup(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled warmup to stop, got %v", err)
+	}
+
+	if err := db.Warmup(context.Background()); err != nil {
+		t.Fatalf("Warmup failed: %v", err)
+	}
+	stats, _ := db.Stats()
+	if stats.CacheEntries != 20 {
+		t.Errorf("Expected all 20 vectors cached, got %d", stats.CacheEntries)
+	}
+	misses := stats.CacheMisses
+	db.Get(7)
+	if stats, _ := db.Stats(); stats.CacheMisses != misses {
+		t.Errorf("Expected a Get after warmup to hit the cache, got %d new misses", stats.CacheMisses-misses)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limited.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(64), cvector.WithCache(1<<20))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	defer cvector.SetMemoryLimit(0)
+
+	for i := 1; i <= 10; i++ {
+		db.Insert(createTestVector(uint64(i), 64))
+	}
+	base := cvector.MemoryCharged()
+	if base <= 0 {
+		t.Fatalf("Expected the index to be charged, got %d", base)
+	}
+
+	// Room for a few more nodes, then inserts are refused without writing
+	if err := cvector.SetMemoryLimit(base + 4096); err != nil {
+		t.Fatalf("SetMemoryLimit failed: %v", err)
+	}
+	var refused error
+	inserted := 10
+	for i := 11; i <= 200 && refused == nil; i++ {
+		if refused = db.Insert(createTestVector(uint64(i), 64)); refused == nil {
+			inserted++
+		}
+	}
+	if !errors.Is(refused, cvector.ErrOutOfMemory) {
+		t.Fatalf("Expected ErrOutOfMemory under the limit, got %v", refused)
+	}
+	if !strings.Contains(refused.Error(), "memory limit") {
+		t.Errorf("Expected the error to name the memory limit, got %q", refused.Error())
+	}
+	if charged := cvector.MemoryCharged(); charged > cvector.MemoryLimit() {
+		t.Errorf("Expected usage within the limit, got %d of %d", charged, cvector.MemoryLimit())
+	}
+	if stats, _ := db.Stats(); stats.TotalVectors != inserted {
+		t.Errorf("Expected the refused insert not to be stored, got %d vectors for %d inserts", stats.TotalVectors, inserted)
+	}
+
+	// Caches shed entries rather than failing reads
+	for i := 1; i <= inserted; i++ {
+		if _, err := db.Get(uint64(i)); err != nil {
+			t.Fatalf("Get %d failed under the limit: %v", i, err)
+		}
+	}
+
+	// Deletes free index memory for new inserts
+	db.Delete(1)
+	db.Delete(2)
+	if err := db.Insert(createTestVector(1000, 64)); err != nil {
+		t.Errorf("Expected an insert after freeing memory to succeed, got %v", err)
+	}
+
+	cvector.SetMemoryLimit(0)
+	if err := cvector.SetMemoryLimit(-1); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected a negative limit to be rejected, got %v", err)
+	}
+}
+
+func TestSizeQuota(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(16), cvector.WithMaxSize(4096),
+		cvector.WithOnConflict(cvector.ConflictOverwrite))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var refused error
+	inserted := 0
+	for i := 1; i <= 1000 && refused == nil; i++ {
+		if refused = db.Insert(createTestVector(uint64(i), 16)); refused == nil {
+			inserted++
+		}
+	}
+	if !errors.Is(refused, cvector.ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded at the quota, got %v", refused)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.MaxSizeBytes != 4096 || stats.TotalSizeBytes > 4096 {
+		t.Errorf("Expected the file within a 4096 byte quota, got %d of %d", stats.TotalSizeBytes, stats.MaxSizeBytes)
+	}
+	if stats.TotalVectors != inserted {
+		t.Errorf("Expected the refused insert not to be stored, got %d vectors for %d inserts", stats.TotalVectors, inserted)
+	}
+
+	// Overwrites append too, so they are refused, and the old vector survives
+	v := createTestVector(1, 16)
+	v.Data[0] = 42
+	if err := db.Insert(v); !errors.Is(err, cvector.ErrQuotaExceeded) {
+		t.Errorf("Expected an overwrite to hit the quota, got %v", err)
+	}
+	if got, err := db.Get(1); err != nil || got.Data[0] == 42 {
+		t.Errorf("Expected vector 1 unchanged after the refused overwrite, got %v, %v", got, err)
+	}
+
+	// Deletes alone do not shrink the file; compaction makes room
+	db.Delete(1)
+	db.Delete(2)
+	if err := db.Insert(createTestVector(2000, 16)); !errors.Is(err, cvector.ErrQuotaExceeded) {
+		t.Errorf("Expected the quota to count tombstones, got %v", err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if err := db.Insert(createTestVector(2000, 16)); err != nil {
+		t.Errorf("Expected an insert after compaction to succeed, got %v", err)
+	}
+
+	if err := db.SetMaxSize(0); err != nil {
+		t.Fatalf("SetMaxSize failed: %v", err)
+	}
+	if err := db.Insert(createTestVector(2001, 16)); err != nil {
+		t.Errorf("Expected inserts without a quota to succeed, got %v", err)
+	}
+	if err := db.SetMaxSize(-1); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected a negative quota to be rejected, got %v", err)
+	}
+}
+
+func TestAdmissionControl(t *testing.T) {
+	dir := t.TempDir()
+
+	// A long delay holds the queue until Flush, so the limit is reached
+	db, err := cvector.Open(filepath.Join(dir, "queued.cvdb"), cvector.WithCreateIfMissing(8),
+		cvector.WithWriteBuffer(100, time.Hour), cvector.WithAdmission(0, 3))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := db.Insert(createTestVector(uint64(i), 8)); err != nil {
+			t.Fatalf("Insert %d failed under the queue limit: %v", i, err)
+		}
+	}
+	err = db.Insert(createTestVector(4, 8))
+	var overload *cvector.OverloadError
+	if !errors.As(err, &overload) || !errors.Is(err, cvector.ErrOverloaded) {
+		t.Fatalf("Expected an OverloadError past the queue limit, got %v", err)
+	}
+	if overload.Limit != "MaxQueuedInserts" || overload.Value != 3 || overload.RetryAfter <= 0 {
+		t.Errorf("Expected a MaxQueuedInserts pushback with a retry hint, got %+v", overload)
+	}
+
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := db.Insert(createTestVector(4, 8)); err != nil {
+		t.Errorf("Expected the retry after draining to succeed, got %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	stats, _ := db.Stats()
+	if stats.TotalVectors != 4 || stats.RejectedInserts != 1 {
+		t.Errorf("Expected 4 vectors and 1 rejection, got %d and %d", stats.TotalVectors, stats.RejectedInserts)
+	}
+	db.Close()
+
+	// Concurrent unbuffered inserts either run or are pushed back, never lost
+	db, err = cvector.Open(filepath.Join(dir, "inflight.cvdb"), cvector.WithCreateIfMissing(8),
+		cvector.WithAdmission(1, 0))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	stored, rejected := 0, 0
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				err := db.Insert(createTestVector(uint64(w*50+i+1), 8))
+				var pushback *cvector.OverloadError
+				mu.Lock()
+				switch {
+				case err == nil:
+					stored++
+				case errors.As(err, &pushback) && pushback.Limit == "MaxInflightInserts":
+					rejected++
+				default:
+					t.Errorf("Unexpected insert error: %v", err)
+				}
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	stats, _ = db.Stats()
+	if stats.TotalVectors != stored || int(stats.RejectedInserts) != rejected {
+		t.Errorf("Expected %d stored and %d rejected, got %d and %d", stored, rejected, stats.TotalVectors, stats.RejectedInserts)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Outermost hook records the order calls reach it
+	var seen []string
+	db.Use(func(call *cvector.Call, next func() error) error {
+		seen = append(seen, string(call.Op))
+		return next()
+	})
+
+	// Validation: veto vectors with a negative first component
+	errNegative := errors.New("negative first component")
+	db.Use(func(call *cvector.Call, next func() error) error {
+		if call.Op == cvector.HookInsert && call.Vector != nil && call.Vector.Data[0] < 0 {
+			return errNegative
+		}
+		return next()
+	})
+
+	// Caching: answer repeated searches without reaching the engine
+	cached := map[float32][]*cvector.Result{}
+	engineSearches := 0
+	db.Use(func(call *cvector.Call, next func() error) error {
+		if call.Op != cvector.HookSearch {
+			return next()
+		}
+		key := call.Query.QueryVector[0]
+		if results, ok := cached[key]; ok {
+			call.Results = results
+			return nil
+		}
+		engineSearches++
+		if err := next(); err != nil {
+			return err
+		}
+		cached[key] = call.Results
+		return nil
+	})
+
+	if err := db.Insert(cvector.NewVector(1, []float32{1, 0, 0, 0})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := db.Insert(cvector.NewVector(2, []float32{-1, 0, 0, 0})); !errors.Is(err, errNegative) {
+		t.Errorf("Expected the hook to veto the insert, got %v", err)
+	}
+	if _, err := db.Get(2); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected the vetoed vector not to be stored, got %v", err)
+	}
+
+	query := &cvector.Query{QueryVector: []float32{1, 0, 0, 0}, TopK: 5}
+	for i := 0; i < 3; i++ {
+		results, err := db.Search(query)
+		if err != nil || len(results) != 1 || results[0].ID != 1 {
+			t.Fatalf("Expected vector 1 from search %d, got %v, %v", i, results, err)
+		}
+	}
+	if engineSearches != 1 {
+		t.Errorf("Expected the cache hook to answer repeats, got %d engine searches", engineSearches)
+	}
+
+	if err := db.Delete(1); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	want := []string{"insert", "insert", "search", "search", "search", "delete"}
+	if strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected hooks to see %v, got %v", want, seen)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var events []webhook.Event
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// The first delivery fails and must be retried
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body struct {
+			Events []webhook.Event `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode webhook body: %v", err)
+		}
+		events = append(events, body.Events...)
+	}))
+	defer server.Close()
+
+	notifier, err := webhook.New(webhook.Config{
+		URLs:          []string{server.URL},
+		BatchSize:     10,
+		FlushInterval: 10 * time.Millisecond,
+		RetryDelay:    time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "webhook.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.Use(notifier.Hook())
+
+	db.Insert(cvector.NewVector(1, []float32{1, 0, 0, 0}))
+	db.Insert(cvector.NewVector(2, []float32{0, 1, 0, 0}))
+	db.Delete(1)
+	db.Delete(99) // Fails, so no event
+	db.Search(&cvector.Query{QueryVector: []float32{1, 0, 0, 0}, TopK: 1})
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	db.Close()
+	notifier.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	var got []string
+	for _, e := range events {
+		got = append(got, fmt.Sprintf("%s:%d", e.Type, e.ID))
+	}
+	want := "insert:1,insert:2,delete:1,compact:0"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Expected events %s, got %v", want, got)
+	}
+	if notifier.Dropped() != 0 {
+		t.Errorf("Expected no dropped events, got %d", notifier.Dropped())
+	}
+
+	// Close gives up on an endpoint that keeps failing rather than retrying
+	// every queued batch to the end
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer dead.Close()
+	stuck, err := webhook.New(webhook.Config{
+		URLs:         []string{dead.URL},
+		BatchSize:    1,
+		MaxRetries:   100,
+		RetryDelay:   time.Second,
+		CloseTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	for id := uint64(1); id <= 5; id++ {
+		stuck.Notify(webhook.Event{Type: "insert", ID: id})
+	}
+	start := time.Now()
+	if err := stuck.Close(); err == nil {
+		t.Error("Expected Close to report undelivered events")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Close to stop at its timeout, took %v", elapsed)
+	}
+	if stuck.Dropped() != 5 {
+		t.Errorf("Expected the 5 undelivered events to be counted as dropped, got %d", stuck.Dropped())
+	}
+
+	if _, err := webhook.New(webhook.Config{}); err == nil {
+		t.Error("Expected a notifier without URLs to be rejected")
+	}
+}
+
+func TestManager(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "tenants")
+	m, err := cvector.NewManager(cvector.ManagerConfig{
+		Root:      root,
+		Dimension: 4,
+		MaxOpen:   2,
+		Limits: func(name string) []cvector.Option {
+			if name == "small" {
+				return []cvector.Option{cvector.WithMaxVectors(1)}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	defer m.Close()
+
+	// Databases are created on first use and routed by name
+	for i, name := range []string{"a", "b", "c"} {
+		if err := m.Insert(name, cvector.NewVector(uint64(i+1), []float32{float32(i + 1), 1, 0, 0})); err != nil {
+			t.Fatalf("Insert into %s failed: %v", name, err)
+		}
+	}
+	if n := m.OpenCount(); n > 2 {
+		t.Errorf("Expected at most 2 open databases, got %d", n)
+	}
+	names, err := m.Names()
+	if err != nil || strings.Join(names, ",") != "a,b,c" {
+		t.Errorf("Expected databases a,b,c, got %v, %v", names, err)
+	}
+
+	// An evicted database reopens with its data
+	results, err := m.Search("a", &cvector.Query{QueryVector: []float32{1, 1, 0, 0}, TopK: 5})
+	if err != nil || len(results) != 1 || results[0].ID != 1 {
+		t.Errorf("Expected vector 1 from a, got %v, %v", results, err)
+	}
+
+	// Per-database limits
+	m.Insert("small", cvector.NewVector(1, []float32{1, 0, 0, 0}))
+	if err := m.Insert("small", cvector.NewVector(2, []float32{1, 0, 0, 0})); !errors.Is(err, cvector.ErrDBFull) {
+		t.Errorf("Expected the small database to be full, got %v", err)
+	}
+
+	if err := m.Insert("../escape", cvector.NewVector(1, []float32{1, 0, 0, 0})); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected a path-like name to be rejected, got %v", err)
+	}
+
+	// Drop refuses a database in use, then removes it
+	err = m.Do("b", func(db *cvector.DB) error { return m.Drop("b") })
+	if !errors.Is(err, cvector.ErrDatabaseInUse) {
+		t.Errorf("Expected ErrDatabaseInUse, got %v", err)
+	}
+	if err := m.Drop("b"); err != nil {
+		t.Fatalf("Drop failed: %v", err)
+	}
+	if _, err := os.Stat(m.Path("b")); !os.IsNotExist(err) {
+		t.Errorf("Expected b's file to be removed, got %v", err)
+	}
+
+	// Without a dimension unknown names are not created
+	strict, err := cvector.NewManager(cvector.ManagerConfig{Root: root, IdleTimeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	defer strict.Close()
+	if err := strict.Insert("missing", cvector.NewVector(1, []float32{1, 0, 0, 0})); !errors.Is(err, cvector.ErrDBNotFound) {
+		t.Errorf("Expected ErrDBNotFound for an unknown name, got %v", err)
+	}
+
+	// Idle databases are closed
+	m.Close()
+	if _, err := strict.Search("c", &cvector.Query{QueryVector: []float32{1, 0, 0, 0}, TopK: 1}); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for strict.OpenCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := strict.OpenCount(); n != 0 {
+		t.Errorf("Expected the idle database to be closed, got %d open", n)
+	}
+}
+
+func TestManagerCollections(t *testing.T) {
+	m, err := cvector.NewManager(cvector.ManagerConfig{Root: t.TempDir(), Dimension: 4, MaxOpen: 1})
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	defer m.Close()
+
+	// Each collection keeps its own dimension and metric next to the default
+	if err := m.Create("images", 8, cvector.SimilarityEuclidean); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := m.Create("images", 8, cvector.SimilarityEuclidean); !errors.Is(err, cvector.ErrFileIO) {
+		t.Errorf("Expected ErrFileIO creating a taken name, got %v", err)
+	}
+	if err := m.Insert("text", cvector.NewVector(1, []float32{1, 0, 0, 0})); err != nil {
+		t.Fatalf("Insert into text failed: %v", err)
+	}
+
+	// MaxOpen of 1 closes each between calls, so every call reopens it
+	for round := 0; round < 2; round++ {
+		image := cvector.NewVector(uint64(round+1), []float32{1, 2, 3, 4, 5, 6, 7, float32(round)})
+		if err := m.Insert("images", image); err != nil {
+			t.Fatalf("Insert into images failed: %v", err)
+		}
+		if err := m.Insert("text", cvector.NewVector(uint64(round+2), []float32{0, 1, 0, 0})); err != nil {
+			t.Fatalf("Insert into text failed: %v", err)
+		}
+	}
+	if err := m.Insert("images", cvector.NewVector(9, []float32{1, 0, 0, 0})); !errors.Is(err, cvector.ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch for a text vector in images, got %v", err)
+	}
+
+	for name, want := range map[string]struct {
+		dimension  uint32
+		similarity cvector.SimilarityType
+	}{
+		"images": {8, cvector.SimilarityEuclidean},
+		"text":   {4, cvector.SimilarityCosine},
+	} {
+		err := m.Do(name, func(db *cvector.DB) error {
+			stats, err := db.Stats()
+			if err != nil {
+				return err
+			}
+			if stats.Dimension != want.dimension || stats.DefaultSimilarity != want.similarity {
+				t.Errorf("Expected %s to have dimension %d and %v, got %d and %v",
+					name, want.dimension, want.similarity, stats.Dimension, stats.DefaultSimilarity)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Stats of %s failed: %v", name, err)
+		}
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	db, err := cvector.Open(filepath.Join(dir, "src.cvdb"), cvector.WithCreateIfMissing(8),
+		cvector.WithSimilarity(cvector.SimilarityEuclidean))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 50; i++ {
+		v := createTestVector(uint64(i), 8)
+		if i%5 == 0 {
+			v.Metadata = map[string]any{"group": "five", "n": float64(i)}
+		}
+		if i%2 == 0 {
+			v.Tags = []string{"even"}
+		}
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert %d failed: %v", i, err)
+		}
+	}
+	db.Delete(7)
+
+	var buf bytes.Buffer
+	n, err := db.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("Expected WriteTo to report %d bytes, got %d", buf.Len(), n)
+	}
+	stream := buf.Bytes()
+
+	dstPath := filepath.Join(dir, "dst.cvdb")
+	dst, err := cvector.ReadFrom(bytes.NewReader(stream), dstPath)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	defer dst.Close()
+
+	stats, _ := dst.Stats()
+	if stats.TotalVectors != 49 || stats.Dimension != 8 || stats.DefaultSimilarity != cvector.SimilarityEuclidean {
+		t.Errorf("Expected 49 euclidean vectors of dimension 8, got %+v", stats)
+	}
+	if _, err := dst.Get(7); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected the deleted vector to stay deleted, got %v", err)
+	}
+	got, err := dst.Get(10)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	want := createTestVector(10, 8)
+	for i := range want.Data {
+		if got.Data[i] != want.Data[i] {
+			t.Fatalf("Expected vector 10 to round-trip, got %v", got.Data)
+		}
+	}
+	if got.Metadata["group"] != "five" || got.Metadata["n"] != float64(10) {
+		t.Errorf("Expected metadata to round-trip, got %v", got.Metadata)
+	}
+	if !slices.Equal(got.Tags, []string{"even"}) {
+		t.Errorf("Expected tags to round-trip, got %v", got.Tags)
+	}
+	results, err := dst.Search(&cvector.Query{QueryVector: want.Data, TopK: 50, Tags: []string{"even"}})
+	if err != nil || len(results) != 25 {
+		t.Errorf("Expected the 25 tagged vectors to be found by tag, got %d (%v)", len(results), err)
+	}
+
+	// Truncated and corrupt streams leave nothing behind
+	badPath := filepath.Join(dir, "bad.cvdb")
+	if _, err := cvector.ReadFrom(bytes.NewReader(stream[:len(stream)-10]), badPath); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected a truncated stream to fail with ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := os.Stat(badPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no database after a failed read, got %v", err)
+	}
+	corrupt := append([]byte(nil), stream...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	if _, err := cvector.ReadFrom(bytes.NewReader(corrupt), badPath); err == nil {
+		t.Error("Expected a corrupt stream to be rejected")
+	}
+	if _, err := os.Stat(badPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no database after a failed read, got %v", err)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	db, err := cvector.Open(filepath.Join(dir, "src.cvdb"), cvector.WithCreateIfMissing(8), cvector.WithVersionHistory(2))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var first *cvector.Vector
+	for i := 1; i <= 30; i++ {
+		v := createTestVector(uint64(i), 8)
+		v.Metadata = map[string]any{"n": float64(i)}
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert %d failed: %v", i, err)
+		}
+		if i == 5 {
+			first = v
+		}
+	}
+	if err := db.UpdateIf(5, 1, createTestVector(50, 8).Data); err != nil {
+		t.Fatalf("UpdateIf failed: %v", err)
+	}
+
+	var archive bytes.Buffer
+	if err := db.Backup(&archive); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dir, "*.backup-*")); len(entries) != 0 {
+		t.Errorf("Expected Backup to clean up its snapshot, found %v", entries)
+	}
+
+	// Writes after the backup are not in it
+	db.Insert(createTestVector(31, 8))
+
+	restored := filepath.Join(dir, "restored.cvdb")
+	if err := cvector.RestoreBackup(bytes.NewReader(archive.Bytes()), restored); err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	rdb, err := cvector.Open(restored, cvector.WithVersionHistory(2))
+	if err != nil {
+		t.Fatalf("Failed to open restored database: %v", err)
+	}
+	defer rdb.Close()
+	stats, _ := rdb.Stats()
+	if stats.TotalVectors != 30 {
+		t.Errorf("Expected 30 restored vectors, got %d", stats.TotalVectors)
+	}
+	if !stats.IndexLoaded || stats.IndexedVectors != 30 {
+		t.Errorf("Expected the backed up index to be loaded, stats %+v", stats)
+	}
+	if v, err := rdb.Get(12); err != nil || v.Metadata["n"] != float64(12) {
+		t.Errorf("Expected vector 12 with its metadata, got %v, %v", v, err)
+	}
+	if old, err := rdb.GetVersion(5, 1); err != nil || !slices.Equal(old.Data, first.Data) || old.Metadata["n"] != float64(5) {
+		t.Errorf("Expected the previous version of vector 5 to be restored, got %v, %v", old, err)
+	}
+
+	// Existing targets are refused
+	if err := cvector.RestoreBackup(bytes.NewReader(archive.Bytes()), restored); err == nil {
+		t.Error("Expected a restore over an existing database to fail")
+	}
+
+	// A damaged archive leaves nothing behind
+	damaged := append([]byte(nil), archive.Bytes()...)
+	damaged[len(damaged)/2] ^= 0xff
+	badPath := filepath.Join(dir, "bad.cvdb")
+	if err := cvector.RestoreBackup(bytes.NewReader(damaged), badPath); !errors.Is(err, cvector.ErrDBCorrupt) {
+		t.Errorf("Expected ErrDBCorrupt for a damaged archive, got %v", err)
+	}
+	if _, err := os.Stat(badPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no database after a failed restore, got %v", err)
+	}
+}
+
+func TestOptimisticConcurrency(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "versions.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer func() { db.Close() }()
+
+	v := cvector.NewVector(1, []float32{1, 0, 0, 0})
+	v.Metadata = map[string]any{"tag": "a"}
+	if err := db.Insert(v); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	got, err := db.Get(1)
+	if err != nil || got.Version != 1 {
+		t.Fatalf("Expected version 1 after insert, got %+v (%v)", got, err)
+	}
+
+	if err := db.UpdateIf(1, 1, []float32{0, 1, 0, 0}); err != nil {
+		t.Fatalf("UpdateIf at the current version failed: %v", err)
+	}
+	got, _ = db.Get(1)
+	if got.Version != 2 || got.Data[1] != 1 || got.Metadata["tag"] != "a" {
+		t.Errorf("Expected version 2 with new data and kept metadata, got %+v", got)
+	}
+	// The update appends a record and supersedes the old one
+	if info, err := cvector.ReadFileInfo(path); err != nil || info.LiveRecords != 1 || info.DeletedRecords != 1 || info.UpdatedRecords != 1 {
+		t.Errorf("Expected one live, one superseded and one updated record, got %+v (%v)", info, err)
+	}
+
+	// A writer holding the old version loses
+	if err := db.UpdateIf(1, 1, []float32{0, 0, 1, 0}); !errors.Is(err, cvector.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict for a stale update, got %v", err)
+	}
+	if err := db.DeleteIf(1, 1); !errors.Is(err, cvector.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict for a stale delete, got %v", err)
+	}
+	if got, _ := db.Get(1); got.Version != 2 || got.Data[1] != 1 {
+		t.Errorf("Expected a conflict to change nothing, got %+v", got)
+	}
+	if err := db.UpdateIf(2, 1, []float32{0, 0, 1, 0}); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound for a missing vector, got %v", err)
+	}
+
+	// Versions survive reopening and compaction
+	db.Close()
+	if db, err = cvector.OpenDB(path); err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if got, err := db.Get(1); err != nil || got.Version != 2 {
+		t.Errorf("Expected version 2 after reopen and compaction, got %+v (%v)", got, err)
+	}
+
+	// Of several writers racing from the same version exactly one wins
+	var wg sync.WaitGroup
+	var wins sync.Map
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := db.UpdateIf(1, 2, []float32{float32(i), 1, 1, 1})
+			switch {
+			case err == nil:
+				wins.Store(i, true)
+			case errors.Is(err, cvector.ErrVersionConflict):
+			default:
+				t.Errorf("Unexpected UpdateIf error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	won := 0
+	wins.Range(func(any, any) bool { won++; return true })
+	if won != 1 {
+		t.Errorf("Expected exactly one racing writer to win, got %d", won)
+	}
+
+	if err := db.DeleteIf(1, 3); err != nil {
+		t.Fatalf("DeleteIf at the current version failed: %v", err)
+	}
+	if _, err := db.Get(1); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected the vector to be deleted, got %v", err)
+	}
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 20; i++ {
+		v := cvector.NewVector(uint64(i), []float32{float32(i), 1, 1, 1})
+		v.Metadata = map[string]any{"n": float64(i)}
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	// Writes from inside the iteration, including a compaction that moves
+	// every record, do not show through
+	var seen []uint64
+	err = db.Iterate(func(v *cvector.Vector) error {
+		seen = append(seen, v.ID)
+		if v.Data[0] != float32(v.ID) || v.Version != 1 || v.Metadata["n"] != float64(v.ID) {
+			t.Errorf("Vector %d changed under the iteration: %+v", v.ID, v)
+		}
+		if v.ID == 1 {
+			for i := 2; i <= 10; i++ {
+				if err := db.Delete(uint64(i)); err != nil {
+					return err
+				}
+			}
+			if err := db.UpdateIf(11, 1, []float32{-1, -1, -1, -1}); err != nil {
+				return err
+			}
+			if err := db.Insert(cvector.NewVector(100, []float32{1, 2, 3, 4})); err != nil {
+				return err
+			}
+			if err := db.Compact(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Iterate failed: %v", err)
+	}
+	if len(seen) != 20 || seen[19] != 20 {
+		t.Errorf("Expected the 20 vectors present at the start in ID order, got %v", seen)
+	}
+
+	// A new iteration sees the writes
+	count := 0
+	db.Iterate(func(v *cvector.Vector) error {
+		count++
+		if v.ID == 11 && (v.Data[0] != -1 || v.Version != 2) {
+			t.Errorf("Expected the update to be visible afterwards, got %+v", v)
+		}
+		return nil
+	})
+	if count != 12 {
+		t.Errorf("Expected 12 vectors after the writes, got %d", count)
+	}
+
+	// Searches racing with overwrites always find the vector being rewritten
+	db, err = cvector.Open(filepath.Join(t.TempDir(), "race.cvdb"), cvector.WithCreateIfMissing(4))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	for i := 1; i <= 5; i++ {
+		if err := db.Insert(cvector.NewVector(uint64(i+12), []float32{float32(i), 1, 1, 1})); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			v, err := db.Get(15)
+			if err != nil {
+				t.Errorf("Get failed: %v", err)
+				return
+			}
+			if err := db.UpdateIf(15, v.Version, []float32{15, 1, 1, float32(i % 3)}); err != nil {
+				t.Errorf("UpdateIf failed: %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		results, err := db.Search(&cvector.Query{QueryVector: []float32{15, 1, 1, 1}, TopK: 5})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		found := false
+		for _, r := range results {
+			found = found || r.ID == 15
+		}
+		if !found {
+			t.Fatalf("Search %d missed a vector that was only being overwritten", i)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestFileLocking(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locked.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	// A second writer is turned away with the holder's PID
+	_, err = cvector.OpenDB(path)
+	if !errors.Is(err, cvector.ErrLocked) {
+		t.Fatalf("Expected ErrLocked opening a locked database, got %v", err)
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("process %d", os.Getpid())) {
+		t.Errorf("Expected the error to name process %d, got %v", os.Getpid(), err)
+	}
+	if pid, err := cvector.LockHolder(path); err != nil || pid != os.Getpid() {
+		t.Errorf("Expected LockHolder to report %d, got %d (%v)", os.Getpid(), pid, err)
+	}
+	if err := cvector.DropDB(path); !errors.Is(err, cvector.ErrLocked) {
+		t.Errorf("Expected ErrLocked dropping a locked database, got %v", err)
+	}
+
+	// Readers do not need the lock
+	reader, err := cvector.OpenDBWithConfig(&cvector.DBConfig{DataPath: path, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Read-only open of a locked database failed: %v", err)
+	}
+	reader.Close()
+
+	// Closing releases it; the lock file left behind does not block anyone
+	db.Close()
+	if pid, err := cvector.LockHolder(path); err != nil || pid != 0 {
+		t.Errorf("Expected no lock holder after Close, got %d (%v)", pid, err)
+	}
+	if db, err = cvector.OpenDB(path); err != nil {
+		t.Fatalf("Reopen after Close failed: %v", err)
+	}
+
+	// Forcing the lock lets a new writer in
+	if err := cvector.ForceUnlock(path); err != nil {
+		t.Fatalf("ForceUnlock failed: %v", err)
+	}
+	forced, err := cvector.OpenDB(path)
+	if err != nil {
+		t.Fatalf("Open after ForceUnlock failed: %v", err)
+	}
+	forced.Close()
+	db.Close()
+
+	if err := cvector.DropDB(path); err != nil {
+		t.Fatalf("DropDB failed: %v", err)
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("Expected DropDB to remove the lock file, got %v", err)
+	}
+}
+
+func TestSharedReaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Insert(cvector.NewVector(1, []float32{1, 0, 0, 0})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	// Any number of readers share the file with the writer
+	var readers []*cvector.DB
+	for i := 0; i < 2; i++ {
+		reader, err := cvector.OpenDBWithConfig(&cvector.DBConfig{DataPath: path, ReadOnly: true})
+		if err != nil {
+			t.Fatalf("Read-only open %d failed: %v", i, err)
+		}
+		defer reader.Close()
+		readers = append(readers, reader)
+	}
+	if err := readers[0].Refresh(); err != nil {
+		t.Fatalf("Refresh of an unchanged database failed: %v", err)
+	}
+
+	// Readers keep their view until they refresh
+	v := cvector.NewVector(2, []float32{0, 1, 0, 0})
+	v.Metadata = map[string]any{"tag": "new"}
+	if err := db.Insert(v); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if _, err := readers[0].Get(2); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected the reader not to see vector 2 before Refresh, got %v", err)
+	}
+	if err := readers[0].Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	got, err := readers[0].Get(2)
+	if err != nil {
+		t.Fatalf("Expected vector 2 after Refresh: %v", err)
+	}
+	if got.Metadata["tag"] != "new" {
+		t.Errorf("Expected the refreshed metadata, got %v", got.Metadata)
+	}
+	if _, err := readers[1].Get(2); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected the other reader to keep its own view, got %v", err)
+	}
+
+	// Dropping waits for the readers
+	if err := cvector.DropDB(path); !errors.Is(err, cvector.ErrLocked) {
+		t.Errorf("Expected ErrLocked dropping a database with readers, got %v", err)
+	}
+
+	// A compaction replaces the file under the readers without disturbing them
+	if err := db.Delete(1); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if _, err := readers[1].Get(1); err != nil {
+		t.Errorf("Expected the reader to keep vector 1 across the compaction: %v", err)
+	}
+	if err := readers[1].Refresh(); err != nil {
+		t.Fatalf("Refresh after compaction failed: %v", err)
+	}
+	if _, err := readers[1].Get(1); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected vector 1 gone after Refresh, got %v", err)
+	}
+	if _, err := readers[1].Get(2); err != nil {
+		t.Errorf("Expected vector 2 after Refresh: %v", err)
+	}
+
+	if err := db.Refresh(); err != nil {
+		t.Errorf("Expected Refresh to be a no-op on the writer, got %v", err)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "broken.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for i := 1; i <= 10; i++ {
+		v := cvector.NewVector(uint64(i), []float32{float32(i), 1, 1, 1})
+		v.Metadata = map[string]any{"n": float64(i)}
+		v.Tags = []string{"kept"}
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := db.Delete(4); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	db.Close()
+
+	// Damage a record header, a record's data and the end of the file. The
+	// 80-byte file header is followed by 48-byte records in insert order.
+	const headerSize, recordSize = 80, 32 + 4*4
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open data file: %v", err)
+	}
+	nan := math.Float32bits(float32(math.NaN()))
+	f.WriteAt([]byte{0xff, 0xff, 0xff, 0x7f}, headerSize+2*recordSize+8)
+	f.WriteAt([]byte{byte(nan), byte(nan >> 8), byte(nan >> 16), byte(nan >> 24)}, headerSize+5*recordSize+32)
+	f.Truncate(headerSize + 9*recordSize + 20)
+	f.Close()
+
+	out := filepath.Join(dir, "recovered.cvdb")
+	report, err := cvector.Repair(path, out)
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if report.RecordsScanned != 10 || report.Recovered != 6 || report.Deleted != 1 || report.Unreadable != 3 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if !slices.Equal(report.LostIDs, []uint64{3, 6, 10}) {
+		t.Errorf("Expected lost IDs [3 6 10], got %v", report.LostIDs)
+	}
+
+	repaired, err := cvector.OpenDB(out)
+	if err != nil {
+		t.Fatalf("Failed to open the repaired database: %v", err)
+	}
+	defer repaired.Close()
+	ids, err := repaired.IDs()
+	if err != nil {
+		t.Fatalf("IDs failed: %v", err)
+	}
+	if !slices.Equal(ids, []uint64{1, 2, 5, 7, 8, 9}) {
+		t.Errorf("Expected IDs [1 2 5 7 8 9], got %v", ids)
+	}
+	v, err := repaired.Get(7)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if v.Data[0] != 7 || v.Metadata["n"] != float64(7) || !slices.Equal(v.Tags, []string{"kept"}) || v.Version != 1 {
+		t.Errorf("Vector 7 not recovered intact: %+v", v)
+	}
+
+	// The target must be new, and a damaged file header is beyond repair
+	if _, err := cvector.Repair(path, out); !errors.Is(err, cvector.ErrFileIO) {
+		t.Errorf("Expected ErrFileIO repairing onto an existing database, got %v", err)
+	}
+	os.WriteFile(path, []byte("not a database file at all, just some bytes to fill a header"), 0644)
+	if _, err := cvector.Repair(path, filepath.Join(dir, "hopeless.cvdb")); !errors.Is(err, cvector.ErrDBCorrupt) {
+		t.Errorf("Expected ErrDBCorrupt for a damaged header, got %v", err)
+	}
+}
+
+func TestSkipCorruptRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "damaged.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := db.Insert(cvector.NewVector(uint64(i), []float32{float32(i), 1, 1, 1})); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	db.Close()
+
+	// Garble the dimension of vector 2's record
+	const headerSize, recordSize = 80, 32 + 4*4
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open data file: %v", err)
+	}
+	f.WriteAt([]byte{0x13, 0x37, 0, 0}, headerSize+recordSize+8)
+	f.Close()
+
+	if _, err := cvector.OpenDB(path); !errors.Is(err, cvector.ErrDBCorrupt) {
+		t.Fatalf("Expected ErrDBCorrupt opening a damaged file, got %v", err)
+	}
+
+	db, err = cvector.Open(path, cvector.WithSkipCorruptRecords())
+	if err != nil {
+		t.Fatalf("Open with SkipCorruptRecords failed: %v", err)
+	}
+	defer db.Close()
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.TotalVectors != 4 || stats.UnreadableRecords != 1 {
+		t.Errorf("Expected 4 vectors and 1 unreadable record, got %d and %d", stats.TotalVectors, stats.UnreadableRecords)
+	}
+	if _, err := db.Get(2); !errors.Is(err, cvector.ErrDBCorrupt) {
+		t.Errorf("Expected ErrDBCorrupt getting the damaged vector, got %v", err)
+	}
+	if _, err := db.Describe(2); !errors.Is(err, cvector.ErrDBCorrupt) {
+		t.Errorf("Expected ErrDBCorrupt describing the damaged vector, got %v", err)
+	}
+	if v, err := db.Get(3); err != nil || v.Data[0] != 3 {
+		t.Errorf("Expected vector 3 past the damaged record, got %v (%v)", v, err)
+	}
+	results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{5, 1, 1, 1}, Similarity: cvector.SimilarityCosine, MinSimilarity: -1})
+	if err != nil || len(results) != 4 || results[0].ID != 5 {
+		t.Errorf("Expected a scan to find the 4 intact vectors, 5 first, got %d results (%v)", len(results), err)
+	}
+
+	// The damaged record's slot is still stepped over by later writes and
+	// compaction, which drops it for good
+	if err := db.Insert(cvector.NewVector(6, []float32{6, 1, 1, 1})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if _, err := db.Get(2); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound after compaction, got %v", err)
+	}
+	db.Close()
+
+	db, err = cvector.OpenDB(path)
+	if err != nil {
+		t.Fatalf("Expected a strict open to succeed after compaction: %v", err)
+	}
+	if ids, err := db.IDs(); err != nil || !slices.Equal(ids, []uint64{1, 3, 4, 5, 6}) {
+		t.Errorf("Expected IDs [1 3 4 5 6], got %v (%v)", ids, err)
+	}
+}
+
+func TestFloat64Vectors(t *testing.T) {
+	db, err := cvector.Open(filepath.Join(t.TempDir(), "f64.cvdb"), cvector.WithCreateIfMissing(3))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	data := []float64{0.1, 0.2, 0.7}
+	if err := db.Insert(cvector.NewVector64(1, data)); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := db.Insert(cvector.NewVector64(2, []float64{-1, 0, 0})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	v, err := db.Get(1)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	for i, x := range v.Data64() {
+		if x != float64(float32(data[i])) {
+			t.Errorf("Component %d: expected %v rounded to float32, got %v", i, data[i], x)
+		}
+	}
+
+	results, err := db.SearchRadius(&cvector.Query{QueryVector64: data, MinSimilarity: 0.99})
+	if err != nil || len(results) != 1 || results[0].ID != 1 {
+		t.Errorf("Expected the float64 query to find vector 1, got %d results (%v)", len(results), err)
+	}
+
+	// Values a float32 cannot hold are rejected rather than stored as infinity
+	err = db.Insert(cvector.NewVector64(3, []float64{1e300, 0, 0}))
+	if !errors.Is(err, cvector.ErrInvalidVectorData) {
+		t.Errorf("Expected ErrInvalidVectorData for an out-of-range component, got %v", err)
+	}
+	if _, err := db.Search(&cvector.Query{QueryVector64: []float64{0, -1e300, 0}, TopK: 1}); !errors.Is(err, cvector.ErrInvalidVectorData) {
+		t.Errorf("Expected ErrInvalidVectorData for an out-of-range query, got %v", err)
+	}
+}
+
+func TestQueryDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "defaults.cvdb")
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 4, DefaultTopK: 2, DefaultMinSimilarity: 0.5, DefaultOversample: 3})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := db.Insert(cvector.NewVector(uint64(i), []float32{1, float32(i) - 1, 0, 0})); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	// Zero fields take the defaults; explicit ones win. Oversampling finds
+	// the best matches where a bare top-2 index search can miss them.
+	results, err := db.Search(&cvector.Query{QueryVector: []float32{1, 0, 0, 0}})
+	if err != nil || len(results) != 2 || results[0].ID != 1 || results[1].ID != 2 {
+		t.Fatalf("Expected the default 2 results, vectors 1 and 2, got %d (%v)", len(results), err)
+	}
+	results, err = db.Search(&cvector.Query{QueryVector: []float32{1, 0, 0, 0}, TopK: 5})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	for _, r := range results {
+		if r.Similarity < 0.5 {
+			t.Errorf("Expected the default threshold to drop vector %d at %v", r.ID, r.Similarity)
+		}
+	}
+	results, err = db.Search(&cvector.Query{QueryVector: []float32{1, 0, 0, 0}, TopK: 1, Oversample: 5})
+	if err != nil || len(results) != 1 || results[0].ID != 1 {
+		t.Errorf("Expected an oversampled search to keep only the best result, got %d (%v)", len(results), err)
+	}
+
+	if err := db.SetQueryDefaults(cvector.QueryDefaults{TopK: 3, Oversample: 2}); err != nil {
+		t.Fatalf("SetQueryDefaults failed: %v", err)
+	}
+	if err := db.SetQueryDefaults(cvector.QueryDefaults{MinSimilarity: 2}); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for a threshold above 1, got %v", err)
+	}
+	db.Close()
+
+	// Stored defaults survive a reopen, and open-time values override them
+	db, err = cvector.OpenDB(path)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	if d := db.QueryDefaults(); d != (cvector.QueryDefaults{TopK: 3, Oversample: 2}) {
+		t.Errorf("Expected the stored defaults, got %+v", d)
+	}
+	db.Close()
+
+	db, err = cvector.OpenDBWithConfig(&cvector.DBConfig{DataPath: path, DefaultTopK: 4})
+	if err != nil {
+		t.Fatalf("OpenDBWithConfig failed: %v", err)
+	}
+	defer db.Close()
+	if d := db.QueryDefaults(); d != (cvector.QueryDefaults{TopK: 4, Oversample: 2}) {
+		t.Errorf("Expected TopK overridden to 4, got %+v", d)
+	}
+}
+
+func TestNormalizedScores(t *testing.T) {
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: filepath.Join(t.TempDir(), "scores.cvdb"), Dimension: 2})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	defer db.Close()
+	for i, v := range [][]float32{{1, 0}, {0, 1}, {-1, 0}} {
+		if err := db.Insert(cvector.NewVector(uint64(i+1), v)); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 0}, MinSimilarity: -1, NormalizeScores: true})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d (%v)", len(results), err)
+	}
+	for i, want := range []float32{1, 0.5, 0} {
+		if math.Abs(float64(results[i].Similarity-want)) > 1e-6 {
+			t.Errorf("Expected normalized cosine score %v for vector %d, got %v", want, results[i].ID, results[i].Similarity)
+		}
+	}
+
+	results, err = db.Search(&cvector.Query{QueryVector: []float32{1, 0}, TopK: 3, Similarity: cvector.SimilarityEuclidean, NormalizeScores: true})
+	if err != nil || len(results) == 0 || results[0].ID != 1 || results[0].Similarity != 1 {
+		t.Fatalf("Expected vector 1 first with score 1, got %d results (%v)", len(results), err)
+	}
+	for _, r := range results {
+		if r.Similarity < 0 || r.Similarity > 1 {
+			t.Errorf("Expected a score in [0, 1] for vector %d, got %v", r.ID, r.Similarity)
+		}
+	}
+
+	cases := []struct {
+		similarity cvector.SimilarityType
+		raw, want  float32
+	}{
+		{cvector.SimilarityCosine, -1, 0},
+		{cvector.SimilarityDotProduct, 0, 0.5},
+		{cvector.SimilarityEuclidean, 0, 1},
+		{cvector.SimilarityEuclidean, -3, 0.25},
+	}
+	for _, c := range cases {
+		if got := cvector.NormalizeScore(c.similarity, c.raw); math.Abs(float64(got-c.want)) > 1e-6 {
+			t.Errorf("NormalizeScore(%v, %v) = %v, want %v", c.similarity, c.raw, got, c.want)
+		}
+	}
+	if cvector.NormalizeScore(cvector.SimilarityDotProduct, 5) <= cvector.NormalizeScore(cvector.SimilarityDotProduct, 4) {
+		t.Error("Expected normalized dot products to keep their order")
+	}
+}
+
+func TestFusion(t *testing.T) {
+	a := []*cvector.Result{{ID: 1, Similarity: 0.9}, {ID: 2, Similarity: 0.8}, {ID: 3, Similarity: 0.1}}
+	b := []*cvector.Result{{ID: 2, Similarity: 0.95}, {ID: 3, Similarity: 0.7}}
+
+	// Vector 2 ranks well in both lists, so reciprocal rank fusion puts it first
+	fused, err := cvector.FuseResults(cvector.Fusion{}, a, b)
+	if err != nil || len(fused) != 3 || fused[0].ID != 2 {
+		t.Fatalf("Expected vector 2 first of 3, got %d results (%v)", len(fused), err)
+	}
+	want := float32(1.0/62 + 1.0/61)
+	if math.Abs(float64(fused[0].Similarity-want)) > 1e-6 {
+		t.Errorf("Expected RRF score %v, got %v", want, fused[0].Similarity)
+	}
+
+	fused, err = cvector.FuseResults(cvector.Fusion{Method: cvector.FusionWeightedSum, Weights: []float32{1, 0.5}, TopK: 2}, a, b)
+	if err != nil || len(fused) != 2 || fused[0].ID != 2 || fused[1].ID != 1 {
+		t.Fatalf("Expected vectors 2 and 1, got %d results (%v)", len(fused), err)
+	}
+	if math.Abs(float64(fused[0].Similarity-1.275)) > 1e-6 {
+		t.Errorf("Expected weighted score 1.275, got %v", fused[0].Similarity)
+	}
+
+	if _, err := cvector.FuseResults(cvector.Fusion{Weights: []float32{1}}, a, b); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for a weight count mismatch, got %v", err)
+	}
+	if _, err := cvector.FuseResults(cvector.Fusion{Method: "max"}, a); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for an unknown method, got %v", err)
+	}
+
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: filepath.Join(t.TempDir(), "fusion.cvdb"), Dimension: 2, DefaultOversample: 4})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	defer db.Close()
+	for i, v := range [][]float32{{1, 0}, {1, 1}, {0, 1}, {-1, 0}} {
+		if err := db.Insert(cvector.NewVector(uint64(i+1), v)); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	// Vector 2 lies between the two query vectors
+	queries := []*cvector.Query{
+		{QueryVector: []float32{1, 0.1}, TopK: 2},
+		{QueryVector: []float32{0.1, 1}, TopK: 2, Similarity: cvector.SimilarityEuclidean},
+	}
+	for _, method := range []cvector.FusionMethod{cvector.FusionRRF, cvector.FusionWeightedSum} {
+		results, err := db.SearchFused(queries, cvector.Fusion{Method: method, TopK: 1})
+		if err != nil || len(results) != 1 || results[0].ID != 2 {
+			t.Errorf("Expected %s fusion to pick vector 2, got %v (%v)", method, results, err)
+		}
+	}
+	if queries[0].NormalizeScores {
+		t.Error("Expected SearchFused to leave the caller's queries unchanged")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: filepath.Join(t.TempDir(), "pipeline.cvdb"), Dimension: 2})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	defer db.Close()
+	for i, v := range [][]float32{{1, 0}, {4, 0.5}, {0, 1}, {-1, 0}} {
+		if err := db.Insert(cvector.NewVector(uint64(i+1), v)); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	// By cosine vector 1 is nearest, but rescoring by euclidean distance
+	// from (3, 0) promotes vector 2
+	var reranked []uint64
+	results, err := db.Pipeline(&cvector.Query{QueryVector: []float32{3, 0}, TopK: 1}).
+		Prefetch(4).
+		Rescore(3, cvector.SimilarityEuclidean).
+		Rerank(2, func(query *cvector.Query, candidates []*cvector.Result) ([]*cvector.Result, error) {
+			for _, c := range candidates {
+				reranked = append(reranked, c.ID)
+			}
+			return candidates, nil
+		}).
+		Run()
+	if err != nil || len(results) != 1 || results[0].ID != 2 {
+		t.Fatalf("Expected vector 2 from the pipeline, got %v (%v)", results, err)
+	}
+	if want := float32(-math.Sqrt(1.25)); math.Abs(float64(results[0].Similarity-want)) > 1e-5 {
+		t.Errorf("Expected the rescored distance %v, got %v", want, results[0].Similarity)
+	}
+	if len(reranked) != 3 || reranked[0] != 2 || reranked[1] != 1 {
+		t.Errorf("Expected the reranker to see the 3 rescored candidates, got %v", reranked)
+	}
+
+	if _, err := db.Pipeline(&cvector.Query{QueryVector: []float32{3, 0}}).Rescore(2, cvector.SimilarityCosine).Prefetch(10).Run(); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for a prefetch after another stage, got %v", err)
+	}
+	if _, err := db.Pipeline(&cvector.Query{QueryVector: []float32{3, 0}}).Rerank(0, nil).Run(); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for an empty rerank stage, got %v", err)
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: filepath.Join(t.TempDir(), "recommend.cvdb"), Dimension: 2, DefaultOversample: 5})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	defer db.Close()
+	for i, v := range [][]float32{{1, 0}, {0.7, 0.7}, {0.95, -0.3}, {0, 1}, {-1, 0}} {
+		if err := db.Insert(cvector.NewVector(uint64(i+1), v)); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	// Moving away from vector 4 favours vector 3 over vector 2
+	results, err := db.Recommend([]uint64{1}, []uint64{4}, 1)
+	if err != nil || len(results) != 1 || results[0].ID != 3 {
+		t.Fatalf("Expected vector 3, got %v (%v)", results, err)
+	}
+	results, err = db.Recommend([]uint64{1}, nil, 10)
+	if err != nil {
+		t.Fatalf("Recommend failed: %v", err)
+	}
+	for _, r := range results {
+		if r.ID == 1 {
+			t.Error("Expected the positive example to be excluded")
+		}
+	}
+
+	results, err = db.RecommendBestScore([]uint64{1}, []uint64{4}, 3)
+	if err != nil || len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d (%v)", len(results), err)
+	}
+	if results[0].ID != 3 || results[1].ID != 2 || results[2].ID != 5 {
+		t.Errorf("Expected vectors 3, 2, 5, got %d, %d, %d", results[0].ID, results[1].ID, results[2].ID)
+	}
+	if results[2].Similarity > 0 {
+		t.Errorf("Expected vector 5, nearer the negative, to score at most 0, got %v", results[2].Similarity)
+	}
+
+	if _, err := db.Recommend(nil, []uint64{4}, 1); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs without positives, got %v", err)
+	}
+	if _, err := db.Recommend([]uint64{99}, nil, 1); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound for a missing example, got %v", err)
+	}
+}
+
+func TestTieOrdering(t *testing.T) {
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: filepath.Join(t.TempDir(), "ties.cvdb"), Dimension: 2})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	defer db.Close()
+
+	// Identical vectors inserted out of ID order all score the same
+	for _, id := range []uint64{7, 3, 9, 1, 5} {
+		if err := db.Insert(cvector.NewVector(id, []float32{1, 1})); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := db.Insert(cvector.NewVector(4, []float32{1, 0})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	want := []uint64{1, 3, 5, 7, 9, 4}
+	for run := 0; run < 5; run++ {
+		results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 1}, MinSimilarity: -1})
+		if err != nil || len(results) != len(want) {
+			t.Fatalf("Expected %d results, got %d (%v)", len(want), len(results), err)
+		}
+		for i, r := range results {
+			if r.ID != want[i] {
+				t.Fatalf("Expected IDs %v, got vector %d at rank %d", want, r.ID, i)
+			}
+		}
+
+		results, err = db.Search(&cvector.Query{QueryVector: []float32{1, 1}, TopK: 6})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		for i := 1; i < len(results); i++ {
+			prev, cur := results[i-1], results[i]
+			if prev.Similarity == cur.Similarity && prev.ID > cur.ID {
+				t.Fatalf("Expected equal scores in ID order, got %d before %d", prev.ID, cur.ID)
+			}
+		}
+	}
+}
+
+func TestDedupeBy(t *testing.T) {
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: filepath.Join(t.TempDir(), "dedupe.cvdb"), Dimension: 2})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	defer db.Close()
+
+	// Three chunks of document a outscore everything in document b
+	chunks := []struct {
+		data []float32
+		doc  string
+	}{
+		{[]float32{1, 0}, "a"},
+		{[]float32{1, 0.05}, "a"},
+		{[]float32{1, 0.1}, "a"},
+		{[]float32{1, 0.5}, "b"},
+		{[]float32{1, 0.6}, "b"},
+		{[]float32{0.2, 1}, "c"},
+	}
+	for i, c := range chunks {
+		v := cvector.NewVector(uint64(i+1), c.data)
+		v.Metadata = map[string]any{"doc_id": c.doc}
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := db.Insert(cvector.NewVector(7, []float32{1, 0.02})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	// Index searches are approximate, so only check no document repeats
+	results, err := db.Search(&cvector.Query{QueryVector: []float32{1, 0}, TopK: 3, DedupeBy: "doc_id"})
+	if err != nil || len(results) == 0 {
+		t.Fatalf("Expected results, got %d (%v)", len(results), err)
+	}
+	docs := make(map[any]bool)
+	for _, r := range results {
+		v, err := db.Get(r.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if doc, ok := v.Metadata["doc_id"]; ok {
+			if docs[doc] {
+				t.Errorf("Expected document %v once, got it again from vector %d", doc, r.ID)
+			}
+			docs[doc] = true
+		}
+	}
+
+	results, err = db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 0}, MinSimilarity: -1, TopK: 3, DedupeBy: "doc_id"})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("Expected 3 radius results, got %d (%v)", len(results), err)
+	}
+	if results[0].ID != 1 || results[1].ID != 7 || results[2].ID != 4 {
+		t.Errorf("Expected radius vectors 1, 7 and 4, got %d, %d and %d", results[0].ID, results[1].ID, results[2].ID)
+	}
+
+	// Values compare by type as filters do: the number 1 and the string "1"
+	// differ, while 1 and 1.0 are the same
+	for id, doc := range map[uint64]any{8: 1, 9: "1", 10: 1.0} {
+		v := cvector.NewVector(id, []float32{1, 0.03 + float32(id-8)*0.005})
+		v.Metadata = map[string]any{"doc_id": doc}
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	results, err = db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 0}, MinSimilarity: -1, TopK: 5, DedupeBy: "doc_id"})
+	if err != nil {
+		t.Fatalf("SearchRadius failed: %v", err)
+	}
+	var ids []uint64
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	if !slices.Equal(ids, []uint64{1, 7, 8, 9, 4}) {
+		t.Errorf("Expected radius vectors 1, 7, 8, 9 and 4, got %v", ids)
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "time.cvdb")
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 2})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+
+	for _, id := range []uint64{2, 1} {
+		if err := db.Insert(cvector.NewVector(id, []float32{1, float32(id)})); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	// Timestamps have one second precision, so start the next batch on a
+	// new second, with a margin for the engine's coarser clock
+	mark := time.Now().Truncate(time.Second).Add(time.Second)
+	time.Sleep(time.Until(mark) + 50*time.Millisecond)
+	if err := db.Insert(cvector.NewVector(3, []float32{1, 3})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	ids := func(vectors []*cvector.Vector) []uint64 {
+		var out []uint64
+		for _, v := range vectors {
+			out = append(out, v.ID)
+		}
+		return out
+	}
+	since, err := db.GetByTimeRange(mark, time.Time{})
+	if err != nil || !slices.Equal(ids(since), []uint64{3}) {
+		t.Errorf("Expected vector 3 since the mark, got %v (%v)", ids(since), err)
+	}
+	before, err := db.GetByTimeRange(time.Time{}, mark)
+	if err != nil || !slices.Equal(ids(before), []uint64{1, 2}) {
+		t.Errorf("Expected vectors 1 and 2 before the mark, got %v (%v)", ids(before), err)
+	}
+	all, err := db.GetByTimeRange(time.Time{}, time.Time{})
+	if err != nil || !slices.Equal(ids(all), []uint64{1, 2, 3}) {
+		t.Errorf("Expected every vector oldest first, got %v (%v)", ids(all), err)
+	}
+
+	// Reopening reads the timestamps back from the records
+	db.Close()
+	db, err = cvector.OpenDB(path)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+	since, err = db.GetByTimeRange(mark, time.Time{})
+	if err != nil || !slices.Equal(ids(since), []uint64{3}) {
+		t.Errorf("Expected vector 3 since the mark after reopening, got %v (%v)", ids(since), err)
+	}
+
+	results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 1}, MinSimilarity: -1, InsertedAfter: mark})
+	if err != nil || len(results) != 1 || results[0].ID != 3 {
+		t.Errorf("Expected only vector 3 inserted after the mark, got %v (%v)", results, err)
+	}
+	results, err = db.Search(&cvector.Query{QueryVector: []float32{1, 3}, TopK: 3, InsertedBefore: mark})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	for _, r := range results {
+		if r.ID == 3 {
+			t.Error("Expected vector 3 to be filtered out as inserted after the mark")
+		}
+	}
+}
+
+func TestUndelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "undelete.cvdb")
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 2, SoftDelete: true})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	for id := uint64(1); id <= 3; id++ {
+		v := cvector.NewVector(id, []float32{1, float32(id)})
+		v.Metadata = map[string]any{"n": float64(id)}
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := db.UpdateIf(1, 1, []float32{5, 5}); err != nil {
+		t.Fatalf("UpdateIf failed: %v", err)
+	}
+	for _, id := range []uint64{1, 2} {
+		if err := db.Delete(id); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+	}
+	if _, err := db.Get(1); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Fatalf("Expected a deleted vector to be hidden, got %v", err)
+	}
+	results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 1}, MinSimilarity: -1})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Expected only vector 3 in searches, got %d results (%v)", len(results), err)
+	}
+
+	// Restoring brings back the latest version with its metadata, across
+	// a reopen
+	if err := db.Undelete(1); err != nil {
+		t.Fatalf("Undelete failed: %v", err)
+	}
+	db.Close()
+	db, err = cvector.Open(path, cvector.WithSoftDelete())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+	if err := db.Undelete(2); err != nil {
+		t.Fatalf("Undelete after reopening failed: %v", err)
+	}
+	for _, id := range []uint64{1, 2} {
+		v, err := db.Get(id)
+		if err != nil {
+			t.Fatalf("Get of restored vector %d failed: %v", id, err)
+		}
+		if v.Metadata["n"] != float64(id) {
+			t.Errorf("Expected vector %d's metadata restored, got %v", id, v.Metadata)
+		}
+		if id == 1 && (v.Data[0] != 5 || v.Version != 2) {
+			t.Errorf("Expected the updated vector 1 at version 2, got %v at %d", v.Data, v.Version)
+		}
+	}
+	results, err = db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 1}, MinSimilarity: -1})
+	if err != nil || len(results) != 3 {
+		t.Errorf("Expected restored vectors in searches, got %d results (%v)", len(results), err)
+	}
+	stats, err := db.Stats()
+	if err != nil || stats.TotalVectors != 3 {
+		t.Errorf("Expected 3 live vectors, got %+v (%v)", stats, err)
+	}
+
+	if err := db.Undelete(1); !errors.Is(err, cvector.ErrDuplicateID) {
+		t.Errorf("Expected ErrDuplicateID for a live vector, got %v", err)
+	}
+	if err := db.Delete(3); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if err := db.Undelete(3); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound after compaction, got %v", err)
+	}
+}
+
+func TestVersionHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "versions.cvdb")
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 2, VersionHistory: 2,
+		OnConflict: cvector.ConflictOverwrite})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	v := cvector.NewVector(1, []float32{1, 0})
+	v.Metadata = map[string]any{"model": "v1"}
+	if err := db.Insert(v); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	v = cvector.NewVector(1, []float32{0, 1})
+	v.Metadata = map[string]any{"model": "v2"}
+	if err := db.Insert(v); err != nil {
+		t.Fatalf("Overwriting insert failed: %v", err)
+	}
+	for version := uint32(2); version <= 3; version++ {
+		if err := db.UpdateIf(1, version, []float32{float32(version), 1}); err != nil {
+			t.Fatalf("UpdateIf failed: %v", err)
+		}
+	}
+
+	// Only the two most recent previous versions are retained
+	versions, err := db.Versions(1)
+	if err != nil || !slices.Equal(versions, []uint32{2, 3, 4}) {
+		t.Fatalf("Expected versions [2 3 4], got %v (%v)", versions, err)
+	}
+	if _, err := db.GetVersion(1, 1); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound for a trimmed version, got %v", err)
+	}
+
+	db.Close()
+	db, err = cvector.Open(path, cvector.WithVersionHistory(2))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+	old, err := db.GetVersion(1, 2)
+	if err != nil {
+		t.Fatalf("GetVersion after reopening failed: %v", err)
+	}
+	if !slices.Equal(old.Data, []float32{0, 1}) || old.Metadata["model"] != "v2" {
+		t.Errorf("Expected version 2 as inserted, got %v %v", old.Data, old.Metadata)
+	}
+
+	// Rolling back is an overwrite of its own
+	if err := db.Rollback(1, 2); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	current, err := db.Get(1)
+	if err != nil || current.Version != 5 || !slices.Equal(current.Data, []float32{0, 1}) {
+		t.Fatalf("Expected version 2's data at version 5, got %+v (%v)", current, err)
+	}
+	versions, _ = db.Versions(1)
+	if !slices.Equal(versions, []uint32{3, 4, 5}) {
+		t.Errorf("Expected versions [3 4 5] after rollback, got %v", versions)
+	}
+
+	// Inserting afresh starts the history over
+	if err := db.Delete(1); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := db.Insert(cvector.NewVector(1, []float32{1, 1})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	versions, _ = db.Versions(1)
+	if !slices.Equal(versions, []uint32{1}) {
+		t.Errorf("Expected only version 1 after reinserting, got %v", versions)
+	}
+
+	if _, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path + "2", Dimension: 2, VersionHistory: -1}); err == nil {
+		t.Error("Expected a negative VersionHistory to be rejected")
+	}
+}
+
+func TestTags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tags.cvdb")
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 2, SoftDelete: true})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	tags := map[uint64][]string{
+		1: {"news", "en"},
+		2: {"news", "de"},
+		3: {"blog", "en", "en"},
+		4: nil,
+	}
+	for id := uint64(1); id <= 4; id++ {
+		v := cvector.NewVector(id, []float32{1, float32(id)})
+		v.Tags = tags[id]
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	v, err := db.Get(3)
+	if err != nil || !slices.Equal(v.Tags, []string{"blog", "en"}) {
+		t.Fatalf("Expected tags stored sorted and distinct, got %v (%v)", v.Tags, err)
+	}
+
+	ids := func(query *cvector.Query) []uint64 {
+		t.Helper()
+		query.QueryVector = []float32{1, 1}
+		query.MinSimilarity = -1
+		results, err := db.SearchRadius(query)
+		if err != nil {
+			t.Fatalf("SearchRadius failed: %v", err)
+		}
+		var out []uint64
+		for _, r := range results {
+			out = append(out, r.ID)
+		}
+		slices.Sort(out)
+		return out
+	}
+	if got := ids(&cvector.Query{Tags: []string{"news"}}); !slices.Equal(got, []uint64{1, 2}) {
+		t.Errorf("Expected news vectors 1 and 2, got %v", got)
+	}
+	if got := ids(&cvector.Query{Tags: []string{"en", "news"}}); !slices.Equal(got, []uint64{1}) {
+		t.Errorf("Expected only vector 1 tagged both en and news, got %v", got)
+	}
+	if got := ids(&cvector.Query{ExcludeTags: []string{"news"}}); !slices.Equal(got, []uint64{3, 4}) {
+		t.Errorf("Expected vectors 3 and 4 without news, got %v", got)
+	}
+	results, err := db.Search(&cvector.Query{QueryVector: []float32{1, 1}, TopK: 4, Tags: []string{"de"}})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	for _, r := range results {
+		if r.ID != 2 {
+			t.Errorf("Expected only vector 2 tagged de, got %d", r.ID)
+		}
+	}
+
+	// Retagging updates the index, and tags survive a soft delete and
+	// restore, and a reopen
+	if err := db.SetTags(4, []string{"news"}); err != nil {
+		t.Fatalf("SetTags failed: %v", err)
+	}
+	if err := db.SetTags(99, []string{"news"}); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound tagging a missing vector, got %v", err)
+	}
+	if err := db.Delete(1); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got := ids(&cvector.Query{Tags: []string{"news"}}); !slices.Equal(got, []uint64{2, 4}) {
+		t.Errorf("Expected news vectors 2 and 4 after retagging and deleting, got %v", got)
+	}
+	if err := db.Undelete(1); err != nil {
+		t.Fatalf("Undelete failed: %v", err)
+	}
+	db.Close()
+	db, err = cvector.OpenDB(path)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+	if got := ids(&cvector.Query{Tags: []string{"news"}}); !slices.Equal(got, []uint64{1, 2, 4}) {
+		t.Errorf("Expected news vectors 1, 2 and 4 after reopening, got %v", got)
+	}
+
+	// A plain delete drops the tags along with the vector
+	if err := db.Delete(2); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := db.Insert(cvector.NewVector(2, []float32{1, 2})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if v, _ := db.Get(2); len(v.Tags) != 0 {
+		t.Errorf("Expected a reinserted vector to start untagged, got %v", v.Tags)
+	}
+
+	// Tagging sees buffered inserts, passes through hooks and is audited
+	buffered := filepath.Join(t.TempDir(), "buffered.cvdb")
+	auditPath := buffered + ".audit"
+	bdb, err := cvector.OpenOrCreate(&cvector.DBConfig{DataPath: buffered, Dimension: 2, AuditLogPath: auditPath,
+		AuditActor: "tagger", WriteBufferSize: 16, WriteBufferDelay: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	var tagged []string
+	bdb.Use(func(call *cvector.Call, next func() error) error {
+		if call.Op == cvector.HookSetTags {
+			tagged = append(tagged, fmt.Sprintf("%d %v", call.ID, call.Tags))
+		}
+		return next()
+	})
+	if err := bdb.Insert(cvector.NewVector(1, []float32{1, 1})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := bdb.SetTags(1, []string{"red"}); err != nil {
+		t.Fatalf("SetTags over a buffered insert failed: %v", err)
+	}
+	if !slices.Equal(tagged, []string{"1 [red]"}) {
+		t.Errorf("Expected the hook to see vector 1 tagged red, got %v", tagged)
+	}
+	if v, err := bdb.Get(1); err != nil || !slices.Equal(v.Tags, []string{"red"}) {
+		t.Errorf("Expected vector 1 tagged red, got %v, %v", v, err)
+	}
+	bdb.Close()
+
+	entries, err := cvector.ReadAuditLog(auditPath)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	var ops []string
+	for _, entry := range entries {
+		ops = append(ops, fmt.Sprintf("%s %d %s", entry.Op, entry.ID, entry.Actor))
+	}
+	if want := []string{"insert 1 tagger", "set_tags 1 tagger"}; !slices.Equal(ops, want) {
+		t.Errorf("Expected audit entries %v, got %v", want, ops)
+	}
+}
+
+func TestMetadataSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.cvdb")
+	schema := &cvector.Schema{Fields: []cvector.SchemaField{
+		{Name: "lang", Type: cvector.FieldString, Indexed: true},
+		{Name: "year", Type: cvector.FieldNumber, Indexed: true},
+		{Name: "draft", Type: cvector.FieldBool},
+	}}
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 2, Schema: schema})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	docs := []map[string]any{
+		{"lang": "en", "year": 2023},
+		{"lang": "en", "year": 2024, "draft": true},
+		{"lang": "de", "year": int64(2024)},
+	}
+	for i, md := range docs {
+		v := cvector.NewVector(uint64(i+1), []float32{1, float32(i)})
+		v.Metadata = md
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	// A typo or a wrong type is rejected before anything is stored
+	var schemaErr *cvector.SchemaError
+	for _, md := range []map[string]any{{"lnag": "en"}, {"year": "2024"}} {
+		v := cvector.NewVector(9, []float32{1, 1})
+		v.Metadata = md
+		if err := db.Insert(v); !errors.As(err, &schemaErr) || !errors.Is(err, cvector.ErrInvalidArgs) {
+			t.Errorf("Expected a SchemaError for %v, got %v", md, err)
+		}
+	}
+	if _, err := db.Get(9); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected a rejected vector not to be stored, got %v", err)
+	}
+
+	ids := func(filter map[string]any) []uint64 {
+		t.Helper()
+		results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 1}, MinSimilarity: -1, Filter: filter})
+		if err != nil {
+			t.Fatalf("SearchRadius failed: %v", err)
+		}
+		var out []uint64
+		for _, r := range results {
+			out = append(out, r.ID)
+		}
+		slices.Sort(out)
+		return out
+	}
+	check := func(filter map[string]any, want []uint64) {
+		t.Helper()
+		if got := ids(filter); !slices.Equal(got, want) {
+			t.Errorf("Filter %v: expected %v, got %v", filter, want, got)
+		}
+	}
+	check(map[string]any{"lang": "en"}, []uint64{1, 2})
+	check(map[string]any{"year": 2024.0, "lang": "en"}, []uint64{2})
+	check(map[string]any{"year": 2024}, []uint64{2, 3})
+	check(map[string]any{"draft": true}, []uint64{2})
+
+	// The schema and its indexes are rebuilt on reopening, and changing
+	// the schema checks the metadata already stored
+	db.Close()
+	db, err = cvector.OpenDB(path)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+	if got := db.Schema(); got == nil || len(got.Fields) != 3 {
+		t.Fatalf("Expected the schema to persist, got %+v", got)
+	}
+	check(map[string]any{"year": 2024, "lang": "de"}, []uint64{3})
+	if err := db.SetSchema(&cvector.Schema{Fields: []cvector.SchemaField{{Name: "lang", Type: cvector.FieldString}}}); !errors.As(err, &schemaErr) {
+		t.Errorf("Expected a SchemaError narrowing the schema under stored metadata, got %v", err)
+	}
+	if err := db.SetSchema(&cvector.Schema{Fields: []cvector.SchemaField{{Name: "", Type: cvector.FieldString}}}); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for an unnamed field, got %v", err)
+	}
+	if err := db.SetSchema(&cvector.Schema{Fields: []cvector.SchemaField{{Name: "draft", Type: cvector.FieldBool, Indexed: true}}, AllowUnknown: true}); err != nil {
+		t.Fatalf("SetSchema failed: %v", err)
+	}
+	check(map[string]any{"draft": true, "lang": "en"}, []uint64{2})
+	v := cvector.NewVector(4, []float32{1, 3})
+	v.Metadata = map[string]any{"anything": []any{"goes"}}
+	if err := db.Insert(v); err != nil {
+		t.Errorf("Expected unknown fields accepted with AllowUnknown, got %v", err)
+	}
+
+	if _, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path + "2", Dimension: 2,
+		Schema: &cvector.Schema{Fields: []cvector.SchemaField{{Name: "a", Type: "date"}}}}); err == nil {
+		t.Error("Expected an unknown field type to be rejected")
+	}
+}
+
+func TestRangeFilters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranges.cvdb")
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 2, Schema: &cvector.Schema{
+		Fields:       []cvector.SchemaField{{Name: "price", Type: cvector.FieldNumber, Indexed: true}},
+		AllowUnknown: true,
+	}})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	defer db.Close()
+	for id := uint64(1); id <= 50; id++ {
+		v := cvector.NewVector(id, []float32{1, float32(id) / 50})
+		v.Metadata = map[string]any{"price": float64(id), "stock": int(id % 5)}
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	// The indexed range admits few enough vectors for search to score
+	// them directly, so the result is exact
+	results, explain, err := db.SearchExplain(&cvector.Query{QueryVector: []float32{1, 1}, TopK: 3,
+		Ranges: map[string]cvector.Range{"price": {Min: 10, Max: 20}}})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	var got []uint64
+	for _, r := range results {
+		got = append(got, r.ID)
+	}
+	if !slices.Equal(got, []uint64{20, 19, 18}) {
+		t.Errorf("Expected the best priced 10..20, got %v", got)
+	}
+	if explain.Strategy != cvector.SearchStrategyScan || explain.CandidatesScanned != 11 {
+		t.Errorf("Expected only the 11 vectors in range scored, got %+v", explain)
+	}
+
+	// Scoring the candidates directly accepts the same queries the engine does
+	for _, bad := range []cvector.Query{{TopK: 20000}, {MinSimilarity: 2}, {MinSimilarity: -5}, {EfSearch: 1 << 20}} {
+		bad.QueryVector = []float32{1, 1}
+		if _, err := db.Search(&bad); !errors.Is(err, cvector.ErrInvalidArgs) {
+			t.Errorf("Expected ErrInvalidArgs for %+v, got %v", bad, err)
+		}
+		bad.Ranges = map[string]cvector.Range{"price": {Min: 10, Max: 20}}
+		if _, err := db.Search(&bad); !errors.Is(err, cvector.ErrInvalidArgs) {
+			t.Errorf("Expected ErrInvalidArgs for %+v with a range, got %v", bad, err)
+		}
+	}
+
+	// Open ends, unindexed fields, and reinserting with a new indexed value
+	if err := db.Delete(5); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	v := cvector.NewVector(5, []float32{1, 0.1})
+	v.Metadata = map[string]any{"price": 1000, "stock": 0}
+	if err := db.Insert(v); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	radius := func(ranges map[string]cvector.Range) []uint64 {
+		t.Helper()
+		results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 1}, MinSimilarity: -1, Ranges: ranges})
+		if err != nil {
+			t.Fatalf("SearchRadius failed: %v", err)
+		}
+		var ids []uint64
+		for _, r := range results {
+			ids = append(ids, r.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	if got := radius(map[string]cvector.Range{"price": {Min: 49, Max: math.Inf(1)}}); !slices.Equal(got, []uint64{5, 49, 50}) {
+		t.Errorf("Expected prices from 49 up, got %v", got)
+	}
+	if got := radius(map[string]cvector.Range{"price": {Min: math.Inf(-1), Max: 3}, "stock": {Min: 2, Max: 2}}); !slices.Equal(got, []uint64{2}) {
+		t.Errorf("Expected price up to 3 with stock 2, got %v", got)
+	}
+	if got := radius(map[string]cvector.Range{"missing": {Min: 0, Max: 100}}); len(got) != 0 {
+		t.Errorf("Expected no vector to match a range on a missing key, got %v", got)
+	}
+}
+
+func TestGeoRadius(t *testing.T) {
+	berlin := cvector.GeoPoint{Lat: 52.5200, Lon: 13.4050}
+	if d := berlin.DistanceMeters(cvector.GeoPoint{Lat: 48.8566, Lon: 2.3522}); d < 870e3 || d > 885e3 {
+		t.Errorf("Expected Berlin to Paris to be about 878 km, got %.0f m", d)
+	}
+
+	for _, indexed := range []bool{true, false} {
+		path := filepath.Join(t.TempDir(), "geo.cvdb")
+		db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 2, Schema: &cvector.Schema{
+			Fields: []cvector.SchemaField{{Name: "at", Type: cvector.FieldGeo, Indexed: indexed}},
+		}})
+		if err != nil {
+			t.Fatalf("CreateDB failed: %v", err)
+		}
+		places := map[uint64]cvector.GeoPoint{
+			1: {Lat: 52.5163, Lon: 13.3777}, // Brandenburg Gate, 2 km from the centre
+			2: {Lat: 52.3906, Lon: 13.0645}, // Potsdam, 27 km
+			3: {Lat: 53.5511, Lon: 9.9937},  // Hamburg, 255 km
+			4: {Lat: -33.8688, Lon: 151.2093},
+		}
+		for id, p := range places {
+			v := cvector.NewVector(id, []float32{1, float32(id)})
+			v.Metadata = map[string]any{"at": p}
+			if err := db.Insert(v); err != nil {
+				t.Fatalf("Insert failed: %v", err)
+			}
+		}
+		v := cvector.NewVector(9, []float32{1, 1})
+		v.Metadata = map[string]any{"at": cvector.GeoPoint{Lat: 91}}
+		if err := db.Insert(v); !errors.Is(err, cvector.ErrInvalidArgs) {
+			t.Errorf("Expected an invalid point to be rejected, got %v", err)
+		}
+
+		near := func(meters float64) []uint64 {
+			t.Helper()
+			results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 1}, MinSimilarity: -1,
+				GeoRadius: &cvector.GeoRadius{Field: "at", Center: berlin, Meters: meters}})
+			if err != nil {
+				t.Fatalf("SearchRadius failed: %v", err)
+			}
+			var ids []uint64
+			for _, r := range results {
+				ids = append(ids, r.ID)
+			}
+			slices.Sort(ids)
+			return ids
+		}
+		for _, tc := range []struct {
+			meters float64
+			want   []uint64
+		}{{1000, nil}, {5000, []uint64{1}}, {50e3, []uint64{1, 2}}, {300e3, []uint64{1, 2, 3}}} {
+			if got := near(tc.meters); !slices.Equal(got, tc.want) {
+				t.Errorf("Indexed %v, within %.0f m: expected %v, got %v", indexed, tc.meters, tc.want, got)
+			}
+		}
+
+		// Points come back from the sidecar as maps and still match
+		db.Close()
+		db, err = cvector.OpenDB(path)
+		if err != nil {
+			t.Fatalf("OpenDB failed: %v", err)
+		}
+		if got := near(50e3); !slices.Equal(got, []uint64{1, 2}) {
+			t.Errorf("Indexed %v, after reopening: expected [1 2], got %v", indexed, got)
+		}
+		results, err := db.Search(&cvector.Query{QueryVector: []float32{1, 4}, TopK: 1,
+			GeoRadius: &cvector.GeoRadius{Field: "at", Center: berlin, Meters: 300e3}})
+		if err != nil || len(results) != 1 || results[0].ID != 3 {
+			t.Errorf("Indexed %v: expected Hamburg as the best match nearby, got %v (%v)", indexed, results, err)
+		}
+		if _, err := db.Search(&cvector.Query{QueryVector: []float32{1, 1},
+			GeoRadius: &cvector.GeoRadius{Field: "at", Center: berlin, Meters: -1}}); !errors.Is(err, cvector.ErrInvalidArgs) {
+			t.Errorf("Expected ErrInvalidArgs for a negative radius, got %v", err)
+		}
+		db.Close()
+	}
+}
+
+func TestKeywordIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.cvdb")
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 2, Schema: &cvector.Schema{
+		Fields: []cvector.SchemaField{
+			{Name: "title", Type: cvector.FieldText, Indexed: true},
+			{Name: "notes", Type: cvector.FieldText},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	titles := map[uint64]string{
+		1: "Red running shoes",
+		2: "Blue running shoes, lightweight",
+		3: "Red wool scarf",
+		4: "Shoes, shoes, shoes: red ones!",
+	}
+	for id, title := range titles {
+		v := cvector.NewVector(id, []float32{1, float32(id)})
+		v.Metadata = map[string]any{"title": title, "notes": title}
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	filtered := func(field, text string) []uint64 {
+		t.Helper()
+		results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 1}, MinSimilarity: -1,
+			Keywords: &cvector.KeywordFilter{Field: field, Text: text}})
+		if err != nil {
+			t.Fatalf("SearchRadius failed: %v", err)
+		}
+		var ids []uint64
+		for _, r := range results {
+			ids = append(ids, r.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	for _, field := range []string{"title", "notes"} {
+		if got := filtered(field, "RED shoes"); !slices.Equal(got, []uint64{1, 4}) {
+			t.Errorf("Field %s: expected red shoes 1 and 4, got %v", field, got)
+		}
+		if got := filtered(field, "scarf"); !slices.Equal(got, []uint64{3}) {
+			t.Errorf("Field %s: expected the scarf, got %v", field, got)
+		}
+	}
+	if _, err := db.Search(&cvector.Query{QueryVector: []float32{1, 1},
+		Keywords: &cvector.KeywordFilter{Field: "title", Text: "!!"}}); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for keywords without words, got %v", err)
+	}
+
+	// BM25 favours the rarer word and repeated, concise matches
+	results, err := db.KeywordSearch("title", "red shoes", 10)
+	if err != nil {
+		t.Fatalf("KeywordSearch failed: %v", err)
+	}
+	if len(results) != 4 || results[0].ID != 4 || results[1].ID != 1 {
+		t.Errorf("Expected 4 then 1 first for red shoes, got %v", results)
+	}
+	if _, err := db.KeywordSearch("notes", "red", 10); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs for an unindexed field, got %v", err)
+	}
+
+	// Hybrid search blends both rankings, keeping to the query's filters;
+	// the index follows reopening
+	db.Close()
+	db, err = cvector.OpenDB(path)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+	hybrid, err := db.SearchHybrid(&cvector.Query{QueryVector: []float32{1, 3}, TopK: 4}, "title", "scarf", cvector.Fusion{})
+	if err != nil {
+		t.Fatalf("SearchHybrid failed: %v", err)
+	}
+	if len(hybrid) == 0 || hybrid[0].ID != 3 {
+		t.Errorf("Expected the scarf first, ranked by both legs, got %v", hybrid)
+	}
+	hybrid, err = db.SearchHybrid(&cvector.Query{QueryVector: []float32{1, 3}, TopK: 4,
+		Filter: map[string]any{"notes": "Blue running shoes, lightweight"}}, "title", "shoes", cvector.Fusion{Method: cvector.FusionWeightedSum})
+	if err != nil {
+		t.Fatalf("SearchHybrid failed: %v", err)
+	}
+	if len(hybrid) != 1 || hybrid[0].ID != 2 {
+		t.Errorf("Expected only the filtered vector 2, got %v", hybrid)
+	}
+}
+
+func TestSearchFacets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "facets.cvdb")
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 2, Schema: &cvector.Schema{
+		Fields: []cvector.SchemaField{
+			{Name: "category", Type: cvector.FieldString, Indexed: true},
+			{Name: "language", Type: cvector.FieldString},
+			{Name: "year", Type: cvector.FieldNumber},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	defer db.Close()
+
+	docs := []map[string]any{
+		{"category": "news", "language": "en", "year": 2023},
+		{"category": "news", "language": "de", "year": 2024.0},
+		{"category": "blog", "language": "en", "year": int64(2024)},
+		{"category": "blog", "language": "en"},
+		{"category": "paper"},
+	}
+	for i, md := range docs {
+		v := cvector.NewVector(uint64(i+1), []float32{1, float32(i + 1)})
+		v.Metadata = md
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := db.Insert(cvector.NewVector(6, []float32{1, 6})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	// Counts cover every match, not only the TopK returned
+	results, facets, err := db.SearchFacets(&cvector.Query{QueryVector: []float32{1, 1}, TopK: 1,
+		Facets: []string{"category", "language", "year"}})
+	if err != nil {
+		t.Fatalf("SearchFacets failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("Expected 1 result, got %d", len(results))
+	}
+	want := map[string]map[string]int{
+		"category": {"news": 2, "blog": 2, "paper": 1},
+		"language": {"en": 3, "de": 1},
+		"year":     {"2023": 1, "2024": 2},
+	}
+	if !reflect.DeepEqual(facets, want) {
+		t.Errorf("Expected facets %v, got %v", want, facets)
+	}
+
+	// Filters narrow the counts, whether answered from an index or not
+	for _, filter := range []map[string]any{{"category": "blog"}, {"language": "en", "category": "blog"}} {
+		_, facets, err = db.SearchFacets(&cvector.Query{QueryVector: []float32{1, 1}, TopK: 10, Filter: filter,
+			Facets: []string{"language", "missing"}})
+		if err != nil {
+			t.Fatalf("SearchFacets failed: %v", err)
+		}
+		want = map[string]map[string]int{"language": {"en": 2}, "missing": {}}
+		if !reflect.DeepEqual(facets, want) {
+			t.Errorf("Filter %v: expected facets %v, got %v", filter, want, facets)
+		}
+	}
+	_, facets, err = db.SearchFacets(&cvector.Query{QueryVector: []float32{1, 1}, TopK: 10, Filter: map[string]any{"language": "en"},
+		Facets: []string{"category"}})
+	if err != nil {
+		t.Fatalf("SearchFacets failed: %v", err)
+	}
+	if want := map[string]int{"news": 1, "blog": 2}; !reflect.DeepEqual(facets["category"], want) {
+		t.Errorf("Expected categories %v for English, got %v", want, facets["category"])
+	}
+
+	// Deleted vectors drop out
+	if err := db.Delete(5); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	_, facets, err = db.SearchFacets(&cvector.Query{QueryVector: []float32{1, 1}, TopK: 10, Facets: []string{"category"}})
+	if err != nil {
+		t.Fatalf("SearchFacets failed: %v", err)
+	}
+	if _, ok := facets["category"]["paper"]; ok {
+		t.Errorf("Expected the deleted paper not to be counted, got %v", facets["category"])
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aggregate.cvdb")
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 2, Schema: &cvector.Schema{
+		Fields: []cvector.SchemaField{
+			{Name: "brand", Type: cvector.FieldString, Indexed: true},
+			{Name: "price", Type: cvector.FieldNumber, Indexed: true},
+		},
+		AllowUnknown: true,
+	}})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	defer db.Close()
+
+	docs := []map[string]any{
+		{"brand": "acme", "price": 10},
+		{"brand": "acme", "price": 30.5},
+		{"brand": "zeta", "price": int64(20)},
+		{"brand": "bolt", "note": "no price"},
+		{"brand": "bolt", "price": 40},
+	}
+	for i, md := range docs {
+		v := cvector.NewVector(uint64(i+1), []float32{1, float32(i + 1)})
+		v.Metadata = md
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	aggs := []cvector.Aggregation{
+		{Field: "price", Op: cvector.AggregateMin},
+		{Field: "price", Op: cvector.AggregateMax},
+		{Field: "price", Op: cvector.AggregateAvg},
+		{Field: "price", Op: cvector.AggregateSum},
+		{Field: "brand", Op: cvector.AggregateTop, N: 2},
+		{Field: "missing", Op: cvector.AggregateAvg},
+	}
+	got, err := db.Aggregate(nil, aggs)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if got[0].Value != 10 || got[1].Value != 40 || got[2].Value != 25.125 || got[3].Value != 100.5 || got[0].Count != 4 {
+		t.Errorf("Expected price min 10, max 40, avg 25.125 and sum 100.5 over 4, got %+v", got[:4])
+	}
+	wantTop := []cvector.ValueCount{{Value: "acme", Count: 2}, {Value: "bolt", Count: 2}}
+	if !slices.Equal(got[4].Top, wantTop) || got[4].Count != 5 {
+		t.Errorf("Expected top brands %v over 5, got %+v", wantTop, got[4])
+	}
+	if got[5].Count != 0 || got[5].Value != 0 {
+		t.Errorf("Expected nothing for a missing field, got %+v", got[5])
+	}
+
+	// Over a filter
+	got, err = db.Aggregate(&cvector.Query{Filter: map[string]any{"brand": "acme"}, Ranges: map[string]cvector.Range{"price": {Min: 0, Max: 35}}}, aggs[:4])
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if got[0].Value != 10 || got[1].Value != 30.5 || got[3].Value != 40.5 || got[3].Count != 2 {
+		t.Errorf("Expected acme prices 10 to 30.5 summing to 40.5, got %+v", got)
+	}
+
+	// Over the results of a search
+	results, got, err := db.SearchAggregate(&cvector.Query{QueryVector: []float32{1, 1}, TopK: 10,
+		Filter: map[string]any{"brand": "bolt"}}, aggs[3:5])
+	if err != nil {
+		t.Fatalf("SearchAggregate failed: %v", err)
+	}
+	if len(results) != 2 || got[0].Value != 40 || got[0].Count != 1 || !slices.Equal(got[1].Top, []cvector.ValueCount{{Value: "bolt", Count: 2}}) {
+		t.Errorf("Expected bolt's price sum 40 over 2 results, got %d results and %+v", len(results), got)
+	}
+
+	for _, bad := range []cvector.Aggregation{{Field: "price", Op: "median"}, {Op: cvector.AggregateSum}, {Field: "brand", Op: cvector.AggregateTop, N: -1}} {
+		if _, err := db.Aggregate(nil, []cvector.Aggregation{bad}); !errors.Is(err, cvector.ErrInvalidArgs) {
+			t.Errorf("Expected ErrInvalidArgs for %+v, got %v", bad, err)
+		}
+	}
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "update_metadata.cvdb")
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 2, Schema: &cvector.Schema{
+		Fields: []cvector.SchemaField{
+			{Name: "label", Type: cvector.FieldString, Indexed: true},
+			{Name: "score", Type: cvector.FieldNumber},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	for id := uint64(1); id <= 3; id++ {
+		v := cvector.NewVector(id, []float32{1, float32(id)})
+		v.Metadata = map[string]any{"label": "old", "score": 1}
+		v.Tags = []string{"keep"}
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	if err := db.UpdateMetadata(1, map[string]any{"label": "new", "score": nil}); err != nil {
+		t.Fatalf("UpdateMetadata failed: %v", err)
+	}
+	v, err := db.Get(1)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !reflect.DeepEqual(v.Metadata, map[string]any{"label": "new"}) || v.Version != 1 || !slices.Equal(v.Tags, []string{"keep"}) {
+		t.Errorf("Expected label new, no score, version 1 and the tag kept, got %+v", v)
+	}
+
+	// A bad patch anywhere changes nothing
+	err = db.UpdateMetadataMany(map[uint64]map[string]any{2: {"label": "new"}, 3: {"score": "high"}})
+	var schemaErr *cvector.SchemaError
+	if !errors.As(err, &schemaErr) || schemaErr.ID != 3 {
+		t.Errorf("Expected a SchemaError for vector 3, got %v", err)
+	}
+	if err := db.UpdateMetadataMany(map[uint64]map[string]any{2: {"label": "new"}, 9: {"label": "new"}}); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound for a missing vector, got %v", err)
+	}
+	if err := db.Delete(3); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := db.UpdateMetadata(3, map[string]any{"label": "new"}); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound for a deleted vector, got %v", err)
+	}
+
+	if err := db.UpdateMetadataMany(map[uint64]map[string]any{2: {"label": "new", "score": 5}}); err != nil {
+		t.Fatalf("UpdateMetadataMany failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The indexes follow the new labels, and the change persists
+	db, err = cvector.OpenDB(path)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+	results, err := db.SearchRadius(&cvector.Query{QueryVector: []float32{1, 1}, MinSimilarity: -1,
+		Filter: map[string]any{"label": "new"}})
+	if err != nil {
+		t.Fatalf("SearchRadius failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected vectors 1 and 2 labelled new, got %d results", len(results))
+	}
+	if v, err := db.Get(2); err != nil || v.Metadata["score"] != 5.0 {
+		t.Errorf("Expected vector 2 to keep score 5, got %v, %v", v, err)
+	}
+
+	// Patches see buffered inserts, pass through hooks and are audited
+	buffered := filepath.Join(t.TempDir(), "buffered.cvdb")
+	auditPath := buffered + ".audit"
+	bdb, err := cvector.OpenOrCreate(&cvector.DBConfig{DataPath: buffered, Dimension: 2, AuditLogPath: auditPath,
+		AuditActor: "tagger", WriteBufferSize: 16, WriteBufferDelay: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	var patched []uint64
+	bdb.Use(func(call *cvector.Call, next func() error) error {
+		if call.Op == cvector.HookUpdateMetadata {
+			for id := range call.Patches {
+				patched = append(patched, id)
+			}
+		}
+		return next()
+	})
+	for id := uint64(1); id <= 2; id++ {
+		if err := bdb.Insert(cvector.NewVector(id, []float32{1, float32(id)})); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := bdb.UpdateMetadataMany(map[uint64]map[string]any{1: {"label": "a"}, 2: {"label": "b"}}); err != nil {
+		t.Fatalf("UpdateMetadataMany over buffered inserts failed: %v", err)
+	}
+	slices.Sort(patched)
+	if !slices.Equal(patched, []uint64{1, 2}) {
+		t.Errorf("Expected the hook to see vectors 1 and 2, got %v", patched)
+	}
+	bdb.Close()
+
+	entries, err := cvector.ReadAuditLog(auditPath)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	var ops []string
+	for _, entry := range entries {
+		ops = append(ops, fmt.Sprintf("%s %d %s", entry.Op, entry.ID, entry.Actor))
+	}
+	want := []string{"insert 1 tagger", "insert 2 tagger", "update_metadata 1 tagger", "update_metadata 2 tagger"}
+	if !slices.Equal(ops, want) {
+		t.Errorf("Expected audit entries %v, got %v", want, ops)
+	}
+}
+
+func TestSearchByID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "search_by_id.cvdb")
+	db, err := cvector.CreateDB(&cvector.DBConfig{DataPath: path, Dimension: 2, DefaultTopK: 2})
+	if err != nil {
+		t.Fatalf("CreateDB failed: %v", err)
+	}
+	defer db.Close()
+
+	data := map[uint64][]float32{1: {1, 0}, 2: {0.9, 0.1}, 3: {0, 1}, 4: {0.5, 0.5}}
+	for id, d := range data {
+		v := cvector.NewVector(id, d)
+		v.Tags = []string{"all"}
+		if err := db.Insert(v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	// A tag filter scores every candidate exactly
+	ids := func(results []*cvector.Result) []uint64 {
+		var out []uint64
+		for _, r := range results {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+	results, err := db.SearchByID(1, &cvector.Query{TopK: 2, Tags: []string{"all"}})
+	if err != nil {
+		t.Fatalf("SearchByID failed: %v", err)
+	}
+	if got := ids(results); !slices.Equal(got, []uint64{2, 4}) {
+		t.Errorf("Expected 2 and 4 like vector 1, got %v", got)
+	}
+	results, err = db.SearchByID(1, &cvector.Query{TopK: 2, Tags: []string{"all"}, IncludeSelf: true})
+	if err != nil {
+		t.Fatalf("SearchByID failed: %v", err)
+	}
+	if got := ids(results); !slices.Equal(got, []uint64{1, 2}) {
+		t.Errorf("Expected vector 1 itself and then 2, got %v", got)
+	}
+
+	// A nil query takes the database's defaults
+	results, err = db.SearchByID(3, nil)
+	if err != nil {
+		t.Fatalf("SearchByID failed: %v", err)
+	}
+	if len(results) > 2 || slices.Contains(ids(results), 3) {
+		t.Errorf("Expected at most 2 results without vector 3, got %v", ids(results))
+	}
+
+	if _, err := db.SearchByID(9, nil); !errors.Is(err, cvector.ErrVectorNotFound) {
+		t.Errorf("Expected ErrVectorNotFound for a missing vector, got %v", err)
+	}
+}
+
+func TestBackgroundIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "background_index.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for i := 1; i <= 3000; i++ {
+		if err := db.Insert(cvector.NewVector(uint64(i), []float32{float32(i), 1, float32(i % 7), 1})); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	db.Close()
+
+	// Without the index saved on close there is one to build
+	os.Remove(path + ".hnsw")
+	db, err = cvector.Open(path, cvector.WithBackgroundIndex())
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	// Writes land while the index is built, and searches find them at once
+	if err := db.Insert(cvector.NewVector(5000, []float32{0, 0, 0, 1})); err != nil {
+		t.Fatalf("Insert during build failed: %v", err)
+	}
+	results, err := db.Search(&cvector.Query{QueryVector: []float32{0, 0, 0, 1}, TopK: 1, Similarity: cvector.SimilarityCosine})
+	if err != nil {
+		t.Fatalf("Search during build failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != 5000 {
+		t.Errorf("Expected the new vector during the build, got %v", results)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		progress, err := db.IndexStatus()
+		if err != nil {
+			t.Fatalf("IndexStatus failed: %v", err)
+		}
+		if progress.Status == cvector.IndexStatusReady {
+			if progress.Building || progress.Pending != 0 || progress.Indexed != 3001 || progress.Fraction() != 1 {
+				t.Errorf("Unexpected progress once built: %+v", progress)
+			}
+			break
+		}
+		if progress.Status != cvector.IndexStatusBuilding || progress.Total != 3001 {
+			t.Fatalf("Unexpected progress during the build: %+v", progress)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the index to be built, progress %+v", progress)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := db.Insert(cvector.NewVector(5001, []float32{1, 0, 0, 0})); err != nil {
+		t.Fatalf("Insert after build failed: %v", err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.IndexStatus != cvector.IndexStatusReady || stats.IndexedVectors != 3002 || stats.UnindexedVectors != 0 {
+		t.Errorf("Expected inserts after the build to be indexed, stats %+v", stats)
+	}
+}
+
+func TestIndexPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index_persist.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4), cvector.WithSimilarity(cvector.SimilarityEuclidean))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for i := 1; i <= 200; i++ {
+		db.Insert(cvector.NewVector(uint64(i), []float32{float32(i), 1, float32(i % 5), 1}))
+	}
+	db.Delete(7)
+	if stats, _ := db.Stats(); stats.IndexLoaded {
+		t.Errorf("Expected a new database's index to be built, not loaded")
+	}
+	ids := func(results []*cvector.Result) []uint64 {
+		var out []uint64
+		for _, r := range results {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+	query := &cvector.Query{QueryVector: []float32{50, 1, 0, 1}, TopK: 3}
+	results, err := db.Search(query)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	before := ids(results)
+	db.Close()
+	if _, err := os.Stat(path + ".hnsw"); err != nil {
+		t.Fatalf("Expected the index to be saved on close: %v", err)
+	}
+
+	db, err = cvector.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if !stats.IndexLoaded || stats.IndexStatus != cvector.IndexStatusReady || stats.IndexedVectors != 199 {
+		t.Errorf("Expected the saved index to be loaded whole, stats %+v", stats)
+	}
+	// The graph is the one searched before closing, not a new build
+	results, err = db.Search(query)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if got := ids(results); !slices.Equal(got, before) {
+		t.Errorf("Expected the loaded index to answer %v as before, got %v", before, got)
+	}
+
+	// Closing without changes leaves the saved index alone
+	saved := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path+".hnsw", saved, saved); err != nil {
+		t.Fatalf("Failed to age saved index: %v", err)
+	}
+	db.Close()
+	if info, err := os.Stat(path + ".hnsw"); err != nil {
+		t.Fatalf("Expected the index to be kept: %v", err)
+	} else if !info.ModTime().Equal(saved) {
+		t.Errorf("Expected an unchanged index not to be saved again, modified %v", info.ModTime())
+	}
+	if db, err = cvector.Open(path); err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+
+	// An index older than the data file is rebuilt rather than trusted
+	stale, err := os.ReadFile(path + ".hnsw")
+	if err != nil {
+		t.Fatalf("Failed to read saved index: %v", err)
+	}
+	db.Insert(cvector.NewVector(500, []float32{50, 1, 0, 1}))
+	db.Close()
+	if err := os.WriteFile(path+".hnsw", stale, 0644); err != nil {
+		t.Fatalf("Failed to restore stale index: %v", err)
+	}
+	db, err = cvector.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	stats, _ = db.Stats()
+	if stats.IndexLoaded || stats.IndexStatus != cvector.IndexStatusReady || stats.IndexedVectors != 200 {
+		t.Errorf("Expected a stale index to be rebuilt, stats %+v", stats)
+	}
+	db.Close()
+
+	// So is a damaged one
+	if err := os.WriteFile(path+".hnsw", []byte("not an index"), 0644); err != nil {
+		t.Fatalf("Failed to damage saved index: %v", err)
+	}
+	db, err = cvector.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open with a damaged index: %v", err)
+	}
+	if stats, _ := db.Stats(); stats.IndexLoaded || stats.IndexedVectors != 200 {
+		t.Errorf("Expected a damaged index to be rebuilt, stats %+v", stats)
+	}
+	db.Close()
+
+	if err := cvector.DropDB(path); err != nil {
+		t.Fatalf("DropDB failed: %v", err)
+	}
+	if _, err := os.Stat(path + ".hnsw"); !os.IsNotExist(err) {
+		t.Errorf("Expected DropDB to remove the saved index, got %v", err)
+	}
+}
+
+func TestEfSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ef_search.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(4), cvector.WithEfSearch(40))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	for i := 1; i <= 300; i++ {
+		db.Insert(cvector.NewVector(uint64(i), []float32{float32(i % 17), float32(i % 13), float32(i % 7), 1}))
+	}
+
+	ef := func(query cvector.Query) *cvector.SearchExplain {
+		t.Helper()
+		query.QueryVector = []float32{3, 5, 1, 1}
+		_, explain, err := db.SearchExplain(&query)
+		if err != nil {
+			t.Fatalf("SearchExplain failed: %v", err)
+		}
+		if explain.Strategy != cvector.SearchStrategyIndex {
+			t.Fatalf("Expected an index search, got %s", explain.Strategy)
+		}
+		return explain
+	}
+
+	if got := ef(cvector.Query{TopK: 5}).EfSearch; got != 40 {
+		t.Errorf("Expected the WithEfSearch setting of 40, got %d", got)
+	}
+	if got := ef(cvector.Query{TopK: 5, EfSearch: 100}).EfSearch; got != 100 {
+		t.Errorf("Expected the query's EfSearch to win, got %d", got)
+	}
+	if got := ef(cvector.Query{TopK: 5, EfSearch: 2}).EfSearch; got != 5 {
+		t.Errorf("Expected EfSearch to be raised to TopK, got %d", got)
+	}
+
+	// A wider candidate list explores more of the graph
+	narrow := ef(cvector.Query{TopK: 1, EfSearch: 1})
+	wide := ef(cvector.Query{TopK: 1, EfSearch: 200})
+	if wide.IndexNodesVisited <= narrow.IndexNodesVisited {
+		t.Errorf("Expected ef 200 to visit more nodes than ef 1, got %d and %d", wide.IndexNodesVisited, narrow.IndexNodesVisited)
+	}
+
+	// Zero restores twice TopK
+	if err := db.SetEfSearch(0); err != nil {
+		t.Fatalf("SetEfSearch failed: %v", err)
+	}
+	if got := ef(cvector.Query{TopK: 5}).EfSearch; got != 10 {
+		t.Errorf("Expected the default of twice TopK, got %d", got)
+	}
+	if err := db.SetEfSearch(64); err != nil {
+		t.Fatalf("SetEfSearch failed: %v", err)
+	}
+	if stats, _ := db.Stats(); stats.EfSearch != 64 {
+		t.Errorf("Expected Stats to report EfSearch 64, got %d", stats.EfSearch)
+	}
+
+	if err := db.SetEfSearch(-1); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected a negative EfSearch to be rejected, got %v", err)
+	}
+	if _, err := db.Search(&cvector.Query{QueryVector: []float32{1, 1, 1, 1}, TopK: 1, EfSearch: 1 << 30}); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected an oversized Query.EfSearch to be rejected, got %v", err)
+	}
+}
+
+func TestTune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tune.cvdb")
+	db, err := cvector.Open(path, cvector.WithCreateIfMissing(8))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer func() { db.Close() }()
+
+	if _, err := db.Tune([][]float32{make([]float32, 8)}, nil); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected tuning an empty database to fail, got %v", err)
+	}
+
+	rng := rand.New(rand.NewSource(7))
+	random := func() []float32 {
+		data := make([]float32, 8)
+		for i := range data {
+			data[i] = rng.Float32()*2 - 1
+		}
+		return data
+	}
+	for i := 1; i <= 500; i++ {
+		if err := db.Insert(cvector.NewVector(uint64(i), random())); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	queries := make([][]float32, 20)
+	for i := range queries {
+		queries[i] = random()
+	}
+
+	result, err := db.Tune(queries, &cvector.TuneOptions{TargetRecall: 0.9, TopK: 5})
+	if err != nil {
+		t.Fatalf("Tune failed: %v", err)
+	}
+	if len(result.Trials) == 0 || result.Trials[0].EfSearch != 5 {
+		t.Fatalf("Expected the sweep to start at TopK, got %+v", result.Trials)
+	}
+	last := result.Trials[len(result.Trials)-1]
+	if !result.Reached || result.Recall < 0.9 || result.EfSearch != last.EfSearch {
+		t.Errorf("Expected the sweep to stop at the first ef reaching 0.9 recall, got %+v", result)
+	}
+	if stats, _ := db.Stats(); stats.EfSearch != 0 {
+		t.Errorf("Expected Tune to leave the setting alone, got %d", stats.EfSearch)
+	}
+
+	// An unreachable target reports the best recall seen
+	result, err = db.Tune(queries, &cvector.TuneOptions{TargetRecall: 1, TopK: 5, Candidates: []int{5}})
+	if err != nil {
+		t.Fatalf("Tune failed: %v", err)
+	}
+	if len(result.Trials) != 1 || result.EfSearch != 5 || result.Reached != (result.Recall == 1) {
+		t.Errorf("Expected a single trial at ef 5, got %+v", result)
+	}
+	if _, err := db.Tune(queries, &cvector.TuneOptions{TargetRecall: 2}); !errors.Is(err, cvector.ErrInvalidArgs) {
+		t.Errorf("Expected a target recall above 1 to be rejected, got %v", err)
+	}
+
+	// The saved setting outlives the handle unless an open overrides it
+	if err := db.SaveEfSearch(48); err != nil {
+		t.Fatalf("SaveEfSearch failed: %v", err)
+	}
+	db.Close()
+	db, err = cvector.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	if stats, _ := db.Stats(); stats.EfSearch != 48 {
+		t.Errorf("Expected the saved EfSearch of 48 after reopening, got %d", stats.EfSearch)
+	}
+	db.Close()
+	db, err = cvector.Open(path, cvector.WithEfSearch(20))
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	if stats, _ := db.Stats(); stats.EfSearch != 20 {
+		t.Errorf("Expected WithEfSearch to override the saved value, got %d", stats.EfSearch)
+	}
+}
+
 func BenchmarkVectorInsert(b *testing.B) {
 	cleanupTestDB(nil)
 	defer cleanupTestDB(nil)